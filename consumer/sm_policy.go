@@ -54,6 +54,15 @@ func SendSMPolicyAssociationCreate(smContext *smf_context.SMContext) (*models.Sm
 		ServingNetwork: models.NewPlmnIdNid(smContext.ServingNetwork.Mcc, smContext.ServingNetwork.Mnc),
 		SuppFeat:       openapi.PtrString("F"),
 	}
+	if smContext.MaPdu != nil {
+		smPolicyData.MaPduInd = models.MAPDUINDICATION_MA_PDU_REQUEST.Ptr()
+		if atsssCapability := smContext.MaPdu.AtsssCapability; atsssCapability != "" {
+			smPolicyData.AtsssCapab = atsssCapability.Ptr()
+		}
+	}
+	if smContext.RedundantPduSession != nil {
+		smPolicyData.RedundantPduSessionInfo = smContext.RedundantPduSession
+	}
 
 	var smPolicyDecision *models.SmPolicyDecision
 	apiCreateSMPolicyRequest := smContext.SMPolicyClient.SMPoliciesCollectionAPI.CreateSMPolicy(context.Background())
@@ -116,6 +125,108 @@ func SendSMPolicyAssociationDelete(smContext *smf_context.SMContext, smDelReq *m
 	}
 }
 
+// SendSMPolicyAssociationUpdateByUsageReport reports to the PCF the accumulated
+// usage of the usage monitoring data whose threshold was reached (US_RE trigger)
+func SendSMPolicyAssociationUpdateByUsageReport(smContext *smf_context.SMContext, accuUsageReports []models.AccuUsageReport) (*models.SmPolicyDecision, int, error) {
+	httpRspStatusCode := http.StatusInternalServerError
+	if smContext.SMPolicyClient == nil {
+		return nil, httpRspStatusCode, fmt.Errorf("smContext not selected PCF")
+	}
+
+	smPolicyUpdateData := models.SmPolicyUpdateContextData{
+		RepPolicyCtrlReqTriggers: []models.PolicyControlRequestTrigger{models.POLICYCONTROLREQUESTTRIGGER_US_RE},
+		AccuUsageReports:         accuUsageReports,
+	}
+
+	// Policy Id (supi-pduSessId)
+	smPolicyID := fmt.Sprintf("%s-%d", smContext.Supi, smContext.PDUSessionID)
+
+	apiUpdateSMPolicyRequest := smContext.SMPolicyClient.IndividualSMPolicyDocumentAPI.UpdateSMPolicy(context.Background(), smPolicyID)
+	apiUpdateSMPolicyRequest = apiUpdateSMPolicyRequest.SmPolicyUpdateContextData(smPolicyUpdateData)
+	smPolicyDecision, httpRsp, err := smContext.SMPolicyClient.IndividualSMPolicyDocumentAPI.UpdateSMPolicyExecute(apiUpdateSMPolicyRequest)
+	if httpRsp != nil {
+		httpRspStatusCode = httpRsp.StatusCode
+	}
+	if err != nil {
+		return nil, httpRspStatusCode, fmt.Errorf("update sm policy association failed: %s", err.Error())
+	}
+
+	return smPolicyDecision, httpRspStatusCode, nil
+}
+
+// SendSMPolicyAssociationUpdateByAccessTypeChange reports to the PCF the new
+// access type of the PDU session (AC_TY_CH trigger)
+func SendSMPolicyAssociationUpdateByAccessTypeChange(smContext *smf_context.SMContext, anType models.AccessType,
+	ratType models.RatType,
+) (*models.SmPolicyDecision, int, error) {
+	httpRspStatusCode := http.StatusInternalServerError
+	if smContext.SMPolicyClient == nil {
+		return nil, httpRspStatusCode, fmt.Errorf("smContext not selected PCF")
+	}
+
+	smPolicyUpdateData := models.SmPolicyUpdateContextData{
+		RepPolicyCtrlReqTriggers: []models.PolicyControlRequestTrigger{models.POLICYCONTROLREQUESTTRIGGER_AC_TY_CH},
+		AccessType:               anType.Ptr(),
+	}
+	if ratType != "" {
+		smPolicyUpdateData.RatType = ratType.Ptr()
+	}
+
+	// Policy Id (supi-pduSessId)
+	smPolicyID := fmt.Sprintf("%s-%d", smContext.Supi, smContext.PDUSessionID)
+
+	apiUpdateSMPolicyRequest := smContext.SMPolicyClient.IndividualSMPolicyDocumentAPI.UpdateSMPolicy(context.Background(), smPolicyID)
+	apiUpdateSMPolicyRequest = apiUpdateSMPolicyRequest.SmPolicyUpdateContextData(smPolicyUpdateData)
+	smPolicyDecision, httpRsp, err := smContext.SMPolicyClient.IndividualSMPolicyDocumentAPI.UpdateSMPolicyExecute(apiUpdateSMPolicyRequest)
+	if httpRsp != nil {
+		httpRspStatusCode = httpRsp.StatusCode
+	}
+	if err != nil {
+		return nil, httpRspStatusCode, fmt.Errorf("update sm policy association failed: %s", err.Error())
+	}
+
+	return smPolicyDecision, httpRspStatusCode, nil
+}
+
+// SendSMPolicyAssociationUpdateByMaPduAccess reports the access added to or
+// released from an MA PDU session
+func SendSMPolicyAssociationUpdateByMaPduAccess(smContext *smf_context.SMContext, anType models.AccessType,
+	ratType models.RatType, release bool,
+) (*models.SmPolicyDecision, int, error) {
+	httpRspStatusCode := http.StatusInternalServerError
+	if smContext.SMPolicyClient == nil {
+		return nil, httpRspStatusCode, fmt.Errorf("smContext not selected PCF")
+	}
+
+	accessInfo := &models.AdditionalAccessInfo{AccessType: anType}
+	if ratType != "" {
+		accessInfo.RatType = ratType.Ptr()
+	}
+	smPolicyUpdateData := models.SmPolicyUpdateContextData{
+		RepPolicyCtrlReqTriggers: []models.PolicyControlRequestTrigger{models.POLICYCONTROLREQUESTTRIGGER_MA_PDU},
+	}
+	if release {
+		smPolicyUpdateData.RelAccessInfo = accessInfo
+	} else {
+		smPolicyUpdateData.AddAccessInfo = accessInfo
+	}
+
+	// Policy Id (supi-pduSessId)
+	smPolicyID := fmt.Sprintf("%s-%d", smContext.Supi, smContext.PDUSessionID)
+
+	apiUpdateSMPolicyRequest := smContext.SMPolicyClient.IndividualSMPolicyDocumentAPI.UpdateSMPolicy(context.Background(), smPolicyID)
+	apiUpdateSMPolicyRequest = apiUpdateSMPolicyRequest.SmPolicyUpdateContextData(smPolicyUpdateData)
+	smPolicyDecision, httpRsp, err := smContext.SMPolicyClient.IndividualSMPolicyDocumentAPI.UpdateSMPolicyExecute(apiUpdateSMPolicyRequest)
+	if httpRsp != nil {
+		httpRspStatusCode = httpRsp.StatusCode
+	}
+	if err != nil {
+		return nil, httpRspStatusCode, fmt.Errorf("update sm policy association failed: %s", err.Error())
+	}
+
+	return smPolicyDecision, httpRspStatusCode, nil
+}
+
 func validateSmPolicyDecision(smPolicy *models.SmPolicyDecision) error {
 	// Validate just presence of important IEs as of now
 	// Sess Rules
@@ -0,0 +1,237 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/factory"
+	"github.com/omec-project/smf/logger"
+	"github.com/omec-project/smf/qos"
+	"github.com/omec-project/util/mongoapi"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const ConditionScheduleCol = "smf.data.conditionSchedule"
+
+// ConditionSchedule is a pending activation or deactivation of the PCC rules
+// of a session which refer to a condition data.
+type ConditionSchedule struct {
+	Time     time.Time `json:"time" yaml:"time" bson:"time"`
+	Ref      string    `json:"ref" yaml:"ref" bson:"ref"`
+	CondId   string    `json:"condId" yaml:"condId" bson:"condId"`
+	Activate bool      `json:"activate" yaml:"activate" bson:"activate"`
+}
+
+func (cs ConditionSchedule) key() string {
+	return fmt.Sprintf("%s/%s/%v", cs.Ref, cs.CondId, cs.Activate)
+}
+
+// ConditionEventHandler installs (activate) or removes the PCC rules of the
+// session referring to the condition data.
+type ConditionEventHandler func(smContext *SMContext, condId string, activate bool)
+
+type conditionScheduler struct {
+	timers  map[string]*time.Timer
+	handler ConditionEventHandler
+	mu      sync.Mutex
+}
+
+var condScheduler = conditionScheduler{
+	timers: make(map[string]*time.Timer),
+}
+
+func SetConditionEventHandler(handler ConditionEventHandler) {
+	condScheduler.mu.Lock()
+	defer condScheduler.mu.Unlock()
+	condScheduler.handler = handler
+}
+
+// PccRuleCondData returns the condition data referred by the PCC rule, if any.
+// The latest policy decision takes precedence over the SM context.
+func (smContext *SMContext) PccRuleCondData(ruleId string) *models.ConditionData {
+	var smPolicyDec *models.SmPolicyDecision
+	if len(smContext.SmPolicyUpdates) > 0 {
+		smPolicyDec = smContext.SmPolicyUpdates[0].SmPolicyDecision
+	}
+
+	refCondData := ""
+	if rule, ok := smPolicyDec.GetPccRules()[ruleId]; ok {
+		refCondData = rule.GetRefCondData()
+	} else if rule := smContext.SmPolicyData.SmCtxtPccRules.PccRules[ruleId]; rule != nil {
+		refCondData = rule.GetRefCondData()
+	}
+	if refCondData == "" {
+		return nil
+	}
+
+	if cond, ok := smPolicyDec.GetConds()[refCondData]; ok && cond.GetCondId() != "" {
+		return &cond
+	}
+	return smContext.SmPolicyData.SmCtxtCondData.CondData[refCondData]
+}
+
+// IsPccRuleActive reports whether the PCC rule is to be installed on the UPF
+// now, as per the time window of its condition data.
+func (smContext *SMContext) IsPccRuleActive(ruleId string) bool {
+	return qos.IsConditionActive(smContext.PccRuleCondData(ruleId), time.Now())
+}
+
+// PccRulesWithCondData returns the names of the PCC rules referring to the condition data.
+func (smContext *SMContext) PccRulesWithCondData(condId string) []string {
+	names := make([]string, 0)
+	for name, rule := range smContext.SmPolicyData.SmCtxtPccRules.PccRules {
+		if rule != nil && rule.GetRefCondData() == condId {
+			names = append(names, name)
+		}
+	}
+	if len(smContext.SmPolicyUpdates) > 0 {
+		for name, rule := range smContext.SmPolicyUpdates[0].SmPolicyDecision.GetPccRules() {
+			if _, exists := smContext.SmPolicyData.SmCtxtPccRules.PccRules[name]; !exists && rule.GetRefCondData() == condId {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// ScheduleConditionData arms a timer for every future activation and
+// deactivation time of the session condition data, replacing the timers armed
+// before. Schedules are kept in the DB when the DB store is enabled.
+func (smContext *SMContext) ScheduleConditionData() {
+	condData := make(map[string]*models.ConditionData)
+	for name, cond := range smContext.SmPolicyData.SmCtxtCondData.CondData {
+		condData[name] = cond
+	}
+	if len(smContext.SmPolicyUpdates) > 0 {
+		for name, pcfCond := range smContext.SmPolicyUpdates[0].SmPolicyDecision.GetConds() {
+			cond := pcfCond
+			if cond.GetCondId() == "" {
+				delete(condData, name)
+				continue
+			}
+			condData[name] = &cond
+		}
+	}
+
+	now := time.Now()
+	schedules := make([]ConditionSchedule, 0)
+	for name, cond := range condData {
+		if activation := cond.GetActivationTime(); activation.After(now) {
+			schedules = append(schedules, ConditionSchedule{Ref: smContext.Ref, CondId: name, Activate: true, Time: activation})
+		}
+		if deactivation := cond.GetDeactivationTime(); deactivation.After(now) {
+			schedules = append(schedules, ConditionSchedule{Ref: smContext.Ref, CondId: name, Activate: false, Time: deactivation})
+		}
+	}
+
+	smContext.CancelConditionSchedules()
+	for _, schedule := range schedules {
+		smContext.SubQosLog.Infof("condition data [%s] activate [%v] scheduled at %v",
+			schedule.CondId, schedule.Activate, schedule.Time)
+		armConditionSchedule(schedule)
+		if factory.SmfConfig.Configuration.EnableDbStore {
+			storeConditionScheduleInDB(schedule)
+		}
+	}
+}
+
+// CancelConditionSchedules stops the condition data timers of the session.
+func (smContext *SMContext) CancelConditionSchedules() {
+	condScheduler.mu.Lock()
+	found := false
+	for key, timer := range condScheduler.timers {
+		if len(key) > len(smContext.Ref) && key[:len(smContext.Ref)+1] == smContext.Ref+"/" {
+			timer.Stop()
+			delete(condScheduler.timers, key)
+			found = true
+		}
+	}
+	condScheduler.mu.Unlock()
+
+	if found && factory.SmfConfig.Configuration.EnableDbStore {
+		if err := mongoapi.CommonDBClient.RestfulAPIDeleteMany(ConditionScheduleCol, bson.M{"ref": smContext.Ref}); err != nil {
+			logger.DataRepoLog.Warnln(err)
+		}
+	}
+}
+
+// RestoreConditionSchedules re-arms the condition data timers kept in the DB,
+// e.g. after a restart. Schedules which expired meanwhile fire at once.
+func RestoreConditionSchedules() {
+	results, err := mongoapi.CommonDBClient.RestfulAPIGetMany(ConditionScheduleCol, bson.M{})
+	if err != nil {
+		logger.DataRepoLog.Warnln(err)
+		return
+	}
+
+	for _, result := range results {
+		var schedule ConditionSchedule
+		if err := json.Unmarshal(mapToByte(result), &schedule); err != nil {
+			logger.DataRepoLog.Errorf("condition schedule unmarshall error: %v", err)
+			continue
+		}
+		logger.DataRepoLog.Infof("restore condition data [%s] schedule of SM context [%s]", schedule.CondId, schedule.Ref)
+		armConditionSchedule(schedule)
+	}
+}
+
+func armConditionSchedule(schedule ConditionSchedule) {
+	condScheduler.mu.Lock()
+	defer condScheduler.mu.Unlock()
+
+	if timer, ok := condScheduler.timers[schedule.key()]; ok {
+		timer.Stop()
+	}
+	condScheduler.timers[schedule.key()] = time.AfterFunc(time.Until(schedule.Time), func() {
+		fireConditionSchedule(schedule)
+	})
+}
+
+func fireConditionSchedule(schedule ConditionSchedule) {
+	condScheduler.mu.Lock()
+	delete(condScheduler.timers, schedule.key())
+	handler := condScheduler.handler
+	condScheduler.mu.Unlock()
+
+	if factory.SmfConfig.Configuration.EnableDbStore {
+		filter := bson.M{"ref": schedule.Ref, "condId": schedule.CondId, "activate": schedule.Activate}
+		if err := mongoapi.CommonDBClient.RestfulAPIDeleteOne(ConditionScheduleCol, filter); err != nil {
+			logger.DataRepoLog.Warnln(err)
+		}
+	}
+
+	smContext := GetSMContext(schedule.Ref)
+	if smContext == nil {
+		logger.CtxLog.Warnf("SM context [%s] of condition data [%s] not found", schedule.Ref, schedule.CondId)
+		return
+	}
+	if handler == nil {
+		smContext.SubQosLog.Warnf("no handler for condition data [%s]", schedule.CondId)
+		return
+	}
+	handler(smContext, schedule.CondId, schedule.Activate)
+}
+
+func storeConditionScheduleInDB(schedule ConditionSchedule) {
+	tmp, err := json.Marshal(schedule)
+	if err != nil {
+		logger.DataRepoLog.Errorf("condition schedule marshall error: %v", err)
+		return
+	}
+	var data bson.M
+	if err = json.Unmarshal(tmp, &data); err != nil {
+		logger.DataRepoLog.Errorf("condition schedule unmarshall error: %v", err)
+		return
+	}
+
+	filter := bson.M{"ref": schedule.Ref, "condId": schedule.CondId, "activate": schedule.Activate}
+	if _, err = mongoapi.CommonDBClient.RestfulAPIPost(ConditionScheduleCol, filter, data); err != nil {
+		logger.DataRepoLog.Warnln(err)
+	}
+}
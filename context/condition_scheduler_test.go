@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/context"
+)
+
+func TestIsPccRuleActive(t *testing.T) {
+	smContext := context.NewSMContext("imsi-208930000000001", 1)
+
+	future := models.NewConditionData("cond-future")
+	future.SetActivationTime(time.Now().Add(time.Hour))
+	past := models.NewConditionData("cond-past")
+	past.SetDeactivationTime(time.Now().Add(-time.Hour))
+	smContext.SmPolicyData.SmCtxtCondData.CondData["cond-future"] = future
+	smContext.SmPolicyData.SmCtxtCondData.CondData["cond-past"] = past
+
+	rules := smContext.SmPolicyData.SmCtxtPccRules.PccRules
+	rules["rule-always"] = &models.PccRule{PccRuleId: "rule-always"}
+	rules["rule-future"] = &models.PccRule{PccRuleId: "rule-future"}
+	rules["rule-future"].SetRefCondData("cond-future")
+	rules["rule-past"] = &models.PccRule{PccRuleId: "rule-past"}
+	rules["rule-past"].SetRefCondData("cond-past")
+
+	testCases := map[string]bool{
+		"rule-always":  true,
+		"rule-future":  false,
+		"rule-past":    false,
+		"rule-unknown": true,
+	}
+	for rule, expected := range testCases {
+		if got := smContext.IsPccRuleActive(rule); got != expected {
+			t.Errorf("%s: expected active %v, got %v", rule, expected, got)
+		}
+	}
+
+	if names := smContext.PccRulesWithCondData("cond-future"); len(names) != 1 || names[0] != "rule-future" {
+		t.Errorf("expected rule-future to refer to cond-future, got %v", names)
+	}
+}
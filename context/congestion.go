@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/nas/v2/nasType"
+)
+
+// Congestion is a congested DNN, S-NSSAI or DNN of an S-NSSAI, TS 23.501 5.19.7
+type Congestion struct {
+	Snssai *SNssai `json:"snssai,omitempty"`
+	Dnn    string  `json:"dnn,omitempty"`
+}
+
+func (c Congestion) key() string {
+	if c.Snssai == nil {
+		return fmt.Sprintf("/%s", c.Dnn)
+	}
+	return fmt.Sprintf("%d-%s/%s", c.Snssai.Sst, c.Snssai.Sd, c.Dnn)
+}
+
+func (c Congestion) String() string {
+	if c.Snssai == nil {
+		return fmt.Sprintf("Congestion: [Dnn:[%v]]", c.Dnn)
+	}
+	return fmt.Sprintf("Congestion: [Snssai:[%v], Dnn:[%v]]", *c.Snssai, c.Dnn)
+}
+
+var congestions = struct {
+	items map[string]Congestion
+	sync.RWMutex
+}{items: make(map[string]Congestion)}
+
+// SetCongestion marks the DNN, the S-NSSAI or the DNN of the S-NSSAI as congested
+func SetCongestion(c Congestion) error {
+	if c.Snssai == nil && c.Dnn == "" {
+		return fmt.Errorf("congestion requires a DNN or an S-NSSAI")
+	}
+	congestions.Lock()
+	defer congestions.Unlock()
+	congestions.items[c.key()] = c
+	return nil
+}
+
+// ClearCongestion clears the congestion state, it returns false if it was not set
+func ClearCongestion(c Congestion) bool {
+	congestions.Lock()
+	defer congestions.Unlock()
+	if _, ok := congestions.items[c.key()]; !ok {
+		return false
+	}
+	delete(congestions.items, c.key())
+	return true
+}
+
+// GetCongestions returns the congestion states set
+func GetCongestions() []Congestion {
+	congestions.RLock()
+	defer congestions.RUnlock()
+	list := make([]Congestion, 0, len(congestions.items))
+	for _, c := range congestions.items {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].key() < list[j].key() })
+	return list
+}
+
+// CheckCongestion returns the cause of the error for a PDU session of the DNN and S-NSSAI
+// under congestion control: "SliceDnnCongestion" (#67), "SliceCongestion" (#69) or
+// "DnnCongestion" (#26), TS 24.501 6.4.1.4.2. It returns "" if neither is congested.
+func CheckCongestion(snssai *SNssai, dnn string) string {
+	congestions.RLock()
+	defer congestions.RUnlock()
+	if snssai != nil {
+		if _, ok := congestions.items[Congestion{Snssai: snssai, Dnn: dnn}.key()]; ok {
+			return "SliceDnnCongestion"
+		}
+		if _, ok := congestions.items[Congestion{Snssai: snssai}.key()]; ok {
+			return "SliceCongestion"
+		}
+	}
+	if _, ok := congestions.items[Congestion{Dnn: dnn}.key()]; ok {
+		return "DnnCongestion"
+	}
+	return ""
+}
+
+// isCongested reports whether the congestion state is set
+func isCongested(c Congestion) bool {
+	congestions.RLock()
+	defer congestions.RUnlock()
+	_, ok := congestions.items[c.key()]
+	return ok
+}
+
+// buildBackoffTimerValue returns the back-off timer sent with the 5GSM cause: T3396 for
+// #26 and T3584/T3585 for #67/#69, TS 24.501 6.2.7. It returns nil for other causes,
+// when congestion control is not active for the DNN or S-NSSAI of the PDU session,
+// see BuildGSMPDUSessionEstablishmentRejectDnnUnavailable for #26 on a DNN unable to
+// serve the PDU session, or when the back-off timer is not configured.
+func buildBackoffTimerValue(smContext *SMContext, iei uint8, cause uint8) *nasType.BackoffTimerValue {
+	var snssai *SNssai
+	if smContext.Snssai != nil {
+		snssai = &SNssai{Sst: smContext.Snssai.GetSst(), Sd: smContext.Snssai.GetSd()}
+	}
+
+	var timer int
+	switch cause {
+	case nasMessage.Cause5GSMInsufficientResources:
+		if isCongested(Congestion{Dnn: smContext.Dnn}) {
+			timer = SMF_Self().DnnBackoffTimer
+		}
+	case nasMessage.Cause5GSMInsufficientResourcesForSpecificSliceAndDNN:
+		if snssai != nil && isCongested(Congestion{Snssai: snssai, Dnn: smContext.Dnn}) {
+			timer = SMF_Self().SnssaiBackoffTimer
+		}
+	case nasMessage.Cause5GSMInsufficientResourcesForSpecificSlice:
+		if snssai != nil && isCongested(Congestion{Snssai: snssai}) {
+			timer = SMF_Self().SnssaiBackoffTimer
+		}
+	}
+	return backoffTimerValue(iei, timer)
+}
+
+// buildDnnBackoffTimerValue returns the T3396 back-off timer of the DNN, nil when
+// the back-off timer is not configured
+func buildDnnBackoffTimerValue(iei uint8) *nasType.BackoffTimerValue {
+	return backoffTimerValue(iei, SMF_Self().DnnBackoffTimer)
+}
+
+func backoffTimerValue(iei uint8, timer int) *nasType.BackoffTimerValue {
+	if timer <= 0 {
+		return nil
+	}
+	backoffTimer := nasType.NewBackoffTimerValue(iei)
+	backoffTimer.SetLen(1)
+	backoffTimer.Octet = gprsTimer3ToNas(timer)
+	return backoffTimer
+}
+
+// gprsTimer3Units are the GPRS timer 3 units from the smallest, TS 24.008 10.5.7.4a
+var gprsTimer3Units = []struct {
+	unit    uint8
+	seconds int
+}{
+	{0x3, 2},
+	{0x4, 30},
+	{0x5, 60},
+	{0x0, 600},
+	{0x1, 3600},
+	{0x2, 36000},
+	{0x6, 1152000},
+}
+
+// gprsTimer3ToNas encodes the timer in seconds with the smallest unit it fits in, rounding up
+func gprsTimer3ToNas(seconds int) uint8 {
+	for _, u := range gprsTimer3Units {
+		if value := (seconds + u.seconds - 1) / u.seconds; value <= 31 {
+			return u.unit<<5 | uint8(value)
+		}
+	}
+	return 0x6<<5 | 31
+}
@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"testing"
+
+	"github.com/omec-project/nas/v2"
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/openapi/v2"
+	"github.com/omec-project/openapi/v2/models"
+)
+
+func TestCheckCongestion(t *testing.T) {
+	snssai := &SNssai{Sst: 1, Sd: "010203"}
+	otherSnssai := &SNssai{Sst: 2, Sd: "010203"}
+
+	if err := SetCongestion(Congestion{}); err == nil {
+		t.Errorf("expected error for congestion without DNN and S-NSSAI")
+	}
+	if cause := CheckCongestion(snssai, "internet"); cause != "" {
+		t.Errorf("expected no congestion, got %s", cause)
+	}
+
+	congestions := []Congestion{
+		{Dnn: "internet"},
+		{Snssai: snssai},
+		{Snssai: snssai, Dnn: "internet"},
+	}
+	for _, c := range congestions {
+		if err := SetCongestion(c); err != nil {
+			t.Fatalf("set congestion %v: %v", c, err)
+		}
+	}
+	defer func() {
+		for _, c := range congestions {
+			ClearCongestion(c)
+		}
+	}()
+	if n := len(GetCongestions()); n != 3 {
+		t.Errorf("expected 3 congestions, got %d", n)
+	}
+
+	if cause := CheckCongestion(snssai, "internet"); cause != "SliceDnnCongestion" {
+		t.Errorf("expected SliceDnnCongestion, got %s", cause)
+	}
+	if cause := CheckCongestion(snssai, "ims"); cause != "SliceCongestion" {
+		t.Errorf("expected SliceCongestion, got %s", cause)
+	}
+	if cause := CheckCongestion(otherSnssai, "internet"); cause != "DnnCongestion" {
+		t.Errorf("expected DnnCongestion, got %s", cause)
+	}
+
+	if !ClearCongestion(Congestion{Snssai: snssai}) {
+		t.Errorf("expected S-NSSAI congestion to be cleared")
+	}
+	if ClearCongestion(Congestion{Snssai: snssai}) {
+		t.Errorf("expected S-NSSAI congestion to be already cleared")
+	}
+	if cause := CheckCongestion(snssai, "ims"); cause != "" {
+		t.Errorf("expected no congestion, got %s", cause)
+	}
+}
+
+func TestGprsTimer3ToNas(t *testing.T) {
+	testCases := []struct {
+		seconds  int
+		expected uint8
+	}{
+		{seconds: 2, expected: 0x3<<5 | 1},
+		{seconds: 60, expected: 0x3<<5 | 30},
+		{seconds: 61, expected: 0x3<<5 | 31},
+		{seconds: 63, expected: 0x4<<5 | 3},
+		{seconds: 720, expected: 0x4<<5 | 24},
+		{seconds: 3600, expected: 0x0<<5 | 6},
+		{seconds: 7200, expected: 0x0<<5 | 12},
+		{seconds: 86400, expected: 0x1<<5 | 24},
+	}
+	for _, tc := range testCases {
+		if value := gprsTimer3ToNas(tc.seconds); value != tc.expected {
+			t.Errorf("%d seconds: expected %#x, got %#x", tc.seconds, tc.expected, value)
+		}
+	}
+}
+
+func TestBuildGSMPDUSessionEstablishmentRejectBackoffTimer(t *testing.T) {
+	smfSelf := SMF_Self()
+	smfSelf.DnnBackoffTimer = 720
+	smfSelf.SnssaiBackoffTimer = 0
+	defer func() { smfSelf.DnnBackoffTimer = 0 }()
+	if err := SetCongestion(Congestion{Dnn: "internet"}); err != nil {
+		t.Fatalf("set congestion: %v", err)
+	}
+	defer ClearCongestion(Congestion{Dnn: "internet"})
+
+	testCases := []struct {
+		dnn         string
+		cause       uint8
+		withBackoff bool
+	}{
+		{dnn: "internet", cause: nasMessage.Cause5GSMInsufficientResources, withBackoff: true},
+		// #26 of a DNN not congested
+		{dnn: "enterprise", cause: nasMessage.Cause5GSMInsufficientResources, withBackoff: false},
+		{dnn: "internet", cause: nasMessage.Cause5GSMInsufficientResourcesForSpecificSliceAndDNN, withBackoff: false},
+		{dnn: "internet", cause: nasMessage.Cause5GSMRequestRejectedUnspecified, withBackoff: false},
+	}
+	for _, tc := range testCases {
+		smContext := &SMContext{PDUSessionID: 10, Dnn: tc.dnn}
+		buf, err := BuildGSMPDUSessionEstablishmentReject(smContext, tc.cause)
+		if err != nil {
+			t.Fatalf("build reject: %v", err)
+		}
+		m := nas.NewMessage()
+		if err := m.GsmMessageDecode(&buf); err != nil {
+			t.Fatalf("decode reject: %v", err)
+		}
+		reject := m.PDUSessionEstablishmentReject
+		if reject.GetCauseValue() != tc.cause {
+			t.Errorf("expected cause %d, got %d", tc.cause, reject.GetCauseValue())
+		}
+		if !tc.withBackoff {
+			if reject.BackoffTimerValue != nil {
+				t.Errorf("cause %d: unexpected back-off timer", tc.cause)
+			}
+			continue
+		}
+		if reject.BackoffTimerValue == nil {
+			t.Fatalf("cause %d: expected back-off timer", tc.cause)
+		}
+		// 720 seconds in units of 30 seconds
+		if unit, value := reject.GetUnitTimerValue(), reject.BackoffTimerValue.GetTimerValue(); unit != 0x4 || value != 24 {
+			t.Errorf("expected back-off timer of 24 x 30 seconds, got unit %d value %d", unit, value)
+		}
+	}
+}
+
+func TestBuildGSMPDUSessionEstablishmentRejectDnnUnavailable(t *testing.T) {
+	smfSelf := SMF_Self()
+	smfSelf.DnnBackoffTimer = 60
+	defer func() { smfSelf.DnnBackoffTimer = 0 }()
+
+	// no UE address left or no UPF available, with the DNN not congested
+	buf, err := BuildGSMPDUSessionEstablishmentRejectDnnUnavailable(&SMContext{PDUSessionID: 10, Dnn: "enterprise"})
+	if err != nil {
+		t.Fatalf("build reject: %v", err)
+	}
+	m := nas.NewMessage()
+	if err := m.GsmMessageDecode(&buf); err != nil {
+		t.Fatalf("decode reject: %v", err)
+	}
+	reject := m.PDUSessionEstablishmentReject
+	if reject.GetCauseValue() != nasMessage.Cause5GSMInsufficientResources {
+		t.Errorf("expected cause #26, got %d", reject.GetCauseValue())
+	}
+	if reject.BackoffTimerValue == nil || reject.BackoffTimerValue.Octet != 0x3<<5|30 {
+		t.Errorf("expected back-off timer of 30 x 2 seconds, got %v", reject.BackoffTimerValue)
+	}
+}
+
+func TestBuildGSMPDUSessionReleaseCommandBackoffTimer(t *testing.T) {
+	smfSelf := SMF_Self()
+	smfSelf.SnssaiBackoffTimer = 60
+	defer func() { smfSelf.SnssaiBackoffTimer = 0 }()
+	congestion := Congestion{Snssai: &SNssai{Sst: 1, Sd: "010203"}}
+	if err := SetCongestion(congestion); err != nil {
+		t.Fatalf("set congestion: %v", err)
+	}
+	defer ClearCongestion(congestion)
+
+	smContext := &SMContext{PDUSessionID: 10, Snssai: &models.Snssai{Sst: 1, Sd: openapi.PtrString("010203")}}
+	buf, err := BuildGSMPDUSessionReleaseCommand(smContext, nasMessage.Cause5GSMInsufficientResourcesForSpecificSlice)
+	if err != nil {
+		t.Fatalf("build release command: %v", err)
+	}
+	m := nas.NewMessage()
+	if err := m.GsmMessageDecode(&buf); err != nil {
+		t.Fatalf("decode release command: %v", err)
+	}
+	release := m.PDUSessionReleaseCommand
+	if release.GetCauseValue() != nasMessage.Cause5GSMInsufficientResourcesForSpecificSlice {
+		t.Errorf("unexpected cause %d", release.GetCauseValue())
+	}
+	if release.BackoffTimerValue == nil || release.BackoffTimerValue.Octet != 0x3<<5|30 {
+		t.Errorf("expected back-off timer of 30 x 2 seconds, got %v", release.BackoffTimerValue)
+	}
+}
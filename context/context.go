@@ -91,6 +91,50 @@ type SMFContext struct {
 
 	// PCSCF Info
 	PCSCFInfo PCSCFInfo
+
+	// Reflective QoS timer in seconds
+	RQTimer int
+
+	// 5GSM congestion control back-off timers in seconds
+	DnnBackoffTimer    int
+	SnssaiBackoffTimer int
+
+	// DN-AAA servers for secondary authentication per DNN
+	DnAaaInfo []factory.DnAaaInfo
+
+	// External DHCP servers of the UE addresses per DNN
+	DhcpInfo []factory.DhcpInfo
+
+	// UE address pools per DNN
+	UeIpPoolInfo []factory.UeIpPoolInfo
+
+	// Allocation strategy and excluded ranges of the UE address pools
+	UeIpAllocation *factory.UeIpAllocation
+
+	// Hold time of the UE addresses per DNN in sticky mode
+	StickyIpInfo []factory.StickyIpInfo
+
+	// Service area of the LADN DNNs
+	LadnInfo []factory.LadnInfo
+
+	// DNAIs of the UE locations for the UPF selection
+	DnaiInfo []factory.DnaiInfo
+
+	// Selection among the UPFs matching a PDU session
+	UpfSelection *factory.UpfSelection
+	UPFSelector  UPFSelector
+
+	// Handling of the PDU sessions per DNN when their UPF fails
+	UpfFailureInfo []factory.UpfFailureInfo
+
+	// Address lifetime per DNN of the PDU sessions relocated in SSC mode 3
+	SscModeInfo []factory.SscModeInfo
+
+	// N3IWFs and TNGFs among the ANs
+	NonThreeGppAnInfo []factory.NonThreeGppAnInfo
+
+	// QoS flows per DNN with redundant N3 transmission
+	RedundantTransmissionInfo []factory.RedundantTransmissionInfo
 }
 
 func (s *SMFContext) Lock()    { s.mu.Lock() }
@@ -292,6 +336,30 @@ func InitSmfContext(config *factory.Config) *SMFContext {
 
 	logger.CtxLog.Infof("SMF Context PCSCF Info: %v", smfContext.PCSCFInfo)
 
+	if configuration.RQTimer == 0 {
+		smfContext.RQTimer = DefaultRQTimer
+	} else {
+		smfContext.RQTimer = configuration.RQTimer
+	}
+
+	if congestionControl := configuration.CongestionControl; congestionControl != nil {
+		smfContext.DnnBackoffTimer = congestionControl.DnnBackoffTimer
+		smfContext.SnssaiBackoffTimer = congestionControl.SnssaiBackoffTimer
+	}
+
+	smfContext.DnAaaInfo = configuration.DnAaaInfo
+	smfContext.DhcpInfo = configuration.DhcpInfo
+	smfContext.UeIpPoolInfo = configuration.UeIpPoolInfo
+	smfContext.UeIpAllocation = configuration.UeIpAllocation
+	smfContext.StickyIpInfo = configuration.StickyIpInfo
+	smfContext.LadnInfo = configuration.LadnInfo
+	smfContext.DnaiInfo = configuration.DnaiInfo
+	initUPFSelection(configuration.UpfSelection)
+	smfContext.UpfFailureInfo = configuration.UpfFailureInfo
+	smfContext.SscModeInfo = configuration.SscModeInfo
+	smfContext.NonThreeGppAnInfo = configuration.NonThreeGppAnInfo
+	smfContext.RedundantTransmissionInfo = configuration.RedundantTransmissionInfo
+
 	smfContext.PodIp = os.Getenv("POD_IP")
 
 	return &smfContext
@@ -346,7 +414,9 @@ func (smfCtxt *SMFContext) Clear() {
 	smfCtxt.UserPlaneInformation.Reset()
 }
 
-func buildSnssaiSmfInfo(sm *nfConfigApi.SessionManagement, staticIpInfo []factory.StaticIpInfo) SnssaiSmfInfo {
+func buildSnssaiSmfInfo(sm *nfConfigApi.SessionManagement, staticIpInfo []factory.StaticIpInfo,
+	ueIpPoolInfo []factory.UeIpPoolInfo, allocation *factory.UeIpAllocation,
+) SnssaiSmfInfo {
 	apiPlmnId := sm.GetPlmnId()
 	apiSnssai := sm.GetSnssai()
 	info := SnssaiSmfInfo{
@@ -365,7 +435,7 @@ func buildSnssaiSmfInfo(sm *nfConfigApi.SessionManagement, staticIpInfo []factor
 			dnnInfo.DNS.IPv4Addr = ip
 		}
 		if subnet := ipdomain.GetUeSubnet(); subnet != "" {
-			allocator, err := NewIPAllocator(subnet)
+			allocator, err := newConfiguredIPAllocator(subnet, allocation, nil)
 			if err != nil {
 				logger.CtxLog.Warnf("invalid subnet %s for DNN %s: %v", subnet, dnn, err)
 			} else {
@@ -373,6 +443,14 @@ func buildSnssaiSmfInfo(sm *nfConfigApi.SessionManagement, staticIpInfo []factor
 				reserveStaticIpsIfNeeded(allocator, staticIpInfo, dnn)
 			}
 		}
+		if poolInfo := findUeIpPoolInfo(ueIpPoolInfo, dnn, info.Snssai); poolInfo != nil {
+			pools, err := NewUeIPPools(poolInfo, staticIpInfo, allocation)
+			if err != nil {
+				logger.CtxLog.Warnf("invalid UE IP pools for DNN %s: %v", dnn, err)
+			} else {
+				dnnInfo.UeIPPools = pools
+			}
+		}
 		info.DnnInfos[dnn] = dnnInfo
 	}
 	if len(info.DnnInfos) == 0 {
@@ -410,7 +488,7 @@ func UpdateSmfContext(smContext *SMFContext, newConfig []nfConfigApi.SessionMana
 
 	var snssaiInfos []SnssaiSmfInfo
 	for _, sm := range newConfig {
-		snssaiInfo := buildSnssaiSmfInfo(&sm, smContext.StaticIpInfo)
+		snssaiInfo := buildSnssaiSmfInfo(&sm, smContext.StaticIpInfo, smContext.UeIpPoolInfo, smContext.UeIpAllocation)
 		if len(snssaiInfo.DnnInfos) == 0 {
 			logger.CtxLog.Warnf("DnnInfos is empty for SnssaiSmfInfo config: %+v", sm)
 			continue
@@ -418,6 +496,7 @@ func UpdateSmfContext(smContext *SMFContext, newConfig []nfConfigApi.SessionMana
 		snssaiInfos = append(snssaiInfos, snssaiInfo)
 	}
 	smContext.SnssaiInfos = snssaiInfos
+	blockStickyIps(snssaiInfos)
 	logger.CtxLog.Debugf("SMF context updated from dynamic session management config successfully")
 	return nil
 }
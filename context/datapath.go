@@ -8,6 +8,7 @@ package context
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 
 	"github.com/omec-project/nas/v2/nasType"
@@ -245,6 +246,15 @@ func (node *DataPathNode) DeactivateUpLinkTunnel(smContext *SMContext) {
 					}
 				}
 			}
+			for _, urr := range pdr.URR {
+				// URRs being removed were already released
+				if urr.State == RULE_REMOVE {
+					continue
+				}
+				if err = node.UPF.RemoveURR(urr); err != nil {
+					logger.CtxLog.Warnln("deactivated UpLinkTunnel", err)
+				}
+			}
 		}
 	}
 	node.DownLinkTunnel = &GTPTunnel{}
@@ -288,6 +298,15 @@ func (node *DataPathNode) DeactivateDownLinkTunnel(smContext *SMContext) {
 					}
 				}
 			}
+			for _, urr := range pdr.URR {
+				// URRs being removed were already released
+				if urr.State == RULE_REMOVE {
+					continue
+				}
+				if err = node.UPF.RemoveURR(urr); err != nil {
+					logger.CtxLog.Warnln("deactivated DownLinkTunnel", err)
+				}
+			}
 		}
 	}
 	node.DownLinkTunnel = &GTPTunnel{}
@@ -339,6 +358,28 @@ func (dataPathPool DataPathPool) GetDefaultPath() (dataPath *DataPath) {
 	return
 }
 
+// TunnelOfPDR returns the node of the UPF and its tunnel holding the PDR,
+// nil if the data path has none
+func (dataPath *DataPath) TunnelOfPDR(nodeID NodeID, pdrID uint16) (*DataPathNode, *GTPTunnel) {
+	nodeIP := nodeID.ResolveNodeIdToIp()
+	for node := dataPath.FirstDPNode; node != nil; node = node.Next() {
+		if node.UPF == nil || !node.UPF.NodeID.ResolveNodeIdToIp().Equal(nodeIP) {
+			continue
+		}
+		for _, tunnel := range []*GTPTunnel{node.UpLinkTunnel, node.DownLinkTunnel} {
+			if tunnel == nil {
+				continue
+			}
+			for _, pdr := range tunnel.PDR {
+				if pdr.PDRID == pdrID {
+					return node, tunnel
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
 func (dataPath *DataPath) String() string {
 	firstDPNode := dataPath.FirstDPNode
 
@@ -416,10 +457,7 @@ func (dpNode *DataPathNode) CreatePccRuleQer(smContext *SMContext, qosData strin
 	}
 
 	// Get Flow Status
-	gateStatus := GateOpen
-	if tc != nil && tc.GetFlowStatus() == models.FLOWSTATUS_DISABLED {
-		gateStatus = GateClose
-	}
+	gateStatus := NewGateStatus(tc.GetFlowStatus())
 
 	var flowQER *QER
 
@@ -430,10 +468,10 @@ func (dpNode *DataPathNode) CreatePccRuleQer(smContext *SMContext, qosData strin
 		newQER.QFI.QFI = qos.GetQosFlowIdFromQosId(refQos.QosId)
 
 		// Flow Status
-		newQER.GateStatus = &GateStatus{
-			ULGate: gateStatus,
-			DLGate: gateStatus,
-		}
+		newQER.GateStatus = gateStatus
+
+		// Reflective QoS
+		newQER.RQI = smContext.IsReflectiveQosFlow(refQos)
 
 		ulMbr := smContext.SelectedSessionRule().AuthSessAmbr.Uplink
 		if maxbrUl, ok := refQos.GetMaxbrUlOk(); ok && maxbrUl != nil && *maxbrUl != "" {
@@ -516,6 +554,7 @@ func (dpNode *DataPathNode) CreateDedicatedQosQer(smContext *SMContext) ([]*QER,
 		} else {
 			// Successfully created QER, set QFI
 			newQER.QFI.QFI = qos.GetQosFlowIdFromQosId(qosData.QosId)
+			newQER.RQI = smContext.IsReflectiveQosFlow(&qosData)
 
 			// Set GateStatus: open UL and DL gates by default
 			newQER.GateStatus = &GateStatus{
@@ -586,15 +625,26 @@ func (dpNode *DataPathNode) CreateDedicatedQosQer(smContext *SMContext) ([]*QER,
 	return createdQERs, nil
 }
 
-// ActivateUpLinkPdr
-func (dpNode *DataPathNode) ActivateUpLinkPdr(smContext *SMContext, defQER *QER, defPrecedence uint32) error {
+// newUEIPAddress returns the UE IP Address IE of the PDRs, IPv6 for an address
+// leased by a DHCPv6 server
+func newUEIPAddress(upf *UPF, ip net.IP) UEIPAddress {
 	ueIpAddr := UEIPAddress{}
-	if dpNode.UPF.IsUpfSupportUeIpAddrAlloc() {
+	switch {
+	case upf.IsUpfSupportUeIpAddrAlloc():
 		ueIpAddr.CHV4 = true
-	} else {
+	case ip != nil && ip.To4() == nil:
+		ueIpAddr.V6 = true
+		ueIpAddr.Ipv6Address = ip
+	default:
 		ueIpAddr.V4 = true
-		ueIpAddr.Ipv4Address = smContext.PDUAddress.Ip.To4()
+		ueIpAddr.Ipv4Address = ip.To4()
 	}
+	return ueIpAddr
+}
+
+// ActivateUpLinkPdr
+func (dpNode *DataPathNode) ActivateUpLinkPdr(smContext *SMContext, defQER *QER, defPrecedence uint32) error {
+	ueIpAddr := newUEIPAddress(dpNode.UPF, smContext.PDUAddress.Ip)
 
 	curULTunnel := dpNode.UpLinkTunnel
 	for name, ULPDR := range curULTunnel.PDR {
@@ -633,6 +683,7 @@ func (dpNode *DataPathNode) ActivateUpLinkPdr(smContext *SMContext, defQER *QER,
 		if dpNode.IsAnchorUPF() {
 			ULFAR.ForwardingParameters.
 				DestinationInterface.InterfaceValue = DestinationInterfaceSgiLanN6Lan
+			ULFAR.UpdateRedirectInformation(smContext.PccRuleRedirectInformation(name))
 		}
 
 		if nextULDest := dpNode.Next(); nextULDest != nil {
@@ -660,13 +711,7 @@ func (dpNode *DataPathNode) ActivateDlLinkPdr(smContext *SMContext, defQER *QER,
 	curDLTunnel := dpNode.DownLinkTunnel
 
 	// UPF provided UE ip-addr
-	ueIpAddr := UEIPAddress{}
-	if dpNode.UPF.IsUpfSupportUeIpAddrAlloc() {
-		ueIpAddr.CHV4 = true
-	} else {
-		ueIpAddr.V4 = true
-		ueIpAddr.Ipv4Address = smContext.PDUAddress.Ip.To4()
-	}
+	ueIpAddr := newUEIPAddress(dpNode.UPF, smContext.PDUAddress.Ip)
 
 	for name, DLPDR := range curDLTunnel.PDR {
 		logger.CtxLog.Infof("activate Downlink PDR[%v]:[%v]", name, DLPDR)
@@ -680,6 +725,10 @@ func (dpNode *DataPathNode) ActivateDlLinkPdr(smContext *SMContext, defQER *QER,
 			DLPDR.OuterHeaderRemoval = &OuterHeaderRemoval{
 				OuterHeaderRemovalDescription: OuterHeaderRemovalGtpUUdpIpv4,
 			}
+			// the N9 tunnel of the next UPF ends here
+			DLPDR.PDI.LocalFTeid = &FTEID{
+				Ch: true,
+			}
 		}
 
 		DLPDR.PDI.SourceInterface = SourceInterface{InterfaceValue: SourceInterfaceCore}
@@ -723,9 +772,6 @@ func (dpNode *DataPathNode) ActivateDlLinkPdr(smContext *SMContext, defQER *QER,
 			}
 		} else {
 			if anIP := smContext.Tunnel.ANInformation.IPAddress; anIP != nil {
-				ANUPF := dataPath.FirstDPNode
-				DefaultDLPDR := ANUPF.DownLinkTunnel.PDR["default"] // TODO: Iterate over all PDRs
-				DLFAR := DefaultDLPDR.FAR
 				DLFAR.ForwardingParameters = new(ForwardingParameters)
 				DLFAR.ForwardingParameters.DestinationInterface.InterfaceValue = DestinationInterfaceAccess
 				DLFAR.ForwardingParameters.NetworkInstance = []byte(smContext.Dnn)
@@ -784,13 +830,7 @@ func (dataPath *DataPath) ActivateTunnelAndPDR(smContext *SMContext, precedence
 			}
 		}
 
-		ueIpAddr := UEIPAddress{}
-		if curDataPathNode.UPF.IsUpfSupportUeIpAddrAlloc() {
-			ueIpAddr.CHV4 = true
-		} else {
-			ueIpAddr.V4 = true
-			ueIpAddr.Ipv4Address = smContext.PDUAddress.Ip.To4()
-		}
+		ueIpAddr := newUEIPAddress(curDataPathNode.UPF, smContext.PDUAddress.Ip)
 
 		if curDataPathNode.DownLinkTunnel != nil {
 			if curDataPathNode.DownLinkTunnel.SrcEndPoint == nil {
@@ -803,6 +843,8 @@ func (dataPath *DataPath) ActivateTunnelAndPDR(smContext *SMContext, precedence
 		}
 	}
 
+	smContext.SetAccessInterfaceType()
+	smContext.SetRedundantTransmission(dataPath)
 	dataPath.Activated = true
 	logger.CtxLog.Debugln("dataPath successfully activated")
 	return nil
@@ -130,16 +130,24 @@ func (smContext *SMContext) MarshalJSON() ([]byte, error) {
 		}
 	}
 
+	// the UPFs of the path by address
+	var upPathVal []string
+	for _, upNode := range smContext.upPath {
+		upPathVal = append(upPathVal, upNode.NodeID.ResolveNodeIdToIp().String())
+	}
+
 	return json.Marshal(&struct {
 		*Alias
 		PFCPContext PFCPContextInDB `json:"pfcpContext"`
 		Tunnel      UPTunnelInDB    `json:"tunnel"`
 		BPManager   json.RawMessage `json:"bpManager,omitempty"`
+		UPPath      []string        `json:"upPath,omitempty"`
 	}{
 		Alias:       (*Alias)(smContext),
 		PFCPContext: PFCPContextVal,
 		Tunnel:      upTunnelVal,
 		BPManager:   bpJSON,
+		UPPath:      upPathVal,
 	})
 }
 
@@ -151,6 +159,7 @@ func (smContext *SMContext) UnmarshalJSON(data []byte) error {
 		*Alias
 		PFCPContextVal PFCPContextInDB `json:"pfcpContext"`
 		Tunnel         UPTunnelInDB    `json:"tunnel"`
+		UPPath         []string        `json:"upPath"`
 	}{
 		Alias: (*Alias)(smContext),
 	}
@@ -206,14 +215,37 @@ func (smContext *SMContext) UnmarshalJSON(data []byte) error {
 			smContext.Tunnel.DataPathPool[key] = newDataPath
 		}
 	}
+	// recover the path to the UPF of the PDU session
+	smContext.upPath = recoverUPPath(aux.UPPath)
 	// recover logs
 	smContext.initLogTags()
+	// recover the access leg of the MA PDU session
+	smContext.recoverAccessLeg()
 	// recover SBIPFCPCommunicationChan
 	smContext.SBIPFCPCommunicationChan = make(chan PFCPSessionResponseStatus, 1)
 
 	return nil
 }
 
+// recoverUPPath returns the path of the UPFs with the addresses, nil if one of
+// them is no longer in the user plane information
+func recoverUPPath(nodeIPs []string) UPPath {
+	upi := GetUserPlaneInformation()
+	if upi == nil || len(nodeIPs) == 0 {
+		return nil
+	}
+	path := make(UPPath, 0, len(nodeIPs))
+	for _, nodeIP := range nodeIPs {
+		upNode := upi.GetUPFNodeByIP(nodeIP)
+		if upNode == nil {
+			logger.DataRepoLog.Warnf("UPF[%s] of the user plane path no longer configured", nodeIP)
+			return nil
+		}
+		path = append(path, upNode)
+	}
+	return path
+}
+
 func ToBsonMSeidRef(data SeidSmContextRef) (ret bson.M) {
 	// Marshal data into json format
 	tmp, err := json.Marshal(data)
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"encoding/json"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/omec-project/openapi/v2/models"
+)
+
+func TestUPPathInDB(t *testing.T) {
+	upi, psa, iupf2, _ := newIUpfTopology()
+	original := smfContext.UserPlaneInformation
+	t.Cleanup(func() { smfContext.UserPlaneInformation = original })
+	smfContext.UserPlaneInformation = upi
+
+	smContext := newTestSMContext(t, "imsi-208930000000001", "internet")
+	smContext.upPath = UPPath{iupf2, psa}
+	data, err := json.Marshal(smContext)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var stored struct {
+		UPPath []string `json:"upPath"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !slices.Equal(stored.UPPath, []string{"10.0.7.2", "10.0.7.1"}) {
+		t.Errorf("expected the path stored by UPF address, got %v", stored.UPPath)
+	}
+	if path := recoverUPPath(stored.UPPath); !slices.Equal(path, UPPath{iupf2, psa}) {
+		t.Errorf("expected the path through the I-UPF to the PSA, got %v", path)
+	}
+
+	// a UPF of the path removed from the configuration
+	delete(upi.UPFIPToName, "10.0.7.2")
+	if path := recoverUPPath(stored.UPPath); path != nil {
+		t.Errorf("expected no path, got %v", path)
+	}
+}
+
+func TestAccessLegInDB(t *testing.T) {
+	smContext := newTestSMContext(t, "imsi-208930000000001", "internet")
+	node := setupMaPdu(t, smContext)
+	if _, _, err := smContext.AddAccessLeg(models.ACCESSTYPE_NON_3_GPP_ACCESS, models.RATTYPE_WLAN, 3); err != nil {
+		t.Fatalf("add access leg: %v", err)
+	}
+	smContext.StoreAccessLegFTEID(node.UPF.NodeID, smContext.MaPdu.leg.PDRs["rule-1"].PDRID, 7, net.ParseIP("10.0.8.1"))
+	data, err := json.Marshal(smContext.MaPdu)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	maPdu := &MaPdu{}
+	if err := json.Unmarshal(data, maPdu); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	smContext.MaPdu = maPdu
+	smContext.recoverAccessLeg()
+	leg := smContext.AccessLeg(models.ACCESSTYPE_NON_3_GPP_ACCESS)
+	if leg == nil {
+		t.Fatalf("expected the access leg recovered")
+	}
+	if leg.Node != node || leg.Pti != 3 || leg.TEID != 7 || !leg.IP.Equal(net.ParseIP("10.0.8.1")) {
+		t.Errorf("unexpected access leg %+v", leg)
+	}
+	if len(leg.PDRs) != 1 || len(leg.FARs) != 1 {
+		t.Errorf("expected the PDR and the FAR of the access leg, got %d PDRs and %d FARs", len(leg.PDRs), len(leg.FARs))
+	}
+
+	// no default data path to attach the access leg to
+	maPdu = &MaPdu{}
+	if err := json.Unmarshal(data, maPdu); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	smContext.MaPdu = maPdu
+	smContext.Tunnel = NewUPTunnel()
+	smContext.recoverAccessLeg()
+	if leg := smContext.AccessLeg(models.ACCESSTYPE_NON_3_GPP_ACCESS); leg != nil {
+		t.Errorf("expected no access leg, got %+v", leg)
+	}
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"sync"
+	"time"
+
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/smf/dhcp"
+	"github.com/omec-project/smf/factory"
+)
+
+// DHCP allocation modes of a DNN
+const (
+	DhcpModeV4 = "dhcpv4"
+	DhcpModeV6 = "dhcpv6"
+)
+
+// dhcpRetryMin is the shortest delay before retrying to renew a lease
+const dhcpRetryMin = 10 * time.Second
+
+// dhcpAllocator leases the UE addresses of a DNN from its DHCP server
+type dhcpAllocator interface {
+	Acquire(clientID []byte) (*dhcp.Lease, error)
+	Renew(lease *dhcp.Lease) (*dhcp.Lease, error)
+	Release(lease *dhcp.Lease) error
+}
+
+// dhcpAllocators holds the relay client of each DNN with a DHCP server
+var dhcpAllocators sync.Map
+
+// DhcpLease is the lease of the UE address, renewed at T1 until the PDU
+// session is released, RFC 2131 4.4.5
+type DhcpLease struct {
+	Lease *dhcp.Lease `json:"lease,omitempty" yaml:"lease" bson:"lease,omitempty"`
+	timer *time.Timer
+}
+
+// DhcpLeaseExpiryHandler releases the PDU session whose UE address lease
+// expired without being renewed.
+type DhcpLeaseExpiryHandler func(smContext *SMContext)
+
+var dhcpLeaseExpiry struct {
+	handler DhcpLeaseExpiryHandler
+	mu      sync.RWMutex
+}
+
+func SetDhcpLeaseExpiryHandler(handler DhcpLeaseExpiryHandler) {
+	dhcpLeaseExpiry.mu.Lock()
+	defer dhcpLeaseExpiry.mu.Unlock()
+	dhcpLeaseExpiry.handler = handler
+}
+
+// RetrieveDhcpInfo returns the DHCP server of the DNN, nil if the UE
+// addresses of the DNN are allocated by the SMF
+func RetrieveDhcpInfo(dnn string) *factory.DhcpInfo {
+	for i := range smfContext.DhcpInfo {
+		if smfContext.DhcpInfo[i].Dnn == dnn {
+			return &smfContext.DhcpInfo[i]
+		}
+	}
+	return nil
+}
+
+func dhcpClient(info *factory.DhcpInfo) dhcpAllocator {
+	if client, ok := dhcpAllocators.Load(info.Dnn); ok {
+		return client.(dhcpAllocator)
+	}
+	timeout := time.Duration(info.Timeout) * time.Second
+	var client dhcpAllocator
+	if info.Mode == DhcpModeV6 {
+		client = dhcp.NewClient6(info.Server, info.RelayAddr, timeout, info.Retries)
+	} else {
+		client = dhcp.NewClient(info.Server, info.RelayAddr, timeout, info.Retries)
+	}
+	actual, _ := dhcpAllocators.LoadOrStore(info.Dnn, client)
+	return actual.(dhcpAllocator)
+}
+
+// dhcpInfo returns the DHCP server the UE address of the PDU session is
+// leased from, if any. DHCPv6 applies to IPv6 PDU sessions only.
+func (smContext *SMContext) dhcpInfo() *factory.DhcpInfo {
+	info := RetrieveDhcpInfo(smContext.Dnn)
+	if info == nil {
+		return nil
+	}
+	switch info.Mode {
+	case DhcpModeV4:
+		if smContext.SelectedPDUSessionType == nasMessage.PDUSessionTypeIPv6 {
+			return nil
+		}
+		if info.OnUeRequest && !smContext.ProtocolConfigurationOptions.DHCPv4Request {
+			return nil
+		}
+	case DhcpModeV6:
+		if smContext.SelectedPDUSessionType != nasMessage.PDUSessionTypeIPv6 {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return info
+}
+
+// armDhcpRenewal renews the lease after the delay. A lease without lease
+// time is infinite and never renewed.
+func (smContext *SMContext) armDhcpRenewal(dhcpLease *DhcpLease, delay time.Duration) {
+	if dhcpLease.Lease.LeaseTime <= 0 {
+		return
+	}
+	dhcpLease.timer = time.AfterFunc(delay, func() {
+		smContext.renewDhcpLease(dhcpLease)
+	})
+}
+
+func (smContext *SMContext) renewDhcpLease(dhcpLease *DhcpLease) {
+	info := RetrieveDhcpInfo(smContext.Dnn)
+	if info == nil {
+		return
+	}
+	smContext.SMLock.Lock()
+	current := dhcpLease.Lease
+	smContext.SMLock.Unlock()
+	lease, err := dhcpClient(info).Renew(current)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+	if smContext.DhcpLease != dhcpLease {
+		// released meanwhile
+		return
+	}
+	if err == nil {
+		dhcpLease.Lease = lease
+		smContext.armDhcpRenewal(dhcpLease, time.Until(lease.RenewAt()))
+		smContext.SubPduSessLog.Debugf("DHCP lease of IP[%s] renewed for %v", lease.IP.String(), lease.LeaseTime)
+		return
+	}
+
+	if delay := dhcpRetryDelay(time.Until(dhcpLease.Lease.Expiry())); delay > 0 {
+		smContext.SubPduSessLog.Warnf("DHCP lease renewal failed, retry in %v: %v", delay, err)
+		smContext.armDhcpRenewal(dhcpLease, delay)
+		return
+	}
+	smContext.SubPduSessLog.Errorf("DHCP lease of IP[%s] expired: %v", dhcpLease.Lease.IP.String(), err)
+	dhcpLeaseExpiry.mu.RLock()
+	handler := dhcpLeaseExpiry.handler
+	dhcpLeaseExpiry.mu.RUnlock()
+	if handler != nil {
+		go handler(smContext)
+	}
+}
+
+// dhcpRetryDelay returns the delay before retrying to renew a lease with the
+// remaining lease time: half of it, no less than dhcpRetryMin, until the lease
+// expires, RFC 2131 4.4.5. It returns 0 once the lease has expired.
+func dhcpRetryDelay(remaining time.Duration) time.Duration {
+	if remaining <= 0 {
+		return 0
+	}
+	return min(max(remaining/2, dhcpRetryMin), remaining)
+}
+
+// releaseDhcpLease stops the renewal and releases the lease of the UE address
+func (smContext *SMContext) releaseDhcpLease() {
+	dhcpLease := smContext.DhcpLease
+	if dhcpLease == nil {
+		return
+	}
+	smContext.DhcpLease = nil
+	if dhcpLease.timer != nil {
+		dhcpLease.timer.Stop()
+	}
+	info := RetrieveDhcpInfo(smContext.Dnn)
+	if info == nil {
+		return
+	}
+	go func() {
+		if err := dhcpClient(info).Release(dhcpLease.Lease); err != nil {
+			smContext.SubPduSessLog.Errorf("DHCP release of IP[%s] failed: %v", dhcpLease.Lease.IP.String(), err)
+		}
+	}()
+}
@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/smf/dhcp"
+	"github.com/omec-project/smf/factory"
+)
+
+func startDhcpServer(t *testing.T, leaseTime time.Duration, released chan<- net.IP) *factory.DhcpInfo {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	server := &dhcp.Server{Handler: func(request *dhcp.Message) *dhcp.Message {
+		var reply *dhcp.Message
+		switch request.Type() {
+		case dhcp.Discover:
+			reply = request.Reply(dhcp.Offer)
+		case dhcp.Request:
+			reply = request.Reply(dhcp.Ack)
+		case dhcp.Release:
+			released <- request.CIAddr
+			return nil
+		default:
+			return nil
+		}
+		reply.YIAddr = net.ParseIP("10.60.0.10")
+		reply.SetIP(dhcp.OptionServerIdentifier, net.ParseIP("127.0.0.1"))
+		reply.SetDuration(dhcp.OptionLeaseTime, leaseTime)
+		return reply
+	}}
+	go func() { _ = server.Serve(conn) }()
+
+	info := factory.DhcpInfo{
+		Dnn:       "internet",
+		Mode:      DhcpModeV4,
+		Server:    conn.LocalAddr().String(),
+		RelayAddr: "127.0.0.1:0",
+		Timeout:   1,
+		Retries:   1,
+	}
+	originalInfo := smfContext.DhcpInfo
+	t.Cleanup(func() {
+		smfContext.DhcpInfo = originalInfo
+		dhcpAllocators.Delete(info.Dnn)
+	})
+	smfContext.DhcpInfo = []factory.DhcpInfo{info}
+	return &smfContext.DhcpInfo[0]
+}
+
+func TestAllocateUeIpAddrByDhcp(t *testing.T) {
+	released := make(chan net.IP, 1)
+	startDhcpServer(t, time.Hour, released)
+	smContext := newTestSMContext(t, "imsi-208930000000002", "internet")
+	smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv4
+	smContext.DNNInfo = &SnssaiSmfDnnInfo{}
+
+	if err := smContext.AllocateUeIpAddr(); err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	if !smContext.PDUAddress.Ip.Equal(net.ParseIP("10.60.0.10")) || !smContext.PDUAddress.DhcpProvided {
+		t.Errorf("unexpected PDU address %+v", smContext.PDUAddress)
+	}
+	if smContext.DhcpLease == nil || smContext.DhcpLease.timer == nil {
+		t.Fatalf("expected the lease renewal to be armed")
+	}
+
+	if err := smContext.ReleaseUeIpAddr(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if smContext.DhcpLease != nil {
+		t.Errorf("expected the lease to be dropped")
+	}
+	select {
+	case ip := <-released:
+		if !ip.Equal(net.ParseIP("10.60.0.10")) {
+			t.Errorf("unexpected released address %v", ip)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("no DHCPRELEASE received")
+	}
+}
+
+func TestDhcpRetryDelay(t *testing.T) {
+	testCases := []struct {
+		remaining time.Duration
+		expected  time.Duration
+	}{
+		{remaining: time.Hour, expected: 30 * time.Minute},
+		{remaining: 15 * time.Second, expected: dhcpRetryMin},
+		// the last retry is at the lease expiry
+		{remaining: 4 * time.Second, expected: 4 * time.Second},
+		{remaining: 0, expected: 0},
+		{remaining: -time.Second, expected: 0},
+	}
+	for _, tc := range testCases {
+		if delay := dhcpRetryDelay(tc.remaining); delay != tc.expected {
+			t.Errorf("%v remaining: expected %v, got %v", tc.remaining, tc.expected, delay)
+		}
+	}
+}
+
+func TestAllocateUeIpAddrStaticInDhcpDnn(t *testing.T) {
+	startDhcpServer(t, time.Hour, nil)
+	smContext := newTestSMContext(t, "imsi-208930000000002", "internet")
+	smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv4
+	smContext.DNNInfo = &SnssaiSmfDnnInfo{}
+
+	originalStatic := smfContext.StaticIpInfo
+	t.Cleanup(func() { smfContext.StaticIpInfo = originalStatic })
+	smfContext.StaticIpInfo = []factory.StaticIpInfo{{
+		Dnn:        "internet",
+		ImsiIpInfo: map[string]string{smContext.Supi: "10.70.0.1"},
+	}}
+
+	if err := smContext.AllocateUeIpAddr(); err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	if !smContext.PDUAddress.Ip.Equal(net.ParseIP("10.70.0.1")) || smContext.PDUAddress.DhcpProvided {
+		t.Errorf("unexpected PDU address %+v", smContext.PDUAddress)
+	}
+	if err := smContext.ReleaseUeIpAddr(); err != nil {
+		t.Errorf("release: %v", err)
+	}
+}
+
+func TestDhcpInfoOnUeRequest(t *testing.T) {
+	info := startDhcpServer(t, time.Hour, nil)
+	info.OnUeRequest = true
+	smContext := newTestSMContext(t, "imsi-208930000000002", "internet")
+	smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv4
+	smContext.DNNInfo = &SnssaiSmfDnnInfo{}
+
+	if smContext.dhcpInfo() != nil {
+		t.Errorf("expected the DNN pool without DHCPv4 request in the PCO")
+	}
+	smContext.ProtocolConfigurationOptions.DHCPv4Request = true
+	if smContext.dhcpInfo() == nil {
+		t.Errorf("expected the DHCP server on DHCPv4 request in the PCO")
+	}
+	smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv6
+	if smContext.dhcpInfo() != nil {
+		t.Errorf("expected no DHCPv4 server for IPv6 PDU sessions")
+	}
+}
+
+func TestPDUAddressToNASIPv6(t *testing.T) {
+	smContext := &SMContext{
+		SelectedPDUSessionType: nasMessage.PDUSessionTypeIPv6,
+		PDUAddress:             &UeIpAddr{Ip: net.ParseIP("2001:db8::1:2:3:4")},
+	}
+	addr, addrLen := smContext.PDUAddressToNAS()
+	if addrLen != 9 || !bytes.Equal(addr[:8], []byte{0, 1, 0, 2, 0, 3, 0, 4}) {
+		t.Errorf("unexpected PDU address %v length %d", addr[:addrLen], addrLen)
+	}
+}
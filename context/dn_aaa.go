@@ -0,0 +1,476 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omec-project/smf/factory"
+	"github.com/omec-project/smf/logger"
+	"github.com/omec-project/smf/radius"
+)
+
+// Secondary authentication methods of a DN-AAA server
+const (
+	DnAaaAuthPap  = "pap"
+	DnAaaAuthChap = "chap"
+	DnAaaAuthEap  = "eap"
+)
+
+// EAP codes and types, RFC 3748 4
+const (
+	eapCodeRequest  uint8 = 1
+	eapCodeResponse uint8 = 2
+	eapCodeSuccess  uint8 = 3
+	eapCodeFailure  uint8 = 4
+	eapTypeIdentity uint8 = 1
+)
+
+// PAP and CHAP codes, RFC 1334 2.2 and RFC 1994 4
+const (
+	papAuthenticateRequest uint8 = 1
+	chapCodeChallenge      uint8 = 1
+	chapCodeResponse       uint8 = 2
+)
+
+// Service-Type Framed, RFC 2865 5.6
+const radiusServiceTypeFramed uint32 = 2
+
+// ErrDnAaaReject is returned when the DN-AAA server does not authorize the PDU session
+var ErrDnAaaReject = errors.New("rejected by DN-AAA server")
+
+// SecondaryAuth holds the secondary authentication/authorization of the PDU
+// session by a DN-AAA server, TS 23.501 5.6.6 and TS 29.561 11
+type SecondaryAuth struct {
+	UserName string `json:"userName,omitempty" yaml:"userName" bson:"userName,omitempty"`
+	// PAP and CHAP credentials from the PCO
+	Password      []byte `json:"-" yaml:"-" bson:"-"`
+	ChapChallenge []byte `json:"-" yaml:"-" bson:"-"`
+	ChapResponse  []byte `json:"-" yaml:"-" bson:"-"`
+	ChapId        uint8  `json:"-" yaml:"-" bson:"-"`
+	// EapId is the identifier of the last EAP request sent to the UE
+	EapId uint8 `json:"eapId,omitempty" yaml:"eapId" bson:"eapId,omitempty"`
+	// EapRequest is the EAP request pending towards the UE and State the
+	// RADIUS State of the ongoing EAP authentication
+	EapRequest []byte `json:"-" yaml:"-" bson:"-"`
+	State      []byte `json:"-" yaml:"-" bson:"-"`
+	// EapMessage is the EAP-Success or EAP-Failure for the UE
+	EapMessage []byte `json:"-" yaml:"-" bson:"-"`
+
+	// Authorization from the Access-Accept
+	FramedIp       net.IP   `json:"framedIp,omitempty" yaml:"framedIp" bson:"framedIp,omitempty"`
+	Class          [][]byte `json:"class,omitempty" yaml:"class" bson:"class,omitempty"`
+	SessionTimeout uint32   `json:"sessionTimeout,omitempty" yaml:"sessionTimeout" bson:"sessionTimeout,omitempty"`
+
+	// Accounting
+	AcctStartTime  time.Time `json:"acctStartTime,omitempty" yaml:"acctStartTime" bson:"acctStartTime,omitempty"`
+	TerminateCause uint32    `json:"terminateCause,omitempty" yaml:"terminateCause" bson:"terminateCause,omitempty"`
+	AcctStarted    bool      `json:"acctStarted,omitempty" yaml:"acctStarted" bson:"acctStarted,omitempty"`
+
+	timer      *time.Timer
+	guardTimer *time.Timer
+}
+
+// DnAaaSessionTimeoutHandler releases the PDU session once the Session-Timeout
+// authorized by the DN-AAA server expires.
+type DnAaaSessionTimeoutHandler func(smContext *SMContext)
+
+var dnAaaSessionTimeout struct {
+	handler DnAaaSessionTimeoutHandler
+	mu      sync.RWMutex
+}
+
+func SetDnAaaSessionTimeoutHandler(handler DnAaaSessionTimeoutHandler) {
+	dnAaaSessionTimeout.mu.Lock()
+	defer dnAaaSessionTimeout.mu.Unlock()
+	dnAaaSessionTimeout.handler = handler
+}
+
+// EapGuardHandler rejects the PDU session establishment once the EAP request
+// of the identifier is left unanswered by the UE.
+type EapGuardHandler func(smContext *SMContext, eapId uint8)
+
+var eapGuard struct {
+	handler EapGuardHandler
+	mu      sync.RWMutex
+}
+
+func SetEapGuardHandler(handler EapGuardHandler) {
+	eapGuard.mu.Lock()
+	defer eapGuard.mu.Unlock()
+	eapGuard.handler = handler
+}
+
+// eapGuardTime bounds the wait for the EAP response of the UE
+var eapGuardTime = 30 * time.Second
+
+// RetrieveDnAaaInfo returns the DN-AAA server of the DNN, nil if the PDU
+// sessions of the DNN are not subject to secondary authentication
+func RetrieveDnAaaInfo(dnn string) *factory.DnAaaInfo {
+	for i := range smfContext.DnAaaInfo {
+		if smfContext.DnAaaInfo[i].Dnn == dnn {
+			return &smfContext.DnAaaInfo[i]
+		}
+	}
+	return nil
+}
+
+func dnAaaClient(addr string, info *factory.DnAaaInfo) *radius.Client {
+	return &radius.Client{
+		Addr:    addr,
+		Secret:  []byte(info.Secret),
+		Timeout: time.Duration(info.Timeout) * time.Second,
+		Retries: info.Retries,
+	}
+}
+
+func (smContext *SMContext) secondaryAuth() *SecondaryAuth {
+	if smContext.SecondaryAuth == nil {
+		smContext.SecondaryAuth = &SecondaryAuth{}
+	}
+	return smContext.SecondaryAuth
+}
+
+// HandlePapPco keeps the credentials of the PAP Authenticate-Request received
+// in the PCO, RFC 1334 2.2.1
+func (smContext *SMContext) HandlePapPco(contents []byte) error {
+	if len(contents) < 5 || contents[0] != papAuthenticateRequest {
+		return fmt.Errorf("invalid PAP Authenticate-Request")
+	}
+	peerIdLen := int(contents[4])
+	if len(contents) < 5+peerIdLen+1 {
+		return fmt.Errorf("invalid PAP Peer-ID length: %d", peerIdLen)
+	}
+	passwdLen := int(contents[5+peerIdLen])
+	if len(contents) < 6+peerIdLen+passwdLen {
+		return fmt.Errorf("invalid PAP Passwd length: %d", passwdLen)
+	}
+	auth := smContext.secondaryAuth()
+	auth.UserName = string(contents[5 : 5+peerIdLen])
+	auth.Password = append([]byte{}, contents[6+peerIdLen:6+peerIdLen+passwdLen]...)
+	return nil
+}
+
+// HandleChapPco keeps the CHAP Challenge or Response received in the PCO, RFC 1994 4.1
+func (smContext *SMContext) HandleChapPco(contents []byte) error {
+	if len(contents) < 5 {
+		return fmt.Errorf("invalid CHAP packet")
+	}
+	valueSize := int(contents[4])
+	if len(contents) < 5+valueSize {
+		return fmt.Errorf("invalid CHAP Value-Size: %d", valueSize)
+	}
+	value := append([]byte{}, contents[5:5+valueSize]...)
+	auth := smContext.secondaryAuth()
+	switch contents[0] {
+	case chapCodeChallenge:
+		auth.ChapChallenge = value
+	case chapCodeResponse:
+		auth.ChapId = contents[1]
+		auth.ChapResponse = value
+		auth.UserName = string(contents[5+valueSize:])
+	default:
+		return fmt.Errorf("unexpected CHAP code: %d", contents[0])
+	}
+	return nil
+}
+
+// stationIds returns the Called-Station-Id and the Calling-Station-Id, TS 29.561 11.3.1
+func (smContext *SMContext) stationIds() (string, string) {
+	calling := strings.TrimPrefix(smContext.Gpsi, "msisdn-")
+	if calling == "" {
+		calling = strings.TrimPrefix(smContext.Supi, "imsi-")
+	}
+	return smContext.Dnn, calling
+}
+
+func (smContext *SMContext) newDnAaaRequest(code radius.Code, info *factory.DnAaaInfo) (*radius.Packet, error) {
+	request, err := radius.New(code)
+	if err != nil {
+		return nil, err
+	}
+	if userName := smContext.secondaryAuth().UserName; userName != "" {
+		request.AddString(radius.UserName, userName)
+	}
+	if info.NasIdentifier != "" {
+		request.AddString(radius.NASIdentifier, info.NasIdentifier)
+	}
+	called, calling := smContext.stationIds()
+	request.AddString(radius.CalledStationID, called)
+	request.AddString(radius.CallingStationID, calling)
+	return request, nil
+}
+
+// AuthenticateByDnAaa authenticates and authorizes the PDU session by PAP or
+// CHAP with the credentials received in the PCO. The caller holds the SMLock,
+// released during the RADIUS exchange the retransmissions may hold for seconds.
+func (smContext *SMContext) AuthenticateByDnAaa(info *factory.DnAaaInfo) error {
+	auth := smContext.secondaryAuth()
+	request, err := smContext.newDnAaaRequest(radius.CodeAccessRequest, info)
+	if err != nil {
+		return err
+	}
+	request.AddUint32(radius.ServiceType, radiusServiceTypeFramed)
+
+	switch info.AuthMethod {
+	case DnAaaAuthPap:
+		if auth.Password == nil {
+			return fmt.Errorf("no PAP credentials in PCO")
+		}
+		request.Add(radius.UserPassword, radius.EncryptUserPassword(auth.Password, []byte(info.Secret), request.Authenticator))
+	case DnAaaAuthChap:
+		if auth.ChapResponse == nil || auth.ChapChallenge == nil {
+			return fmt.Errorf("no CHAP credentials in PCO")
+		}
+		request.Add(radius.CHAPPassword, append([]byte{auth.ChapId}, auth.ChapResponse...))
+		request.Add(radius.CHAPChallenge, auth.ChapChallenge)
+	default:
+		return fmt.Errorf("unsupported DN-AAA authentication method: %s", info.AuthMethod)
+	}
+
+	smContext.SMLock.Unlock()
+	response, err := dnAaaClient(info.AuthServer, info).Exchange(request)
+	smContext.SMLock.Lock()
+	if err != nil {
+		return err
+	}
+	if response.Code != radius.CodeAccessAccept {
+		return fmt.Errorf("%w: %s", ErrDnAaaReject, response.Code)
+	}
+	smContext.applyAccessAccept(response)
+	return nil
+}
+
+// StartEapAuthentication starts the EAP authentication of the UE by the DN-AAA
+// server with an EAP-Request/Identity, TS 33.501 11.1.2
+func (smContext *SMContext) StartEapAuthentication() {
+	auth := smContext.secondaryAuth()
+	auth.EapId++
+	auth.State = nil
+	auth.EapRequest = []byte{eapCodeRequest, auth.EapId, 0, 5, eapTypeIdentity}
+	smContext.startEapGuardTimer()
+}
+
+// startEapGuardTimer arms the guard of the EAP request pending towards the UE
+func (smContext *SMContext) startEapGuardTimer() {
+	auth := smContext.SecondaryAuth
+	auth.stopEapGuardTimer()
+	eapId := auth.EapId
+	auth.guardTimer = time.AfterFunc(eapGuardTime, func() {
+		eapGuard.mu.RLock()
+		handler := eapGuard.handler
+		eapGuard.mu.RUnlock()
+		smContext.SubPduSessLog.Warnf("EAP request [%d] unanswered for %v", eapId, eapGuardTime)
+		if handler != nil {
+			handler(smContext, eapId)
+		}
+	})
+}
+
+func (auth *SecondaryAuth) stopEapGuardTimer() {
+	if auth.guardTimer != nil {
+		auth.guardTimer.Stop()
+		auth.guardTimer = nil
+	}
+}
+
+// IsEapRequestPending reports whether the EAP request of the identifier is
+// still pending towards the UE
+func (smContext *SMContext) IsEapRequestPending(eapId uint8) bool {
+	return smContext.IsSecondaryAuthPending() && smContext.SecondaryAuth.EapId == eapId
+}
+
+// IsSecondaryAuthPending reports whether an EAP request is pending towards the UE
+func (smContext *SMContext) IsSecondaryAuthPending() bool {
+	return smContext.SecondaryAuth != nil && smContext.SecondaryAuth.EapRequest != nil
+}
+
+// RelayEapResponse relays the EAP response of the UE to the DN-AAA server.
+// The next EAP request for the UE is kept in EapRequest while the
+// authentication is ongoing, and the EAP-Success or EAP-Failure in EapMessage
+// once completed. ErrDnAaaReject is returned if the UE is not authorized.
+func (smContext *SMContext) RelayEapResponse(info *factory.DnAaaInfo, eap []byte) error {
+	if len(eap) < 4 || eap[0] != eapCodeResponse {
+		return fmt.Errorf("invalid EAP response")
+	}
+	auth := smContext.secondaryAuth()
+	if len(eap) > 5 && eap[4] == eapTypeIdentity && auth.UserName == "" {
+		auth.UserName = string(eap[5:])
+	}
+
+	request, err := smContext.newDnAaaRequest(radius.CodeAccessRequest, info)
+	if err != nil {
+		return err
+	}
+	request.AddUint32(radius.ServiceType, radiusServiceTypeFramed)
+	request.Add(radius.EAPMessage, eap)
+	if auth.State != nil {
+		request.Add(radius.State, auth.State)
+	}
+
+	auth.EapRequest = nil
+	auth.stopEapGuardTimer()
+	response, err := dnAaaClient(info.AuthServer, info).Exchange(request)
+	if err != nil {
+		return err
+	}
+
+	eapMessage := response.GetEAPMessage()
+	switch response.Code {
+	case radius.CodeAccessChallenge:
+		if len(eapMessage) < 4 {
+			return fmt.Errorf("no EAP request in Access-Challenge")
+		}
+		auth.State = response.Get(radius.State)
+		auth.EapId = eapMessage[1]
+		auth.EapRequest = eapMessage
+		smContext.startEapGuardTimer()
+		return nil
+	case radius.CodeAccessAccept:
+		if len(eapMessage) < 4 {
+			eapMessage = []byte{eapCodeSuccess, eap[1], 0, 4}
+		}
+		auth.EapMessage = eapMessage
+		auth.State = nil
+		smContext.applyAccessAccept(response)
+		return nil
+	default:
+		if len(eapMessage) < 4 {
+			eapMessage = []byte{eapCodeFailure, eap[1], 0, 4}
+		}
+		auth.EapMessage = eapMessage
+		auth.State = nil
+		return fmt.Errorf("%w: %s", ErrDnAaaReject, response.Code)
+	}
+}
+
+func (smContext *SMContext) secondaryAuthEapMessage() []byte {
+	if smContext.SecondaryAuth == nil {
+		return nil
+	}
+	return smContext.SecondaryAuth.EapMessage
+}
+
+// applyAccessAccept keeps the authorization of the PDU session, TS 29.561 11.3.2
+func (smContext *SMContext) applyAccessAccept(response *radius.Packet) {
+	auth := smContext.secondaryAuth()
+	auth.FramedIp = response.GetIP(radius.FramedIPAddress)
+	auth.Class = response.GetAll(radius.Class)
+	auth.SessionTimeout, _ = response.GetUint32(radius.SessionTimeout)
+	smContext.SubPduSessLog.Infof("authorized by DN-AAA server, framed IP [%v] session timeout [%d]",
+		auth.FramedIp, auth.SessionTimeout)
+}
+
+func (smContext *SMContext) newAccountingRequest(info *factory.DnAaaInfo, statusType uint32) (*radius.Packet, error) {
+	auth := smContext.secondaryAuth()
+	request, err := smContext.newDnAaaRequest(radius.CodeAccountingRequest, info)
+	if err != nil {
+		return nil, err
+	}
+	request.AddUint32(radius.AcctStatusType, statusType)
+	request.AddString(radius.AcctSessionID, smContext.Ref)
+	if smContext.PDUAddress != nil && smContext.PDUAddress.Ip.To4() != nil {
+		request.AddIP(radius.FramedIPAddress, smContext.PDUAddress.Ip)
+	}
+	for _, class := range auth.Class {
+		request.Add(radius.Class, class)
+	}
+	return request, nil
+}
+
+func (smContext *SMContext) sendAccounting(info *factory.DnAaaInfo, request *radius.Packet) {
+	go func() {
+		if _, err := dnAaaClient(info.AcctServer, info).Exchange(request); err != nil {
+			logger.CtxLog.Errorf("DN-AAA accounting for session [%s] failed: %v", smContext.Ref, err)
+		}
+	}()
+}
+
+// StartDnAaaSession sends the Accounting Start of the established PDU session
+// and arms the Session-Timeout authorized by the DN-AAA server
+func (smContext *SMContext) StartDnAaaSession() {
+	auth := smContext.SecondaryAuth
+	info := RetrieveDnAaaInfo(smContext.Dnn)
+	if auth == nil || info == nil || auth.AcctStarted {
+		return
+	}
+	auth.AcctStarted = true
+	auth.AcctStartTime = time.Now()
+	auth.TerminateCause = radius.AcctTerminateCauseUserRequest
+
+	if auth.SessionTimeout != 0 {
+		auth.timer = time.AfterFunc(time.Duration(auth.SessionTimeout)*time.Second, func() {
+			dnAaaSessionTimeout.mu.RLock()
+			handler := dnAaaSessionTimeout.handler
+			dnAaaSessionTimeout.mu.RUnlock()
+			smContext.SubPduSessLog.Infof("DN-AAA session timeout [%ds] expired", auth.SessionTimeout)
+			smContext.SMLock.Lock()
+			auth.TerminateCause = radius.AcctTerminateCauseSessionTimeout
+			smContext.SMLock.Unlock()
+			if handler != nil {
+				handler(smContext)
+			}
+		})
+	}
+
+	if info.AcctServer == "" {
+		return
+	}
+	request, err := smContext.newAccountingRequest(info, radius.AcctStatusTypeStart)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("build DN-AAA Accounting Start failed: %v", err)
+		return
+	}
+	smContext.sendAccounting(info, request)
+}
+
+// StopDnAaaSession cancels the EAP guard and the Session-Timeout and sends the
+// Accounting Stop of the released PDU session
+func (smContext *SMContext) StopDnAaaSession() {
+	auth := smContext.SecondaryAuth
+	if auth == nil {
+		return
+	}
+	auth.stopEapGuardTimer()
+	if !auth.AcctStarted {
+		return
+	}
+	auth.AcctStarted = false
+	if auth.timer != nil {
+		auth.timer.Stop()
+		auth.timer = nil
+	}
+
+	info := RetrieveDnAaaInfo(smContext.Dnn)
+	if info == nil || info.AcctServer == "" {
+		return
+	}
+	request, err := smContext.newAccountingRequest(info, radius.AcctStatusTypeStop)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("build DN-AAA Accounting Stop failed: %v", err)
+		return
+	}
+	request.AddUint32(radius.AcctSessionTime, uint32(time.Since(auth.AcctStartTime)/time.Second))
+	request.AddUint32(radius.AcctTerminateCause, auth.TerminateCause)
+	smContext.sendAccounting(info, request)
+}
+
+// DnAaaUeIpAddr returns the Framed-IP-Address authorized by the DN-AAA server,
+// if any. An address of the DNN pools is reserved like a subscribed static IP.
+func (smContext *SMContext) DnAaaUeIpAddr() net.IP {
+	if smContext.SecondaryAuth == nil {
+		return nil
+	}
+	ip := smContext.SecondaryAuth.FramedIp
+	// 255.255.255.254 and 255.255.255.255 leave the address to the SMF, RFC 2865 5.8
+	if ip == nil || ip.Equal(net.IPv4(255, 255, 255, 254)) || ip.Equal(net.IPv4bcast) {
+		return nil
+	}
+	return ip
+}
@@ -0,0 +1,266 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/omec-project/smf/factory"
+	"github.com/omec-project/smf/radius"
+)
+
+const dnAaaSecret = "testing123"
+
+func startDnAaaServer(t *testing.T, handler radius.Handler) *factory.DnAaaInfo {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	server := &radius.Server{Secret: []byte(dnAaaSecret), Handler: handler}
+	go func() { _ = server.Serve(conn) }()
+
+	info := factory.DnAaaInfo{
+		Dnn:        "internet",
+		AuthServer: conn.LocalAddr().String(),
+		AcctServer: conn.LocalAddr().String(),
+		Secret:     dnAaaSecret,
+		Timeout:    1,
+		Retries:    1,
+	}
+	originalInfo := smfContext.DnAaaInfo
+	t.Cleanup(func() { smfContext.DnAaaInfo = originalInfo })
+	smfContext.DnAaaInfo = []factory.DnAaaInfo{info}
+	return &smfContext.DnAaaInfo[0]
+}
+
+func TestHandlePapChapPco(t *testing.T) {
+	smContext := &SMContext{}
+	// Authenticate-Request with Peer-ID "user" and Passwd "secret"
+	pap := []byte{1, 1, 0, 16, 4, 'u', 's', 'e', 'r', 6, 's', 'e', 'c', 'r', 'e', 't'}
+	if err := smContext.HandlePapPco(pap); err != nil {
+		t.Fatalf("PAP: %v", err)
+	}
+	if smContext.SecondaryAuth.UserName != "user" || string(smContext.SecondaryAuth.Password) != "secret" {
+		t.Errorf("unexpected PAP credentials %q %q", smContext.SecondaryAuth.UserName, smContext.SecondaryAuth.Password)
+	}
+	if err := smContext.HandlePapPco(pap[:8]); err == nil {
+		t.Errorf("expected error for truncated PAP Authenticate-Request")
+	}
+
+	challenge := []byte{1, 7, 0, 9, 4, 1, 2, 3, 4}
+	response := []byte{2, 7, 0, 13, 4, 5, 6, 7, 8, 'u', 's', 'e', 'r'}
+	for _, contents := range [][]byte{challenge, response} {
+		if err := smContext.HandleChapPco(contents); err != nil {
+			t.Fatalf("CHAP: %v", err)
+		}
+	}
+	auth := smContext.SecondaryAuth
+	if !bytes.Equal(auth.ChapChallenge, []byte{1, 2, 3, 4}) || !bytes.Equal(auth.ChapResponse, []byte{5, 6, 7, 8}) ||
+		auth.ChapId != 7 || auth.UserName != "user" {
+		t.Errorf("unexpected CHAP credentials %+v", auth)
+	}
+}
+
+func TestAuthenticateByDnAaa(t *testing.T) {
+	info := startDnAaaServer(t, func(request *radius.Packet) *radius.Packet {
+		password, err := radius.DecryptUserPassword(request.Get(radius.UserPassword), []byte(dnAaaSecret), request.Authenticator)
+		if err != nil || string(password) != "secret" || string(request.Get(radius.CallingStationID)) != "0900000000" {
+			return request.Response(radius.CodeAccessReject)
+		}
+		response := request.Response(radius.CodeAccessAccept)
+		response.AddIP(radius.FramedIPAddress, net.ParseIP("10.1.2.3"))
+		response.AddUint32(radius.SessionTimeout, 3600)
+		response.AddString(radius.Class, "gold")
+		return response
+	})
+	info.AuthMethod = DnAaaAuthPap
+
+	smContext := newTestSMContext(t, "imsi-208930000000001", "internet")
+	smContext.Gpsi = "msisdn-0900000000"
+	smContext.secondaryAuth().UserName = "user"
+	smContext.secondaryAuth().Password = []byte("secret")
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+	if err := smContext.AuthenticateByDnAaa(info); err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if ip := smContext.DnAaaUeIpAddr(); !ip.Equal(net.ParseIP("10.1.2.3")) {
+		t.Errorf("unexpected UE IP address %v", ip)
+	}
+	if auth := smContext.SecondaryAuth; auth.SessionTimeout != 3600 || len(auth.Class) != 1 || string(auth.Class[0]) != "gold" {
+		t.Errorf("unexpected authorization %+v", auth)
+	}
+
+	smContext.SecondaryAuth.Password = []byte("wrong")
+	if err := smContext.AuthenticateByDnAaa(info); err == nil {
+		t.Errorf("expected rejection")
+	}
+}
+
+func TestRelayEapResponse(t *testing.T) {
+	eapChallenge := []byte{1, 2, 0, 6, 4, 0xaa}
+	info := startDnAaaServer(t, func(request *radius.Packet) *radius.Packet {
+		eap := request.GetEAPMessage()
+		if request.Get(radius.State) == nil {
+			// EAP-Response/Identity
+			response := request.Response(radius.CodeAccessChallenge)
+			response.Add(radius.EAPMessage, eapChallenge)
+			response.AddString(radius.State, "round-1")
+			return response
+		}
+		if eap[1] != 2 {
+			return request.Response(radius.CodeAccessReject)
+		}
+		response := request.Response(radius.CodeAccessAccept)
+		response.Add(radius.EAPMessage, []byte{3, 2, 0, 4})
+		return response
+	})
+	info.AuthMethod = DnAaaAuthEap
+
+	smContext := newTestSMContext(t, "imsi-208930000000001", "internet")
+	smContext.Gpsi = "msisdn-0900000000"
+	smContext.StartEapAuthentication()
+	if !smContext.IsSecondaryAuthPending() {
+		t.Fatalf("expected EAP-Request/Identity pending")
+	}
+
+	identity := append([]byte{2, smContext.SecondaryAuth.EapId, 0, 9, 1}, "user"...)
+	if err := smContext.RelayEapResponse(info, identity); err != nil {
+		t.Fatalf("relay identity: %v", err)
+	}
+	if !smContext.IsSecondaryAuthPending() || !bytes.Equal(smContext.SecondaryAuth.EapRequest, eapChallenge) {
+		t.Fatalf("expected EAP challenge pending, got %v", smContext.SecondaryAuth.EapRequest)
+	}
+	if smContext.SecondaryAuth.UserName != "user" {
+		t.Errorf("expected user name from EAP identity, got %q", smContext.SecondaryAuth.UserName)
+	}
+
+	if err := smContext.RelayEapResponse(info, []byte{2, 2, 0, 6, 4, 0xbb}); err != nil {
+		t.Fatalf("relay challenge response: %v", err)
+	}
+	if smContext.IsSecondaryAuthPending() {
+		t.Errorf("expected EAP authentication completed")
+	}
+	if eap := smContext.secondaryAuthEapMessage(); len(eap) != 4 || eap[0] != eapCodeSuccess {
+		t.Errorf("expected EAP-Success, got %v", eap)
+	}
+}
+
+func TestDnAaaAccounting(t *testing.T) {
+	requests := make(chan *radius.Packet, 2)
+	startDnAaaServer(t, func(request *radius.Packet) *radius.Packet {
+		requests <- request
+		return request.Response(radius.CodeAccountingResponse)
+	})
+
+	smContext := newTestSMContext(t, "imsi-208930000000001", "internet")
+	smContext.Gpsi = "msisdn-0900000000"
+	smContext.PDUAddress = &UeIpAddr{Ip: net.ParseIP("10.1.2.3").To4()}
+	smContext.secondaryAuth().Class = [][]byte{[]byte("gold")}
+
+	smContext.StartDnAaaSession()
+	smContext.StopDnAaaSession()
+
+	for _, statusType := range []uint32{radius.AcctStatusTypeStart, radius.AcctStatusTypeStop} {
+		var request *radius.Packet
+		select {
+		case request = <-requests:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no accounting request received")
+		}
+		if request.Code != radius.CodeAccountingRequest {
+			t.Fatalf("expected Accounting-Request, got %s", request.Code)
+		}
+		gotType, _ := request.GetUint32(radius.AcctStatusType)
+		if gotType == radius.AcctStatusTypeStop {
+			if cause, ok := request.GetUint32(radius.AcctTerminateCause); !ok || cause != radius.AcctTerminateCauseUserRequest {
+				t.Errorf("unexpected Acct-Terminate-Cause %d", cause)
+			}
+		}
+		if !request.GetIP(radius.FramedIPAddress).Equal(net.ParseIP("10.1.2.3")) ||
+			string(request.Get(radius.Class)) != "gold" || string(request.Get(radius.AcctSessionID)) != smContext.Ref {
+			t.Errorf("unexpected accounting attributes for status type %d", statusType)
+		}
+	}
+}
+
+func TestEapGuardTimer(t *testing.T) {
+	originalGuardTime := eapGuardTime
+	t.Cleanup(func() {
+		eapGuardTime = originalGuardTime
+		SetEapGuardHandler(nil)
+	})
+	eapGuardTime = 10 * time.Millisecond
+	expired := make(chan uint8, 2)
+	SetEapGuardHandler(func(smContext *SMContext, eapId uint8) {
+		if smContext.IsEapRequestPending(eapId) {
+			expired <- eapId
+		}
+	})
+
+	smContext := newTestSMContext(t, "imsi-208930000000001", "internet")
+	smContext.Gpsi = "msisdn-0900000000"
+	smContext.StartEapAuthentication()
+	select {
+	case eapId := <-expired:
+		if eapId != smContext.SecondaryAuth.EapId {
+			t.Errorf("expected the guard of EAP request [%d], got [%d]", smContext.SecondaryAuth.EapId, eapId)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the unanswered EAP request guarded")
+	}
+
+	smContext.StartEapAuthentication()
+	smContext.StopDnAaaSession()
+	select {
+	case eapId := <-expired:
+		t.Errorf("unexpected guard of EAP request [%d] after release", eapId)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAllocateDnAaaUeIpAddr(t *testing.T) {
+	allocator, err := NewIPAllocator("10.60.0.0/29")
+	if err != nil {
+		t.Fatalf("new allocator: %v", err)
+	}
+	newSMContext := func(supi, framedIp string) *SMContext {
+		smContext := newTestSMContext(t, supi, "internet")
+		smContext.DNNInfo = &SnssaiSmfDnnInfo{UeIPAllocator: allocator}
+		smContext.secondaryAuth().FramedIp = net.ParseIP(framedIp)
+		return smContext
+	}
+
+	smContext := newSMContext("imsi-208930000000001", "10.60.0.2")
+	if err := smContext.AllocateUeIpAddr(); err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	if smContext.PDUAddress.AaaProvided {
+		t.Errorf("expected the address of the pool reserved in the pool")
+	}
+	if err := newSMContext("imsi-208930000000002", "10.60.0.2").AllocateUeIpAddr(); !errors.Is(err, ErrStaticIpConflict) {
+		t.Errorf("expected the address of another UE refused, got %v", err)
+	}
+
+	outside := newSMContext("imsi-208930000000003", "10.1.2.3")
+	if err := outside.AllocateUeIpAddr(); err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	if !outside.PDUAddress.AaaProvided || !outside.PDUAddress.Ip.Equal(net.ParseIP("10.1.2.3")) {
+		t.Errorf("expected the address outside of the pool left to the DN-AAA server, got %+v", outside.PDUAddress)
+	}
+
+	if err := smContext.ReleaseUeIpAddr(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if err := newSMContext("imsi-208930000000002", "10.60.0.2").AllocateUeIpAddr(); err != nil {
+		t.Errorf("expected the released address available, got %v", err)
+	}
+}
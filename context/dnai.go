@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"slices"
+	"strings"
+)
+
+// containsFold reports whether the TAIs or cell identities contain the value,
+// regardless of the case of the hex digits
+func containsFold(values []string, value string) bool {
+	return value != "" && slices.ContainsFunc(values, func(v string) bool {
+		return strings.EqualFold(v, value)
+	})
+}
+
+// upfDnaiList returns the DNAIs served by the UPF, the UPF serving the UEs
+// out of any DNAI if none
+func upfDnaiList(upfName string) []string {
+	var dnaiList []string
+	for _, info := range smfContext.DnaiInfo {
+		if slices.Contains(info.Upfs, upfName) {
+			dnaiList = append(dnaiList, info.Dnai)
+		}
+	}
+	if len(dnaiList) == 0 {
+		return []string{""}
+	}
+	return dnaiList
+}
+
+// ueDnai returns the DNAI the UE is located in, "" if its location is not
+// mapped to a DNAI. The NR cell takes precedence over the TAI.
+func (smContext *SMContext) ueDnai() string {
+	loc := smContext.UeLocation
+	if loc == nil || loc.NrLocation == nil {
+		return ""
+	}
+	if cellId := loc.NrLocation.Ncgi.NrCellId; cellId != "" {
+		for _, info := range smfContext.DnaiInfo {
+			if containsFold(info.NrCellIds, cellId) {
+				return info.Dnai
+			}
+		}
+	}
+	tai := smContext.ueTai()
+	for _, info := range smfContext.DnaiInfo {
+		if containsFold(info.Tais, tai) {
+			return info.Dnai
+		}
+	}
+	return ""
+}
+
+// UPFSelectionParams returns the parameters selecting the UPFs of the PDU
+// session, with the DNAI of the UE location and the AN of its access
+func (smContext *SMContext) UPFSelectionParams() *UPFSelectionParams {
+	selection := &UPFSelectionParams{
+		Dnn:        smContext.Dnn,
+		Dnai:       smContext.ueDnai(),
+		AccessType: smContext.AnType,
+		AccessNode: smContext.ueAccessNode(),
+	}
+	if smContext.Snssai != nil {
+		selection.SNssai = &SNssai{
+			Sst: smContext.Snssai.GetSst(),
+			Sd:  smContext.Snssai.GetSd(),
+		}
+	}
+	return selection
+}
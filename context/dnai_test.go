@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"testing"
+
+	"github.com/omec-project/openapi/v2"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/openapi/v2/nfConfigApi"
+	"github.com/omec-project/smf/factory"
+)
+
+func newDnaiUPNode(ip string, dnaiList []string, an *UPNode) *UPNode {
+	node := &UPNode{
+		Type:   UPNODE_UPF,
+		NodeID: *NewNodeID(ip),
+		UPF: &UPF{SNssaiInfos: []SnssaiUPFInfo{{
+			SNssai:  SNssai{Sst: 1, Sd: "010203"},
+			DnnList: []DnnUPFInfoItem{{Dnn: "internet", DnaiList: dnaiList}},
+		}}},
+		Links: []*UPNode{an},
+	}
+	an.Links = append(an.Links, node)
+	return node
+}
+
+func TestUPFSelectionByDnai(t *testing.T) {
+	original := smfContext.DnaiInfo
+	t.Cleanup(func() { smfContext.DnaiInfo = original })
+	smfContext.DnaiInfo = []factory.DnaiInfo{
+		{Dnai: "edge1", Tais: []string{"208-93-00000A"}},
+		{Dnai: "edge2", NrCellIds: []string{"00000001f"}},
+	}
+
+	an := &UPNode{Type: UPNODE_AN, NodeID: *NewNodeID("192.168.1.1")}
+	central := newDnaiUPNode("10.0.0.1", nil, an)
+	edge := newDnaiUPNode("10.0.0.2", []string{"edge1"}, an)
+	upi := &UserPlaneInformation{
+		UPNodes:              map[string]*UPNode{"gnb": an, "central": central, "edge": edge},
+		UPFs:                 map[string]*UPNode{"central": central, "edge": edge},
+		AccessNetwork:        map[string]*UPNode{"gnb": an},
+		DefaultUserPlanePath: map[string][]*UPNode{},
+	}
+
+	tests := []struct {
+		name     string
+		tac      string
+		cellId   string
+		dnai     string
+		expected *UPNode
+	}{
+		{name: "TAI of the edge DNAI", tac: "00000a", dnai: "edge1", expected: edge},
+		{name: "TAI out of any DNAI", tac: "000001", expected: central},
+		{name: "cell of a DNAI without UPF", tac: "00000a", cellId: "00000001F", dnai: "edge2", expected: central},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			smContext := &SMContext{
+				Dnn:    "internet",
+				Snssai: &models.Snssai{Sst: 1, Sd: openapi.PtrString("010203")},
+				UeLocation: &models.UserLocation{NrLocation: &models.NrLocation{
+					Tai:  models.Tai{PlmnId: models.PlmnId{Mcc: "208", Mnc: "93"}, Tac: tc.tac},
+					Ncgi: models.Ncgi{NrCellId: tc.cellId},
+				}},
+			}
+			selection := smContext.UPFSelectionParams()
+			if selection.Dnai != tc.dnai {
+				t.Errorf("expected DNAI %q, got %q", tc.dnai, selection.Dnai)
+			}
+			path := upi.GetDefaultUserPlanePathByDNN(selection)
+			if len(path) == 0 || path[len(path)-1] != tc.expected {
+				t.Errorf("expected UPF %s, got path %v", tc.expected.NodeID.ResolveNodeIdToIp(), path)
+			}
+		})
+	}
+}
+
+func TestUPFDnaiListFromSessionManagement(t *testing.T) {
+	original := smfContext.DnaiInfo
+	t.Cleanup(func() { smfContext.DnaiInfo = original })
+	smfContext.DnaiInfo = []factory.DnaiInfo{{Dnai: "edge1", Upfs: []string{"10.1.1.2"}}}
+
+	upi := BuildUserPlaneInformationFromSessionManagement(nil, []nfConfigApi.SessionManagement{
+		makeTestSessionConfig("slice1", "208", "93", "1", "010203", "internet", "10.0.0.0/24", "10.1.1.1", []string{"gnb1"}),
+		makeTestSessionConfig("slice1", "208", "93", "1", "010203", "internet", "10.0.0.0/24", "10.1.1.2", []string{"gnb1"}),
+	})
+
+	for name, expected := range map[string]string{"10.1.1.1": "", "10.1.1.2": "edge1"} {
+		dnnList := upi.UPFs[name].UPF.SNssaiInfos[0].DnnList
+		if len(dnnList) != 1 || len(dnnList[0].DnaiList) != 1 || dnnList[0].DnaiList[0] != expected {
+			t.Errorf("expected UPF %s to serve DNAI %q, got %+v", name, expected, dnnList)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import "testing"
+
+// newTestSMContext returns a new SM context of the UE in the DNN, dropped
+// from the SM context pool at the end of the test
+func newTestSMContext(t *testing.T, supi, dnn string) *SMContext {
+	t.Helper()
+	smContext := NewSMContext(supi, 1)
+	smContext.Supi = supi
+	smContext.Dnn = dnn
+	t.Cleanup(func() {
+		smContextPool.Delete(smContext.Ref)
+		canonicalRef.Delete(canonicalName(supi, 1))
+	})
+	return smContext
+}
+
+// newTestDataPathNode returns a data path node on an associated UPF with a
+// forwarding uplink and downlink PDR per name
+func newTestDataPathNode(t *testing.T, names ...string) *DataPathNode {
+	t.Helper()
+	upf := NewUPF(NewNodeID("10.0.8.1"), nil)
+	upf.UPFStatus = AssociatedSetUpSuccess
+	node := NewDataPathNode()
+	node.UPF = upf
+	for _, name := range names {
+		ulPDR, err := upf.AddPDR()
+		if err != nil {
+			t.Fatalf("add uplink PDR: %v", err)
+		}
+		ulPDR.FAR.ApplyAction = ApplyAction{Forw: true}
+		dlPDR, err := upf.AddPDR()
+		if err != nil {
+			t.Fatalf("add downlink PDR: %v", err)
+		}
+		dlPDR.FAR.ApplyAction = ApplyAction{Forw: true}
+		dlPDR.FAR.ForwardingParameters = &ForwardingParameters{}
+		node.UpLinkTunnel.PDR[name] = ulPDR
+		node.DownLinkTunnel.PDR[name] = dlPDR
+	}
+	return node
+}
+
+// addTestDefaultPath sets the node as the first node of the activated
+// default data path of the SM context
+func addTestDefaultPath(smContext *SMContext, node *DataPathNode) {
+	smContext.Tunnel = NewUPTunnel()
+	smContext.Tunnel.AddDataPath(&DataPath{Activated: true, IsDefaultPath: true, FirstDPNode: node})
+}
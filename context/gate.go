@@ -3,6 +3,11 @@
 
 package context
 
+import (
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/qos"
+)
+
 const (
 	GateOpen uint8 = iota
 	GateClose
@@ -12,3 +17,123 @@ type GateStatus struct {
 	ULGate uint8 // 0x00001100
 	DLGate uint8 // 0x00000011
 }
+
+// NewGateStatus maps the PCC rule flow status (TS 29.512 5.6.3.6) to QER gates.
+// An absent flow status leaves both gates open.
+func NewGateStatus(flowStatus models.FlowStatus) *GateStatus {
+	switch flowStatus {
+	case models.FLOWSTATUS_DISABLED, models.FLOWSTATUS_REMOVED:
+		return &GateStatus{ULGate: GateClose, DLGate: GateClose}
+	case models.FLOWSTATUS_ENABLED_UPLINK:
+		return &GateStatus{ULGate: GateOpen, DLGate: GateClose}
+	case models.FLOWSTATUS_ENABLED_DOWNLINK:
+		return &GateStatus{ULGate: GateClose, DLGate: GateOpen}
+	default:
+		return &GateStatus{ULGate: GateOpen, DLGate: GateOpen}
+	}
+}
+
+// PccRuleGateStatus returns the gate status for the PCC rule, derived from the
+// flow status of its traffic control data.
+func (smContext *SMContext) PccRuleGateStatus(ruleId string) *GateStatus {
+	var refTcData []string
+	if len(smContext.SmPolicyUpdates) > 0 && smContext.SmPolicyUpdates[0].SmPolicyDecision != nil {
+		if rule, ok := smContext.SmPolicyUpdates[0].SmPolicyDecision.GetPccRules()[ruleId]; ok {
+			refTcData = rule.RefTcData
+		}
+	}
+	if len(refTcData) == 0 {
+		if rule := smContext.SmPolicyData.SmCtxtPccRules.PccRules[ruleId]; rule != nil {
+			refTcData = rule.RefTcData
+		}
+	}
+	if len(refTcData) == 0 {
+		return NewGateStatus("")
+	}
+
+	var tc *models.TrafficControlData
+	if len(smContext.SmPolicyUpdates) > 0 && smContext.SmPolicyUpdates[0].SmPolicyDecision != nil {
+		tc = qos.GetTcDataFromPolicyDecision(smContext.SmPolicyUpdates[0].SmPolicyDecision, refTcData[0])
+	}
+	if tc == nil {
+		tc = smContext.SmPolicyData.SmCtxtTCData.TrafficControlData[refTcData[0]]
+	}
+	return NewGateStatus(tc.GetFlowStatus())
+}
+
+// UpdatePccRuleGateStatus applies the flow status of the modified traffic
+// control data to the QERs installed for the PCC rules referring to it.
+// It returns the QERs whose gates changed, marked for a PFCP Update QER.
+func (smContext *SMContext) UpdatePccRuleGateStatus(tcData map[string]*models.TrafficControlData) []*QER {
+	qerList := make([]*QER, 0)
+	updated := make(map[uint32]bool)
+
+	for ruleName, rule := range smContext.SmPolicyData.SmCtxtPccRules.PccRules {
+		if rule == nil || len(rule.RefTcData) == 0 {
+			continue
+		}
+		tc, ok := tcData[rule.RefTcData[0]]
+		if !ok {
+			continue
+		}
+		gateStatus := NewGateStatus(tc.GetFlowStatus())
+
+		for _, dataPath := range smContext.Tunnel.DataPathPool {
+			if !dataPath.Activated {
+				continue
+			}
+			for node := dataPath.FirstDPNode; node != nil; node = node.Next() {
+				for _, tunnel := range []*GTPTunnel{node.UpLinkTunnel, node.DownLinkTunnel} {
+					for _, qer := range tunnel.PccRuleQERs(ruleName) {
+						if updated[qer.QERID] || (qer.GateStatus != nil && *qer.GateStatus == *gateStatus) {
+							continue
+						}
+						qer.GateStatus = &GateStatus{ULGate: gateStatus.ULGate, DLGate: gateStatus.DLGate}
+						if qer.State == RULE_CREATE {
+							qer.State = RULE_UPDATE
+						}
+						updated[qer.QERID] = true
+						qerList = append(qerList, qer)
+						smContext.SubQosLog.Infof("PCC rule [%s] flow status [%s], QER [%d] gate UL [%d] DL [%d]",
+							ruleName, tc.GetFlowStatus(), qer.QERID, gateStatus.ULGate, gateStatus.DLGate)
+					}
+				}
+			}
+		}
+	}
+	return qerList
+}
+
+// PccRuleQERs returns the QERs of the PCC rule PDR in the tunnel, leaving out
+// QERs shared with other PDRs such as the session rule QER.
+func (tunnel *GTPTunnel) PccRuleQERs(ruleName string) []*QER {
+	if tunnel == nil {
+		return nil
+	}
+	pdr, ok := tunnel.PDR[ruleName]
+	if !ok || pdr == nil {
+		return nil
+	}
+
+	qers := make([]*QER, 0, len(pdr.QER))
+	for _, qer := range pdr.QER {
+		if qer == nil {
+			continue
+		}
+		shared := false
+		for name, other := range tunnel.PDR {
+			if name == ruleName || other == nil {
+				continue
+			}
+			for _, otherQer := range other.QER {
+				if otherQer == qer {
+					shared = true
+				}
+			}
+		}
+		if !shared {
+			qers = append(qers, qer)
+		}
+	}
+	return qers
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context_test
+
+import (
+	"testing"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/context"
+)
+
+func TestNewGateStatus(t *testing.T) {
+	testCases := []struct {
+		flowStatus models.FlowStatus
+		expected   context.GateStatus
+	}{
+		{"", context.GateStatus{ULGate: context.GateOpen, DLGate: context.GateOpen}},
+		{models.FLOWSTATUS_ENABLED, context.GateStatus{ULGate: context.GateOpen, DLGate: context.GateOpen}},
+		{models.FLOWSTATUS_DISABLED, context.GateStatus{ULGate: context.GateClose, DLGate: context.GateClose}},
+		{models.FLOWSTATUS_REMOVED, context.GateStatus{ULGate: context.GateClose, DLGate: context.GateClose}},
+		{models.FLOWSTATUS_ENABLED_UPLINK, context.GateStatus{ULGate: context.GateOpen, DLGate: context.GateClose}},
+		{models.FLOWSTATUS_ENABLED_DOWNLINK, context.GateStatus{ULGate: context.GateClose, DLGate: context.GateOpen}},
+	}
+
+	for _, tc := range testCases {
+		if got := context.NewGateStatus(tc.flowStatus); *got != tc.expected {
+			t.Errorf("flow status %q: expected %v, got %v", tc.flowStatus, tc.expected, *got)
+		}
+	}
+}
+
+func TestUpdatePccRuleGateStatus(t *testing.T) {
+	smContext := context.NewSMContext("imsi-208930000000001", 1)
+	smContext.SmPolicyData.SmCtxtPccRules.PccRules["rule-1"] = &models.PccRule{
+		PccRuleId: "rule-1",
+		RefTcData: []string{"tc-1"},
+	}
+
+	sessQer := &context.QER{QERID: 1, State: context.RULE_CREATE, GateStatus: context.NewGateStatus("")}
+	ruleQer := &context.QER{QERID: 2, State: context.RULE_CREATE, GateStatus: context.NewGateStatus("")}
+	otherQer := &context.QER{QERID: 3, State: context.RULE_CREATE, GateStatus: context.NewGateStatus("")}
+
+	node := context.NewDataPathNode()
+	node.UpLinkTunnel.PDR["rule-1"] = &context.PDR{QER: []*context.QER{ruleQer, sessQer}}
+	node.UpLinkTunnel.PDR["rule-2"] = &context.PDR{QER: []*context.QER{otherQer, sessQer}}
+
+	dataPath := context.NewDataPath()
+	dataPath.Activated = true
+	dataPath.FirstDPNode = node
+	smContext.Tunnel = context.NewUPTunnel()
+	smContext.Tunnel.AddDataPath(dataPath)
+
+	disabled := models.FLOWSTATUS_DISABLED
+	qers := smContext.UpdatePccRuleGateStatus(map[string]*models.TrafficControlData{
+		"tc-1": {TcId: "tc-1", FlowStatus: &disabled},
+	})
+
+	if len(qers) != 1 || qers[0] != ruleQer {
+		t.Fatalf("expected only the PCC rule QER to be updated, got %v", qers)
+	}
+	if ruleQer.State != context.RULE_UPDATE {
+		t.Errorf("expected QER state update, got %v", ruleQer.State)
+	}
+	if ruleQer.GateStatus.ULGate != context.GateClose || ruleQer.GateStatus.DLGate != context.GateClose {
+		t.Errorf("expected closed gates, got %v", ruleQer.GateStatus)
+	}
+	if sessQer.State != context.RULE_CREATE || sessQer.GateStatus.ULGate != context.GateOpen {
+		t.Errorf("expected shared session QER to be untouched")
+	}
+}
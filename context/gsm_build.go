@@ -10,6 +10,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/omec-project/nas/v2"
 	"github.com/omec-project/nas/v2/nasConvert"
@@ -25,6 +26,10 @@ const (
 )
 
 func BuildGSMPDUSessionEstablishmentAccept(smContext *SMContext) ([]byte, error) {
+	return buildGSMPDUSessionEstablishmentAccept(smContext, smContext.SmPolicyUpdates[0], smContext.Pti)
+}
+
+func buildGSMPDUSessionEstablishmentAccept(smContext *SMContext, policyUpdate *qos.PolicyUpdate, pti uint8) ([]byte, error) {
 	m := nas.NewMessage()
 	m.GsmMessage = nas.NewGsmMessage()
 	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionEstablishmentAccept)
@@ -32,12 +37,12 @@ func BuildGSMPDUSessionEstablishmentAccept(smContext *SMContext) ([]byte, error)
 	m.PDUSessionEstablishmentAccept = nasMessage.NewPDUSessionEstablishmentAccept(0x0)
 	pDUSessionEstablishmentAccept := m.PDUSessionEstablishmentAccept
 
-	sessRule := smContext.SmPolicyUpdates[0].SessRuleUpdate.ActiveSessRule
+	sessRule := policyUpdate.SessRuleUpdate.ActiveSessRule
 
 	pDUSessionEstablishmentAccept.SetPDUSessionID(uint8(smContext.PDUSessionID))
 	pDUSessionEstablishmentAccept.SetMessageType(nas.MsgTypePDUSessionEstablishmentAccept)
 	pDUSessionEstablishmentAccept.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
-	pDUSessionEstablishmentAccept.SetPTI(smContext.Pti)
+	pDUSessionEstablishmentAccept.SetPTI(pti)
 
 	if v := smContext.EstAcceptCause5gSMValue; v != 0 {
 		pDUSessionEstablishmentAccept.Cause5GSM = nasType.NewCause5GSM(nasMessage.PDUSessionEstablishmentAcceptCause5GSMType)
@@ -45,11 +50,15 @@ func BuildGSMPDUSessionEstablishmentAccept(smContext *SMContext) ([]byte, error)
 	}
 	pDUSessionEstablishmentAccept.SetPDUSessionType(smContext.SelectedPDUSessionType)
 
-	pDUSessionEstablishmentAccept.SetSSCMode(1)
+	pDUSessionEstablishmentAccept.SetSSCMode(smContext.sscMode())
 	pDUSessionEstablishmentAccept.SessionAMBR = nasConvert.ModelsToSessionAMBR(sessRule.AuthSessAmbr)
 	pDUSessionEstablishmentAccept.SessionAMBR.SetLen(uint8(len(pDUSessionEstablishmentAccept.SessionAMBR.Octet)))
 
-	qoSRules := qos.BuildQosRules(smContext.SmPolicyUpdates[0])
+	if smContext.RqosSupported {
+		pDUSessionEstablishmentAccept.RQTimerValue = buildRQTimerValue(nasMessage.PDUSessionEstablishmentAcceptRQTimerValueType)
+	}
+
+	qoSRules := qos.BuildQosRules(policyUpdate)
 
 	qosRulesBytes, err := qoSRules.MarshalBinary()
 	if err != nil {
@@ -68,9 +77,9 @@ func BuildGSMPDUSessionEstablishmentAccept(smContext *SMContext) ([]byte, error)
 	}
 
 	// Get Authorized QoS Flow Descriptions
-	authQfd := qos.BuildAuthorizedQosFlowDescriptions(smContext.SmPolicyUpdates[0])
+	authQfd := qos.BuildAuthorizedQosFlowDescriptions(policyUpdate)
 	// Add Default Qos Flow
-	// authQfd.AddDefaultQosFlowDescription(smContext.SmPolicyUpdates[0].SessRuleUpdate.ActiveSessRule)
+	// authQfd.AddDefaultQosFlowDescription(policyUpdate.SessRuleUpdate.ActiveSessRule)
 
 	pDUSessionEstablishmentAccept.AuthorizedQosFlowDescriptions = nasType.NewAuthorizedQosFlowDescriptions(nasMessage.PDUSessionEstablishmentAcceptAuthorizedQosFlowDescriptionsType)
 	pDUSessionEstablishmentAccept.AuthorizedQosFlowDescriptions.SetLen(authQfd.IeLen)
@@ -156,10 +165,39 @@ func BuildGSMPDUSessionEstablishmentAccept(smContext *SMContext) ([]byte, error)
 			SetLen(uint16(pcoContentsLength))
 		pDUSessionEstablishmentAccept.SetExtendedProtocolConfigurationOptionsContents(pcoContents)
 	}
-	return m.PlainNasEncode()
+
+	// EAP-Success of the secondary authentication
+	if eap := smContext.secondaryAuthEapMessage(); eap != nil {
+		pDUSessionEstablishmentAccept.EAPMessage = buildEAPMessage(nasMessage.PDUSessionEstablishmentAcceptEAPMessageType, eap)
+	}
+	buf, err := m.PlainNasEncode()
+	if err != nil || smContext.MaPdu == nil {
+		return buf, err
+	}
+	// ATSSS container, the last IE of the PDU Session Establishment Accept
+	atsssContainer, err := buildAtsssContainer(smContext, policyUpdate)
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, atsssContainer...), nil
 }
 
 func BuildGSMPDUSessionEstablishmentReject(smContext *SMContext, cause uint8) ([]byte, error) {
+	return buildGSMPDUSessionEstablishmentReject(smContext, cause,
+		buildBackoffTimerValue(smContext, nasMessage.PDUSessionEstablishmentRejectBackoffTimerValueType, cause))
+}
+
+// BuildGSMPDUSessionEstablishmentRejectDnnUnavailable rejects with cause #26 the PDU
+// session of a DNN unable to serve it, no UE address left in the pool or no UPF
+// available, with the T3396 back-off timer whether congestion control is active or not
+func BuildGSMPDUSessionEstablishmentRejectDnnUnavailable(smContext *SMContext) ([]byte, error) {
+	return buildGSMPDUSessionEstablishmentReject(smContext, nasMessage.Cause5GSMInsufficientResources,
+		buildDnnBackoffTimerValue(nasMessage.PDUSessionEstablishmentRejectBackoffTimerValueType))
+}
+
+func buildGSMPDUSessionEstablishmentReject(smContext *SMContext, cause uint8,
+	backoffTimer *nasType.BackoffTimerValue,
+) ([]byte, error) {
 	m := nas.NewMessage()
 	m.GsmMessage = nas.NewGsmMessage()
 	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionEstablishmentReject)
@@ -172,10 +210,43 @@ func BuildGSMPDUSessionEstablishmentReject(smContext *SMContext, cause uint8) ([
 	pDUSessionEstablishmentReject.SetPDUSessionID(uint8(smContext.PDUSessionID))
 	pDUSessionEstablishmentReject.SetCauseValue(cause)
 	pDUSessionEstablishmentReject.SetPTI(smContext.Pti)
+	pDUSessionEstablishmentReject.BackoffTimerValue = backoffTimer
+
+	// EAP-Failure of the secondary authentication
+	if eap := smContext.secondaryAuthEapMessage(); eap != nil {
+		pDUSessionEstablishmentReject.EAPMessage = buildEAPMessage(nasMessage.PDUSessionEstablishmentRejectEAPMessageType, eap)
+	}
+
+	return m.PlainNasEncode()
+}
+
+// BuildGSMPDUSessionAuthenticationCommand carries the EAP request of the
+// DN-AAA server to the UE, TS 24.501 8.3.4
+func BuildGSMPDUSessionAuthenticationCommand(smContext *SMContext, eap []byte) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GsmMessage = nas.NewGsmMessage()
+	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionAuthenticationCommand)
+	m.GsmHeader.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	m.PDUSessionAuthenticationCommand = nasMessage.NewPDUSessionAuthenticationCommand(0x0)
+	pDUSessionAuthenticationCommand := m.PDUSessionAuthenticationCommand
+
+	pDUSessionAuthenticationCommand.SetMessageType(nas.MsgTypePDUSessionAuthenticationCommand)
+	pDUSessionAuthenticationCommand.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	pDUSessionAuthenticationCommand.SetPDUSessionID(uint8(smContext.PDUSessionID))
+	pDUSessionAuthenticationCommand.SetPTI(PTI)
+	pDUSessionAuthenticationCommand.EAPMessage.SetLen(uint16(len(eap)))
+	pDUSessionAuthenticationCommand.SetEAPMessage(eap)
 
 	return m.PlainNasEncode()
 }
 
+func buildEAPMessage(iei uint8, eap []byte) *nasType.EAPMessage {
+	eapMessage := nasType.NewEAPMessage(iei)
+	eapMessage.SetLen(uint16(len(eap)))
+	eapMessage.SetEAPMessage(eap)
+	return eapMessage
+}
+
 /*func BuildGSMPDUSessionModificationReject(smContext *SMContext, cause uint8) ([]byte, error) {
 	m := nas.NewMessage()
 	m.GsmMessage = nas.NewGsmMessage()
@@ -192,7 +263,7 @@ func BuildGSMPDUSessionEstablishmentReject(smContext *SMContext, cause uint8) ([
 	return m.PlainNasEncode()
 }*/
 
-func BuildGSMPDUSessionReleaseCommand(smContext *SMContext) ([]byte, error) {
+func BuildGSMPDUSessionReleaseCommand(smContext *SMContext, cause uint8) ([]byte, error) {
 	m := nas.NewMessage()
 	m.GsmMessage = nas.NewGsmMessage()
 	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionReleaseCommand)
@@ -204,7 +275,8 @@ func BuildGSMPDUSessionReleaseCommand(smContext *SMContext) ([]byte, error) {
 	pDUSessionReleaseCommand.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
 	pDUSessionReleaseCommand.SetPDUSessionID(uint8(smContext.PDUSessionID))
 	pDUSessionReleaseCommand.SetPTI(smContext.Pti)
-	pDUSessionReleaseCommand.SetCauseValue(0x0)
+	pDUSessionReleaseCommand.SetCauseValue(cause)
+	pDUSessionReleaseCommand.BackoffTimerValue = buildBackoffTimerValue(smContext, nasMessage.PDUSessionReleaseCommandBackoffTimerValueType, cause)
 
 	return m.PlainNasEncode()
 }
@@ -309,6 +381,34 @@ func BuildGSMPDUSessionModificationCommand(smContext *SMContext) ([]byte, error)
 	return encoded, nil
 }
 
+// BuildGSMPDUSessionAddressLifetimeCommand builds the PDU Session
+// Modification Command asking the UE to establish a PDU session on a new PSA,
+// the PDU session being kept for the address lifetime, TS 23.502 4.3.5.2
+func BuildGSMPDUSessionAddressLifetimeCommand(smContext *SMContext, lifetime time.Duration) ([]byte, error) {
+	m := nas.NewMessage()
+	m.GsmMessage = nas.NewGsmMessage()
+	m.GsmHeader.SetMessageType(nas.MsgTypePDUSessionModificationCommand)
+	m.GsmHeader.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	m.PDUSessionModificationCommand = nasMessage.NewPDUSessionModificationCommand(0x0)
+	pDUSessionModificationCommand := m.PDUSessionModificationCommand
+
+	pDUSessionModificationCommand.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSSessionManagementMessage)
+	pDUSessionModificationCommand.SetPDUSessionID(uint8(smContext.PDUSessionID))
+	pDUSessionModificationCommand.SetPTI(PTI)
+	pDUSessionModificationCommand.SetMessageType(nas.MsgTypePDUSessionModificationCommand)
+
+	pDUSessionModificationCommand.Cause5GSM = nasType.NewCause5GSM(nasMessage.PDUSessionModificationCommandCause5GSMType)
+	pDUSessionModificationCommand.SetCauseValue(nasMessage.Cause5GSMReactivationRequested)
+
+	pcoContents := pduSessionAddressLifetime(lifetime)
+	pDUSessionModificationCommand.ExtendedProtocolConfigurationOptions = nasType.NewExtendedProtocolConfigurationOptions(
+		nasMessage.PDUSessionModificationCommandExtendedProtocolConfigurationOptionsType)
+	pDUSessionModificationCommand.ExtendedProtocolConfigurationOptions.SetLen(uint16(len(pcoContents)))
+	pDUSessionModificationCommand.SetExtendedProtocolConfigurationOptionsContents(pcoContents)
+
+	return m.PlainNasEncode()
+}
+
 func BuildGSMPDUSessionReleaseReject(smContext *SMContext) ([]byte, error) {
 	m := nas.NewMessage()
 	m.GsmMessage = nas.NewGsmMessage()
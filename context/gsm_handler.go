@@ -49,6 +49,23 @@ func (smContext *SMContext) HandlePDUSessionEstablishmentRequest(req *nasMessage
 		return err
 	}
 
+	var requestedSscMode uint8
+	if req.SSCMode != nil {
+		requestedSscMode = req.GetSSCMode()
+	}
+	smContext.selectSscMode(requestedSscMode)
+
+	if req.Capability5GSM != nil {
+		smContext.RqosSupported = req.Capability5GSM.GetRqoS() == 1
+		smContext.SubGsmLog.Infof("UE reflective QoS support: %v", smContext.RqosSupported)
+		smContext.SetAtsssCapability(req.Capability5GSM.Octet[0])
+	}
+
+	if req.SMPDUDNRequestContainer != nil {
+		// DN-specific identity of the UE for the DN-AAA server, TS 24.501 9.11.4.15
+		smContext.secondaryAuth().UserName = string(req.GetDNSpecificIdentity())
+	}
+
 	if req.ExtendedProtocolConfigurationOptions != nil {
 		EPCOContents := req.GetExtendedProtocolConfigurationOptionsContents()
 		protocolConfigurationOptions := nasConvert.NewProtocolConfigurationOptions()
@@ -86,7 +103,7 @@ func (smContext *SMContext) HandlePDUSessionEstablishmentRequest(req *nasMessage
 			case nasMessage.IPAddressAllocationViaNASSignallingUL:
 				smContext.SubGsmLog.Infoln("Didn't Implement container type IPAddressAllocationViaNASSignallingUL")
 			case nasMessage.IPv4AddressAllocationViaDHCPv4UL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type IPv4AddressAllocationViaDHCPv4UL")
+				smContext.ProtocolConfigurationOptions.DHCPv4Request = true
 			case nasMessage.PCSCFIPv4AddressRequestUL:
 				smContext.ProtocolConfigurationOptions.PCSCFIPv4Request = true
 				smContext.SubGsmLog.Infoln("PCSCFIPv4AddressRequestUL has been set true")
@@ -133,9 +150,13 @@ func (smContext *SMContext) HandlePDUSessionEstablishmentRequest(req *nasMessage
 			case nasMessage.LinkControlProtocolUL:
 				smContext.SubGsmLog.Infoln("Didn't Implement container type LinkControlProtocolUL")
 			case nasMessage.PushAccessControlProtocolUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type PushAccessControlProtocolUL")
+				if err := smContext.HandlePapPco(container.Contents); err != nil {
+					smContext.SubGsmLog.Warnf("parsing PAP container failed: %v", err)
+				}
 			case nasMessage.ChallengeHandshakeAuthenticationProtocolUL:
-				smContext.SubGsmLog.Infoln("Didn't Implement container type ChallengeHandshakeAuthenticationProtocolUL")
+				if err := smContext.HandleChapPco(container.Contents); err != nil {
+					smContext.SubGsmLog.Warnf("parsing CHAP container failed: %v", err)
+				}
 			case nasMessage.InternetProtocolControlProtocolUL:
 				smContext.SubGsmLog.Infoln("Didn't Implement container type InternetProtocolControlProtocolUL")
 			case nasMessage.IPv4LinkMTURequestUL:
@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import "net"
+
+// HandoverTarget is the downlink tunnel of the target AN of an N2 handover,
+// used by the PDU session once the handover completes
+type HandoverTarget struct {
+	IPAddress net.IP
+	TEID      uint32
+}
+
+// CompleteHandover moves the AN tunnel of the PDU session to the target AN
+// of the handover. The caller holds the SMLock.
+func (smContext *SMContext) CompleteHandover() {
+	target := smContext.handoverTarget
+	if target == nil {
+		return
+	}
+	smContext.handoverTarget = nil
+	smContext.Tunnel.ANInformation.IPAddress = target.IPAddress
+	smContext.Tunnel.ANInformation.TEID = target.TEID
+}
+
+// CancelHandover points the downlink of the PDU session back to the source
+// AN after a cancelled or failed handover, TS 23.502 4.9.1.4. It returns
+// false if the downlink was not moved to the target AN. The FARs to restore
+// on the UPF are left in the RULE_UPDATE state. The caller holds the SMLock.
+func (smContext *SMContext) CancelHandover() bool {
+	if smContext.handoverTarget == nil {
+		return false
+	}
+	smContext.handoverTarget = nil
+	anInformation := smContext.Tunnel.ANInformation
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		if !dataPath.Activated {
+			continue
+		}
+		for _, pdr := range dataPath.FirstDPNode.DownLinkTunnel.PDR {
+			if pdr.FAR.ForwardingParameters == nil {
+				continue
+			}
+			if anInformation.IPAddress == nil {
+				pdr.FAR.ForwardingParameters.OuterHeaderCreation = nil
+			} else {
+				pdr.FAR.ForwardingParameters.OuterHeaderCreation = &OuterHeaderCreation{
+					OuterHeaderCreationDescription: OuterHeaderCreationGtpUUdpIpv4,
+					Teid:                           anInformation.TEID,
+					Ipv4Address:                    anInformation.IPAddress.To4(),
+				}
+			}
+			pdr.FAR.State = RULE_UPDATE
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"net"
+	"testing"
+)
+
+// setupHandover moves the downlink of the SM context to the target AN and
+// returns the downlink FAR
+func setupHandover(smContext *SMContext) *FAR {
+	node := NewDataPathNode()
+	far := &FAR{
+		ApplyAction: ApplyAction{Forw: true},
+		ForwardingParameters: &ForwardingParameters{
+			DestinationInterface: DestinationInterface{InterfaceValue: DestinationInterfaceAccess},
+			OuterHeaderCreation: &OuterHeaderCreation{
+				OuterHeaderCreationDescription: OuterHeaderCreationGtpUUdpIpv4,
+				Teid:                           8,
+				Ipv4Address:                    net.ParseIP("192.168.1.2").To4(),
+			},
+		},
+		State: RULE_CREATE,
+	}
+	node.DownLinkTunnel.PDR["default"] = &PDR{FAR: far}
+	addTestDefaultPath(smContext, node)
+	smContext.Tunnel.ANInformation.IPAddress = net.ParseIP("192.168.1.1")
+	smContext.Tunnel.ANInformation.TEID = 7
+	smContext.handoverTarget = &HandoverTarget{IPAddress: net.ParseIP("192.168.1.2"), TEID: 8}
+	return far
+}
+
+func TestCancelHandover(t *testing.T) {
+	smContext := newTestSMContext(t, "imsi-208930000000001", "internet")
+	far := setupHandover(smContext)
+
+	if !smContext.CancelHandover() {
+		t.Fatalf("expected the downlink moved back to the source AN")
+	}
+	ohc := far.ForwardingParameters.OuterHeaderCreation
+	if far.State != RULE_UPDATE || ohc.Teid != 7 || !ohc.Ipv4Address.Equal(net.ParseIP("192.168.1.1")) {
+		t.Errorf("expected the downlink FAR to the source AN, got %+v", far)
+	}
+	if smContext.CancelHandover() {
+		t.Errorf("expected nothing to cancel")
+	}
+}
+
+func TestCompleteHandover(t *testing.T) {
+	smContext := newTestSMContext(t, "imsi-208930000000001", "internet")
+	setupHandover(smContext)
+
+	smContext.CompleteHandover()
+	anInformation := smContext.Tunnel.ANInformation
+	if anInformation.TEID != 8 || !anInformation.IPAddress.Equal(net.ParseIP("192.168.1.2")) {
+		t.Errorf("expected the AN tunnel of the target AN, got %+v", anInformation)
+	}
+	if smContext.CancelHandover() {
+		t.Errorf("expected no handover to cancel once completed")
+	}
+}
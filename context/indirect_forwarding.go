@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"fmt"
+	"net"
+)
+
+// IndirectForwarding is the indirect data forwarding tunnel of an N2
+// handover, from the source AN to the target AN through the UPF serving the
+// source AN, TS 23.502 4.9.1.3.2
+type IndirectForwarding struct {
+	Node *DataPathNode
+	PDR  *PDR
+	// Tunnel endpoint allocated by the UPF to the source AN
+	TEID uint32
+	IP   net.IP
+	// QoS flows the target AN accepted to forward
+	QosFlows []int64
+}
+
+// SetupIndirectForwarding creates the PDR and FAR forwarding the data of the
+// source AN to the DL forwarding tunnel of the target AN. The PDR is to be
+// sent in a PFCP Session Modification Request, whose response carries the
+// tunnel endpoint allocated by the UPF. The caller holds the SMLock.
+func (smContext *SMContext) SetupIndirectForwarding(targetIP net.IP, targetTEID uint32, qosFlows []int64) (*PDR, error) {
+	if smContext.indirectForwarding != nil {
+		return nil, fmt.Errorf("indirect forwarding tunnel already set up")
+	}
+	dataPath := smContext.Tunnel.DataPathPool.GetDefaultPath()
+	if dataPath == nil || dataPath.FirstDPNode == nil {
+		return nil, fmt.Errorf("no default data path")
+	}
+	node := dataPath.FirstDPNode
+	pdr, err := node.UPF.AddPDR()
+	if err != nil {
+		return nil, err
+	}
+	pdr.Precedence = 255
+	pdr.PDI = PDI{
+		SourceInterface: SourceInterface{InterfaceValue: SourceInterfaceAccess},
+		LocalFTeid:      &FTEID{Ch: true},
+		NetworkInstance: []byte(smContext.Dnn),
+	}
+	pdr.OuterHeaderRemoval = &OuterHeaderRemoval{
+		OuterHeaderRemovalDescription: OuterHeaderRemovalGtpUUdpIpv4,
+	}
+	pdr.FAR.ApplyAction = ApplyAction{Forw: true}
+	pdr.FAR.ForwardingParameters = &ForwardingParameters{
+		DestinationInterface: DestinationInterface{InterfaceValue: DestinationInterfaceAccess},
+		NetworkInstance:      []byte(smContext.Dnn),
+		OuterHeaderCreation: &OuterHeaderCreation{
+			OuterHeaderCreationDescription: OuterHeaderCreationGtpUUdpIpv4,
+			Teid:                           targetTEID,
+			Ipv4Address:                    targetIP.To4(),
+		},
+	}
+	if err = smContext.PutPDRtoPFCPSession(node.UPF.NodeID, map[string]*PDR{"forwarding": pdr}); err != nil {
+		smContext.releaseForwardingRules(node, pdr)
+		return nil, err
+	}
+	smContext.indirectForwarding = &IndirectForwarding{Node: node, PDR: pdr, QosFlows: qosFlows}
+	return pdr, nil
+}
+
+// StoreForwardingFTEID stores the tunnel endpoint the UPF allocated to the
+// indirect forwarding PDR, false if the PDR is not the forwarding PDR
+func (smContext *SMContext) StoreForwardingFTEID(nodeID NodeID, pdrID uint16, teid uint32, ip net.IP) bool {
+	forwarding := smContext.indirectForwarding
+	if forwarding == nil || forwarding.PDR.PDRID != pdrID ||
+		!forwarding.Node.UPF.NodeID.ResolveNodeIdToIp().Equal(nodeID.ResolveNodeIdToIp()) {
+		return false
+	}
+	forwarding.TEID = teid
+	forwarding.IP = ip
+	return true
+}
+
+// IndirectForwarding returns the indirect forwarding tunnel of the ongoing N2
+// handover, nil if there is none. The caller holds the SMLock.
+func (smContext *SMContext) IndirectForwarding() *IndirectForwarding {
+	return smContext.indirectForwarding
+}
+
+// ReleaseIndirectForwarding releases the indirect forwarding tunnel and
+// returns its node and PDR to remove from the PFCP session, nil if there is
+// none. The caller holds the SMLock.
+func (smContext *SMContext) ReleaseIndirectForwarding() (*DataPathNode, *PDR) {
+	forwarding := smContext.indirectForwarding
+	if forwarding == nil {
+		return nil, nil
+	}
+	smContext.indirectForwarding = nil
+	smContext.RemovePDRfromPFCPSession(forwarding.Node.UPF.NodeID, forwarding.PDR)
+	smContext.releaseForwardingRules(forwarding.Node, forwarding.PDR)
+	return forwarding.Node, forwarding.PDR
+}
+
+func (smContext *SMContext) releaseForwardingRules(node *DataPathNode, pdr *PDR) {
+	if err := node.UPF.RemovePDR(pdr); err != nil {
+		smContext.SubPduSessLog.Warnf("release forwarding PDR: %v", err)
+	}
+	if err := node.UPF.RemoveFAR(pdr.FAR); err != nil {
+		smContext.SubPduSessLog.Warnf("release forwarding FAR: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIndirectForwarding(t *testing.T) {
+	upf := NewUPF(NewNodeID("10.0.7.1"), nil)
+	upf.UPFStatus = AssociatedSetUpSuccess
+	node := NewDataPathNode()
+	node.UPF = upf
+	dataPath := &DataPath{IsDefaultPath: true, FirstDPNode: node}
+
+	smContext := &SMContext{
+		Dnn:         "internet",
+		Tunnel:      NewUPTunnel(),
+		PFCPContext: map[string]*PFCPSessionContext{"10.0.7.1": {PDRs: make(map[uint16]*PDR)}},
+	}
+	smContext.initLogTags()
+	smContext.Tunnel.AddDataPath(dataPath)
+
+	pdr, err := smContext.SetupIndirectForwarding(net.ParseIP("192.168.1.2"), 9, []int64{1})
+	if err != nil {
+		t.Fatalf("set up indirect forwarding: %v", err)
+	}
+	if pdr.PDI.LocalFTeid == nil || !pdr.PDI.LocalFTeid.Ch {
+		t.Errorf("expected the F-TEID of the forwarding PDR chosen by the UPF")
+	}
+	ohc := pdr.FAR.ForwardingParameters.OuterHeaderCreation
+	if !pdr.FAR.ApplyAction.Forw || ohc.Teid != 9 || !ohc.Ipv4Address.Equal(net.ParseIP("192.168.1.2")) {
+		t.Errorf("expected the forwarding FAR to the target AN, got %+v", pdr.FAR)
+	}
+	if _, ok := smContext.PFCPContext["10.0.7.1"].PDRs[pdr.PDRID]; !ok {
+		t.Errorf("expected the forwarding PDR in the PFCP session")
+	}
+	if _, err = smContext.SetupIndirectForwarding(net.ParseIP("192.168.1.2"), 9, nil); err == nil {
+		t.Errorf("expected a single indirect forwarding tunnel")
+	}
+
+	if smContext.StoreForwardingFTEID(*NewNodeID("10.0.7.2"), pdr.PDRID, 5, net.ParseIP("10.0.3.1")) {
+		t.Errorf("expected the F-TEID of another UPF ignored")
+	}
+	if smContext.StoreForwardingFTEID(*NewNodeID("10.0.7.1"), pdr.PDRID+1, 5, net.ParseIP("10.0.3.1")) {
+		t.Errorf("expected the F-TEID of another PDR ignored")
+	}
+	if !smContext.StoreForwardingFTEID(*NewNodeID("10.0.7.1"), pdr.PDRID, 5, net.ParseIP("10.0.3.1")) {
+		t.Fatalf("expected the F-TEID of the forwarding PDR stored")
+	}
+	if forwarding := smContext.IndirectForwarding(); forwarding.TEID != 5 || !forwarding.IP.Equal(net.ParseIP("10.0.3.1")) {
+		t.Errorf("expected the forwarding tunnel endpoint stored, got %+v", forwarding)
+	}
+
+	releasedNode, releasedPDR := smContext.ReleaseIndirectForwarding()
+	if releasedNode != node || releasedPDR != pdr {
+		t.Errorf("expected the forwarding PDR released")
+	}
+	if _, ok := smContext.PFCPContext["10.0.7.1"].PDRs[pdr.PDRID]; ok {
+		t.Errorf("expected the forwarding PDR removed from the PFCP session")
+	}
+	if smContext.IndirectForwarding() != nil {
+		t.Errorf("expected no indirect forwarding tunnel")
+	}
+	if _, releasedPDR = smContext.ReleaseIndirectForwarding(); releasedPDR != nil {
+		t.Errorf("expected nothing to release")
+	}
+}
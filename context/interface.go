@@ -15,6 +15,13 @@ const (
 	DestinationInterfaceSgiLanN6Lan
 )
 
+// 3GPP Interface Type of the N3 rules of the non-3GPP access PDU sessions,
+// TS 29.244 8.2.118
+const (
+	TgppInterfaceTypeN3TrustedNon3GppAccess   uint8 = 12
+	TgppInterfaceTypeN3UntrustedNon3GppAccess uint8 = 13
+)
+
 type SourceInterface struct {
 	InterfaceValue uint8 // 0x00001111
 }
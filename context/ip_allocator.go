@@ -6,15 +6,36 @@
 package context
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"math/bits"
+	"math/rand/v2"
 	"net"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 
+	"github.com/omec-project/smf/factory"
 	"github.com/omec-project/smf/logger"
 )
 
+// ErrStaticIpConflict is returned for a subscribed static address outside of
+// the pools of the DNN or in use by another UE
+var ErrStaticIpConflict = errors.New("static IP conflict")
+
+// Allocation strategies of the UE addresses of a pool
+const (
+	// AllocationSequential allocates the next free address after the last
+	// allocated one, so released addresses are reused last
+	AllocationSequential = "sequential"
+	// AllocationRandom allocates a free address at random
+	AllocationRandom = "random"
+	// AllocationSticky allocates again the last address of the UE when free
+	AllocationSticky = "sticky"
+)
+
 type IPAllocator struct {
 	ipNetwork *net.IPNet
 	g         *_IDPool
@@ -33,6 +54,97 @@ func NewIPAllocator(cidr string) (*IPAllocator, error) {
 	return allocator, nil
 }
 
+// newConfiguredIPAllocator returns an allocator of the pool with the strategy
+// and excluded ranges of the configuration, the pool ones taking precedence
+func newConfiguredIPAllocator(cidr string, allocation *factory.UeIpAllocation, pool *factory.UeIpPool) (*IPAllocator, error) {
+	allocator, err := NewIPAllocator(cidr)
+	if err != nil {
+		return nil, err
+	}
+	var strategy string
+	var excludedRanges []string
+	if allocation != nil {
+		strategy = allocation.Strategy
+		excludedRanges = append(excludedRanges, allocation.ExcludedRanges...)
+	}
+	if pool != nil {
+		if pool.Strategy != "" {
+			strategy = pool.Strategy
+		}
+		excludedRanges = append(excludedRanges, pool.ExcludedRanges...)
+	}
+	if err := allocator.SetStrategy(strategy); err != nil {
+		return nil, err
+	}
+	if err := allocator.ExcludeRanges(excludedRanges); err != nil {
+		return nil, err
+	}
+	return allocator, nil
+}
+
+// SetStrategy selects how the addresses are allocated, sequential if empty
+func (a *IPAllocator) SetStrategy(strategy string) error {
+	switch strategy {
+	case "":
+		strategy = AllocationSequential
+	case AllocationSequential, AllocationRandom, AllocationSticky:
+	default:
+		return fmt.Errorf("unknown allocation strategy %q", strategy)
+	}
+	a.g.lock.Lock()
+	defer a.g.lock.Unlock()
+	a.g.strategy = strategy
+	return nil
+}
+
+// ExcludeRanges removes addresses from allocation, e.g. gateway addresses.
+// A range is a CIDR, an address or first-last addresses. The addresses
+// outside of the pool are ignored.
+func (a *IPAllocator) ExcludeRanges(ranges []string) error {
+	for _, r := range ranges {
+		first, last, err := parseIPRange(r)
+		if err != nil {
+			return err
+		}
+		if first.To4() == nil || last.To4() == nil {
+			continue
+		}
+		a.g.exclude(a.offset(first), a.offset(last))
+	}
+	return nil
+}
+
+func parseIPRange(r string) (first, last net.IP, err error) {
+	if strings.Contains(r, "/") {
+		_, ipNet, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		last = make(net.IP, len(ipNet.IP))
+		for i := range ipNet.IP {
+			last[i] = ipNet.IP[i] | ^ipNet.Mask[i]
+		}
+		return ipNet.IP, last, nil
+	}
+	if firstStr, lastStr, ok := strings.Cut(r, "-"); ok {
+		first, last = net.ParseIP(strings.TrimSpace(firstStr)), net.ParseIP(strings.TrimSpace(lastStr))
+	} else {
+		first = net.ParseIP(strings.TrimSpace(r))
+		last = first
+	}
+	if first == nil || last == nil {
+		return nil, nil, fmt.Errorf("invalid IP range %q", r)
+	}
+	return first, last, nil
+}
+
+// offset returns the offset of the IPv4 address from the pool network address,
+// negative or past the pool for an address outside of the pool
+func (a *IPAllocator) offset(ip net.IP) int64 {
+	base := binary.BigEndian.Uint32(a.ipNetwork.IP.To4())
+	return int64(binary.BigEndian.Uint32(ip.To4())) - int64(base)
+}
+
 func maskBits(mask net.IPMask) int {
 	var cnt int
 	for _, b := range mask {
@@ -86,7 +198,7 @@ func (a *IPAllocator) Allocate(imsi string) (net.IP, error) {
 		}
 	}
 
-	if offset, err := a.g.allocate(); err != nil {
+	if offset, err := a.g.allocate(imsi); err != nil {
 		return nil, errors.New("ip allocation failed" + err.Error())
 	} else {
 		smfCountStr := os.Getenv("SMF_COUNT")
@@ -98,9 +210,7 @@ func (a *IPAllocator) Allocate(imsi string) (net.IP, error) {
 			logger.CtxLog.Errorf("failed to convert SMF_COUNT to int: %v", err)
 		}
 		ip := IPAddrWithOffset(a.ipNetwork.IP, int(offset)+(smfCount-1)*5000)
-		logger.CtxLog.Infof("unique id - ip %v", ip)
-		logger.CtxLog.Infof("unique id - offset %v", offset)
-		logger.CtxLog.Infof("unique id - smfCount %v", smfCount)
+		logger.CtxLog.Debugf("unique id - ip %v, offset %v, smfCount %v", ip, offset, smfCount)
 		return ip, nil
 	}
 }
@@ -121,10 +231,16 @@ func (a *IPAllocator) BlockIp(ip net.IP) {
 }
 
 func (a *IPAllocator) Release(imsi string, ip net.IP) {
+	if !a.Contains(ip) {
+		return
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
 	// Don't release static IPs
 	if a.g.staticIps != nil {
 		staticIps := *a.g.staticIps
-		if ipStr := staticIps[imsi]; ipStr != "" {
+		if ipStr := staticIps[imsi]; ipStr != "" && net.ParseIP(ipStr).Equal(ip) {
 			return
 		}
 	}
@@ -133,55 +249,270 @@ func (a *IPAllocator) Release(imsi string, ip net.IP) {
 	a.g.release(int64(offset))
 }
 
+// ReserveSubscribedIp blocks the static address of the UE subscription data
+// in the pool. The address is held until the last PDU session using it is
+// released.
+func (a *IPAllocator) ReserveSubscribedIp(imsi string, ip net.IP) error {
+	v4 := ip.To4()
+	if v4 == nil || !a.Contains(v4) {
+		return fmt.Errorf("%w: IP[%s] outside of pool %s", ErrStaticIpConflict, ip.String(), a.ipNetwork.String())
+	}
+	offset := int64(IPAddrOffset(v4, a.ipNetwork.IP))
+	if offset < a.g.minValue || offset > a.g.maxValue {
+		return fmt.Errorf("%w: IP[%s] is not a host address of pool %s", ErrStaticIpConflict, ip.String(), a.ipNetwork.String())
+	}
+	if a.g.staticIps != nil {
+		for staticImsi, ipStr := range *a.g.staticIps {
+			if !net.ParseIP(ipStr).Equal(v4) {
+				continue
+			}
+			if staticImsi != imsi {
+				return fmt.Errorf("%w: IP[%s] configured as static IP of %s", ErrStaticIpConflict, ip.String(), staticImsi)
+			}
+			// already blocked for the UE
+			return nil
+		}
+	}
+
+	a.g.lock.Lock()
+	defer a.g.lock.Unlock()
+	if owner := a.g.subscribed[offset]; owner != nil {
+		if owner.imsi != imsi {
+			return fmt.Errorf("%w: IP[%s] subscribed by %s", ErrStaticIpConflict, ip.String(), owner.imsi)
+		}
+		owner.sessions++
+		return nil
+	}
+	if a.g.isExcluded(offset) {
+		return fmt.Errorf("%w: IP[%s] excluded from pool %s", ErrStaticIpConflict, ip.String(), a.ipNetwork.String())
+	}
+	if a.g.isSet(offset - a.g.minValue) {
+		return fmt.Errorf("%w: IP[%s] already allocated to another UE", ErrStaticIpConflict, ip.String())
+	}
+	a.g.setBit(offset - a.g.minValue)
+	a.g.used++
+	a.g.subscribed[offset] = &subscribedIp{imsi: imsi, sessions: 1}
+	return nil
+}
+
+// Usage returns the number of addresses of the pool and of the allocated ones
+func (a *IPAllocator) Usage() (size, allocated int64) {
+	a.g.lock.Lock()
+	defer a.g.lock.Unlock()
+	return a.g.size() - a.g.excludedN, a.g.used
+}
+
+// Contains reports whether the address belongs to the pool
+func (a *IPAllocator) Contains(ip net.IP) bool {
+	return a.ipNetwork.Contains(ip)
+}
+
+// subscribedIp is a static address of the UE subscription data
+type subscribedIp struct {
+	imsi     string
+	sessions int
+}
+
+// idRange is a range of excluded IDs
+type idRange struct {
+	first, last int64
+}
+
+// _IDPool tracks the used IDs in a bitmap, one bit per ID, and the full words
+// of the bitmap in a summary bitmap so that the search of a free ID skips
+// 4096 used IDs per summary word.
 type _IDPool struct {
-	staticIps *map[string]string // map of [imsi]ip
-	isUsed    map[int64]bool
-	minValue  int64
-	maxValue  int64
-	index     int64
-	lock      sync.Mutex
+	staticIps  *map[string]string      // map of [imsi]ip
+	subscribed map[int64]*subscribedIp // static IPs from the UDM
+	sticky     map[string]int64        // last ID of each imsi, sticky strategy
+	bitmap     []uint64
+	full       []uint64
+	excluded   []idRange
+	strategy   string
+	minValue   int64
+	maxValue   int64
+	index      int64
+	used       int64
+	excludedN  int64
+	lock       sync.Mutex
 }
 
 func newIDPool(minValue int64, maxValue int64) (idPool *_IDPool) {
 	idPool = new(_IDPool)
 	idPool.minValue = minValue
 	idPool.maxValue = maxValue
-	idPool.isUsed = make(map[int64]bool)
-	idPool.index = 1
+	idPool.subscribed = make(map[int64]*subscribedIp)
+	idPool.sticky = make(map[string]int64)
+	idPool.strategy = AllocationSequential
+	idPool.index = minValue
+
+	n := idPool.size()
+	idPool.bitmap = make([]uint64, (n+63)/64)
+	idPool.full = make([]uint64, (len(idPool.bitmap)+63)/64)
+	// the bits past the last ID are never free
+	for bit := n; bit < int64(len(idPool.bitmap))*64; bit++ {
+		idPool.setBit(bit)
+	}
 	return
 }
 
-func (i *_IDPool) allocate() (id int64, err error) {
-	i.lock.Lock()
-	defer i.lock.Unlock()
+func (i *_IDPool) size() int64 {
+	if i.maxValue < i.minValue {
+		return 0
+	}
+	return i.maxValue - i.minValue + 1
+}
 
-	for id = i.index; id <= i.maxValue; id++ {
-		if _, exist := i.isUsed[id]; !exist {
-			i.isUsed[id] = true
-			i.index = (id % i.maxValue) + 1
-			return id, nil
+func (i *_IDPool) inRange(id int64) bool {
+	return id >= i.minValue && id <= i.maxValue
+}
+
+func (i *_IDPool) isSet(bit int64) bool {
+	return i.bitmap[bit/64]&(1<<(bit%64)) != 0
+}
+
+func (i *_IDPool) setBit(bit int64) {
+	w := bit / 64
+	i.bitmap[w] |= 1 << (bit % 64)
+	if i.bitmap[w] == ^uint64(0) {
+		i.full[w/64] |= 1 << (w % 64)
+	}
+}
+
+func (i *_IDPool) clearBit(bit int64) {
+	w := bit / 64
+	i.bitmap[w] &^= 1 << (bit % 64)
+	i.full[w/64] &^= 1 << (w % 64)
+}
+
+// nextNonFullWord returns the first word from w with a free bit, -1 if none
+func (i *_IDPool) nextNonFullWord(w int64) int64 {
+	words := int64(len(i.bitmap))
+	for s := w / 64; s*64 < words; s++ {
+		notFull := ^i.full[s]
+		if s == w/64 {
+			notFull &= ^uint64(0) << (w % 64)
+		}
+		if notFull != 0 {
+			if next := s*64 + int64(bits.TrailingZeros64(notFull)); next < words {
+				return next
+			}
+			return -1
 		}
 	}
+	return -1
+}
+
+// scan returns the first free bit in [from, to)
+func (i *_IDPool) scan(from, to int64) (int64, bool) {
+	for w := from / 64; w*64 < to; w++ {
+		if w = i.nextNonFullWord(w); w < 0 {
+			return 0, false
+		}
+		free := ^i.bitmap[w]
+		if w == from/64 {
+			free &= ^uint64(0) << (from % 64)
+		}
+		if free != 0 {
+			bit := w*64 + int64(bits.TrailingZeros64(free))
+			return bit, bit < to
+		}
+	}
+	return 0, false
+}
+
+// nextFree returns the first free bit from the given one, wrapping around
+func (i *_IDPool) nextFree(from int64) (int64, bool) {
+	n := i.size()
+	if from >= n || from < 0 {
+		from = 0
+	}
+	if bit, ok := i.scan(from, n); ok {
+		return bit, true
+	}
+	return i.scan(0, from)
+}
+
+func (i *_IDPool) allocate(imsi string) (id int64, err error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
 
-	for id = 1; id < i.index; id++ {
-		if _, exist := i.isUsed[id]; !exist {
-			i.isUsed[id] = true
-			i.index = id + 1
+	if i.strategy == AllocationSticky && imsi != "" {
+		if id, ok := i.sticky[imsi]; ok && !i.isSet(id-i.minValue) {
+			i.setBit(id - i.minValue)
+			i.used++
 			return id, nil
 		}
 	}
 
-	return 0, errors.New("no available value range to allocate id")
+	start := i.index - i.minValue
+	if i.strategy == AllocationRandom && i.size() > 0 {
+		start = rand.Int64N(i.size())
+	}
+	bit, ok := i.nextFree(start)
+	if !ok {
+		return 0, errors.New("no available value range to allocate id")
+	}
+	i.setBit(bit)
+	i.used++
+	id = bit + i.minValue
+	i.index = id + 1
+	if i.strategy == AllocationSticky && imsi != "" {
+		i.sticky[imsi] = id
+	}
+	return id, nil
 }
 
 func (i *_IDPool) block(id int64) {
 	i.lock.Lock()
 	defer i.lock.Unlock()
-	i.isUsed[id] = true
+	if !i.inRange(id) || i.isSet(id-i.minValue) {
+		return
+	}
+	i.setBit(id - i.minValue)
+	i.used++
+}
+
+func (i *_IDPool) isExcluded(id int64) bool {
+	for _, r := range i.excluded {
+		if id >= r.first && id <= r.last {
+			return true
+		}
+	}
+	return false
+}
+
+// exclude removes the IDs of the range from allocation
+func (i *_IDPool) exclude(first, last int64) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	first, last = max(first, i.minValue), min(last, i.maxValue)
+	if first > last {
+		return
+	}
+	i.excluded = append(i.excluded, idRange{first: first, last: last})
+	for id := first; id <= last; id++ {
+		if bit := id - i.minValue; !i.isSet(bit) {
+			i.setBit(bit)
+			i.excludedN++
+		}
+	}
 }
 
 func (i *_IDPool) release(id int64) {
 	i.lock.Lock()
 	defer i.lock.Unlock()
-	delete(i.isUsed, id)
+	if !i.inRange(id) || i.isExcluded(id) {
+		return
+	}
+	if owner := i.subscribed[id]; owner != nil {
+		if owner.sessions--; owner.sessions > 0 {
+			return
+		}
+		delete(i.subscribed, id)
+	}
+	if bit := id - i.minValue; i.isSet(bit) {
+		i.clearBit(bit)
+		i.used--
+	}
 }
@@ -5,9 +5,15 @@
 package context_test
 
 import (
+	"errors"
 	"net"
+	"slices"
+	"strconv"
 	"testing"
 
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/openapi/v2"
+	"github.com/omec-project/openapi/v2/models"
 	smf_context "github.com/omec-project/smf/context"
 )
 
@@ -94,3 +100,238 @@ func TestIPPoolAllocLeastRecentlyUsed(t *testing.T) {
 		t.Errorf("ip1 %v & ip2 %v same ", ip1, ip2)
 	}
 }
+
+func TestIPPoolReserveSubscribedIp(t *testing.T) {
+	allocator, err := smf_context.NewIPAllocator("192.168.1.0/24")
+	if err != nil {
+		t.Fatalf("failed to allocate pool %v", err)
+	}
+	allocator.ReserveStaticIps(&map[string]string{"imsi-3": "192.168.1.3"})
+
+	subscribed := net.ParseIP("192.168.1.1")
+	if err := allocator.ReserveSubscribedIp("imsi-1", subscribed); err != nil {
+		t.Fatalf("failed to reserve subscribed IP %v", err)
+	}
+	// a second PDU session of the UE shares the address
+	if err := allocator.ReserveSubscribedIp("imsi-1", subscribed); err != nil {
+		t.Fatalf("failed to reserve subscribed IP twice %v", err)
+	}
+	for _, conflict := range []struct {
+		imsi string
+		ip   string
+	}{
+		{"imsi-2", "192.168.1.1"},   // subscribed by another UE
+		{"imsi-2", "192.168.1.3"},   // static IP of another UE
+		{"imsi-2", "192.168.2.1"},   // outside of the pool
+		{"imsi-2", "192.168.1.255"}, // broadcast address
+	} {
+		if err := allocator.ReserveSubscribedIp(conflict.imsi, net.ParseIP(conflict.ip)); !errors.Is(err, smf_context.ErrStaticIpConflict) {
+			t.Errorf("expected conflict for %s, got %v", conflict.ip, err)
+		}
+	}
+
+	ip, err := allocator.Allocate("imsi-2")
+	if err != nil || ip.Equal(subscribed) {
+		t.Errorf("expected subscribed IP to be blocked, allocated %v %v", ip, err)
+	}
+	if err := allocator.ReserveSubscribedIp("imsi-4", ip); !errors.Is(err, smf_context.ErrStaticIpConflict) {
+		t.Errorf("expected conflict for allocated IP %v, got %v", ip, err)
+	}
+
+	allocator.Release("imsi-1", subscribed)
+	if err := allocator.ReserveSubscribedIp("imsi-2", subscribed); err == nil {
+		t.Errorf("expected subscribed IP held by the remaining PDU session")
+	}
+	allocator.Release("imsi-1", subscribed)
+	if err := allocator.ReserveSubscribedIp("imsi-2", subscribed); err != nil {
+		t.Errorf("expected released subscribed IP to be available, got %v", err)
+	}
+}
+
+func TestAllocateUeIpAddrSubscribedStaticIp(t *testing.T) {
+	allocator, err := smf_context.NewIPAllocator("192.168.1.0/24")
+	if err != nil {
+		t.Fatalf("failed to allocate pool %v", err)
+	}
+	smContext := smf_context.NewSMContext("imsi-208930000000005", 1)
+	smContext.Supi = "imsi-208930000000005"
+	smContext.Dnn = "internet"
+	smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv4
+	smContext.DNNInfo = &smf_context.SnssaiSmfDnnInfo{UeIPAllocator: allocator}
+	smContext.DnnConfiguration.StaticIpAddress = []models.IpAddress{{Ipv4Addr: openapi.PtrString("192.168.1.20")}}
+
+	if err := smContext.AllocateUeIpAddr(); err != nil {
+		t.Fatalf("failed to allocate IP %v", err)
+	}
+	if !smContext.PDUAddress.Ip.Equal(net.ParseIP("192.168.1.20")) {
+		t.Errorf("expected subscribed static IP, got %v", smContext.PDUAddress.Ip)
+	}
+
+	other := smf_context.NewSMContext("imsi-208930000000006", 1)
+	other.Supi = "imsi-208930000000006"
+	other.Dnn = "internet"
+	other.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv4
+	other.DNNInfo = smContext.DNNInfo
+	other.DnnConfiguration.StaticIpAddress = smContext.DnnConfiguration.StaticIpAddress
+	if err := other.AllocateUeIpAddr(); !errors.Is(err, smf_context.ErrStaticIpConflict) {
+		t.Errorf("expected conflict for static IP of another UE, got %v", err)
+	}
+
+	if err := smContext.ReleaseUeIpAddr(); err != nil {
+		t.Fatalf("failed to release IP %v", err)
+	}
+	if err := other.AllocateUeIpAddr(); err != nil {
+		t.Errorf("expected released static IP to be available, got %v", err)
+	}
+}
+
+func TestIPPoolExcludedRanges(t *testing.T) {
+	allocator, err := smf_context.NewIPAllocator("192.168.1.0/29")
+	if err != nil {
+		t.Fatalf("failed to allocate pool %v", err)
+	}
+	if err := allocator.ExcludeRanges([]string{"192.168.1.1", "192.168.1.4-192.168.1.5", "10.0.0.0/8"}); err != nil {
+		t.Fatalf("failed to exclude ranges %v", err)
+	}
+	if size, allocated := allocator.Usage(); size != 3 || allocated != 0 {
+		t.Errorf("unexpected usage %d/%d", allocated, size)
+	}
+
+	var allocated []string
+	for range 3 {
+		ip, err := allocator.Allocate("")
+		if err != nil {
+			t.Fatalf("failed to allocate %v", err)
+		}
+		allocated = append(allocated, ip.String())
+	}
+	if want := []string{"192.168.1.2", "192.168.1.3", "192.168.1.6"}; !slices.Equal(allocated, want) {
+		t.Errorf("expected %v, allocated %v", want, allocated)
+	}
+	if ip, err := allocator.Allocate(""); err == nil {
+		t.Errorf("expected exhausted pool, allocated %v", ip)
+	}
+
+	// excluded addresses are never released nor reserved
+	allocator.Release("", net.ParseIP("192.168.1.4"))
+	if _, allocated := allocator.Usage(); allocated != 3 {
+		t.Errorf("unexpected allocated addresses %d", allocated)
+	}
+	if err := allocator.ReserveSubscribedIp("imsi-1", net.ParseIP("192.168.1.1")); !errors.Is(err, smf_context.ErrStaticIpConflict) {
+		t.Errorf("expected conflict for excluded IP, got %v", err)
+	}
+
+	for _, invalid := range []string{"192.168.1", "192.168.1.1-", "192.168.1.0/33"} {
+		if err := allocator.ExcludeRanges([]string{invalid}); err == nil {
+			t.Errorf("expected error for range %q", invalid)
+		}
+	}
+}
+
+func TestIPPoolStrategies(t *testing.T) {
+	allocator, err := smf_context.NewIPAllocator("192.168.1.0/24")
+	if err != nil {
+		t.Fatalf("failed to allocate pool %v", err)
+	}
+	if err := allocator.SetStrategy("lottery"); err == nil {
+		t.Errorf("expected error for unknown strategy")
+	}
+
+	if err := allocator.SetStrategy(smf_context.AllocationSticky); err != nil {
+		t.Fatalf("failed to set strategy %v", err)
+	}
+	ip1, _ := allocator.Allocate("imsi-1")
+	allocator.Release("imsi-1", ip1)
+	if ip2, _ := allocator.Allocate("imsi-2"); ip2.Equal(ip1) {
+		t.Errorf("expected another address for imsi-2, got %v", ip2)
+	}
+	if ip, _ := allocator.Allocate("imsi-1"); !ip.Equal(ip1) {
+		t.Errorf("expected sticky address %v for imsi-1, got %v", ip1, ip)
+	}
+
+	random, err := smf_context.NewIPAllocator("192.168.2.0/24")
+	if err != nil {
+		t.Fatalf("failed to allocate pool %v", err)
+	}
+	if err := random.SetStrategy(smf_context.AllocationRandom); err != nil {
+		t.Fatalf("failed to set strategy %v", err)
+	}
+	seen := map[string]bool{}
+	for range 254 {
+		ip, err := random.Allocate("")
+		if err != nil {
+			t.Fatalf("failed to allocate %v", err)
+		}
+		if seen[ip.String()] {
+			t.Fatalf("address %v allocated twice", ip)
+		}
+		seen[ip.String()] = true
+	}
+	if ip, err := random.Allocate(""); err == nil {
+		t.Errorf("expected exhausted pool, allocated %v", ip)
+	}
+}
+
+func TestIPPoolLarge(t *testing.T) {
+	allocator, err := smf_context.NewIPAllocator("10.0.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to allocate pool %v", err)
+	}
+	var last net.IP
+	for range 65534 {
+		if last, err = allocator.Allocate(""); err != nil {
+			t.Fatalf("failed to allocate %v", err)
+		}
+	}
+	if !last.Equal(net.ParseIP("10.0.255.254")) {
+		t.Errorf("unexpected last address %v", last)
+	}
+	if ip, err := allocator.Allocate(""); err == nil {
+		t.Fatalf("expected exhausted pool, allocated %v", ip)
+	}
+
+	released := net.ParseIP("10.0.128.7")
+	allocator.Release("", released)
+	if ip, err := allocator.Allocate(""); err != nil || !ip.Equal(released) {
+		t.Errorf("expected released address %v, got %v %v", released, ip, err)
+	}
+}
+
+func benchmarkIPPool(b *testing.B, cidr, strategy string, prefill int) {
+	allocator, err := smf_context.NewIPAllocator(cidr)
+	if err != nil {
+		b.Fatalf("failed to allocate pool %v", err)
+	}
+	if err := allocator.SetStrategy(strategy); err != nil {
+		b.Fatalf("failed to set strategy %v", err)
+	}
+	for range prefill {
+		if _, err := allocator.Allocate(""); err != nil {
+			b.Fatalf("failed to prefill %v", err)
+		}
+	}
+	for i := 0; b.Loop(); i++ {
+		imsi := "imsi-" + strconv.Itoa(i%1000)
+		ip, err := allocator.Allocate(imsi)
+		if err != nil {
+			b.Fatalf("failed to allocate %v", err)
+		}
+		allocator.Release(imsi, ip)
+	}
+}
+
+func BenchmarkIPPoolSequential16(b *testing.B) {
+	benchmarkIPPool(b, "10.0.0.0/16", smf_context.AllocationSequential, 60000)
+}
+
+func BenchmarkIPPoolSequential8(b *testing.B) {
+	benchmarkIPPool(b, "10.0.0.0/8", smf_context.AllocationSequential, 1000000)
+}
+
+func BenchmarkIPPoolRandom8(b *testing.B) {
+	benchmarkIPPool(b, "10.0.0.0/8", smf_context.AllocationRandom, 1000000)
+}
+
+func BenchmarkIPPoolSticky8(b *testing.B) {
+	benchmarkIPPool(b, "10.0.0.0/8", smf_context.AllocationSticky, 1000000)
+}
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/omec-project/openapi/v2/models"
+)
+
+// IUpfChange is the change of the I-UPF of a PDU session on mobility. The
+// inserted I-UPF gets its PFCP session established, the PSA its downlink
+// moved and the removed I-UPF its PFCP session deleted.
+type IUpfChange struct {
+	Inserted *DataPathNode
+	Removed  *DataPathNode
+	Anchor   *DataPathNode
+	previous UPPath
+}
+
+// accessNodeByIP returns the AN with the N3 address
+func (upi *UserPlaneInformation) accessNodeByIP(ip net.IP) *UPNode {
+	for _, node := range upi.AccessNetwork {
+		if node.ANIP.Equal(ip) {
+			return node
+		}
+		if node.NodeID.NodeIdType != NodeIdTypeFqdn && node.NodeID.ResolveNodeIdToIp().Equal(ip) {
+			return node
+		}
+	}
+	return nil
+}
+
+// TargetUserPlanePath returns the path from the AN to the PSA of the PDU
+// session after a path switch or handover to the AN, TS 23.502 4.9.1.3. It
+// is nil if the UPF serving the previous AN serves the AN too, or if the
+// AN cannot reach the PSA through a single I-UPF. The caller holds the
+// SMLock.
+func (smContext *SMContext) TargetUserPlanePath(anIP net.IP) UPPath {
+	upi := GetUserPlaneInformation()
+	if upi == nil || anIP == nil || len(smContext.upPath) == 0 || len(smContext.upPath) > 2 {
+		return nil
+	}
+	an := upi.accessNodeByIP(anIP)
+	if an == nil {
+		smContext.SubPduSessLog.Debugf("AN[%s] not in the user plane topology", anIP)
+		return nil
+	}
+	psa := smContext.upPath[len(smContext.upPath)-1]
+	if len(smContext.upPath) > 1 && slices.Contains(an.Links, psa) {
+		// the I-UPF is not needed anymore
+		return UPPath{psa}
+	}
+	if slices.Contains(an.Links, smContext.upPath[0]) {
+		return nil
+	}
+
+	// the other ANs do not relay user plane traffic
+	visited := make(map[*UPNode]bool)
+	for _, node := range upi.AccessNetwork {
+		visited[node] = node != an
+	}
+	path, ok := getPathBetween(an, psa, visited, smContext.UPFSelectionParams())
+	if !ok || len(path) != 3 || !path[1].healthy() {
+		smContext.SubPduSessLog.Warnf("no I-UPF between AN[%s] and the PSA", anIP)
+		return nil
+	}
+	return path[1:]
+}
+
+// ChangeIUpf moves the data path of the PDU session to the path returned by
+// TargetUserPlanePath. The PFCP rules of the inserted I-UPF are activated,
+// the removed I-UPF keeps its rules until its PFCP session is deleted. The
+// caller holds the SMLock.
+func (smContext *SMContext) ChangeIUpf(path UPPath) (*IUpfChange, error) {
+	if len(smContext.Tunnel.DataPathPool) != 1 || smContext.BPManager != nil {
+		return nil, fmt.Errorf("I-UPF change of a PDU session with an UL CL")
+	}
+	dataPath := smContext.Tunnel.DataPathPool.GetDefaultPath()
+	if dataPath == nil || dataPath.FirstDPNode == nil {
+		return nil, fmt.Errorf("no default data path")
+	}
+	change := &IUpfChange{previous: smContext.upPath}
+	for node := dataPath.FirstDPNode; node != nil; node = node.Next() {
+		change.Anchor = node
+	}
+	if change.Anchor.UPF != path[len(path)-1].UPF {
+		return nil, fmt.Errorf("the PSA of the PDU session is not on the path")
+	}
+	if dataPath.FirstDPNode != change.Anchor {
+		change.Removed = dataPath.FirstDPNode
+	}
+	if len(path) > 1 {
+		if change.Anchor.UPF.GetInterface(models.UPINTERFACETYPE_N9, smContext.Dnn) == nil ||
+			path[0].UPF.GetInterface(models.UPINTERFACETYPE_N9, smContext.Dnn) == nil {
+			return nil, fmt.Errorf("no N9 interface between the I-UPF and the PSA")
+		}
+		change.Inserted = NewDataPathNode()
+		change.Inserted.UPF = path[0].UPF
+		change.Inserted.AddNext(change.Anchor)
+		change.Anchor.AddPrev(change.Inserted)
+		dataPath.FirstDPNode = change.Inserted
+		if err := smContext.activateIUpf(dataPath, change.Inserted); err != nil {
+			smContext.RevertIUpfChange(change)
+			return nil, err
+		}
+	} else {
+		change.Anchor.AddPrev(nil)
+		dataPath.FirstDPNode = change.Anchor
+	}
+	smContext.upPath = path
+	return change, nil
+}
+
+// RevertIUpfChange restores the data path of the PDU session before the I-UPF
+// change, whose inserted I-UPF got no PFCP session. The caller holds the
+// SMLock.
+func (smContext *SMContext) RevertIUpfChange(change *IUpfChange) {
+	dataPath := smContext.Tunnel.DataPathPool.GetDefaultPath()
+	if change.Removed != nil {
+		change.Anchor.AddPrev(change.Removed)
+		dataPath.FirstDPNode = change.Removed
+	} else {
+		change.Anchor.AddPrev(nil)
+		dataPath.FirstDPNode = change.Anchor
+	}
+	if change.Inserted != nil {
+		smContext.ReleaseIUpf(change.Inserted)
+	}
+	smContext.upPath = change.previous
+}
+
+// activateIUpf allocates the PFCP session and the PFCP rules of the I-UPF
+// inserted in the data path
+func (smContext *SMContext) activateIUpf(dataPath *DataPath, node *DataPathNode) error {
+	smContext.AllocateLocalSEIDForDataPath(dataPath)
+	if err := node.ActivateUpLinkTunnel(smContext); err != nil {
+		return err
+	}
+	if err := node.ActivateDownLinkTunnel(smContext); err != nil {
+		return err
+	}
+	defQER, err := node.CreateSessRuleQer(smContext)
+	if err != nil {
+		return err
+	}
+	if err = node.ActivateUpLinkPdr(smContext, defQER, 255); err != nil {
+		return err
+	}
+	if err = node.ActivateDlLinkPdr(smContext, defQER, 255, dataPath); err != nil {
+		return err
+	}
+	if smContext.Tunnel.ANInformation.IPAddress != nil {
+		for _, pdr := range node.DownLinkTunnel.PDR {
+			pdr.FAR.ApplyAction = ApplyAction{Forw: true}
+		}
+	}
+	smContext.SetAccessInterfaceType()
+	return nil
+}
+
+// UpdateAnchorDownlink points the downlink of the PSA to the inserted I-UPF,
+// or to the AN if the I-UPF was removed, and returns the FARs to update
+func (smContext *SMContext) UpdateAnchorDownlink(change *IUpfChange) ([]*FAR, error) {
+	outerHeaderCreation := &OuterHeaderCreation{
+		OuterHeaderCreationDescription: OuterHeaderCreationGtpUUdpIpv4,
+		Teid:                           smContext.Tunnel.ANInformation.TEID,
+		Ipv4Address:                    smContext.Tunnel.ANInformation.IPAddress.To4(),
+	}
+	if change.Inserted != nil {
+		iface := change.Inserted.UPF.GetInterface(models.UPINTERFACETYPE_N9, smContext.Dnn)
+		upIP, err := iface.IP(smContext.SelectedPDUSessionType)
+		if err != nil {
+			return nil, err
+		}
+		outerHeaderCreation.Ipv4Address = upIP
+		outerHeaderCreation.Teid = change.Inserted.DownLinkTunnel.TEID
+	}
+	fars := make([]*FAR, 0, len(change.Anchor.DownLinkTunnel.PDR))
+	for _, pdr := range change.Anchor.DownLinkTunnel.PDR {
+		far := pdr.FAR
+		far.ApplyAction = ApplyAction{Forw: true}
+		far.ForwardingParameters = &ForwardingParameters{
+			DestinationInterface: DestinationInterface{InterfaceValue: DestinationInterfaceAccess},
+			NetworkInstance:      []byte(smContext.Dnn),
+			OuterHeaderCreation:  outerHeaderCreation,
+		}
+		far.State = RULE_UPDATE
+		fars = append(fars, far)
+	}
+	return fars, nil
+}
+
+// ReleaseIUpf releases the PFCP rules and the PFCP session of the removed
+// I-UPF, once its PFCP session is deleted. The caller holds the SMLock.
+func (smContext *SMContext) ReleaseIUpf(node *DataPathNode) {
+	node.DeactivateDownLinkTunnel(smContext)
+	node.DeactivateUpLinkTunnel(smContext)
+	nodeIP := node.GetNodeIP()
+	if pfcpSessionContext, ok := smContext.PFCPContext[nodeIP]; ok {
+		dropPFCPSession(nodeIP, pfcpSessionContext)
+		delete(smContext.PFCPContext, nodeIP)
+	}
+}
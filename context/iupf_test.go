@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/openapi/v2"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/factory"
+)
+
+// newIUpfTopology returns the PSA reachable from gnb1 directly and from gnb2
+// and gnb3 through an I-UPF
+func newIUpfTopology() (upi *UserPlaneInformation, psa, iupf2, iupf3 *UPNode) {
+	newAN := func(ip string) *UPNode {
+		return &UPNode{Type: UPNODE_AN, NodeID: *NewNodeID(ip), ANIP: net.ParseIP(ip)}
+	}
+	gnb1, gnb2, gnb3 := newAN("192.168.1.1"), newAN("192.168.1.2"), newAN("192.168.1.3")
+	psa = newDnaiUPNode("10.0.7.1", nil, gnb1)
+	iupf2 = newDnaiUPNode("10.0.7.2", nil, gnb2)
+	iupf3 = newDnaiUPNode("10.0.7.3", nil, gnb3)
+	for _, iupf := range []*UPNode{iupf2, iupf3} {
+		iupf.Links = append(iupf.Links, psa)
+		psa.Links = append(psa.Links, iupf)
+	}
+	for _, node := range []*UPNode{psa, iupf2, iupf3} {
+		node.UPF.NodeID = node.NodeID
+		node.UPF.UPFStatus = AssociatedSetUpSuccess
+		node.UPF.N9Interfaces = []UPFInterfaceInfo{{
+			NetworkInstance:       "internet",
+			IPv4EndPointAddresses: []net.IP{node.NodeID.ResolveNodeIdToIp()},
+		}}
+	}
+	upi = &UserPlaneInformation{
+		UPNodes: map[string]*UPNode{
+			"gnb1": gnb1, "gnb2": gnb2, "gnb3": gnb3, "psa": psa, "iupf2": iupf2, "iupf3": iupf3,
+		},
+		UPFs:          map[string]*UPNode{"psa": psa, "iupf2": iupf2, "iupf3": iupf3},
+		AccessNetwork: map[string]*UPNode{"gnb1": gnb1, "gnb2": gnb2, "gnb3": gnb3},
+		UPFIPToName:   map[string]string{"10.0.7.1": "psa", "10.0.7.2": "iupf2", "10.0.7.3": "iupf3"},
+	}
+	return upi, psa, iupf2, iupf3
+}
+
+func TestTargetUserPlanePath(t *testing.T) {
+	upi, psa, iupf2, iupf3 := newIUpfTopology()
+	original := smfContext.UserPlaneInformation
+	t.Cleanup(func() { smfContext.UserPlaneInformation = original })
+	smfContext.UserPlaneInformation = upi
+
+	tests := []struct {
+		name     string
+		upPath   UPPath
+		anIP     string
+		expected UPPath
+	}{
+		{name: "PSA serving the AN", upPath: UPPath{psa}, anIP: "192.168.1.1"},
+		{name: "I-UPF serving the AN", upPath: UPPath{iupf2, psa}, anIP: "192.168.1.2"},
+		{name: "AN out of the topology", upPath: UPPath{psa}, anIP: "192.168.1.9"},
+		{name: "insertion", upPath: UPPath{psa}, anIP: "192.168.1.2", expected: UPPath{iupf2, psa}},
+		{name: "relocation", upPath: UPPath{iupf2, psa}, anIP: "192.168.1.3", expected: UPPath{iupf3, psa}},
+		{name: "removal", upPath: UPPath{iupf3, psa}, anIP: "192.168.1.1", expected: UPPath{psa}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			smContext := &SMContext{
+				Dnn:    "internet",
+				Snssai: &models.Snssai{Sst: 1, Sd: openapi.PtrString("010203")},
+				upPath: tc.upPath,
+			}
+			smContext.initLogTags()
+			path := smContext.TargetUserPlanePath(net.ParseIP(tc.anIP))
+			if !slices.Equal(path, tc.expected) {
+				t.Errorf("expected path %v, got %v", tc.expected, path)
+			}
+		})
+	}
+
+	iupf3.UPF.UPFStatus = NotAssociated
+	smContext := &SMContext{
+		Dnn:    "internet",
+		Snssai: &models.Snssai{Sst: 1, Sd: openapi.PtrString("010203")},
+		upPath: UPPath{psa},
+	}
+	smContext.initLogTags()
+	if path := smContext.TargetUserPlanePath(net.ParseIP("192.168.1.3")); path != nil {
+		t.Errorf("expected no path through an unhealthy I-UPF, got %v", path)
+	}
+}
+
+func TestChangeIUpfRemoval(t *testing.T) {
+	originalCfg := factory.SmfConfig.Configuration
+	t.Cleanup(func() { factory.SmfConfig.Configuration = originalCfg })
+	factory.SmfConfig.Configuration = &factory.Configuration{}
+
+	_, psa, iupf2, _ := newIUpfTopology()
+	dataPath := GenerateDataPath(UPPath{iupf2, psa})
+	dataPath.IsDefaultPath = true
+	anchor := dataPath.FirstDPNode.Next()
+	anchor.DownLinkTunnel.PDR["default"] = &PDR{FAR: &FAR{ApplyAction: ApplyAction{Drop: true}}}
+
+	smContext := &SMContext{
+		Dnn:                    "internet",
+		SelectedPDUSessionType: nasMessage.PDUSessionTypeIPv4,
+		Tunnel:                 NewUPTunnel(),
+		upPath:                 UPPath{iupf2, psa},
+		PFCPContext:            map[string]*PFCPSessionContext{"10.0.7.1": {}, "10.0.7.2": {LocalSEID: 72}},
+	}
+	smContext.initLogTags()
+	smContext.Tunnel.ANInformation.IPAddress = net.ParseIP("192.168.1.1")
+	smContext.Tunnel.ANInformation.TEID = 7
+	smContext.Tunnel.AddDataPath(dataPath)
+
+	change, err := smContext.ChangeIUpf(UPPath{psa})
+	if err != nil {
+		t.Fatalf("change I-UPF: %v", err)
+	}
+	if change.Inserted != nil || change.Removed == nil || change.Removed.UPF != iupf2.UPF {
+		t.Fatalf("expected the I-UPF removed, got %+v", change)
+	}
+	if dataPath.FirstDPNode != anchor || anchor.Prev() != nil {
+		t.Errorf("expected the PSA first in the data path")
+	}
+
+	fars, err := smContext.UpdateAnchorDownlink(change)
+	if err != nil {
+		t.Fatalf("update PSA downlink: %v", err)
+	}
+	if len(fars) != 1 || fars[0].State != RULE_UPDATE || !fars[0].ApplyAction.Forw {
+		t.Fatalf("expected the downlink FAR of the PSA updated, got %+v", fars)
+	}
+	ohc := fars[0].ForwardingParameters.OuterHeaderCreation
+	if ohc.Teid != 7 || !ohc.Ipv4Address.Equal(net.ParseIP("192.168.1.1")) {
+		t.Errorf("expected the downlink to the AN, got %+v", ohc)
+	}
+
+	smContext.ReleaseIUpf(change.Removed)
+	if _, ok := smContext.PFCPContext["10.0.7.2"]; ok {
+		t.Errorf("expected the PFCP session of the removed I-UPF released")
+	}
+	if _, ok := smContext.PFCPContext["10.0.7.1"]; !ok {
+		t.Errorf("expected the PFCP session of the PSA kept")
+	}
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"sync"
+	"time"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/factory"
+)
+
+// LadnReleaseHandler releases the PDU session of a LADN DNN once the UE
+// stayed out of the LADN service area for the release timer.
+type LadnReleaseHandler func(smContext *SMContext)
+
+var ladnRelease struct {
+	handler LadnReleaseHandler
+	mu      sync.RWMutex
+}
+
+func SetLadnReleaseHandler(handler LadnReleaseHandler) {
+	ladnRelease.mu.Lock()
+	defer ladnRelease.mu.Unlock()
+	ladnRelease.handler = handler
+}
+
+// RetrieveLadnInfo returns the LADN service area of the DNN, nil if the DNN
+// is not a LADN
+func RetrieveLadnInfo(dnn string) *factory.LadnInfo {
+	for i := range smfContext.LadnInfo {
+		if smfContext.LadnInfo[i].Dnn == dnn {
+			return &smfContext.LadnInfo[i]
+		}
+	}
+	return nil
+}
+
+// InLadnServiceArea reports whether the UE may use the DNN of the PDU session.
+// The presence reported by the AMF prevails, else the TAI of the UE is
+// checked against the LADN service area, TS 23.502 4.3.2.2.1.
+func (smContext *SMContext) InLadnServiceArea() bool {
+	info := RetrieveLadnInfo(smContext.Dnn)
+	if info == nil {
+		return true
+	}
+	switch smContext.PresenceInLadn {
+	case models.PRESENCESTATE_IN_AREA:
+		return true
+	case models.PRESENCESTATE_OUT_OF_AREA:
+		return false
+	}
+	return containsFold(info.Tais, smContext.ueTai())
+}
+
+// UpdatePresenceInLadn stores the presence of the UE in the LADN service area
+// reported by the AMF. It returns true when the UE left the area, the UP
+// connection of the PDU session is then to be deactivated and the release
+// timer of the DNN is armed. Entering the area again stops the timer.
+func (smContext *SMContext) UpdatePresenceInLadn(presence models.PresenceState) bool {
+	info := RetrieveLadnInfo(smContext.Dnn)
+	if info == nil || presence == "" || presence == smContext.PresenceInLadn {
+		return false
+	}
+	smContext.SubPduSessLog.Infof("presence in LADN %s changed from %s to %s", smContext.Dnn, smContext.PresenceInLadn, presence)
+	smContext.PresenceInLadn = presence
+
+	if presence != models.PRESENCESTATE_OUT_OF_AREA {
+		smContext.stopLadnReleaseTimer()
+		return false
+	}
+	if info.ReleaseTimer > 0 && smContext.ladnReleaseTimer == nil {
+		var timer *time.Timer
+		timer = time.AfterFunc(time.Duration(info.ReleaseTimer)*time.Second, func() {
+			smContext.SMLock.Lock()
+			expired := smContext.ladnReleaseTimer == timer
+			if expired {
+				smContext.ladnReleaseTimer = nil
+			}
+			smContext.SMLock.Unlock()
+			if !expired {
+				return
+			}
+			smContext.SubPduSessLog.Infof("UE out of LADN %s service area for %ds", smContext.Dnn, info.ReleaseTimer)
+			ladnRelease.mu.RLock()
+			handler := ladnRelease.handler
+			ladnRelease.mu.RUnlock()
+			if handler != nil {
+				handler(smContext)
+			}
+		})
+		smContext.ladnReleaseTimer = timer
+	}
+	return true
+}
+
+func (smContext *SMContext) stopLadnReleaseTimer() {
+	if smContext.ladnReleaseTimer != nil {
+		smContext.ladnReleaseTimer.Stop()
+		smContext.ladnReleaseTimer = nil
+	}
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"testing"
+	"time"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/factory"
+)
+
+func setupLadn(t *testing.T, releaseTimer int) {
+	t.Helper()
+	original := smfContext.LadnInfo
+	t.Cleanup(func() {
+		smfContext.LadnInfo = original
+		SetLadnReleaseHandler(nil)
+	})
+	smfContext.LadnInfo = []factory.LadnInfo{{
+		Dnn:          "campus",
+		Tais:         []string{"208-93-00000a"},
+		ReleaseTimer: releaseTimer,
+	}}
+}
+
+// ladnLocation returns the NR location of the UE in the TAC
+func ladnLocation(tac string) *models.UserLocation {
+	return &models.UserLocation{NrLocation: &models.NrLocation{
+		Tai: models.Tai{PlmnId: models.PlmnId{Mcc: "208", Mnc: "93"}, Tac: tac},
+	}}
+}
+
+func TestInLadnServiceArea(t *testing.T) {
+	setupLadn(t, 0)
+
+	tests := []struct {
+		name     string
+		dnn      string
+		tac      string
+		presence models.PresenceState
+		expected bool
+	}{
+		{name: "not a LADN", dnn: "internet", tac: "000001", expected: true},
+		{name: "TAI in area", dnn: "campus", tac: "00000A", expected: true},
+		{name: "TAI out of area", dnn: "campus", tac: "000001", expected: false},
+		{name: "reported in area", dnn: "campus", tac: "000001", presence: models.PRESENCESTATE_IN_AREA, expected: true},
+		{name: "reported out of area", dnn: "campus", tac: "00000a", presence: models.PRESENCESTATE_OUT_OF_AREA, expected: false},
+		{name: "unknown presence", dnn: "campus", tac: "00000a", presence: models.PRESENCESTATE_UNKNOWN, expected: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			smContext := newTestSMContext(t, "imsi-208930000000001", tc.dnn)
+			smContext.UeLocation = ladnLocation(tc.tac)
+			smContext.PresenceInLadn = tc.presence
+			if got := smContext.InLadnServiceArea(); got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdatePresenceInLadn(t *testing.T) {
+	setupLadn(t, 0)
+	smContext := newTestSMContext(t, "imsi-208930000000001", "campus")
+	smContext.UeLocation = ladnLocation("00000a")
+	smContext.PresenceInLadn = models.PRESENCESTATE_IN_AREA
+
+	if smContext.UpdatePresenceInLadn(models.PRESENCESTATE_IN_AREA) {
+		t.Errorf("expected no deactivation without presence change")
+	}
+	if !smContext.UpdatePresenceInLadn(models.PRESENCESTATE_OUT_OF_AREA) {
+		t.Errorf("expected deactivation when leaving the area")
+	}
+	if smContext.ladnReleaseTimer != nil {
+		t.Errorf("expected no release timer without release timer configured")
+	}
+	if smContext.UpdatePresenceInLadn(models.PRESENCESTATE_IN_AREA) || smContext.PresenceInLadn != models.PRESENCESTATE_IN_AREA {
+		t.Errorf("expected presence back in area, got %s", smContext.PresenceInLadn)
+	}
+
+	smContext.Dnn = "internet"
+	if smContext.UpdatePresenceInLadn(models.PRESENCESTATE_OUT_OF_AREA) {
+		t.Errorf("expected no deactivation for a DNN which is not a LADN")
+	}
+}
+
+func TestLadnReleaseTimer(t *testing.T) {
+	setupLadn(t, 1)
+	released := make(chan *SMContext, 1)
+	SetLadnReleaseHandler(func(smContext *SMContext) {
+		released <- smContext
+	})
+
+	// back in the area before the release timer expires
+	smContext := newTestSMContext(t, "imsi-208930000000001", "campus")
+	smContext.UeLocation = ladnLocation("00000a")
+	smContext.UpdatePresenceInLadn(models.PRESENCESTATE_OUT_OF_AREA)
+	smContext.SMLock.Lock()
+	smContext.UpdatePresenceInLadn(models.PRESENCESTATE_IN_AREA)
+	smContext.SMLock.Unlock()
+
+	other := newTestSMContext(t, "imsi-208930000000001", "campus")
+	other.UeLocation = ladnLocation("00000a")
+	other.SMLock.Lock()
+	other.UpdatePresenceInLadn(models.PRESENCESTATE_OUT_OF_AREA)
+	other.SMLock.Unlock()
+
+	select {
+	case got := <-released:
+		if got != other {
+			t.Errorf("expected the release of the PDU session out of the area")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("PDU session out of the area not released")
+	}
+	select {
+	case <-released:
+		t.Errorf("expected no release of the PDU session back in the area")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,560 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+
+	"github.com/omec-project/ngap/v2/aper"
+	"github.com/omec-project/ngap/v2/ngapType"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/qos"
+)
+
+// ATSSS container IEI of the PDU Session Establishment Accept, TS 24.501
+// 8.3.2.1
+const atsssContainerIEI uint8 = 0x77
+
+// MaPdu is the multi-access state of an MA PDU session, TS 23.501 5.32. The
+// PDU session is established over smContext.AnType, the access leg is the
+// user plane over the other access. Both accesses end in the UPF serving the
+// AN of the default data path, whose MARs steer the downlink traffic.
+type MaPdu struct {
+	leg *AccessLeg
+	// ATSSS capability of the UE, from its 5GSM capability
+	AtsssCapability models.AtsssCapabilityPcf `json:"atsssCapability,omitempty" yaml:"atsssCapability" bson:"atsssCapability,omitempty"`
+}
+
+// AccessLeg is the user plane of an MA PDU session over its second access
+type AccessLeg struct {
+	// First node of the default data path, not stored in the DB
+	Node *DataPathNode `json:"-"`
+	// Uplink PDRs and downlink FARs of the access, keyed as the PDRs of the
+	// default data path
+	PDRs          map[string]*PDR
+	FARs          map[string]*FAR
+	ANInformation struct {
+		IPAddress net.IP
+		TEID      uint32
+	}
+	// Tunnel endpoint allocated by the UPF to the AN
+	IP         net.IP
+	AnType     models.AccessType
+	RatType    models.RatType
+	UpCnxState models.UpCnxState
+	TEID       uint32
+	// PTI of the PDU Session Establishment Request over the access
+	Pti uint8
+}
+
+// MarshalJSON stores the access leg along with the MA PDU session
+func (maPdu *MaPdu) MarshalJSON() ([]byte, error) {
+	type Alias MaPdu
+	return json.Marshal(&struct {
+		*Alias
+		Leg *AccessLeg `json:"leg,omitempty"`
+	}{
+		Alias: (*Alias)(maPdu),
+		Leg:   maPdu.leg,
+	})
+}
+
+// UnmarshalJSON recovers the access leg of the MA PDU session, its node
+// being set by recoverAccessLeg once the data paths are recovered
+func (maPdu *MaPdu) UnmarshalJSON(data []byte) error {
+	type Alias MaPdu
+	aux := &struct {
+		*Alias
+		Leg *AccessLeg `json:"leg"`
+	}{
+		Alias: (*Alias)(maPdu),
+	}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+	maPdu.leg = aux.Leg
+	return nil
+}
+
+// recoverAccessLeg attaches the access leg of the MA PDU session read from
+// the DB to the first node of the default data path, the leg being dropped
+// without one
+func (smContext *SMContext) recoverAccessLeg() {
+	if smContext.MaPdu == nil || smContext.MaPdu.leg == nil {
+		return
+	}
+	dataPath := smContext.Tunnel.DataPathPool.GetDefaultPath()
+	if dataPath == nil || dataPath.FirstDPNode == nil || dataPath.FirstDPNode.UPF == nil {
+		smContext.SubPduSessLog.Warnf("no default data path for the access leg over %s", smContext.MaPdu.leg.AnType)
+		smContext.MaPdu.leg = nil
+		return
+	}
+	smContext.MaPdu.leg.Node = dataPath.FirstDPNode
+}
+
+// SetAtsssCapability stores the ATSSS-ST bits of the 5GSM capability of the
+// UE, TS 24.501 9.11.4.1
+func (smContext *SMContext) SetAtsssCapability(capability uint8) {
+	if smContext.MaPdu == nil {
+		return
+	}
+	switch (capability >> 2) & 0x0f {
+	case 1:
+		smContext.MaPdu.AtsssCapability = models.ATSSSCAPABILITYPCF_ATSSS_LL
+	case 2:
+		smContext.MaPdu.AtsssCapability = models.ATSSSCAPABILITYPCF_MPTCP_ATSSS_LL_WITH_ASMODE_UL
+	case 3:
+		smContext.MaPdu.AtsssCapability = models.ATSSSCAPABILITYPCF_MPTCP_ATSSS_LL
+	}
+}
+
+// AccessLeg returns the access leg of the MA PDU session over the access,
+// nil if the access is not the one of the access leg. The caller holds the
+// SMLock.
+func (smContext *SMContext) AccessLeg(anType models.AccessType) *AccessLeg {
+	if smContext.MaPdu == nil || smContext.MaPdu.leg == nil || smContext.MaPdu.leg.AnType != anType {
+		return nil
+	}
+	return smContext.MaPdu.leg
+}
+
+// AddAccessLeg sets up the user plane of the MA PDU session over the access.
+// The uplink PDRs from the AN of the access come along with their FARs, and
+// the downlink PDRs get a MAR steering the traffic across both accesses. It
+// returns the PDRs and FARs to send in a PFCP Session Modification Request,
+// whose response carries the tunnel endpoint allocated by the UPF. The
+// caller holds the SMLock.
+func (smContext *SMContext) AddAccessLeg(anType models.AccessType, ratType models.RatType, pti uint8) ([]*PDR, []*FAR, error) {
+	if smContext.MaPdu == nil {
+		return nil, nil, fmt.Errorf("not an MA PDU session")
+	}
+	if smContext.MaPdu.leg != nil || anType == smContext.AnType {
+		return nil, nil, fmt.Errorf("user plane over %s already set up", anType)
+	}
+	dataPath := smContext.Tunnel.DataPathPool.GetDefaultPath()
+	if dataPath == nil || dataPath.FirstDPNode == nil {
+		return nil, nil, fmt.Errorf("no default data path")
+	}
+	node := dataPath.FirstDPNode
+	leg := &AccessLeg{
+		Node:       node,
+		PDRs:       make(map[string]*PDR),
+		FARs:       make(map[string]*FAR),
+		AnType:     anType,
+		RatType:    ratType,
+		UpCnxState: models.UPCNXSTATE_DEACTIVATED,
+		Pti:        pti,
+	}
+	interfaceType := leg.interfaceType()
+	var pdrs []*PDR
+	var fars []*FAR
+	release := func() {
+		smContext.releaseAccessLegRules(leg)
+		for _, pdr := range node.DownLinkTunnel.PDR {
+			if pdr.MAR != nil && pdr.MAR.State == RULE_INITIAL {
+				smContext.releaseMAR(node, pdr)
+			}
+		}
+	}
+
+	for name, ulPDR := range node.UpLinkTunnel.PDR {
+		pdr, err := node.UPF.AddPDR()
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		leg.PDRs[name] = pdr
+		pdr.Precedence = ulPDR.Precedence
+		pdr.PDI = ulPDR.PDI
+		pdr.PDI.LocalFTeid = &FTEID{Ch: true}
+		pdr.PDI.TgppInterfaceType = interfaceType
+		pdr.OuterHeaderRemoval = ulPDR.OuterHeaderRemoval
+		pdr.QER = ulPDR.QER
+		pdr.FAR.ApplyAction = ulPDR.FAR.ApplyAction
+		if ulPDR.FAR.ForwardingParameters != nil {
+			forwardingParameters := *ulPDR.FAR.ForwardingParameters
+			pdr.FAR.ForwardingParameters = &forwardingParameters
+		}
+		pdrs = append(pdrs, pdr)
+		fars = append(fars, pdr.FAR)
+	}
+
+	for name, dlPDR := range node.DownLinkTunnel.PDR {
+		far, err := node.UPF.AddFAR()
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		leg.FARs[name] = far
+		far.ApplyAction = ApplyAction{Buff: true, Nocp: true}
+		far.ForwardingParameters = &ForwardingParameters{
+			DestinationInterface: DestinationInterface{InterfaceValue: DestinationInterfaceAccess},
+			NetworkInstance:      []byte(smContext.Dnn),
+			TgppInterfaceType:    interfaceType,
+		}
+		fars = append(fars, far)
+
+		mar, err := node.UPF.AddMAR()
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		dlPDR.MAR = mar
+		dlPDR.State = RULE_UPDATE
+		pdrs = append(pdrs, dlPDR)
+	}
+
+	if err := smContext.PutPDRtoPFCPSession(node.UPF.NodeID, leg.PDRs); err != nil {
+		release()
+		return nil, nil, err
+	}
+	smContext.MaPdu.leg = leg
+	smContext.steerDownlink()
+	return pdrs, fars, nil
+}
+
+// StoreAccessLegFTEID stores the tunnel endpoint the UPF allocated to the
+// uplink PDRs of the access leg, false if the PDR is not one of them
+func (smContext *SMContext) StoreAccessLegFTEID(nodeID NodeID, pdrID uint16, teid uint32, ip net.IP) bool {
+	if smContext.MaPdu == nil || smContext.MaPdu.leg == nil {
+		return false
+	}
+	leg := smContext.MaPdu.leg
+	if !leg.Node.UPF.NodeID.ResolveNodeIdToIp().Equal(nodeID.ResolveNodeIdToIp()) {
+		return false
+	}
+	for _, pdr := range leg.PDRs {
+		if pdr.PDRID == pdrID {
+			if leg.IP == nil {
+				leg.TEID = teid
+				leg.IP = ip
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// ActivateAccessLeg forwards the downlink traffic of the access leg to the
+// tunnel of the AN in the PDU Session Resource Setup Response Transfer. It
+// returns the FARs and the downlink PDRs whose MAR changed. The caller holds
+// the SMLock.
+func (smContext *SMContext) ActivateAccessLeg(leg *AccessLeg, b []byte) ([]*PDR, []*FAR, error) {
+	resourceSetupResponseTransfer := ngapType.PDUSessionResourceSetupResponseTransfer{}
+	if err := aper.UnmarshalWithParams(b, &resourceSetupResponseTransfer, "valueExt"); err != nil {
+		return nil, nil, err
+	}
+	gtpTunnel, err := setupResponseGTPTunnel(&resourceSetupResponseTransfer)
+	if err != nil {
+		return nil, nil, err
+	}
+	leg.ANInformation.IPAddress = gtpTunnel.TransportLayerAddress.Value.Bytes
+	leg.ANInformation.TEID = binary.BigEndian.Uint32(gtpTunnel.GTPTEID.Value)
+
+	fars := make([]*FAR, 0, len(leg.FARs))
+	for _, far := range leg.FARs {
+		far.ApplyAction = ApplyAction{Forw: true}
+		far.ForwardingParameters.OuterHeaderCreation = &OuterHeaderCreation{
+			OuterHeaderCreationDescription: OuterHeaderCreationGtpUUdpIpv4,
+			Teid:                           leg.ANInformation.TEID,
+			Ipv4Address:                    leg.ANInformation.IPAddress.To4(),
+		}
+		far.State = RULE_UPDATE
+		fars = append(fars, far)
+	}
+	leg.UpCnxState = models.UPCNXSTATE_ACTIVATED
+	return smContext.steerDownlink(), fars, nil
+}
+
+// DeactivateAccessLeg buffers the downlink traffic of the access leg while
+// its UP connection is deactivated. It returns the FARs and the downlink
+// PDRs whose MAR changed. The caller holds the SMLock.
+func (smContext *SMContext) DeactivateAccessLeg(leg *AccessLeg) ([]*PDR, []*FAR) {
+	fars := make([]*FAR, 0, len(leg.FARs))
+	for _, far := range leg.FARs {
+		far.ApplyAction = ApplyAction{Buff: true, Nocp: true}
+		far.ForwardingParameters.OuterHeaderCreation = nil
+		far.State = RULE_UPDATE
+		fars = append(fars, far)
+	}
+	leg.UpCnxState = models.UPCNXSTATE_DEACTIVATED
+	return smContext.steerDownlink(), fars
+}
+
+// SteerDownlink updates the MARs of the MA PDU session after the UP
+// connection over one of its accesses was activated or deactivated. It
+// returns the downlink PDRs whose MAR changed. The caller holds the SMLock.
+func (smContext *SMContext) SteerDownlink() []*PDR {
+	if smContext.MaPdu == nil || smContext.MaPdu.leg == nil {
+		return nil
+	}
+	return smContext.steerDownlink()
+}
+
+// ReleaseAccessLeg releases the user plane of the MA PDU session over the
+// access, TS 23.502 4.22.7. Releasing the access the PDU session was
+// established over moves the PDU session to the access of the access leg.
+// It returns the PDRs and FARs to update and to remove from the PFCP
+// session. The caller holds the SMLock.
+func (smContext *SMContext) ReleaseAccessLeg(anType models.AccessType) (pdrs []*PDR, fars []*FAR, removePDRs []*PDR, removeFARs []*FAR) {
+	if smContext.MaPdu == nil || smContext.MaPdu.leg == nil {
+		return nil, nil, nil, nil
+	}
+	leg := smContext.MaPdu.leg
+	node := leg.Node
+	if anType == smContext.AnType {
+		// the access leg takes over the rules of the released access
+		for name, pdr := range leg.PDRs {
+			leg.PDRs[name], node.UpLinkTunnel.PDR[name] = node.UpLinkTunnel.PDR[name], pdr
+		}
+		for name, dlPDR := range node.DownLinkTunnel.PDR {
+			if far := leg.FARs[name]; far != nil {
+				dlPDR.FAR.ApplyAction = far.ApplyAction
+				dlPDR.FAR.ForwardingParameters = far.ForwardingParameters
+				dlPDR.FAR.State = RULE_UPDATE
+				fars = append(fars, dlPDR.FAR)
+			}
+		}
+		node.UpLinkTunnel.TEID = leg.TEID
+		smContext.Tunnel.ANInformation.IPAddress = leg.ANInformation.IPAddress
+		smContext.Tunnel.ANInformation.TEID = leg.ANInformation.TEID
+		smContext.AnType = leg.AnType
+		if leg.RatType != "" {
+			smContext.RatType = leg.RatType
+		}
+		smContext.UpCnxState = leg.UpCnxState
+	}
+
+	for _, pdr := range leg.PDRs {
+		removePDRs = append(removePDRs, pdr)
+		removeFARs = append(removeFARs, pdr.FAR)
+	}
+	for _, far := range leg.FARs {
+		removeFARs = append(removeFARs, far)
+	}
+	for _, dlPDR := range node.DownLinkTunnel.PDR {
+		if dlPDR.MAR == nil {
+			continue
+		}
+		dlPDR.MAR.State = RULE_REMOVE
+		dlPDR.State = RULE_UPDATE
+		if err := node.UPF.RemoveMAR(dlPDR.MAR); err != nil {
+			smContext.SubPduSessLog.Warnf("release MAR: %v", err)
+		}
+		pdrs = append(pdrs, dlPDR)
+	}
+	smContext.releaseAccessLegRules(leg)
+	smContext.MaPdu.leg = nil
+	return pdrs, fars, removePDRs, removeFARs
+}
+
+// ReleaseMaPduRules returns the rule IDs of the access leg to the UPF once
+// the PFCP session is deleted. The caller holds the SMLock.
+func (smContext *SMContext) ReleaseMaPduRules() {
+	if smContext.MaPdu == nil || smContext.MaPdu.leg == nil {
+		return
+	}
+	leg := smContext.MaPdu.leg
+	for _, dlPDR := range leg.Node.DownLinkTunnel.PDR {
+		if dlPDR.MAR != nil {
+			smContext.releaseMAR(leg.Node, dlPDR)
+		}
+	}
+	smContext.releaseAccessLegRules(leg)
+	smContext.MaPdu.leg = nil
+}
+
+func (smContext *SMContext) releaseAccessLegRules(leg *AccessLeg) {
+	for _, pdr := range leg.PDRs {
+		smContext.RemovePDRfromPFCPSession(leg.Node.UPF.NodeID, pdr)
+		if err := leg.Node.UPF.RemovePDR(pdr); err != nil {
+			smContext.SubPduSessLog.Warnf("release access leg PDR: %v", err)
+		}
+		if err := leg.Node.UPF.RemoveFAR(pdr.FAR); err != nil {
+			smContext.SubPduSessLog.Warnf("release access leg FAR: %v", err)
+		}
+	}
+	for _, far := range leg.FARs {
+		if err := leg.Node.UPF.RemoveFAR(far); err != nil {
+			smContext.SubPduSessLog.Warnf("release access leg FAR: %v", err)
+		}
+	}
+}
+
+func (smContext *SMContext) releaseMAR(node *DataPathNode, pdr *PDR) {
+	if err := node.UPF.RemoveMAR(pdr.MAR); err != nil {
+		smContext.SubPduSessLog.Warnf("release MAR: %v", err)
+	}
+	pdr.MAR = nil
+}
+
+// steerDownlink sets the MARs of the downlink PDRs from the steering modes
+// of the PCC rules and the accesses whose UP connection is active, and
+// returns the PDRs whose MAR changed
+func (smContext *SMContext) steerDownlink() []*PDR {
+	leg := smContext.MaPdu.leg
+	var pdrs []*PDR
+	for name, dlPDR := range leg.Node.DownLinkTunnel.PDR {
+		mar := dlPDR.MAR
+		legFAR := leg.FARs[name]
+		if mar == nil || legFAR == nil {
+			continue
+		}
+		previous := *mar
+		var tgppFAR, nonTgppFAR *FAR
+		if smContext.AnType == models.ACCESSTYPE_NON_3_GPP_ACCESS {
+			tgppFAR, nonTgppFAR = legFAR, dlPDR.FAR
+		} else {
+			tgppFAR, nonTgppFAR = dlPDR.FAR, legFAR
+		}
+		mar.TgppAccess = &AccessForwardingAction{FAR: tgppFAR}
+		mar.NonTgppAccess = &AccessForwardingAction{FAR: nonTgppFAR}
+		mar.SteeringFunctionality = SteeringFunctionalityATSSSLL
+		smContext.setSteeringMode(mar, smContext.pccRuleSteeringMode(name))
+
+		activeAccess := smContext.AnType
+		switch {
+		case smContext.UpCnxState == models.UPCNXSTATE_ACTIVATED && leg.UpCnxState == models.UPCNXSTATE_ACTIVATED:
+			activeAccess = ""
+		case leg.UpCnxState == models.UPCNXSTATE_ACTIVATED:
+			activeAccess = leg.AnType
+		}
+		if activeAccess != "" {
+			// the traffic goes over the only access up, and is buffered
+			// there if none is
+			smContext.setSteeringMode(mar, &models.SteeringMode{
+				SteerModeValue: models.STEERMODEVALUE_ACTIVE_STANDBY,
+				Active:         &activeAccess,
+			})
+		}
+
+		if mar.State == RULE_INITIAL || marChanged(&previous, mar) {
+			if mar.State != RULE_INITIAL {
+				mar.State = RULE_UPDATE
+			}
+			pdrs = append(pdrs, dlPDR)
+		}
+	}
+	return pdrs
+}
+
+// pccRuleSteeringMode returns the downlink steering mode of the traffic
+// control data of the PCC rule, nil if there is none
+func (smContext *SMContext) pccRuleSteeringMode(name string) *models.SteeringMode {
+	pccRule := smContext.SmPolicyData.SmCtxtPccRules.PccRules[name]
+	if pccRule == nil || len(pccRule.GetRefTcData()) == 0 {
+		return nil
+	}
+	tcData := smContext.SmPolicyData.SmCtxtTCData.TrafficControlData[pccRule.GetRefTcData()[0]]
+	if tcData == nil {
+		return nil
+	}
+	if tcData.SteerModeDl != nil {
+		return tcData.SteerModeDl
+	}
+	return tcData.SteerModeUl
+}
+
+// setSteeringMode sets the steering mode of the MAR and the weight or the
+// priority of its accesses. Without steering mode the traffic stays on the
+// access the PDU session was established over.
+func (smContext *SMContext) setSteeringMode(mar *MAR, steerMode *models.SteeringMode) {
+	if steerMode == nil {
+		steerMode = &models.SteeringMode{SteerModeValue: models.STEERMODEVALUE_ACTIVE_STANDBY}
+	}
+	tgpp, nonTgpp := mar.TgppAccess, mar.NonTgppAccess
+	tgpp.Weight, nonTgpp.Weight = 0, 0
+	tgpp.Priority, nonTgpp.Priority = 0, 0
+	switch steerMode.SteerModeValue {
+	case models.STEERMODEVALUE_SMALLEST_DELAY:
+		mar.SteeringMode = SteeringModeSmallestDelay
+	case models.STEERMODEVALUE_LOAD_BALANCING:
+		mar.SteeringMode = SteeringModeLoadBalancing
+		tgpp.Weight = uint8(min(max(steerMode.GetVar3gLoad(), 0), 100))
+		nonTgpp.Weight = 100 - tgpp.Weight
+	case models.STEERMODEVALUE_PRIORITY_BASED:
+		mar.SteeringMode = SteeringModePriorityBased
+		tgpp.Priority, nonTgpp.Priority = AccessPriorityHigh, AccessPriorityLow
+		if steerMode.GetPrioAcc() == models.ACCESSTYPE_NON_3_GPP_ACCESS {
+			tgpp.Priority, nonTgpp.Priority = AccessPriorityLow, AccessPriorityHigh
+		}
+	default:
+		mar.SteeringMode = SteeringModeActiveStandby
+		active := smContext.AnType
+		if steerMode.Active != nil {
+			active = *steerMode.Active
+		}
+		tgpp.Priority, nonTgpp.Priority = AccessPriorityActive, AccessPriorityStandby
+		if active == models.ACCESSTYPE_NON_3_GPP_ACCESS {
+			tgpp.Priority, nonTgpp.Priority = AccessPriorityStandby, AccessPriorityActive
+		}
+	}
+}
+
+func marChanged(previous, mar *MAR) bool {
+	return previous.TgppAccess == nil || previous.NonTgppAccess == nil ||
+		previous.SteeringMode != mar.SteeringMode ||
+		*previous.TgppAccess != *mar.TgppAccess || *previous.NonTgppAccess != *mar.NonTgppAccess
+}
+
+// interfaceType returns the 3GPP Interface Type of the N3 rules of the
+// access leg
+func (leg *AccessLeg) interfaceType() uint8 {
+	if leg.AnType != models.ACCESSTYPE_NON_3_GPP_ACCESS {
+		return 0
+	}
+	switch leg.RatType {
+	case models.RATTYPE_TRUSTED_N3_GA, models.RATTYPE_TRUSTED_WLAN:
+		return TgppInterfaceTypeN3TrustedNon3GppAccess
+	}
+	return TgppInterfaceTypeN3UntrustedNon3GppAccess
+}
+
+// BuildAccessLegResourceSetupRequestTransfer builds the PDU Session Resource
+// Setup Request Transfer to the AN of the access leg
+func BuildAccessLegResourceSetupRequestTransfer(ctx *SMContext, leg *AccessLeg) ([]byte, error) {
+	return buildPDUSessionResourceSetupRequestTransfer(ctx, leg.Node.UPF, leg.TEID)
+}
+
+// BuildGSMAccessLegEstablishmentAccept builds the PDU Session Establishment
+// Accept of the PDU Session Establishment Request over the access of the
+// access leg, from the SM policy decision the PDU session enforces
+func BuildGSMAccessLegEstablishmentAccept(smContext *SMContext, leg *AccessLeg) ([]byte, error) {
+	policyUpdate := qos.BuildSmPolicyUpdate(&qos.SmCtxtPolicyData{}, smContext.SmPolicyData.SmPolicyDecision())
+	return buildGSMPDUSessionEstablishmentAccept(smContext, policyUpdate, leg.Pti)
+}
+
+// buildAtsssContainer builds the ATSSS container IE carrying the ATSSS rules
+// of the PCC rules of the policy update, TS 24.501 9.11.4.22
+func buildAtsssContainer(smContext *SMContext, policyUpdate *qos.PolicyUpdate) ([]byte, error) {
+	var pccRules map[string]*models.PccRule
+	if policyUpdate.PccRuleUpdate != nil {
+		pccRules = policyUpdate.PccRuleUpdate.GetAddPccRuleUpdate()
+	}
+	tcData := make(map[string]*models.TrafficControlData)
+	if decision := policyUpdate.SmPolicyDecision; decision != nil {
+		for id, tc := range decision.GetTraffContDecs() {
+			tcData[id] = &tc
+		}
+	}
+	parameters, err := qos.BuildAtsssParameters(qos.BuildAtsssRules(pccRules, tcData, smContext.AnType))
+	if err != nil {
+		return nil, err
+	}
+	if len(parameters) > math.MaxUint16 {
+		return nil, fmt.Errorf("ATSSS container too long: %d octets", len(parameters))
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte(atsssContainerIEI)
+	if err := binary.Write(buf, binary.BigEndian, uint16(len(parameters))); err != nil {
+		return nil, err
+	}
+	buf.Write(parameters)
+	return buf.Bytes(), nil
+}
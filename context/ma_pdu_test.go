@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"net"
+	"testing"
+
+	"github.com/omec-project/ngap/v2/aper"
+	"github.com/omec-project/ngap/v2/ngapType"
+	"github.com/omec-project/openapi/v2"
+	"github.com/omec-project/openapi/v2/models"
+)
+
+// setupMaPdu makes the SM context an MA PDU session over 3GPP access, with a
+// load balancing PCC rule on the returned UPF node
+func setupMaPdu(t *testing.T, smContext *SMContext) *DataPathNode {
+	t.Helper()
+	node := newTestDataPathNode(t, "rule-1")
+	node.UpLinkTunnel.PDR["rule-1"].PDI = PDI{LocalFTeid: &FTEID{Teid: 1}}
+
+	smContext.AnType = models.ACCESSTYPE__3_GPP_ACCESS
+	smContext.RatType = models.RATTYPE_NR
+	smContext.UpCnxState = models.UPCNXSTATE_ACTIVATED
+	smContext.MaPdu = &MaPdu{}
+	smContext.PFCPContext["10.0.8.1"] = &PFCPSessionContext{PDRs: make(map[uint16]*PDR)}
+	smContext.SmPolicyData.SmCtxtPccRules.PccRules["rule-1"] = &models.PccRule{
+		PccRuleId: "rule-1",
+		RefTcData: []string{"tc-1"},
+	}
+	smContext.SmPolicyData.SmCtxtTCData.TrafficControlData["tc-1"] = &models.TrafficControlData{
+		TcId: "tc-1",
+		SteerModeDl: &models.SteeringMode{
+			SteerModeValue: models.STEERMODEVALUE_LOAD_BALANCING,
+			Var3gLoad:      openapi.PtrInt32(70),
+		},
+	}
+	addTestDefaultPath(smContext, node)
+	return node
+}
+
+func setupResponseTransfer(t *testing.T, ip string, teid uint32) []byte {
+	t.Helper()
+	transfer := ngapType.PDUSessionResourceSetupResponseTransfer{}
+	qosFlowPerTNLInformation := &transfer.DLQosFlowPerTNLInformation
+	qosFlowPerTNLInformation.UPTransportLayerInformation.Present = ngapType.UPTransportLayerInformationPresentGTPTunnel
+	qosFlowPerTNLInformation.UPTransportLayerInformation.GTPTunnel = &ngapType.GTPTunnel{
+		TransportLayerAddress: ngapType.TransportLayerAddress{
+			Value: aper.BitString{Bytes: net.ParseIP(ip).To4(), BitLength: 32},
+		},
+		GTPTEID: ngapType.GTPTEID{Value: aper.OctetString{byte(teid >> 24), byte(teid >> 16), byte(teid >> 8), byte(teid)}},
+	}
+	qosFlowPerTNLInformation.AssociatedQosFlowList.List = []ngapType.AssociatedQosFlowItem{
+		{QosFlowIdentifier: ngapType.QosFlowIdentifier{Value: 1}},
+	}
+	b, err := aper.MarshalWithParams(transfer, "valueExt")
+	if err != nil {
+		t.Fatalf("encode PDU Session Resource Setup Response Transfer: %v", err)
+	}
+	return b
+}
+
+func TestAccessLeg(t *testing.T) {
+	smContext := newTestSMContext(t, "imsi-208930000000001", "internet")
+	node := setupMaPdu(t, smContext)
+	dlPDR := node.DownLinkTunnel.PDR["rule-1"]
+
+	if _, _, err := smContext.AddAccessLeg(models.ACCESSTYPE__3_GPP_ACCESS, models.RATTYPE_NR, 1); err == nil {
+		t.Errorf("expected no access leg over the access of the PDU session")
+	}
+	pdrs, fars, err := smContext.AddAccessLeg(models.ACCESSTYPE_NON_3_GPP_ACCESS, models.RATTYPE_WLAN, 3)
+	if err != nil {
+		t.Fatalf("add access leg: %v", err)
+	}
+	if len(pdrs) != 2 || len(fars) != 2 {
+		t.Fatalf("expected the uplink and downlink PDRs and the FARs of the leg, got %d PDRs and %d FARs", len(pdrs), len(fars))
+	}
+	leg := smContext.AccessLeg(models.ACCESSTYPE_NON_3_GPP_ACCESS)
+	if leg == nil || leg.Pti != 3 {
+		t.Fatalf("expected the access leg over the non-3GPP access")
+	}
+	legPDR := leg.PDRs["rule-1"]
+	if legPDR.PDI.LocalFTeid == nil || !legPDR.PDI.LocalFTeid.Ch ||
+		legPDR.PDI.TgppInterfaceType != TgppInterfaceTypeN3UntrustedNon3GppAccess {
+		t.Errorf("expected the uplink PDR of the leg with an F-TEID chosen by the UPF, got %+v", legPDR.PDI)
+	}
+	if _, ok := smContext.PFCPContext["10.0.8.1"].PDRs[legPDR.PDRID]; !ok {
+		t.Errorf("expected the uplink PDR of the leg in the PFCP session")
+	}
+	mar := dlPDR.MAR
+	if mar == nil || mar.State != RULE_INITIAL || dlPDR.State != RULE_UPDATE {
+		t.Fatalf("expected a MAR created for the downlink PDR")
+	}
+	if mar.SteeringMode != SteeringModeActiveStandby || mar.TgppAccess.Priority != AccessPriorityActive {
+		t.Errorf("expected the downlink traffic on the 3GPP access until the leg is up, got %+v", mar)
+	}
+
+	if !smContext.StoreAccessLegFTEID(*NewNodeID("10.0.8.1"), legPDR.PDRID, 7, net.ParseIP("10.0.3.1")) ||
+		leg.TEID != 7 || !leg.IP.Equal(net.ParseIP("10.0.3.1")) {
+		t.Errorf("expected the F-TEID of the leg stored, got %+v", leg)
+	}
+	if smContext.StoreAccessLegFTEID(*NewNodeID("10.0.8.1"), dlPDR.PDRID, 8, net.ParseIP("10.0.3.1")) {
+		t.Errorf("expected the F-TEID of another PDR ignored")
+	}
+
+	mar.State = RULE_CREATE
+	pdrs, fars, err = smContext.ActivateAccessLeg(leg, setupResponseTransfer(t, "192.168.2.1", 9))
+	if err != nil {
+		t.Fatalf("activate access leg: %v", err)
+	}
+	legFAR := leg.FARs["rule-1"]
+	if len(fars) != 1 || !legFAR.ApplyAction.Forw || legFAR.ForwardingParameters.OuterHeaderCreation.Teid != 9 {
+		t.Errorf("expected the downlink FAR of the leg forwarding to the AN, got %+v", legFAR)
+	}
+	if len(pdrs) != 1 || mar.State != RULE_UPDATE || mar.SteeringMode != SteeringModeLoadBalancing ||
+		mar.TgppAccess.Weight != 70 || mar.NonTgppAccess.Weight != 30 {
+		t.Errorf("expected the downlink traffic balanced across both accesses, got %+v", mar)
+	}
+
+	mar.State = RULE_CREATE
+	smContext.UpCnxState = models.UPCNXSTATE_DEACTIVATED
+	if pdrs := smContext.SteerDownlink(); len(pdrs) != 1 || mar.SteeringMode != SteeringModeActiveStandby ||
+		mar.NonTgppAccess.Priority != AccessPriorityActive {
+		t.Errorf("expected the downlink traffic on the non-3GPP access, got %+v", mar)
+	}
+	mar.State = RULE_CREATE
+	if pdrs := smContext.SteerDownlink(); len(pdrs) != 0 {
+		t.Errorf("expected the MAR unchanged")
+	}
+
+	pdrs, fars, removePDRs, removeFARs := smContext.ReleaseAccessLeg(models.ACCESSTYPE_NON_3_GPP_ACCESS)
+	if len(pdrs) != 1 || len(fars) != 0 || len(removePDRs) != 1 || len(removeFARs) != 2 {
+		t.Errorf("expected the rules of the leg removed, got %d, %d, %d and %d", len(pdrs), len(fars), len(removePDRs), len(removeFARs))
+	}
+	if mar.State != RULE_REMOVE || smContext.AccessLeg(models.ACCESSTYPE_NON_3_GPP_ACCESS) != nil {
+		t.Errorf("expected the MAR removed along with the leg")
+	}
+	if _, ok := smContext.PFCPContext["10.0.8.1"].PDRs[legPDR.PDRID]; ok {
+		t.Errorf("expected the uplink PDR of the leg removed from the PFCP session")
+	}
+}
+
+func TestReleaseAccessOfMaPduSession(t *testing.T) {
+	smContext := newTestSMContext(t, "imsi-208930000000001", "internet")
+	node := setupMaPdu(t, smContext)
+	ulPDR := node.UpLinkTunnel.PDR["rule-1"]
+	if _, _, err := smContext.AddAccessLeg(models.ACCESSTYPE_NON_3_GPP_ACCESS, models.RATTYPE_WLAN, 3); err != nil {
+		t.Fatalf("add access leg: %v", err)
+	}
+	leg := smContext.AccessLeg(models.ACCESSTYPE_NON_3_GPP_ACCESS)
+	legPDR := leg.PDRs["rule-1"]
+	leg.TEID = 7
+	if _, _, err := smContext.ActivateAccessLeg(leg, setupResponseTransfer(t, "192.168.2.1", 9)); err != nil {
+		t.Fatalf("activate access leg: %v", err)
+	}
+
+	_, fars, removePDRs, _ := smContext.ReleaseAccessLeg(models.ACCESSTYPE__3_GPP_ACCESS)
+	if smContext.AnType != models.ACCESSTYPE_NON_3_GPP_ACCESS || smContext.RatType != models.RATTYPE_WLAN {
+		t.Errorf("expected the PDU session moved to the non-3GPP access, got %s", smContext.AnType)
+	}
+	if node.UpLinkTunnel.PDR["rule-1"] != legPDR || node.UpLinkTunnel.TEID != 7 {
+		t.Errorf("expected the uplink PDR of the leg taking over")
+	}
+	if len(removePDRs) != 1 || removePDRs[0] != ulPDR {
+		t.Errorf("expected the uplink PDR of the 3GPP access removed")
+	}
+	dlFAR := node.DownLinkTunnel.PDR["rule-1"].FAR
+	if len(fars) != 1 || fars[0] != dlFAR || dlFAR.ForwardingParameters.OuterHeaderCreation.Teid != 9 {
+		t.Errorf("expected the downlink FAR forwarding to the non-3GPP AN, got %+v", dlFAR)
+	}
+	if smContext.ReleaseAccessLeg(models.ACCESSTYPE__3_GPP_ACCESS); smContext.AnType != models.ACCESSTYPE_NON_3_GPP_ACCESS {
+		t.Errorf("expected the last access kept")
+	}
+}
@@ -7,6 +7,7 @@ package context
 import (
 	"encoding/binary"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 
@@ -68,9 +69,12 @@ func buildAllocationAndRetentionPriority(qosFlow *models.QosData, sessRule *mode
 
 func BuildPDUSessionResourceSetupRequestTransfer(ctx *SMContext) ([]byte, error) {
 	ANUPF := ctx.Tunnel.DataPathPool.GetDefaultPath().FirstDPNode
-	UpNode := ANUPF.UPF
+	return buildPDUSessionResourceSetupRequestTransfer(ctx, ANUPF.UPF, ANUPF.UpLinkTunnel.TEID)
+}
+
+func buildPDUSessionResourceSetupRequestTransfer(ctx *SMContext, UpNode *UPF, teid uint32) ([]byte, error) {
 	teidOct := make([]byte, 4)
-	binary.BigEndian.PutUint32(teidOct, ANUPF.UpLinkTunnel.TEID)
+	binary.BigEndian.PutUint32(teidOct, teid)
 
 	resourceSetupRequestTransfer := ngapType.PDUSessionResourceSetupRequestTransfer{}
 
@@ -179,7 +183,9 @@ func BuildPDUSessionResourceSetupRequestTransfer(ctx *SMContext) ([]byte, error)
 						},
 					},
 					AllocationAndRetentionPriority: allocationAndRetentionPriority,
+					ReflectiveQosAttribute:         ctx.reflectiveQosAttribute(qosFlow),
 				},
+				IEExtensions: ctx.redundantQosFlowIndicator(qosFlow),
 			}
 			qosFlowsList = append(qosFlowsList, qosFlowItem)
 		}
@@ -249,6 +255,47 @@ func BuildPDUSessionResourceSetupRequestTransfer(ctx *SMContext) ([]byte, error)
 		resourceSetupRequestTransfer.ProtocolIEs.List = append(resourceSetupRequestTransfer.ProtocolIEs.List, ie)
 	}*/
 
+	// Redundant UL NG-U UP TNL Information
+	if ctx.RedundantN3 != nil && ctx.RedundantN3.TEID != 0 {
+		redundantIP := n3IP
+		if ip := ctx.RedundantN3.IP.To4(); ip != nil {
+			redundantIP = ip
+		}
+		redundantTeidOct := make([]byte, 4)
+		binary.BigEndian.PutUint32(redundantTeidOct, ctx.RedundantN3.TEID)
+		ie = ngapType.PDUSessionResourceSetupRequestTransferIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDRedundantULNGUUPTNLInformation
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value = ngapType.PDUSessionResourceSetupRequestTransferIEsValue{
+			Present: ngapType.PDUSessionResourceSetupRequestTransferIEsPresentRedundantULNGUUPTNLInformation,
+			RedundantULNGUUPTNLInformation: &ngapType.UPTransportLayerInformation{
+				Present: ngapType.UPTransportLayerInformationPresentGTPTunnel,
+				GTPTunnel: &ngapType.GTPTunnel{
+					TransportLayerAddress: ngapType.TransportLayerAddress{
+						Value: aper.BitString{
+							Bytes:     redundantIP,
+							BitLength: uint64(len(redundantIP) * 8),
+						},
+					},
+					GTPTEID: ngapType.GTPTEID{Value: redundantTeidOct},
+				},
+			},
+		}
+		resourceSetupRequestTransfer.ProtocolIEs.List = append(resourceSetupRequestTransfer.ProtocolIEs.List, ie)
+	}
+
+	// Redundant PDU Session Information
+	if redundantInformation := ctx.redundantPDUSessionInformation(); redundantInformation != nil {
+		ie = ngapType.PDUSessionResourceSetupRequestTransferIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDRedundantPDUSessionInformation
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value = ngapType.PDUSessionResourceSetupRequestTransferIEsValue{
+			Present:                        ngapType.PDUSessionResourceSetupRequestTransferIEsPresentRedundantPDUSessionInformation,
+			RedundantPDUSessionInformation: redundantInformation,
+		}
+		resourceSetupRequestTransfer.ProtocolIEs.List = append(resourceSetupRequestTransfer.ProtocolIEs.List, ie)
+	}
+
 	if buf, err := aper.MarshalWithParams(resourceSetupRequestTransfer, "valueExt"); err != nil {
 		return nil, fmt.Errorf("encode resourceSetupRequestTransfer failed: %s", err)
 	} else {
@@ -366,6 +413,7 @@ func BuildPDUSessionResourceModifyRequestTransfer(ctx *SMContext) ([]byte, error
 	// Default QoS params
 	var qfi int32
 	var qi int32
+	var reflectiveQos *ngapType.ReflectiveQosAttribute
 	priority := int32(8)
 
 	// Prefer deriving QFI from existing SM context QoS data (QosId carries the QFI)
@@ -418,6 +466,7 @@ func BuildPDUSessionResourceModifyRequestTransfer(ctx *SMContext) ([]byte, error
 					}
 				}
 				qi = qos.GetVar5qi()
+				reflectiveQos = ctx.reflectiveQosAttribute(&qos)
 				break
 			}
 		}
@@ -456,6 +505,7 @@ func BuildPDUSessionResourceModifyRequestTransfer(ctx *SMContext) ([]byte, error
 				for qosId, qosData := range policyUpdate.QosFlowUpdate.GetModified() {
 					if qosData != nil {
 						ctx.SubPduSessLog.Infof("Modified QoS data: QosId[%s], Var5QI=%d", qosId, qosData.GetVar5qi())
+						reflectiveQos = ctx.reflectiveQosAttribute(qosData)
 						// Convert QosId string to int
 						if qfiVal, err := strconv.Atoi(qosData.GetQosId()); err == nil {
 							qfi = int32(qfiVal)
@@ -489,6 +539,7 @@ func BuildPDUSessionResourceModifyRequestTransfer(ctx *SMContext) ([]byte, error
 				for qosId, qosData := range policyUpdate.QosFlowUpdate.GetAdded() {
 					if qosData != nil {
 						ctx.SubPduSessLog.Infof("Added QoS data: QosId[%s], Var5QI=%d", qosId, qosData.GetVar5qi())
+						reflectiveQos = ctx.reflectiveQosAttribute(qosData)
 						if qfiVal, err := strconv.Atoi(qosData.GetQosId()); err == nil {
 							qfi = int32(qfiVal)
 						} else {
@@ -553,6 +604,7 @@ func BuildPDUSessionResourceModifyRequestTransfer(ctx *SMContext) ([]byte, error
 							PreEmptionCapability:    ngapType.PreEmptionCapability{Value: arpPreemptCap},
 							PreEmptionVulnerability: ngapType.PreEmptionVulnerability{Value: arpPreemptVul},
 						},
+						ReflectiveQosAttribute: reflectiveQos,
 					},
 				}},
 			},
@@ -574,6 +626,76 @@ func BuildPDUSessionResourceModifyRequestTransfer(ctx *SMContext) ([]byte, error
 	}
 }
 
+// BuildULNGUUPTNLModifyRequestTransfer builds the
+// PDUSessionResourceModifyRequestTransfer moving the uplink of the PDU session
+// to the UPF of its tunnel, TS 38.413 9.3.4.3
+func BuildULNGUUPTNLModifyRequestTransfer(ctx *SMContext) ([]byte, error) {
+	ANUPF := ctx.Tunnel.DataPathPool.GetDefaultPath().FirstDPNode
+	UpNode := ANUPF.UPF
+	teidOct := make([]byte, 4)
+	binary.BigEndian.PutUint32(teidOct, ANUPF.UpLinkTunnel.TEID)
+
+	UpNode.UpfLock.RLock()
+	if len(UpNode.N3Interfaces) == 0 {
+		UpNode.UpfLock.RUnlock()
+		return nil, fmt.Errorf("no N3Interfaces available in UPF node")
+	}
+	n3IP, err := UpNode.N3Interfaces[0].IP(ctx.SelectedPDUSessionType)
+	UpNode.UpfLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	anIP := ctx.Tunnel.ANInformation.IPAddress
+	if anIP == nil {
+		return nil, fmt.Errorf("no AN tunnel")
+	}
+	if v4 := anIP.To4(); v4 != nil {
+		anIP = v4
+	}
+	anTeidOct := make([]byte, 4)
+	binary.BigEndian.PutUint32(anTeidOct, ctx.Tunnel.ANInformation.TEID)
+
+	modifyItem := ngapType.ULNGUUPTNLModifyItem{
+		ULNGUUPTNLInformation: ngapType.UPTransportLayerInformation{
+			Present: ngapType.UPTransportLayerInformationPresentGTPTunnel,
+			GTPTunnel: &ngapType.GTPTunnel{
+				TransportLayerAddress: ngapType.TransportLayerAddress{
+					Value: aper.BitString{Bytes: n3IP, BitLength: uint64(len(n3IP) * 8)},
+				},
+				GTPTEID: ngapType.GTPTEID{Value: teidOct},
+			},
+		},
+		DLNGUUPTNLInformation: ngapType.UPTransportLayerInformation{
+			Present: ngapType.UPTransportLayerInformationPresentGTPTunnel,
+			GTPTunnel: &ngapType.GTPTunnel{
+				TransportLayerAddress: ngapType.TransportLayerAddress{
+					Value: aper.BitString{Bytes: anIP, BitLength: uint64(len(anIP) * 8)},
+				},
+				GTPTEID: ngapType.GTPTEID{Value: anTeidOct},
+			},
+		},
+	}
+
+	resourceModifyRequestTransfer := ngapType.PDUSessionResourceModifyRequestTransfer{}
+	resourceModifyRequestTransfer.ProtocolIEs.List = append(resourceModifyRequestTransfer.ProtocolIEs.List,
+		ngapType.PDUSessionResourceModifyRequestTransferIEs{
+			Id:          ngapType.ProtocolIEID{Value: ngapType.ProtocolIEIDULNGUUPTNLModifyList},
+			Criticality: ngapType.Criticality{Value: ngapType.CriticalityPresentReject},
+			Value: ngapType.PDUSessionResourceModifyRequestTransferIEsValue{
+				Present: ngapType.PDUSessionResourceModifyRequestTransferIEsPresentULNGUUPTNLModifyList,
+				ULNGUUPTNLModifyList: &ngapType.ULNGUUPTNLModifyList{
+					List: []ngapType.ULNGUUPTNLModifyItem{modifyItem},
+				},
+			},
+		})
+
+	if buf, err := aper.MarshalWithParams(resourceModifyRequestTransfer, "valueExt"); err != nil {
+		return nil, fmt.Errorf("encode resourceModifyRequestTransfer failed: %w", err)
+	} else {
+		return buf, nil
+	}
+}
+
 // This function is needed because QoS parameters in 3GPP specifications (e.g., GBR, MBR)
 // are often provisioned or configured as strings with units (kbps/mbps),
 // but internally the SMF/UPF and PFCP signaling require numeric values in bps.
@@ -691,6 +813,7 @@ func BuildPathSwitchRequestAcknowledgeTransfer(ctx *SMContext) ([]byte, error) {
 	}
 }
 
+// TS 38.413 9.3.4.7
 func BuildHandoverCommandTransfer(ctx *SMContext) ([]byte, error) {
 	ANUPF := ctx.Tunnel.DataPathPool.GetDefaultPath().FirstDPNode
 	UpNode := ANUPF.UPF
@@ -702,15 +825,31 @@ func BuildHandoverCommandTransfer(ctx *SMContext) ([]byte, error) {
 	handoverCommandTransfer.DLForwardingUPTNLInformation.Present = ngapType.UPTransportLayerInformationPresentGTPTunnel
 	handoverCommandTransfer.DLForwardingUPTNLInformation.GTPTunnel = new(ngapType.GTPTunnel)
 
-	UpNode.UpfLock.RLock()
-	if len(UpNode.N3Interfaces) == 0 {
+	var n3IP net.IP
+	if forwarding := ctx.IndirectForwarding(); forwarding != nil && forwarding.TEID != 0 && forwarding.IP != nil {
+		binary.BigEndian.PutUint32(teidOct, forwarding.TEID)
+		n3IP = forwarding.IP.To4()
+		if len(forwarding.QosFlows) > 0 {
+			handoverCommandTransfer.QosFlowToBeForwardedList = new(ngapType.QosFlowToBeForwardedList)
+			for _, qfi := range forwarding.QosFlows {
+				handoverCommandTransfer.QosFlowToBeForwardedList.List = append(handoverCommandTransfer.QosFlowToBeForwardedList.List,
+					ngapType.QosFlowToBeForwardedItem{QosFlowIdentifier: ngapType.QosFlowIdentifier{Value: qfi}})
+			}
+		}
+	} else {
+		// the encoder requires the DL forwarding tunnel, the uplink tunnel of
+		// the UPF stands for it without indirect forwarding
+		UpNode.UpfLock.RLock()
+		if len(UpNode.N3Interfaces) == 0 {
+			UpNode.UpfLock.RUnlock()
+			return nil, fmt.Errorf("no N3Interfaces available in UPF node")
+		}
+		var err error
+		n3IP, err = UpNode.N3Interfaces[0].IP(ctx.SelectedPDUSessionType)
 		UpNode.UpfLock.RUnlock()
-		return nil, fmt.Errorf("no N3Interfaces available in UPF node")
-	}
-	n3IP, err := UpNode.N3Interfaces[0].IP(ctx.SelectedPDUSessionType)
-	UpNode.UpfLock.RUnlock()
-	if err != nil {
-		return nil, err
+		if err != nil {
+			return nil, err
+		}
 	}
 	gtpTunnel := handoverCommandTransfer.DLForwardingUPTNLInformation.GTPTunnel
 	gtpTunnel.GTPTEID.Value = teidOct
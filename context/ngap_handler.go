@@ -21,15 +21,11 @@ func HandlePDUSessionResourceSetupResponseTransfer(b []byte, ctx *SMContext) (er
 		return err
 	}
 
-	QosFlowPerTNLInformation := resourceSetupResponseTransfer.DLQosFlowPerTNLInformation
-
-	if QosFlowPerTNLInformation.UPTransportLayerInformation.Present !=
-		ngapType.UPTransportLayerInformationPresentGTPTunnel {
-		return errors.New("resourceSetupResponseTransfer.QosFlowPerTNLInformation.UPTransportLayerInformation.Present")
+	gtpTunnel, err := setupResponseGTPTunnel(&resourceSetupResponseTransfer)
+	if err != nil {
+		return err
 	}
 
-	gtpTunnel := QosFlowPerTNLInformation.UPTransportLayerInformation.GTPTunnel
-
 	teid := binary.BigEndian.Uint32(gtpTunnel.GTPTEID.Value)
 
 	ctx.Tunnel.ANInformation.IPAddress = gtpTunnel.TransportLayerAddress.Value.Bytes
@@ -47,11 +43,24 @@ func HandlePDUSessionResourceSetupResponseTransfer(b []byte, ctx *SMContext) (er
 			}
 		}
 	}
+	ctx.setRedundantDLTunnel(&resourceSetupResponseTransfer)
 
 	ctx.UpCnxState = models.UPCNXSTATE_ACTIVATED
 	return nil
 }
 
+// setupResponseGTPTunnel returns the DL tunnel of the AN in the PDU Session
+// Resource Setup Response Transfer
+func setupResponseGTPTunnel(resourceSetupResponseTransfer *ngapType.PDUSessionResourceSetupResponseTransfer) (*ngapType.GTPTunnel, error) {
+	QosFlowPerTNLInformation := resourceSetupResponseTransfer.DLQosFlowPerTNLInformation
+
+	if QosFlowPerTNLInformation.UPTransportLayerInformation.Present !=
+		ngapType.UPTransportLayerInformationPresentGTPTunnel {
+		return nil, errors.New("resourceSetupResponseTransfer.QosFlowPerTNLInformation.UPTransportLayerInformation.Present")
+	}
+	return QosFlowPerTNLInformation.UPTransportLayerInformation.GTPTunnel, nil
+}
+
 func HandlePathSwitchRequestTransfer(b []byte, ctx *SMContext) error {
 	pathSwitchRequestTransfer := ngapType.PathSwitchRequestTransfer{}
 
@@ -101,6 +110,18 @@ func HandlePathSwitchRequestSetupFailedTransfer(b []byte, ctx *SMContext) (err e
 	return nil
 }
 
+func HandleHandoverResourceAllocationUnsuccessfulTransfer(b []byte, ctx *SMContext) (err error) {
+	transfer := ngapType.HandoverResourceAllocationUnsuccessfulTransfer{}
+
+	err = aper.UnmarshalWithParams(b, &transfer, "valueExt")
+	if err != nil {
+		return err
+	}
+
+	ctx.SubPduSessLog.Infof("handover resource allocation failed, cause %+v", transfer.Cause)
+	return nil
+}
+
 func HandleHandoverRequiredTransfer(b []byte, ctx *SMContext) (err error) {
 	handoverRequiredTransfer := ngapType.HandoverRequiredTransfer{}
 
@@ -126,6 +147,7 @@ func HandleHandoverRequestAcknowledgeTransfer(b []byte, ctx *SMContext) (err err
 	// GTPTEID.Value is constrained to exactly 4 bytes (sizeLB:4,sizeUB:4) by the APER
 	// schema, so a successful UnmarshalWithParams above guarantees the length.
 	teid := binary.BigEndian.Uint32(GTPTunnel.GTPTEID.Value)
+	ctx.handoverTarget = &HandoverTarget{IPAddress: GTPTunnel.TransportLayerAddress.Value.Bytes, TEID: teid}
 
 	for _, dataPath := range ctx.Tunnel.DataPathPool {
 		if dataPath.Activated {
@@ -147,5 +169,20 @@ func HandleHandoverRequestAcknowledgeTransfer(b []byte, ctx *SMContext) (err err
 		}
 	}
 
+	// Indirect data forwarding, TS 23.502 4.9.1.3.2
+	if forwarding := handoverRequestAcknowledgeTransfer.DLForwardingUPTNLInformation; forwarding != nil &&
+		forwarding.GTPTunnel != nil {
+		qosFlows := make([]int64, 0)
+		for _, item := range handoverRequestAcknowledgeTransfer.QosFlowSetupResponseList.List {
+			if item.DataForwardingAccepted != nil {
+				qosFlows = append(qosFlows, item.QosFlowIdentifier.Value)
+			}
+		}
+		if _, err := ctx.SetupIndirectForwarding(forwarding.GTPTunnel.TransportLayerAddress.Value.Bytes,
+			binary.BigEndian.Uint32(forwarding.GTPTunnel.GTPTEID.Value), qosFlows); err != nil {
+			ctx.SubPduSessLog.Warnf("indirect forwarding tunnel setup failed: %v", err)
+		}
+	}
+
 	return nil
 }
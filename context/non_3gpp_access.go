@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"strings"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/factory"
+)
+
+// nonThreeGppAn returns the configuration of the AN if it is an N3IWF or a
+// TNGF, nil for a gNB
+func nonThreeGppAn(name string) *factory.NonThreeGppAnInfo {
+	for i := range smfContext.NonThreeGppAnInfo {
+		if smfContext.NonThreeGppAnInfo[i].Name == name {
+			return &smfContext.NonThreeGppAnInfo[i]
+		}
+	}
+	return nil
+}
+
+// allowsAccessNode reports whether the path of the PDU session may start at
+// the AN. The N3IWFs and TNGFs serve the non-3GPP access PDU sessions only,
+// all ANs serve them if none is configured.
+func (selection *UPFSelectionParams) allowsAccessNode(anName string) bool {
+	if selection.AccessNode != "" {
+		return anName == selection.AccessNode
+	}
+	nonThreeGppAccess := selection.AccessType == models.ACCESSTYPE_NON_3_GPP_ACCESS
+	if nonThreeGppAccess && len(smfContext.NonThreeGppAnInfo) == 0 {
+		return true
+	}
+	return (nonThreeGppAn(anName) != nil) == nonThreeGppAccess
+}
+
+// ueAccessNode returns the name of the N3IWF serving the UE, "" if the UE is
+// not located behind a configured N3IWF
+func (smContext *SMContext) ueAccessNode() string {
+	if smContext.AnType != models.ACCESSTYPE_NON_3_GPP_ACCESS || smContext.UeLocation == nil ||
+		smContext.UeLocation.N3gaLocation == nil {
+		return ""
+	}
+	n3iwfId := smContext.UeLocation.N3gaLocation.GetN3IwfId()
+	if n3iwfId == "" {
+		return ""
+	}
+	for _, info := range smfContext.NonThreeGppAnInfo {
+		if strings.EqualFold(info.N3iwfId, n3iwfId) {
+			return info.Name
+		}
+	}
+	return ""
+}
+
+// AccessInterfaceType returns the 3GPP Interface Type of the N3 rules of the
+// PDU session, 0 for the 3GPP access
+func (smContext *SMContext) AccessInterfaceType() uint8 {
+	if smContext.AnType != models.ACCESSTYPE_NON_3_GPP_ACCESS {
+		return 0
+	}
+	switch smContext.RatType {
+	case models.RATTYPE_TRUSTED_N3_GA, models.RATTYPE_TRUSTED_WLAN:
+		return TgppInterfaceTypeN3TrustedNon3GppAccess
+	}
+	if an := nonThreeGppAn(smContext.ueAccessNode()); an != nil && strings.EqualFold(an.Type, "tngf") {
+		return TgppInterfaceTypeN3TrustedNon3GppAccess
+	}
+	return TgppInterfaceTypeN3UntrustedNon3GppAccess
+}
+
+// SetAccessInterfaceType sets the 3GPP Interface Type of the uplink PDRs
+// and downlink FARs of the UPFs serving the AN. It returns the rules
+// already on the UPF whose interface type changed, in the RULE_UPDATE
+// state. The caller holds the SMLock.
+func (smContext *SMContext) SetAccessInterfaceType() ([]*PDR, []*FAR) {
+	interfaceType := smContext.AccessInterfaceType()
+	var pdrs []*PDR
+	var fars []*FAR
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		node := dataPath.FirstDPNode
+		if node == nil {
+			continue
+		}
+		if node.UpLinkTunnel != nil {
+			for _, pdr := range node.UpLinkTunnel.PDR {
+				if pdr.PDI.TgppInterfaceType == interfaceType {
+					continue
+				}
+				pdr.PDI.TgppInterfaceType = interfaceType
+				if pdr.State != RULE_INITIAL {
+					pdr.State = RULE_UPDATE
+					pdrs = append(pdrs, pdr)
+				}
+			}
+		}
+		if node.DownLinkTunnel != nil {
+			for _, pdr := range node.DownLinkTunnel.PDR {
+				far := pdr.FAR
+				if far == nil || far.ForwardingParameters == nil ||
+					far.ForwardingParameters.TgppInterfaceType == interfaceType {
+					continue
+				}
+				far.ForwardingParameters.TgppInterfaceType = interfaceType
+				if far.State != RULE_INITIAL {
+					far.State = RULE_UPDATE
+					fars = append(fars, far)
+				}
+			}
+		}
+	}
+	return pdrs, fars
+}
+
+// ChangeAccessType moves the PDU session to the access type, TS 23.502
+// 4.9.2.3. The resources of the previous access are released once the AN of
+// the new access has set up its tunnel. The caller holds the SMLock.
+func (smContext *SMContext) ChangeAccessType(anType models.AccessType, ratType models.RatType) {
+	if smContext.accessChangeSource == "" {
+		smContext.accessChangeSource = smContext.AnType
+	}
+	smContext.AnType = anType
+	if ratType != "" {
+		smContext.RatType = ratType
+	}
+}
+
+// CompleteAccessTypeChange returns the access type whose resources are to be
+// released after an access type change, "" if there is none. The caller
+// holds the SMLock.
+func (smContext *SMContext) CompleteAccessTypeChange() models.AccessType {
+	source := smContext.accessChangeSource
+	smContext.accessChangeSource = ""
+	if source == smContext.AnType {
+		// back to the previous access before the change completed
+		return ""
+	}
+	return source
+}
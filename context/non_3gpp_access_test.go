@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"testing"
+
+	"github.com/omec-project/openapi/v2"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/factory"
+)
+
+func TestUPFSelectionByAccessType(t *testing.T) {
+	original := smfContext.NonThreeGppAnInfo
+	t.Cleanup(func() { smfContext.NonThreeGppAnInfo = original })
+	smfContext.NonThreeGppAnInfo = []factory.NonThreeGppAnInfo{
+		{Name: "n3iwf1", N3iwfId: "0a"},
+		{Name: "n3iwf2", N3iwfId: "0b"},
+	}
+
+	gnb := &UPNode{Type: UPNODE_AN, NodeID: *NewNodeID("192.168.1.1")}
+	n3iwf1 := &UPNode{Type: UPNODE_AN, NodeID: *NewNodeID("192.168.2.1")}
+	n3iwf2 := &UPNode{Type: UPNODE_AN, NodeID: *NewNodeID("192.168.2.2")}
+	upf1 := newDnaiUPNode("10.0.0.1", nil, gnb)
+	upf2 := newDnaiUPNode("10.0.0.2", nil, n3iwf1)
+	upf3 := newDnaiUPNode("10.0.0.3", nil, n3iwf2)
+	upi := &UserPlaneInformation{
+		UPNodes: map[string]*UPNode{
+			"gnb": gnb, "n3iwf1": n3iwf1, "n3iwf2": n3iwf2, "upf1": upf1, "upf2": upf2, "upf3": upf3,
+		},
+		UPFs:          map[string]*UPNode{"upf1": upf1, "upf2": upf2, "upf3": upf3},
+		AccessNetwork: map[string]*UPNode{"gnb": gnb, "n3iwf1": n3iwf1, "n3iwf2": n3iwf2},
+	}
+
+	tests := []struct {
+		name     string
+		anType   models.AccessType
+		n3iwfId  string
+		expected []*UPNode
+	}{
+		{name: "3GPP access", anType: models.ACCESSTYPE__3_GPP_ACCESS, expected: []*UPNode{upf1}},
+		{name: "non-3GPP access", anType: models.ACCESSTYPE_NON_3_GPP_ACCESS, expected: []*UPNode{upf2, upf3}},
+		{name: "UE behind an N3IWF", anType: models.ACCESSTYPE_NON_3_GPP_ACCESS, n3iwfId: "0B", expected: []*UPNode{upf3}},
+		{name: "UE behind an unknown N3IWF", anType: models.ACCESSTYPE_NON_3_GPP_ACCESS, n3iwfId: "0c", expected: []*UPNode{upf2, upf3}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			smContext := &SMContext{
+				Dnn:    "internet",
+				Snssai: &models.Snssai{Sst: 1, Sd: openapi.PtrString("010203")},
+				AnType: tc.anType,
+			}
+			if tc.n3iwfId != "" {
+				smContext.UeLocation = &models.UserLocation{N3gaLocation: &models.N3gaLocation{
+					N3IwfId: openapi.PtrString(tc.n3iwfId),
+				}}
+			}
+			path := upi.SelectUserPlanePath(smContext.UPFSelectionParams())
+			if len(path) == 0 {
+				t.Fatalf("expected a path")
+			}
+			found := false
+			for _, upf := range tc.expected {
+				found = found || path[len(path)-1] == upf
+			}
+			if !found {
+				t.Errorf("expected a UPF among %v, got path %v", tc.expected, path)
+			}
+		})
+	}
+}
+
+func TestSetAccessInterfaceType(t *testing.T) {
+	original := smfContext.NonThreeGppAnInfo
+	t.Cleanup(func() { smfContext.NonThreeGppAnInfo = original })
+	smfContext.NonThreeGppAnInfo = []factory.NonThreeGppAnInfo{{Name: "tngf", Type: "tngf", N3iwfId: "0a"}}
+
+	node := NewDataPathNode()
+	ulPDR := &PDR{State: RULE_CREATE}
+	dlFAR := &FAR{ForwardingParameters: &ForwardingParameters{}, State: RULE_CREATE}
+	node.UpLinkTunnel.PDR["default"] = ulPDR
+	node.DownLinkTunnel.PDR["default"] = &PDR{FAR: dlFAR}
+	smContext := &SMContext{AnType: models.ACCESSTYPE__3_GPP_ACCESS, Tunnel: NewUPTunnel()}
+	smContext.Tunnel.AddDataPath(&DataPath{Activated: true, IsDefaultPath: true, FirstDPNode: node})
+
+	if pdrs, fars := smContext.SetAccessInterfaceType(); len(pdrs) != 0 || len(fars) != 0 {
+		t.Errorf("expected no 3GPP Interface Type for the 3GPP access")
+	}
+
+	smContext.ChangeAccessType(models.ACCESSTYPE_NON_3_GPP_ACCESS, models.RATTYPE_WLAN)
+	pdrs, fars := smContext.SetAccessInterfaceType()
+	if len(pdrs) != 1 || len(fars) != 1 || ulPDR.State != RULE_UPDATE || dlFAR.State != RULE_UPDATE {
+		t.Fatalf("expected the N3 rules updated, got %d PDRs and %d FARs", len(pdrs), len(fars))
+	}
+	if ulPDR.PDI.TgppInterfaceType != TgppInterfaceTypeN3UntrustedNon3GppAccess ||
+		dlFAR.ForwardingParameters.TgppInterfaceType != TgppInterfaceTypeN3UntrustedNon3GppAccess {
+		t.Errorf("expected the N3 untrusted non-3GPP access interface type")
+	}
+
+	smContext.UeLocation = &models.UserLocation{N3gaLocation: &models.N3gaLocation{N3IwfId: openapi.PtrString("0a")}}
+	if smContext.AccessInterfaceType() != TgppInterfaceTypeN3TrustedNon3GppAccess {
+		t.Errorf("expected the N3 trusted non-3GPP access interface type behind a TNGF")
+	}
+
+	if source := smContext.CompleteAccessTypeChange(); source != models.ACCESSTYPE__3_GPP_ACCESS {
+		t.Errorf("expected the 3GPP access released, got %q", source)
+	}
+	if source := smContext.CompleteAccessTypeChange(); source != "" {
+		t.Errorf("expected no access to release, got %q", source)
+	}
+}
+
+func TestAccessTypeChangeBack(t *testing.T) {
+	smContext := &SMContext{AnType: models.ACCESSTYPE__3_GPP_ACCESS, RatType: models.RATTYPE_NR}
+	smContext.ChangeAccessType(models.ACCESSTYPE_NON_3_GPP_ACCESS, "")
+	smContext.ChangeAccessType(models.ACCESSTYPE__3_GPP_ACCESS, "")
+	if smContext.RatType != models.RATTYPE_NR {
+		t.Errorf("expected the RAT type kept, got %s", smContext.RatType)
+	}
+	if source := smContext.CompleteAccessTypeChange(); source != "" {
+		t.Errorf("expected no access to release, got %q", source)
+	}
+}
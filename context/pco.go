@@ -10,4 +10,6 @@ type ProtocolConfigurationOptions struct {
 	DNSIPv6Request     bool
 	IPv4LinkMTURequest bool
 	PCSCFIPv4Request   bool
+	// IPv4 address allocation via DHCPv4 requested by the UE
+	DHCPv4Request bool
 }
@@ -27,7 +27,9 @@ type PDR struct {
 	OuterHeaderRemoval *OuterHeaderRemoval
 
 	FAR *FAR
-	URR *URR
+	// MAR replaces the FAR of a multi-access PDU session downlink PDR
+	MAR *MAR
+	URR []*URR
 	QER []*QER
 
 	PDI        PDI
@@ -83,17 +85,32 @@ type PDI struct {
 	ApplicationID   string
 	NetworkInstance nasType.Dnn
 	SourceInterface SourceInterface
+	// 3GPP Interface Type, not sent if 0
+	TgppInterfaceType uint8
+	// Second N3 tunnel of the redundant transmission of the QoS flow
+	RedundantTransmission *RedundantTransmissionParameters
+}
+
+// Redundant Transmission Parameters in PDI. 7.5.2.2-5
+type RedundantTransmissionParameters struct {
+	LocalFTeid      *FTEID
+	NetworkInstance nasType.Dnn
 }
 
 // Forwarding Action Rule. 7.5.2.3-1
 type FAR struct {
 	ForwardingParameters *ForwardingParameters
+	// Duplication of the downlink packets on the second N3 tunnel
+	RedundantForwardingParameters *RedundantTransmissionForwardingParameters
 
 	BAR   *BAR
 	State RuleState
 	FARID uint32
 
 	ApplyAction ApplyAction
+	// Recreate removes and creates again the FAR installed on the UPF, an
+	// Update FAR keeping the forwarding parameters it leaves out
+	Recreate bool
 }
 
 type PFCPSMReqFlags struct {
@@ -106,9 +123,18 @@ type PFCPSMReqFlags struct {
 type ForwardingParameters struct {
 	OuterHeaderCreation  *OuterHeaderCreation
 	PFCPSMReqFlags       *PFCPSMReqFlags
+	RedirectInformation  *RedirectInformation
 	ForwardingPolicyID   string
 	NetworkInstance      nasType.Dnn
 	DestinationInterface DestinationInterface
+	// 3GPP Interface Type, not sent if 0
+	TgppInterfaceType uint8
+}
+
+// Redundant Transmission Forwarding Parameters. 7.5.2.3-4
+type RedundantTransmissionForwardingParameters struct {
+	OuterHeaderCreation *OuterHeaderCreation
+	NetworkInstance     nasType.Dnn
 }
 
 type SuggestedBufferingPacketsCount struct {
@@ -138,14 +164,70 @@ type QER struct {
 	State RuleState
 	QFI   QFI
 	QERID uint32
+	// RQI marking of the downlink packets for reflective QoS
+	RQI bool
+}
+
+// Usage Reporting Rule. 7.5.2.4-1
+type URR struct {
+	VolumeThreshold *VolumeThreshold
+
+	// usage monitoring key (UmId) of the PCF usage monitoring data
+	MonitoringKey     string
+	MeasurementMethod MeasurementMethod
+	ReportingTriggers ReportingTriggers
+	// TimeThreshold in seconds
+	TimeThreshold uint32
+
+	State RuleState
+	URRID uint32
 }
 
-// Usage Report Rule
-type URR struct{}
+// Multi-Access Rule. 7.5.2.8-1
+type MAR struct {
+	TgppAccess    *AccessForwardingAction
+	NonTgppAccess *AccessForwardingAction
+
+	State                 RuleState
+	MARID                 uint16
+	SteeringFunctionality uint8
+	SteeringMode          uint8
+}
+
+// Access Forwarding Action Information. 7.5.2.8-2
+type AccessForwardingAction struct {
+	FAR *FAR
+	// Weight in percent of the traffic steered to the access, load balancing only
+	Weight   uint8
+	Priority uint8
+}
+
+// Steering Functionality. 8.2.123
+const (
+	SteeringFunctionalityATSSSLL uint8 = 0
+	SteeringFunctionalityMPTCP   uint8 = 1
+)
+
+// Steering Mode. 8.2.124
+const (
+	SteeringModeActiveStandby uint8 = 0
+	SteeringModeSmallestDelay uint8 = 1
+	SteeringModeLoadBalancing uint8 = 2
+	SteeringModePriorityBased uint8 = 3
+)
+
+// Priority of an access. 8.2.126
+const (
+	AccessPriorityActive    uint8 = 0
+	AccessPriorityStandby   uint8 = 1
+	AccessPriorityNoStandby uint8 = 2
+	AccessPriorityHigh      uint8 = 3
+	AccessPriorityLow       uint8 = 4
+)
 
 func (pdr PDR) String() string {
-	return fmt.Sprintf("PDR: [PdrId:[%v], Precedence:[%v], PDI:[%v], OuterHeaderRem:[%v], Far:[%v], RuleState:[%v], QERS:[%v]]",
-		pdr.PDRID, pdr.Precedence, pdr.PDI, pdr.OuterHeaderRemoval, pdr.FAR, pdr.State, pdr.QER)
+	return fmt.Sprintf("PDR: [PdrId:[%v], Precedence:[%v], PDI:[%v], OuterHeaderRem:[%v], Far:[%v], RuleState:[%v], QERS:[%v], URRS:[%v]]",
+		pdr.PDRID, pdr.Precedence, pdr.PDI, pdr.OuterHeaderRemoval, pdr.FAR, pdr.State, pdr.QER, pdr.URR)
 }
 
 func (pdi PDI) String() string {
@@ -163,8 +245,8 @@ func ActionString(act ApplyAction) string {
 }
 
 func (fp ForwardingParameters) String() string {
-	return fmt.Sprintf("FwdParam: [DestIntf:[%v], NetworkInstance:[%v], OuterHeaderCreation:[%v], PFCPSMReqFlags:[%v], ForwardingPolicyID:[%v]]",
-		fp.DestinationInterface, fp.NetworkInstance, fp.OuterHeaderCreation, fp.PFCPSMReqFlags, fp.ForwardingPolicyID)
+	return fmt.Sprintf("FwdParam: [DestIntf:[%v], NetworkInstance:[%v], OuterHeaderCreation:[%v], PFCPSMReqFlags:[%v], RedirectInfo:[%v], ForwardingPolicyID:[%v]]",
+		fp.DestinationInterface, fp.NetworkInstance, fp.OuterHeaderCreation, fp.PFCPSMReqFlags, fp.RedirectInformation, fp.ForwardingPolicyID)
 }
 
 func (bar BAR) String() string {
@@ -178,3 +260,8 @@ func (qer QER) String() string {
 	// return fmt.Sprintf("\nQER:[Id:[%v], QFI:[%v], MBR:[UL:[%v], DL:[%v]], GBR:[UL:[%v], DL:[%v]], Gate:[UL:[%v], DL:[%v]], RuleState:[%v]] ",
 	//	qer.QERID, qer.QFI, qer.MBR.ULMBR, qer.MBR.DLMBR, qer.GBR.ULGBR, qer.GBR.DLGBR, qer.GateStatus.ULGate, qer.GateStatus.DLGate, qer.State)
 }
+
+func (urr URR) String() string {
+	return fmt.Sprintf("URR: [Id:[%v], MonitoringKey:[%v], Method:[%v], Triggers:[%v], VolThreshold:[%v], TimeThreshold:[%v], RuleState:[%v]]",
+		urr.URRID, urr.MonitoringKey, urr.MeasurementMethod, urr.ReportingTriggers, urr.VolumeThreshold, urr.TimeThreshold, urr.State)
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/qos"
+)
+
+// Redirect Address Type values, TS 29.244 8.2.20
+const (
+	RedirectAddressIPv4 uint8 = iota
+	RedirectAddressIPv6
+	RedirectAddressURL
+	RedirectAddressSIPURI
+)
+
+type RedirectInformation struct {
+	RedirectServerAddress string
+	RedirectAddressType   uint8
+}
+
+func (ri RedirectInformation) String() string {
+	return fmt.Sprintf("RedirectInfo: [AddrType:[%v], ServerAddr:[%v]]", ri.RedirectAddressType, ri.RedirectServerAddress)
+}
+
+// NewRedirectInformation converts the PCF provided redirect information into
+// its PFCP form. It returns nil when redirection is not enabled.
+func NewRedirectInformation(redirectInfo *models.RedirectInformation) (*RedirectInformation, error) {
+	if redirectInfo == nil || !redirectInfo.GetRedirectEnabled() {
+		return nil, nil
+	}
+
+	addr := redirectInfo.GetRedirectServerAddress()
+	if addr == "" {
+		return nil, fmt.Errorf("redirect server address missing")
+	}
+
+	ri := &RedirectInformation{RedirectServerAddress: addr}
+	switch redirectInfo.GetRedirectAddressType() {
+	case models.REDIRECTADDRESSTYPE_IPV4_ADDR:
+		if ip := net.ParseIP(addr); ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("invalid redirect IPv4 address %q", addr)
+		}
+		ri.RedirectAddressType = RedirectAddressIPv4
+	case models.REDIRECTADDRESSTYPE_IPV6_ADDR:
+		if ip := net.ParseIP(addr); ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("invalid redirect IPv6 address %q", addr)
+		}
+		ri.RedirectAddressType = RedirectAddressIPv6
+	case models.REDIRECTADDRESSTYPE_URL:
+		ri.RedirectAddressType = RedirectAddressURL
+	case models.REDIRECTADDRESSTYPE_SIP_URI:
+		ri.RedirectAddressType = RedirectAddressSIPURI
+	default:
+		return nil, fmt.Errorf("unsupported redirect address type %q", redirectInfo.GetRedirectAddressType())
+	}
+
+	return ri, nil
+}
+
+// PccRuleRedirectInformation returns the redirect information of the traffic
+// control data referenced by the given PCC rule. The latest policy decision
+// takes precedence over the data already committed to the SM context.
+func (smContext *SMContext) PccRuleRedirectInformation(ruleId string) *RedirectInformation {
+	var refTcData []string
+	var tcData *models.TrafficControlData
+
+	if len(smContext.SmPolicyUpdates) > 0 && smContext.SmPolicyUpdates[0].SmPolicyDecision != nil {
+		smPolicyDec := smContext.SmPolicyUpdates[0].SmPolicyDecision
+		if rule, ok := smPolicyDec.GetPccRules()[ruleId]; ok {
+			refTcData = rule.RefTcData
+		}
+		if len(refTcData) > 0 {
+			tcData = qos.GetTcDataFromPolicyDecision(smPolicyDec, refTcData[0])
+		}
+	}
+
+	if len(refTcData) == 0 {
+		if rule := smContext.SmPolicyData.SmCtxtPccRules.PccRules[ruleId]; rule != nil {
+			refTcData = rule.RefTcData
+		}
+	}
+	if tcData == nil && len(refTcData) > 0 {
+		tcData = smContext.SmPolicyData.SmCtxtTCData.TrafficControlData[refTcData[0]]
+	}
+	if tcData == nil {
+		return nil
+	}
+
+	ri, err := NewRedirectInformation(tcData.RedirectInfo)
+	if err != nil {
+		smContext.SubPfcpLog.Warnf("ignoring redirect information of traffic control data %s: %v", tcData.GetTcId(), err)
+		return nil
+	}
+	return ri
+}
+
+// UpdateRedirectInformation sets the redirect information of the FAR. A FAR
+// already installed on the UPF is marked for update when redirection changes.
+// Once redirection is disabled the FAR is recreated, as an Update FAR without
+// Redirect Information leaves the UPF redirecting, TS 29.244 7.5.4.3.
+func (far *FAR) UpdateRedirectInformation(ri *RedirectInformation) {
+	if far.ForwardingParameters == nil {
+		far.ForwardingParameters = new(ForwardingParameters)
+	}
+
+	current := far.ForwardingParameters.RedirectInformation
+	if current == nil && ri == nil {
+		return
+	}
+	if current != nil && ri != nil && *current == *ri {
+		return
+	}
+
+	if far.State == RULE_CREATE {
+		far.State = RULE_UPDATE
+	}
+	if ri == nil && far.State == RULE_UPDATE {
+		far.Recreate = true
+	}
+	far.ForwardingParameters.RedirectInformation = ri
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context_test
+
+import (
+	"testing"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/context"
+)
+
+func newModelsRedirectInformation(enabled bool, addrType models.RedirectAddressType, addr string) *models.RedirectInformation {
+	ri := models.NewRedirectInformation()
+	ri.SetRedirectEnabled(enabled)
+	ri.SetRedirectAddressType(addrType)
+	ri.SetRedirectServerAddress(addr)
+	return ri
+}
+
+func TestNewRedirectInformation(t *testing.T) {
+	testCases := []struct {
+		name         string
+		redirectInfo *models.RedirectInformation
+		expected     *context.RedirectInformation
+		expectErr    bool
+	}{
+		{
+			name:         "nil",
+			redirectInfo: nil,
+		},
+		{
+			name:         "disabled",
+			redirectInfo: newModelsRedirectInformation(false, models.REDIRECTADDRESSTYPE_URL, "http://portal"),
+		},
+		{
+			name:         "ipv4",
+			redirectInfo: newModelsRedirectInformation(true, models.REDIRECTADDRESSTYPE_IPV4_ADDR, "10.1.1.1"),
+			expected:     &context.RedirectInformation{RedirectAddressType: context.RedirectAddressIPv4, RedirectServerAddress: "10.1.1.1"},
+		},
+		{
+			name:         "ipv6",
+			redirectInfo: newModelsRedirectInformation(true, models.REDIRECTADDRESSTYPE_IPV6_ADDR, "2001:db8::1"),
+			expected:     &context.RedirectInformation{RedirectAddressType: context.RedirectAddressIPv6, RedirectServerAddress: "2001:db8::1"},
+		},
+		{
+			name:         "url",
+			redirectInfo: newModelsRedirectInformation(true, models.REDIRECTADDRESSTYPE_URL, "http://portal"),
+			expected:     &context.RedirectInformation{RedirectAddressType: context.RedirectAddressURL, RedirectServerAddress: "http://portal"},
+		},
+		{
+			name:         "sip uri",
+			redirectInfo: newModelsRedirectInformation(true, models.REDIRECTADDRESSTYPE_SIP_URI, "sip:topup@example.com"),
+			expected:     &context.RedirectInformation{RedirectAddressType: context.RedirectAddressSIPURI, RedirectServerAddress: "sip:topup@example.com"},
+		},
+		{
+			name:         "ipv4 type with ipv6 address",
+			redirectInfo: newModelsRedirectInformation(true, models.REDIRECTADDRESSTYPE_IPV4_ADDR, "2001:db8::1"),
+			expectErr:    true,
+		},
+		{
+			name:         "missing address",
+			redirectInfo: newModelsRedirectInformation(true, models.REDIRECTADDRESSTYPE_URL, ""),
+			expectErr:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ri, err := context.NewRedirectInformation(tc.redirectInfo)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", ri)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.expected == nil {
+				if ri != nil {
+					t.Fatalf("expected no redirect information, got %v", ri)
+				}
+				return
+			}
+			if ri == nil || *ri != *tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, ri)
+			}
+		})
+	}
+}
+
+func TestFARUpdateRedirectInformation(t *testing.T) {
+	ri := &context.RedirectInformation{RedirectAddressType: context.RedirectAddressURL, RedirectServerAddress: "http://portal"}
+
+	far := &context.FAR{State: context.RULE_INITIAL}
+	far.UpdateRedirectInformation(ri)
+	if far.State != context.RULE_INITIAL {
+		t.Errorf("expected new FAR to stay in initial state, got %v", far.State)
+	}
+	if far.ForwardingParameters.RedirectInformation != ri {
+		t.Fatalf("expected redirect information to be set")
+	}
+
+	// FAR installed on the UPF, same redirection is not an update
+	far.State = context.RULE_CREATE
+	far.UpdateRedirectInformation(&context.RedirectInformation{RedirectAddressType: context.RedirectAddressURL, RedirectServerAddress: "http://portal"})
+	if far.State != context.RULE_CREATE {
+		t.Errorf("expected unchanged FAR to stay created, got %v", far.State)
+	}
+
+	// PCF disables redirection
+	far.UpdateRedirectInformation(nil)
+	if far.State != context.RULE_UPDATE || !far.Recreate {
+		t.Errorf("expected FAR to be recreated, got state %v recreate %v", far.State, far.Recreate)
+	}
+	if removal := far.ForwardingParameters.RedirectInformation; removal != nil {
+		t.Errorf("expected redirect information cleared to stop redirection, got %v", removal)
+	}
+}
@@ -0,0 +1,282 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"encoding/binary"
+	"net"
+	"slices"
+
+	"github.com/omec-project/nas/v2/nasType"
+	"github.com/omec-project/ngap/v2/ngapType"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/qos"
+)
+
+// IEIs of the PDU Session Establishment Request for the redundant PDU
+// sessions, TS 24.501 8.3.1.1
+const (
+	pduSessionPairIDIEI uint8 = 0x34
+	rsnIEI              uint8 = 0x35
+)
+
+// RedundantTransmission is the second N3 tunnel of the QoS flows transmitted
+// redundantly between the UPF and the NG-RAN, TS 23.501 5.33.2.2
+type RedundantTransmission struct {
+	// UL F-TEID allocated by the UPF to the redundant tunnel
+	IP   net.IP `json:"ip,omitempty" yaml:"ip" bson:"ip,omitempty"`
+	TEID uint32 `json:"teid,omitempty" yaml:"teid" bson:"teid,omitempty"`
+	// DL tunnel of the NG-RAN for the redundant transmission
+	ANInformation struct {
+		IPAddress net.IP `json:"ipAddress,omitempty" yaml:"ipAddress" bson:"ipAddress,omitempty"`
+		TEID      uint32 `json:"teid,omitempty" yaml:"teid" bson:"teid,omitempty"`
+	} `json:"anInformation" yaml:"anInformation" bson:"anInformation"`
+}
+
+// isRedundant5qi reports whether the QoS flows of the 5QI in the DNN of the
+// PDU session are to be transmitted over two N3 tunnels
+func (smContext *SMContext) isRedundant5qi(fiveQi int32) bool {
+	for _, info := range SMF_Self().RedundantTransmissionInfo {
+		if info.Dnn == smContext.Dnn {
+			return len(info.FiveQis) == 0 || slices.Contains(info.FiveQis, fiveQi)
+		}
+	}
+	return false
+}
+
+// IsRedundantQosFlow reports whether the QoS flow is transmitted redundantly
+// on N3, TS 23.501 5.33.2.2
+func (smContext *SMContext) IsRedundantQosFlow(qosData *models.QosData) bool {
+	return qosData != nil && smContext.isRedundant5qi(qosData.GetVar5qi())
+}
+
+// redundantQosFlowIndicator returns the indication to the NG-RAN of the
+// redundant transmission of the QoS flow, TS 38.413 9.3.4.1
+func (smContext *SMContext) redundantQosFlowIndicator(qosData *models.QosData) *ngapType.ProtocolExtensionContainerQosFlowSetupRequestItemExtIEs {
+	if !smContext.IsRedundantQosFlow(qosData) {
+		return nil
+	}
+	return &ngapType.ProtocolExtensionContainerQosFlowSetupRequestItemExtIEs{
+		List: []ngapType.QosFlowSetupRequestItemExtIEs{{
+			Id:          ngapType.ProtocolExtensionID{Value: ngapType.ProtocolIEIDRedundantQosFlowIndicator},
+			Criticality: ngapType.Criticality{Value: ngapType.CriticalityPresentIgnore},
+			ExtensionValue: ngapType.QosFlowSetupRequestItemExtIEsExtensionValue{
+				Present: ngapType.QosFlowSetupRequestItemExtIEsPresentRedundantQosFlowIndicator,
+				RedundantQosFlowIndicator: &ngapType.RedundantQosFlowIndicator{
+					Value: ngapType.RedundantQosFlowIndicatorPresentTrue,
+				},
+			},
+		}},
+	}
+}
+
+// pccRuleQosData returns the QoS data of the PCC rule, pending or installed
+func (smContext *SMContext) pccRuleQosData(ruleId string) *models.QosData {
+	if len(smContext.SmPolicyUpdates) > 0 && smContext.SmPolicyUpdates[0].SmPolicyDecision != nil {
+		smPolicyDec := smContext.SmPolicyUpdates[0].SmPolicyDecision
+		if rule, ok := smPolicyDec.GetPccRules()[ruleId]; ok && len(rule.RefQosData) > 0 {
+			if qosData := qos.GetQoSDataFromPolicyDecision(smPolicyDec, rule.RefQosData[0]); qosData != nil {
+				return qosData
+			}
+		}
+	}
+	if rule := smContext.SmPolicyData.SmCtxtPccRules.PccRules[ruleId]; rule != nil && len(rule.RefQosData) > 0 {
+		return smContext.SmPolicyData.SmCtxtQosData.QosData[rule.RefQosData[0]]
+	}
+	return nil
+}
+
+// isRedundantPDR reports whether the PDR of the tunnel, named after its PCC
+// rule, detects a QoS flow transmitted redundantly
+func (smContext *SMContext) isRedundantPDR(name string) bool {
+	if name != "default" {
+		return smContext.IsRedundantQosFlow(smContext.pccRuleQosData(name))
+	}
+	if sessRule := smContext.SelectedSessionRule(); sessRule != nil && sessRule.AuthDefQos != nil {
+		return smContext.isRedundant5qi(sessRule.AuthDefQos.GetVar5qi())
+	}
+	return false
+}
+
+// SetRedundantTransmission asks the UPF serving the AN of the data path for
+// a second UL F-TEID for the QoS flows transmitted redundantly on N3, and
+// to eliminate the duplicated UL packets received on both tunnels.
+func (smContext *SMContext) SetRedundantTransmission(dataPath *DataPath) {
+	node := dataPath.FirstDPNode
+	if node == nil || node.UpLinkTunnel == nil {
+		return
+	}
+	for name, pdr := range node.UpLinkTunnel.PDR {
+		if !smContext.isRedundantPDR(name) {
+			continue
+		}
+		pdr.PDI.RedundantTransmission = &RedundantTransmissionParameters{
+			LocalFTeid:      &FTEID{Ch: true},
+			NetworkInstance: nasType.Dnn(smContext.Dnn),
+		}
+		if smContext.RedundantN3 == nil {
+			smContext.RedundantN3 = &RedundantTransmission{}
+		}
+		smContext.SubPduSessLog.Infof("redundant N3 transmission of the QoS flow of PDR[%s]", name)
+	}
+}
+
+// StoreRedundantFTEID stores the second UL F-TEID the UPF allocated to the
+// PDR, and reports whether the PDR is transmitted redundantly
+func (smContext *SMContext) StoreRedundantFTEID(nodeID NodeID, pdrID uint16, teid uint32, ip net.IP) bool {
+	if smContext.RedundantN3 == nil || smContext.Tunnel == nil {
+		return false
+	}
+	defaultPath := smContext.Tunnel.DataPathPool.GetDefaultPath()
+	if defaultPath == nil {
+		return false
+	}
+	node, tunnel := defaultPath.TunnelOfPDR(nodeID, pdrID)
+	if tunnel == nil || tunnel != node.UpLinkTunnel {
+		return false
+	}
+	smContext.RedundantN3.TEID = teid
+	smContext.RedundantN3.IP = ip
+	return true
+}
+
+// setRedundantDLTunnel stores the redundant DL tunnel of the NG-RAN, then
+// has the UPF duplicate the DL packets of the redundant QoS flows on it
+func (smContext *SMContext) setRedundantDLTunnel(transfer *ngapType.PDUSessionResourceSetupResponseTransfer) {
+	if smContext.RedundantN3 == nil || transfer.IEExtensions == nil {
+		return
+	}
+	qosFlowPerTNLInformation := transfer.IEExtensions.FindRedundantDLQosFlowPerTNLInformation()
+	if qosFlowPerTNLInformation == nil ||
+		qosFlowPerTNLInformation.UPTransportLayerInformation.Present != ngapType.UPTransportLayerInformationPresentGTPTunnel {
+		smContext.SubPduSessLog.Warnln("no redundant DL tunnel from the NG-RAN, QoS flows transmitted on a single N3 tunnel")
+		return
+	}
+	gtpTunnel := qosFlowPerTNLInformation.UPTransportLayerInformation.GTPTunnel
+	anInformation := &smContext.RedundantN3.ANInformation
+	anInformation.IPAddress = gtpTunnel.TransportLayerAddress.Value.Bytes
+	anInformation.TEID = binary.BigEndian.Uint32(gtpTunnel.GTPTEID.Value)
+
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		if !dataPath.Activated || dataPath.FirstDPNode == nil || dataPath.FirstDPNode.DownLinkTunnel == nil {
+			continue
+		}
+		for name, pdr := range dataPath.FirstDPNode.DownLinkTunnel.PDR {
+			if pdr.FAR == nil || !smContext.isRedundantPDR(name) {
+				continue
+			}
+			pdr.FAR.RedundantForwardingParameters = &RedundantTransmissionForwardingParameters{
+				OuterHeaderCreation: &OuterHeaderCreation{
+					OuterHeaderCreationDescription: OuterHeaderCreationGtpUUdpIpv4,
+					Teid:                           anInformation.TEID,
+					Ipv4Address:                    anInformation.IPAddress.To4(),
+				},
+				NetworkInstance: nasType.Dnn(smContext.Dnn),
+			}
+		}
+	}
+}
+
+// HandleRedundantPduSessionRequest retrieves the RSN and the PDU session
+// pair ID of a redundant PDU session from the PDU Session Establishment
+// Request, TS 23.501 5.33.2.1. The NAS library does not decode them. They
+// are kept when the subscription allows redundant PDU sessions in the DNN.
+func (smContext *SMContext) HandleRedundantPduSessionRequest(gsmMessage []byte) {
+	info := redundantPduSessionInformation(gsmMessage)
+	if info == nil {
+		return
+	}
+	if !smContext.DnnConfiguration.GetRedundantSessionAllowed() {
+		smContext.SubGsmLog.Warnf("redundant PDU session not allowed in DNN[%s], RSN ignored", smContext.Dnn)
+		return
+	}
+	smContext.RedundantPduSession = info
+	smContext.SubGsmLog.Infof("redundant PDU session, RSN[%s] PDU session pair ID[%d]", info.Rsn, info.GetPduSessionPairId())
+}
+
+// redundantPduSessionInformation scans the optional IEs of the PDU Session
+// Establishment Request for the RSN and the PDU session pair ID
+func redundantPduSessionInformation(gsmMessage []byte) *models.RedundantPduSessionInformation {
+	// EPD, PDU session ID, PTI, message type, integrity protection maximum data rate
+	const fixedLen = 6
+	var info *models.RedundantPduSessionInformation
+	var pairID *int32
+	for i := fixedLen; i < len(gsmMessage); {
+		iei := gsmMessage[i]
+		var valueStart, valueEnd int
+		switch {
+		case iei >= 0x80:
+			// type 1 IE, value in the same octet
+			i++
+			continue
+		case iei == 0x55:
+			// maximum number of supported packet filters, type 3
+			i += 3
+			continue
+		case iei >= 0x70 && iei <= 0x7f:
+			// type 6 IE, 2 octets length
+			if i+3 > len(gsmMessage) {
+				return info
+			}
+			valueStart = i + 3
+			valueEnd = valueStart + int(binary.BigEndian.Uint16(gsmMessage[i+1:i+3]))
+		default:
+			// type 4 IE
+			if i+2 > len(gsmMessage) {
+				return info
+			}
+			valueStart = i + 2
+			valueEnd = valueStart + int(gsmMessage[i+1])
+		}
+		if valueEnd > len(gsmMessage) {
+			break
+		}
+		if valueEnd > valueStart {
+			switch iei {
+			case rsnIEI:
+				rsn := models.RSN_V1
+				if gsmMessage[valueStart]&0x01 == 1 {
+					rsn = models.RSN_V2
+				}
+				info = models.NewRedundantPduSessionInformation(rsn)
+			case pduSessionPairIDIEI:
+				id := int32(gsmMessage[valueStart])
+				pairID = &id
+			}
+		}
+		i = valueEnd
+	}
+	if info != nil {
+		info.PduSessionPairId = pairID
+	}
+	return info
+}
+
+// redundantPDUSessionInformation returns the RSN and the PDU session pair ID
+// of a redundant PDU session to the NG-RAN, TS 38.413 9.3.1.191
+func (smContext *SMContext) redundantPDUSessionInformation() *ngapType.RedundantPDUSessionInformation {
+	info := smContext.RedundantPduSession
+	if info == nil {
+		return nil
+	}
+	redundantInformation := &ngapType.RedundantPDUSessionInformation{
+		RSN: ngapType.RSN{Value: ngapType.RSNPresentV1},
+	}
+	if info.Rsn == models.RSN_V2 {
+		redundantInformation.RSN.Value = ngapType.RSNPresentV2
+	}
+	if info.PduSessionPairId != nil {
+		redundantInformation.IEExtensions = &ngapType.ProtocolExtensionContainerRedundantPDUSessionInformationExtIEs{
+			List: []ngapType.RedundantPDUSessionInformationExtIEs{{
+				Id:          ngapType.ProtocolExtensionID{Value: ngapType.ProtocolIEIDPDUSessionPairID},
+				Criticality: ngapType.Criticality{Value: ngapType.CriticalityPresentIgnore},
+				ExtensionValue: ngapType.RedundantPDUSessionInformationExtIEsExtensionValue{
+					Present:          ngapType.RedundantPDUSessionInformationExtIEsPresentPDUSessionPairID,
+					PDUSessionPairID: &ngapType.PDUSessionPairID{Value: int64(*info.PduSessionPairId)},
+				},
+			}},
+		}
+	}
+	return redundantInformation
+}
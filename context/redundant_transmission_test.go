@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"net"
+	"testing"
+
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/ngap/v2/aper"
+	"github.com/omec-project/ngap/v2/ngapType"
+	"github.com/omec-project/openapi/v2"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/factory"
+)
+
+// setupRedundantTransmission installs a URLLC and an internet PCC rule of the
+// SM context on the returned UPF node
+func setupRedundantTransmission(t *testing.T, smContext *SMContext) *DataPathNode {
+	t.Helper()
+	node := newTestDataPathNode(t, "urllc", "internet")
+	node.UPF.N3Interfaces = []UPFInterfaceInfo{{IPv4EndPointAddresses: []net.IP{net.ParseIP("10.0.3.1")}}}
+	for _, pdr := range node.UpLinkTunnel.PDR {
+		pdr.PDI = PDI{LocalFTeid: &FTEID{Ch: true}}
+	}
+
+	smContext.SelectedPDUSessionType = nasMessage.PDUSessionTypeIPv4
+	smContext.SmPolicyData.SmCtxtSessionRules.ActiveRule = &models.SessionRule{
+		AuthSessAmbr: &models.Ambr{Uplink: "100 Mbps", Downlink: "100 Mbps"},
+	}
+	for name, fiveQi := range map[string]int32{"urllc": 82, "internet": 9} {
+		smContext.SmPolicyData.SmCtxtPccRules.PccRules[name] = &models.PccRule{
+			PccRuleId:  name,
+			RefQosData: []string{name},
+		}
+		smContext.SmPolicyData.SmCtxtQosData.QosData[name] = &models.QosData{
+			QosId:  name,
+			Var5qi: openapi.PtrInt32(fiveQi),
+		}
+	}
+	addTestDefaultPath(smContext, node)
+	return node
+}
+
+func setRedundantTransmissionInfo(t *testing.T, info []factory.RedundantTransmissionInfo) {
+	t.Helper()
+	original := smfContext.RedundantTransmissionInfo
+	t.Cleanup(func() {
+		smfContext.RedundantTransmissionInfo = original
+	})
+	smfContext.RedundantTransmissionInfo = info
+}
+
+func TestIsRedundantQosFlow(t *testing.T) {
+	setRedundantTransmissionInfo(t, []factory.RedundantTransmissionInfo{
+		{Dnn: "factory", FiveQis: []int32{82}},
+		{Dnn: "robots"},
+	})
+	urllc := &models.QosData{QosId: "1", Var5qi: openapi.PtrInt32(82)}
+	internet := &models.QosData{QosId: "2", Var5qi: openapi.PtrInt32(9)}
+
+	smContext := &SMContext{Dnn: "factory"}
+	if ext := smContext.redundantQosFlowIndicator(urllc); ext == nil || len(ext.List) != 1 ||
+		ext.List[0].ExtensionValue.RedundantQosFlowIndicator.Value != ngapType.RedundantQosFlowIndicatorPresentTrue {
+		t.Errorf("expected the QoS flow of 5QI 82 indicated redundant, got %+v", ext)
+	}
+	if smContext.IsRedundantQosFlow(internet) {
+		t.Errorf("expected the QoS flow of 5QI 9 on a single N3 tunnel")
+	}
+	smContext.Dnn = "robots"
+	if !smContext.IsRedundantQosFlow(internet) {
+		t.Errorf("expected all the QoS flows of the DNN redundant")
+	}
+	smContext.Dnn = "internet"
+	if smContext.IsRedundantQosFlow(urllc) {
+		t.Errorf("expected no redundant transmission in a DNN not configured")
+	}
+}
+
+func TestRedundantTransmission(t *testing.T) {
+	setRedundantTransmissionInfo(t, []factory.RedundantTransmissionInfo{{Dnn: "factory", FiveQis: []int32{82}}})
+	smContext := newTestSMContext(t, "imsi-208930000000001", "factory")
+	node := setupRedundantTransmission(t, smContext)
+	urllcPDR := node.UpLinkTunnel.PDR["urllc"]
+
+	smContext.SetRedundantTransmission(smContext.Tunnel.DataPathPool.GetDefaultPath())
+	if rt := urllcPDR.PDI.RedundantTransmission; rt == nil || rt.LocalFTeid == nil || !rt.LocalFTeid.Ch {
+		t.Fatalf("expected a second UL F-TEID chosen by the UPF, got %+v", rt)
+	}
+	if node.UpLinkTunnel.PDR["internet"].PDI.RedundantTransmission != nil {
+		t.Errorf("expected no redundant transmission of the internet QoS flow")
+	}
+
+	if smContext.StoreRedundantFTEID(*NewNodeID("10.0.8.1"), node.DownLinkTunnel.PDR["urllc"].PDRID, 7, net.ParseIP("10.0.3.2")) {
+		t.Errorf("expected the F-TEID of a downlink PDR ignored")
+	}
+	if !smContext.StoreRedundantFTEID(*NewNodeID("10.0.8.1"), urllcPDR.PDRID, 7, net.ParseIP("10.0.3.2")) ||
+		smContext.RedundantN3.TEID != 7 {
+		t.Fatalf("expected the redundant F-TEID stored, got %+v", smContext.RedundantN3)
+	}
+
+	n2Buf, err := buildPDUSessionResourceSetupRequestTransfer(smContext, node.UPF, 1)
+	if err != nil {
+		t.Fatalf("build PDU Session Resource Setup Request Transfer: %v", err)
+	}
+	transfer := ngapType.PDUSessionResourceSetupRequestTransfer{}
+	if err := aper.UnmarshalWithParams(n2Buf, &transfer, "valueExt"); err != nil {
+		t.Fatalf("decode PDU Session Resource Setup Request Transfer: %v", err)
+	}
+	var redundantUL *ngapType.GTPTunnel
+	redundantFlows := 0
+	for _, ie := range transfer.ProtocolIEs.List {
+		switch ie.Id.Value {
+		case ngapType.ProtocolIEIDRedundantULNGUUPTNLInformation:
+			redundantUL = ie.Value.RedundantULNGUUPTNLInformation.GTPTunnel
+		case ngapType.ProtocolIEIDQosFlowSetupRequestList:
+			for _, item := range ie.Value.QosFlowSetupRequestList.List {
+				if item.IEExtensions != nil && item.IEExtensions.FindRedundantQosFlowIndicator() != nil {
+					redundantFlows++
+				}
+			}
+		}
+	}
+	if redundantUL == nil || !net.IP(redundantUL.TransportLayerAddress.Value.Bytes).Equal(net.ParseIP("10.0.3.2")) ||
+		redundantUL.GTPTEID.Value[3] != 7 {
+		t.Errorf("expected the redundant UL tunnel sent to the NG-RAN, got %+v", redundantUL)
+	}
+	if redundantFlows != 1 {
+		t.Errorf("expected 1 QoS flow indicated redundant, got %d", redundantFlows)
+	}
+
+	response := ngapType.PDUSessionResourceSetupResponseTransfer{}
+	if err := aper.UnmarshalWithParams(setupResponseTransfer(t, "192.168.2.1", 9), &response, "valueExt"); err != nil {
+		t.Fatalf("decode PDU Session Resource Setup Response Transfer: %v", err)
+	}
+	redundantDL := &ngapType.QosFlowPerTNLInformation{}
+	redundantDL.UPTransportLayerInformation.Present = ngapType.UPTransportLayerInformationPresentGTPTunnel
+	redundantDL.UPTransportLayerInformation.GTPTunnel = &ngapType.GTPTunnel{
+		TransportLayerAddress: ngapType.TransportLayerAddress{
+			Value: aper.BitString{Bytes: net.ParseIP("192.168.2.2").To4(), BitLength: 32},
+		},
+		GTPTEID: ngapType.GTPTEID{Value: aper.OctetString{0, 0, 0, 10}},
+	}
+	redundantDL.AssociatedQosFlowList.List = []ngapType.AssociatedQosFlowItem{
+		{QosFlowIdentifier: ngapType.QosFlowIdentifier{Value: 1}},
+	}
+	response.IEExtensions = &ngapType.ProtocolExtensionContainerPDUSessionResourceSetupResponseTransferExtIEs{
+		List: []ngapType.PDUSessionResourceSetupResponseTransferExtIEs{{
+			Id:          ngapType.ProtocolExtensionID{Value: ngapType.ProtocolIEIDRedundantDLQosFlowPerTNLInformation},
+			Criticality: ngapType.Criticality{Value: ngapType.CriticalityPresentIgnore},
+			ExtensionValue: ngapType.PDUSessionResourceSetupResponseTransferExtIEsExtensionValue{
+				Present:                             ngapType.PDUSessionResourceSetupResponseTransferExtIEsPresentRedundantDLQosFlowPerTNLInformation,
+				RedundantDLQosFlowPerTNLInformation: redundantDL,
+			},
+		}},
+	}
+	responseBuf, err := aper.MarshalWithParams(response, "valueExt")
+	if err != nil {
+		t.Fatalf("encode PDU Session Resource Setup Response Transfer: %v", err)
+	}
+	if err := HandlePDUSessionResourceSetupResponseTransfer(responseBuf, smContext); err != nil {
+		t.Fatalf("handle PDU Session Resource Setup Response Transfer: %v", err)
+	}
+	rfp := node.DownLinkTunnel.PDR["urllc"].FAR.RedundantForwardingParameters
+	if rfp == nil || rfp.OuterHeaderCreation.Teid != 10 || !rfp.OuterHeaderCreation.Ipv4Address.Equal(net.ParseIP("192.168.2.2")) {
+		t.Errorf("expected the DL packets duplicated on the redundant tunnel, got %+v", rfp)
+	}
+	if node.DownLinkTunnel.PDR["internet"].FAR.RedundantForwardingParameters != nil {
+		t.Errorf("expected no duplication of the internet QoS flow")
+	}
+}
+
+func TestRedundantPduSessionInformation(t *testing.T) {
+	// PDU Session Establishment Request with the integrity protection
+	// maximum data rate, PDU session type, 5GSM capability, maximum number
+	// of supported packet filters, PDU session pair ID and RSN
+	gsmMessage := []byte{
+		0x2e, 0x05, 0x01, 0xc1, 0xff, 0xff,
+		0x91,
+		0x28, 0x01, 0x00,
+		0x55, 0x00, 0x10,
+		0x34, 0x01, 0x02,
+		0x35, 0x01, 0x01,
+	}
+
+	smContext := &SMContext{Dnn: "factory"}
+	smContext.initLogTags()
+	smContext.HandleRedundantPduSessionRequest(gsmMessage)
+	if smContext.RedundantPduSession != nil {
+		t.Errorf("expected the RSN ignored without the subscription of redundant PDU sessions")
+	}
+
+	smContext.DnnConfiguration.SetRedundantSessionAllowed(true)
+	smContext.HandleRedundantPduSessionRequest(gsmMessage)
+	info := smContext.RedundantPduSession
+	if info == nil || info.Rsn != models.RSN_V2 || info.GetPduSessionPairId() != 2 {
+		t.Fatalf("expected RSN v2 and PDU session pair ID 2, got %+v", info)
+	}
+	ngapInfo := smContext.redundantPDUSessionInformation()
+	if ngapInfo.RSN.Value != ngapType.RSNPresentV2 || ngapInfo.IEExtensions.FindPDUSessionPairID().Value != 2 {
+		t.Errorf("expected RSN v2 and PDU session pair ID 2 to the NG-RAN, got %+v", ngapInfo)
+	}
+
+	if info := redundantPduSessionInformation(gsmMessage[:16]); info != nil {
+		t.Errorf("expected no redundant PDU session without RSN, got %+v", info)
+	}
+}
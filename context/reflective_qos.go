@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"github.com/omec-project/nas/v2/nasConvert"
+	"github.com/omec-project/nas/v2/nasType"
+	"github.com/omec-project/ngap/v2/ngapType"
+	"github.com/omec-project/openapi/v2/models"
+)
+
+// DefaultRQTimer is the reflective QoS timer in seconds used when none is
+// configured, TS 24.501 10.3
+const DefaultRQTimer = 60
+
+// IsReflectiveQosFlow reports whether reflective QoS applies to the QoS flow,
+// i.e. the PCF flagged the QoS data as reflective and the UE supports it (TS 23.501 5.7.5).
+func (smContext *SMContext) IsReflectiveQosFlow(qosData *models.QosData) bool {
+	return smContext.RqosSupported && qosData != nil && qosData.GetReflectiveQos()
+}
+
+// reflectiveQosAttribute returns the RQA of the QoS flow to be signalled to the NG-RAN, TS 38.413 9.3.1.12
+func (smContext *SMContext) reflectiveQosAttribute(qosData *models.QosData) *ngapType.ReflectiveQosAttribute {
+	if !smContext.IsReflectiveQosFlow(qosData) {
+		return nil
+	}
+	return &ngapType.ReflectiveQosAttribute{Value: ngapType.ReflectiveQosAttributePresentSubjectTo}
+}
+
+// buildRQTimerValue returns the RQ timer sent to a UE supporting reflective QoS, TS 24.501 9.11.2.3
+func buildRQTimerValue(iei uint8) *nasType.RQTimerValue {
+	rqTimer := nasType.NewRQTimerValue(iei)
+	rqTimer.Octet = nasConvert.GPRSTimer2ToNas(SMF_Self().RQTimer)
+	return rqTimer
+}
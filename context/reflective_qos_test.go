@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"testing"
+
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/ngap/v2/ngapType"
+	"github.com/omec-project/openapi/v2/models"
+)
+
+func TestReflectiveQosAttribute(t *testing.T) {
+	reflective := models.NewQosData("1")
+	reflective.SetReflectiveQos(true)
+	nonReflective := models.NewQosData("2")
+
+	smContext := &SMContext{RqosSupported: true}
+	if rqa := smContext.reflectiveQosAttribute(reflective); rqa == nil ||
+		rqa.Value != ngapType.ReflectiveQosAttributePresentSubjectTo {
+		t.Errorf("expected RQA subject to reflective QoS, got %v", rqa)
+	}
+	if rqa := smContext.reflectiveQosAttribute(nonReflective); rqa != nil {
+		t.Errorf("expected no RQA for non reflective QoS flow, got %v", rqa)
+	}
+
+	smContext.RqosSupported = false
+	if smContext.IsReflectiveQosFlow(reflective) {
+		t.Errorf("expected no reflective QoS for UE not supporting it")
+	}
+}
+
+func TestBuildRQTimerValue(t *testing.T) {
+	original := smfContext.RQTimer
+	t.Cleanup(func() {
+		smfContext.RQTimer = original
+	})
+	smfContext.RQTimer = DefaultRQTimer
+
+	rqTimer := buildRQTimerValue(nasMessage.PDUSessionEstablishmentAcceptRQTimerValueType)
+	if rqTimer.GetIei() != nasMessage.PDUSessionEstablishmentAcceptRQTimerValueType {
+		t.Errorf("unexpected IEI %x", rqTimer.GetIei())
+	}
+	// 60 seconds in units of 2 seconds
+	if rqTimer.GetUnit() != 0 || rqTimer.GetTimerValue() != 30 {
+		t.Errorf("expected RQ timer of 30 x 2 seconds, got unit %d value %d", rqTimer.GetUnit(), rqTimer.GetTimerValue())
+	}
+}
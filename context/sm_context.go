@@ -15,6 +15,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/omec-project/nas/v2/nasConvert"
@@ -65,6 +66,7 @@ const (
 	SmStatePfcpRelease
 	SmStateRelease
 	SmStateN1N2TransferPending
+	SmStateSecondaryAuthPending
 	SmStateMax
 )
 
@@ -84,6 +86,13 @@ func decSMContextActive() uint64 {
 type UeIpAddr struct {
 	Ip          net.IP
 	UpfProvided bool
+	// AaaProvided is set for a Framed-IP-Address from the DN-AAA server
+	// outside of the DNN pools
+	AaaProvided bool
+	// DhcpProvided is set for an address leased by the DHCP server of the DNN
+	DhcpProvided bool
+	// Pool is the name of the DNN pool the address was allocated from
+	Pool string
 }
 
 type SMContext struct {
@@ -104,7 +113,7 @@ type SMContext struct {
 	SelectedPCFProfile models.NFProfileDiscovery `json:"selectedPCFProfile,omitempty" yaml:"selectedPCFProfile" bson:"selectedPCFProfile,omitempty"`
 	AnType             models.AccessType         `json:"anType" yaml:"anType" bson:"anType"`
 	RatType            models.RatType            `json:"ratType,omitempty" yaml:"ratType" bson:"ratType,omitempty"`
-	PresenceInLadn     models.PresenceState      `json:"presenceInLadn,omitempty" yaml:"presenceInLadn" bson:"presenceInLadn,omitempty"` // ignore
+	PresenceInLadn     models.PresenceState      `json:"presenceInLadn,omitempty" yaml:"presenceInLadn" bson:"presenceInLadn,omitempty"`
 	HoState            models.HoState            `json:"hoState,omitempty" yaml:"hoState" bson:"hoState,omitempty"`
 	DnnConfiguration   models.DnnConfiguration   `json:"dnnConfiguration,omitempty" yaml:"dnnConfiguration" bson:"dnnConfiguration,omitempty"` // ?
 
@@ -170,6 +179,35 @@ type SMContext struct {
 	// NAS
 	Pti                     uint8 `json:"pti,omitempty" yaml:"pti" bson:"pti,omitempty"` // ignore
 	EstAcceptCause5gSMValue uint8 `json:"estAcceptCause5gSMValue,omitempty" yaml:"estAcceptCause5gSMValue" bson:"estAcceptCause5gSMValue,omitempty"`
+	// SSC mode of the PDU session, TS 23.501 5.6.9
+	SscMode uint8 `json:"sscMode,omitempty" yaml:"sscMode" bson:"sscMode,omitempty"`
+	// UE supports reflective QoS, 5GSM capability RQoS bit
+	RqosSupported bool `json:"rqosSupported,omitempty" yaml:"rqosSupported" bson:"rqosSupported,omitempty"`
+	// Secondary authentication/authorization by the DN-AAA server
+	SecondaryAuth *SecondaryAuth `json:"secondaryAuth,omitempty" yaml:"secondaryAuth" bson:"secondaryAuth,omitempty"`
+	// Lease of the UE address from the DHCP server of the DNN
+	DhcpLease *DhcpLease `json:"dhcpLease,omitempty" yaml:"dhcpLease" bson:"dhcpLease,omitempty"`
+	// Multi-access state of an MA PDU session, nil for a single access one
+	MaPdu *MaPdu `json:"maPdu,omitempty" yaml:"maPdu" bson:"maPdu,omitempty"`
+	// Second N3 tunnel of the QoS flows transmitted redundantly
+	RedundantN3 *RedundantTransmission `json:"redundantN3,omitempty" yaml:"redundantN3" bson:"redundantN3,omitempty"`
+	// RSN and PDU session pair ID of a redundant PDU session
+	RedundantPduSession *models.RedundantPduSessionInformation `json:"redundantPduSession,omitempty" yaml:"redundantPduSession" bson:"redundantPduSession,omitempty"`
+	// Release of the LADN PDU session once the UE left the service area
+	ladnReleaseTimer *time.Timer
+	// Path to the UPF selected for the PDU session, stored by UPF address
+	upPath UPPath
+	// PSA relocation of the PDU session is ongoing
+	psaRelocation bool
+	// Re-anchoring of the PDU session on an alternate UPF is ongoing
+	reanchoring bool
+	// Indirect data forwarding tunnel of the ongoing N2 handover
+	indirectForwarding *IndirectForwarding
+	// Tunnel of the target AN of the ongoing N2 handover
+	handoverTarget *HandoverTarget
+	// Access type whose resources are released once the access type change
+	// completes
+	accessChangeSource models.AccessType
 }
 
 func canonicalName(identifier string, pduSessID int32) (canonical string) {
@@ -230,6 +268,14 @@ func (smContext *SMContext) initLogTags() {
 	smContext.SubQosLog = logger.QosLog.With("uuid", smContext.Ref, "id", smContext.Identifier, "pduid", smContext.PDUSessionID)
 }
 
+// enterprise returns the enterprise of the slice of the PDU session
+func (smContext *SMContext) enterprise() string {
+	if smfContext.EnterpriseList == nil || smContext.Snssai == nil {
+		return ""
+	}
+	return (*smfContext.EnterpriseList)[strconv.Itoa(int(smContext.Snssai.GetSst()))+smContext.Snssai.GetSd()]
+}
+
 func (smContext *SMContext) ChangeState(nextState SMContextState) {
 	// Update Subscriber profile Metrics
 	if nextState == SmStateActive || smContext.SMContextState == SmStateActive {
@@ -247,10 +293,9 @@ func (smContext *SMContext) ChangeState(nextState SMContextState) {
 		// enterprise name
 		ent := "na"
 		if smfContext.EnterpriseList != nil {
-			entMap := *smfContext.EnterpriseList
 			smContext.SubCtxLog.Debugf("context state change, Enterprises configured = [%v], subscriber slice sst [%v], sd [%v]",
-				entMap, smContext.Snssai.Sst, smContext.Snssai.Sd)
-			ent = entMap[strconv.Itoa(int(smContext.Snssai.GetSst()))+smContext.Snssai.GetSd()]
+				*smfContext.EnterpriseList, smContext.Snssai.Sst, smContext.Snssai.Sd)
+			ent = smContext.enterprise()
 		} else {
 			smContext.SubCtxLog.Debug("context state change, enterprise info not available")
 		}
@@ -277,7 +322,7 @@ func GetSMContext(ref string) (smContext *SMContext) {
 		smContext = value.(*SMContext)
 	} else {
 		if factory.SmfConfig.Configuration.EnableDbStore {
-			smContext := GetSMContextByRefInDB(ref)
+			smContext = GetSMContextByRefInDB(ref)
 			if smContext != nil {
 				smContextPool.Store(ref, smContext)
 			}
@@ -305,11 +350,8 @@ func RemoveSMContext(ref string) {
 	smContext.SubCtxLog.Infof("RemoveSMContext, SM context released ")
 	smContext.ChangeState(SmStateRelease)
 
-	for _, pfcpSessionContext := range smContext.PFCPContext {
-		seidSMContextMap.Delete(pfcpSessionContext.LocalSEID)
-		if factory.SmfConfig.Configuration.EnableDbStore {
-			DeleteSmContextInDBBySEID(pfcpSessionContext.LocalSEID)
-		}
+	for nodeIP, pfcpSessionContext := range smContext.PFCPContext {
+		dropPFCPSession(nodeIP, pfcpSessionContext)
 	}
 
 	// Release UE IP-Address
@@ -318,6 +360,14 @@ func RemoveSMContext(ref string) {
 		smContext.SubCtxLog.Errorf("release UE IP-Address failed, %v", err)
 	}
 
+	// Stop condition data timers
+	smContext.CancelConditionSchedules()
+
+	// Accounting Stop towards the DN-AAA server
+	smContext.StopDnAaaSession()
+
+	smContext.stopLadnReleaseTimer()
+
 	smContextPool.Delete(ref)
 
 	canonicalRef.Delete(canonicalName(smContext.Supi, smContext.PDUSessionID))
@@ -329,6 +379,15 @@ func RemoveSMContext(ref string) {
 	}
 }
 
+// dropPFCPSession forgets the PFCP session of the SM context on the UPF
+func dropPFCPSession(nodeIP string, pfcpSessionContext *PFCPSessionContext) {
+	upfSessionCounter(nodeIP).Add(-1)
+	seidSMContextMap.Delete(pfcpSessionContext.LocalSEID)
+	if factory.SmfConfig.Configuration.EnableDbStore {
+		DeleteSmContextInDBBySEID(pfcpSessionContext.LocalSEID)
+	}
+}
+
 // *** add unit test ***//
 func GetSMContextBySEID(SEID uint64) (smContext *SMContext) {
 	if value, ok := seidSMContextMap.Load(SEID); ok {
@@ -341,13 +400,179 @@ func GetSMContextBySEID(SEID uint64) (smContext *SMContext) {
 	return
 }
 
+// staticUeIpAddr returns the static address configured for the UE in the DNN
+func (smContext *SMContext) staticUeIpAddr() net.IP {
+	for _, static := range SMF_Self().StaticIpInfo {
+		if static.Dnn != smContext.Dnn {
+			continue
+		}
+		if ip := net.ParseIP(static.ImsiIpInfo[smContext.Supi]); ip != nil {
+			return ip.To4()
+		}
+	}
+	return nil
+}
+
+// subscribedStaticIp returns the static address of the UE subscription data
+// matching the PDU session type, TS 29.503 DnnConfiguration
+func (smContext *SMContext) subscribedStaticIp() net.IP {
+	for _, addr := range smContext.DnnConfiguration.StaticIpAddress {
+		if smContext.SelectedPDUSessionType == nasMessage.PDUSessionTypeIPv6 {
+			if ip := net.ParseIP(addr.GetIpv6Addr()); ip != nil {
+				return ip
+			}
+			if ip, _, err := net.ParseCIDR(addr.GetIpv6Prefix()); err == nil {
+				return ip
+			}
+			continue
+		}
+		if ip := net.ParseIP(addr.GetIpv4Addr()).To4(); ip != nil {
+			return ip
+		}
+	}
+	return nil
+}
+
+// inUeIpPools reports whether the address belongs to a pool of the DNN
+func (smContext *SMContext) inUeIpPools(ip net.IP) bool {
+	if ip.To4() == nil || smContext.DNNInfo == nil || smContext.dhcpInfo() != nil {
+		return false
+	}
+	if pools := smContext.DNNInfo.UeIPPools; pools != nil {
+		return pools.Contains(ip)
+	}
+	if allocator := smContext.DNNInfo.UeIPAllocator; allocator != nil {
+		return allocator.Contains(ip)
+	}
+	return false
+}
+
+// reserveSubscribedIp blocks the static address of the subscription data, or
+// the Framed-IP-Address of the DN-AAA server, in the pool of the DNN. IPv6
+// addresses and addresses of DNNs served by a DHCP server are outside of the
+// SMF pools.
+func (smContext *SMContext) reserveSubscribedIp(ip net.IP) error {
+	smContext.PDUAddress = &UeIpAddr{Ip: ip}
+	if ip.To4() == nil || smContext.dhcpInfo() != nil {
+		smContext.SubPduSessLog.Infof("static IP[%s] allocated", ip.String())
+		return nil
+	}
+	if pools := smContext.DNNInfo.UeIPPools; pools != nil {
+		pool, err := pools.ReserveSubscribedIp(smContext.Supi, ip)
+		if err != nil {
+			smContext.PDUAddress = nil
+			return err
+		}
+		smContext.PDUAddress.Pool = pool
+	} else if allocator := smContext.DNNInfo.UeIPAllocator; allocator != nil {
+		if err := allocator.ReserveSubscribedIp(smContext.Supi, ip); err != nil {
+			smContext.PDUAddress = nil
+			return err
+		}
+	} else {
+		smContext.PDUAddress = nil
+		return fmt.Errorf("%w: no UE IP pool for DNN %s", ErrStaticIpConflict, smContext.Dnn)
+	}
+	smContext.SubPduSessLog.Infof("static IP[%s] allocated", ip.String())
+	return nil
+}
+
+// AllocateUeIpAddr allocates the UE address of the PDU session: the address
+// authorized by the DN-AAA server, the static address of the UE subscription
+// data or of the configuration, an address leased by the DHCP server of the
+// DNN, the address held for the UE or an address of the DNN pools
+func (smContext *SMContext) AllocateUeIpAddr() error {
+	if ip := smContext.DnAaaUeIpAddr(); ip != nil {
+		if smContext.inUeIpPools(ip) {
+			// blocked in the pool not to be allocated to another UE
+			return smContext.reserveSubscribedIp(ip)
+		}
+		smContext.PDUAddress = &UeIpAddr{Ip: ip, AaaProvided: true}
+		smContext.SubPduSessLog.Infof("IP[%s] provided by DN-AAA server", ip.String())
+		return nil
+	}
+
+	if ip := smContext.subscribedStaticIp(); ip != nil {
+		return smContext.reserveSubscribedIp(ip)
+	}
+
+	if info := smContext.dhcpInfo(); info != nil {
+		if ip := smContext.staticUeIpAddr(); ip != nil {
+			// static addresses are outside of the DHCP server scope
+			smContext.PDUAddress = &UeIpAddr{Ip: ip}
+			smContext.SubPduSessLog.Infof("static IP[%s] allocated", ip.String())
+			return nil
+		}
+		lease, err := dhcpClient(info).Acquire([]byte(smContext.Supi))
+		if err != nil {
+			return fmt.Errorf("DHCP lease from %s failed: %w", info.Server, err)
+		}
+		smContext.PDUAddress = &UeIpAddr{Ip: lease.IP, DhcpProvided: true}
+		smContext.DhcpLease = &DhcpLease{Lease: lease}
+		smContext.armDhcpRenewal(smContext.DhcpLease, time.Until(lease.RenewAt()))
+		smContext.SubPduSessLog.Infof("IP[%s] leased by DHCP server %s for %v", lease.IP.String(), info.Server, lease.LeaseTime)
+		return nil
+	}
+
+	if ip, pool := smContext.takeStickyIp(); ip != nil {
+		smContext.PDUAddress = &UeIpAddr{Ip: ip, Pool: pool}
+		smContext.SubPduSessLog.Infof("held IP[%s] reassigned", ip.String())
+		return nil
+	}
+
+	if pools := smContext.DNNInfo.UeIPPools; pools != nil {
+		if ip := smContext.staticUeIpAddr(); ip != nil {
+			smContext.PDUAddress = &UeIpAddr{Ip: ip}
+			smContext.SubPduSessLog.Infof("static IP[%s] allocated", ip.String())
+			return nil
+		}
+		ip, pool, err := pools.Allocate(smContext.Supi, smContext.ueIpPoolKey(pools.Selection))
+		if err != nil {
+			return err
+		}
+		smContext.PDUAddress = &UeIpAddr{Ip: ip, Pool: pool}
+		smContext.SubPduSessLog.Infof("IP alloc success IP[%s] from pool %s", ip.String(), pool)
+		return nil
+	}
+
+	if smContext.DNNInfo.UeIPAllocator == nil {
+		return fmt.Errorf("no UE IP pool for DNN %s", smContext.Dnn)
+	}
+	ip, err := smContext.DNNInfo.UeIPAllocator.Allocate(smContext.Supi)
+	if err != nil {
+		return err
+	}
+	smContext.PDUAddress = &UeIpAddr{Ip: ip, UpfProvided: false}
+	smContext.SubPduSessLog.Infof("IP alloc success IP[%s]", ip.String())
+	return nil
+}
+
 func (smContext *SMContext) ReleaseUeIpAddr() error {
 	if smContext.PDUAddress == nil {
 		logger.CtxLog.Warnf("ReleaseUeIpAddr: PduSessionUeAddress is nil, skipping release")
 		return nil
 	}
-	if ip := smContext.PDUAddress.Ip; ip != nil && !smContext.PDUAddress.UpfProvided {
-		smContext.SubPduSessLog.Infof("Release IP[%s]", smContext.PDUAddress.Ip.String())
+	if smContext.PDUAddress.DhcpProvided {
+		smContext.SubPduSessLog.Infof("Release DHCP lease of IP[%s]", smContext.PDUAddress.Ip.String())
+		smContext.releaseDhcpLease()
+		smContext.PDUAddress.Ip = net.IPv4(0, 0, 0, 0)
+		return nil
+	}
+	ip := smContext.PDUAddress.Ip
+	if ip.To4() == nil || smContext.PDUAddress.UpfProvided || smContext.PDUAddress.AaaProvided || smContext.DNNInfo == nil {
+		// the pools hold IPv4 addresses only
+		return nil
+	}
+	if (smContext.DNNInfo.UeIPPools != nil || smContext.DNNInfo.UeIPAllocator != nil) && smContext.holdStickyIp(ip) {
+		smContext.PDUAddress.Ip = net.IPv4(0, 0, 0, 0)
+		return nil
+	}
+	if pools := smContext.DNNInfo.UeIPPools; pools != nil {
+		smContext.SubPduSessLog.Infof("Release IP[%s]", ip.String())
+		pools.Release(smContext.Supi, smContext.PDUAddress.Pool, ip)
+		smContext.PDUAddress.Ip = net.IPv4(0, 0, 0, 0)
+	} else if smContext.DNNInfo.UeIPAllocator != nil {
+		smContext.SubPduSessLog.Infof("Release IP[%s]", ip.String())
 		smContext.DNNInfo.UeIPAllocator.Release(smContext.Supi, ip)
 		smContext.PDUAddress.Ip = net.IPv4(0, 0, 0, 0)
 	}
@@ -370,6 +595,9 @@ func (smContext *SMContext) SetCreateData(createData *models.SmContextCreateData
 	smContext.AddUeLocation = createData.AddUeLocation
 	smContext.OldPduSessionId = createData.GetOldPduSessionId()
 	smContext.ServingNfId = createData.GetServingNfId()
+	if createData.GetMaRequestInd() {
+		smContext.MaPdu = &MaPdu{}
+	}
 }
 
 // RebuildCommunicationClient reconstructs the Namf_Communication API client
@@ -405,6 +633,12 @@ func (smContext *SMContext) PDUAddressToNAS() (addr [12]byte, addrLen uint8) {
 	case nasMessage.PDUSessionTypeIPv4:
 		addrLen = 4 + 1
 	case nasMessage.PDUSessionTypeIPv6:
+		// interface identifier of the IPv6 link local address, TS 24.501 9.11.4.10
+		if ip := smContext.PDUAddress.Ip.To16(); ip != nil {
+			addr = [12]byte{}
+			copy(addr[:], ip[8:])
+		}
+		addrLen = 8 + 1
 	case nasMessage.PDUSessionTypeIPv4IPv6:
 		addrLen = 12 + 1
 	}
@@ -502,6 +736,7 @@ func (smContext *SMContext) AllocateLocalSEIDForDataPath(dataPath *DataPath) {
 			}
 
 			seidSMContextMap.Store(allocatedSEID, smContext)
+			upfSessionCounter(NodeIDtoIP).Add(1)
 
 			if factory.SmfConfig.Configuration.EnableDbStore {
 				StoreSeidContextInDB(allocatedSEID, smContext)
@@ -662,12 +897,21 @@ func (smContextState SMContextState) String() string {
 		return "SmStatePfcpRelease"
 	case SmStateN1N2TransferPending:
 		return "SmStateN1N2TransferPending"
+	case SmStateSecondaryAuthPending:
+		return "SmStateSecondaryAuthPending"
 
 	default:
 		return "Unknown State"
 	}
 }
 
+// dnnUnavailableErrors are the errors of a DNN unable to serve the PDU session the
+// UE is told to back off from, TS 24.501 6.4.1.4.2
+var dnnUnavailableErrors = map[string]bool{
+	"IpAllocError":     true,
+	"UPFDataPathError": true,
+}
+
 func (smContext *SMContext) GeneratePDUSessionEstablishmentReject(cause string) *httpwrapper.Response {
 	httpResponse := &httpwrapper.Response{
 		Header: nil,
@@ -679,9 +923,14 @@ func (smContext *SMContext) GeneratePDUSessionEstablishmentReject(cause string)
 		},
 	}
 
-	if buf, err := BuildGSMPDUSessionEstablishmentReject(
-		smContext,
-		errors.ErrorCause[cause]); err != nil {
+	var buf []byte
+	var err error
+	if dnnUnavailableErrors[cause] {
+		buf, err = BuildGSMPDUSessionEstablishmentRejectDnnUnavailable(smContext)
+	} else {
+		buf, err = BuildGSMPDUSessionEstablishmentReject(smContext, errors.ErrorCause[cause])
+	}
+	if err != nil {
 		return httpResponse
 	} else {
 		tmpFile, err := util.CreatePayloadTempFile(buf)
@@ -708,6 +957,9 @@ func (smContext *SMContext) CommitSmPolicyDecision(status bool) error {
 		if err != nil {
 			logger.CtxLog.Errorf("failed to commit SM Policy Decision, %v", err)
 		}
+
+		// Arm timers of time conditioned PCC rules
+		smContext.ScheduleConditionData()
 	}
 
 	// Release 0th index update
@@ -785,7 +1037,7 @@ func mapPduSessStateToMetricStateAndOp(state SMContextState) (string, mi.Subscri
 		return DISCONNECTED, mi.SubsOpDel
 	case SmStateRelease:
 		return DISCONNECTED, mi.SubsOpDel
-	case SmStateN1N2TransferPending:
+	case SmStateN1N2TransferPending, SmStateSecondaryAuthPending:
 		return IDLE, mi.SubsOpMod
 	default:
 		return "unknown", mi.SubsOpDel
@@ -21,8 +21,10 @@ type SnssaiSmfInfo struct {
 // SnssaiSmfDnnInfo records the SMF per S-NSSAI DNN information
 type SnssaiSmfDnnInfo struct {
 	UeIPAllocator *IPAllocator
-	DNS           DNS
-	MTU           uint16
+	// UeIPPools replace UeIPAllocator when several pools are configured
+	UeIPPools *UeIPPools
+	DNS       DNS
+	MTU       uint16
 }
 
 type DNS struct {
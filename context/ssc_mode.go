@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"slices"
+	"time"
+
+	"github.com/omec-project/nas/v2/nasConvert"
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/openapi/v2/models"
+)
+
+// SSC modes of a PDU session as coded in NAS, TS 24.501 9.11.4.16
+const (
+	SscMode1 uint8 = iota + 1
+	SscMode2
+	SscMode3
+)
+
+// defaultAddressLifetime is the lifetime of the PDU session of the previous
+// PSA of a DNN without SSC mode configuration
+const defaultAddressLifetime = 60 * time.Second
+
+func sscModeToNas(mode models.SscMode) uint8 {
+	switch mode {
+	case models.SSCMODE_SSC_MODE_2:
+		return SscMode2
+	case models.SSCMODE_SSC_MODE_3:
+		return SscMode3
+	case models.SSCMODE_SSC_MODE_1:
+		return SscMode1
+	}
+	return 0
+}
+
+// selectSscMode selects the SSC mode requested by the UE if the subscription
+// allows it, else the default SSC mode of the subscription, TS 23.501 5.6.9.3.
+// A UE without subscribed SSC modes gets SSC mode 1.
+func (smContext *SMContext) selectSscMode(requested uint8) {
+	sscModes := smContext.DnnConfiguration.SscModes
+	if requested != 0 && slices.ContainsFunc(sscModes.AllowedSscModes, func(mode models.SscMode) bool {
+		return sscModeToNas(mode) == requested
+	}) {
+		smContext.SscMode = requested
+	} else if mode := sscModeToNas(sscModes.DefaultSscMode); mode != 0 {
+		smContext.SscMode = mode
+	} else {
+		smContext.SscMode = SscMode1
+	}
+	if requested != 0 && requested != smContext.SscMode {
+		smContext.SubGsmLog.Infof("requested SSC mode %d not allowed, SSC mode %d selected", requested, smContext.SscMode)
+	}
+}
+
+// sscMode returns the SSC mode of the PDU session, SSC mode 1 if none was
+// selected
+func (smContext *SMContext) sscMode() uint8 {
+	if smContext.SscMode == 0 {
+		return SscMode1
+	}
+	return smContext.SscMode
+}
+
+// RetrieveAddressLifetime returns how long the PDU session of the previous
+// PSA of an SSC mode 3 PDU session of the DNN is kept
+func RetrieveAddressLifetime(dnn string) time.Duration {
+	for _, info := range smfContext.SscModeInfo {
+		if info.Dnn == dnn && info.AddressLifetime > 0 {
+			return time.Duration(info.AddressLifetime) * time.Second
+		}
+	}
+	return defaultAddressLifetime
+}
+
+// PsaRelocationRequired reports whether the PSA of an SSC mode 2 or 3 PDU
+// session does not serve the DNAI the UE moved to while another UPF does.
+// The caller holds the SMLock.
+func (smContext *SMContext) PsaRelocationRequired() bool {
+	if smContext.sscMode() == SscMode1 || smContext.psaRelocation || len(smContext.upPath) == 0 {
+		return false
+	}
+	upi := GetUserPlaneInformation()
+	selection := smContext.UPFSelectionParams()
+	if upi == nil || selection.Dnai == "" || selection.SNssai == nil {
+		return false
+	}
+	candidates := slices.DeleteFunc(upi.selectMatchUPF(selection), func(node *UPNode) bool {
+		return !node.healthy()
+	})
+	if len(candidates) == 0 {
+		return false
+	}
+	return !slices.Contains(candidates, smContext.upPath[len(smContext.upPath)-1])
+}
+
+// StartPsaRelocation marks the PSA relocation of an SSC mode 2 or 3 PDU
+// session as ongoing, false if the SSC mode does not allow it or it is
+// ongoing already. The caller holds the SMLock.
+func (smContext *SMContext) StartPsaRelocation() bool {
+	if smContext.sscMode() == SscMode1 || smContext.psaRelocation {
+		return false
+	}
+	smContext.psaRelocation = true
+	return true
+}
+
+// StopPsaRelocation allows a new PSA relocation of the PDU session. The
+// caller holds the SMLock.
+func (smContext *SMContext) StopPsaRelocation() {
+	smContext.psaRelocation = false
+}
+
+// pduSessionAddressLifetime returns the ePCO with the PDU session address
+// lifetime, TS 24.008 10.5.6.3
+func pduSessionAddressLifetime(lifetime time.Duration) []byte {
+	pco := nasConvert.NewProtocolConfigurationOptions()
+	pco.ProtocolOrContainerList = append(pco.ProtocolOrContainerList, &nasConvert.ProtocolOrContainerUnit{
+		ProtocolOrContainerID: nasMessage.PDUSessionAddressLifetimeDL,
+		LengthOfContents:      1,
+		Contents:              []byte{gprsTimer3ToNas(int(lifetime / time.Second))},
+	})
+	return pco.Marshal()
+}
@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"testing"
+	"time"
+
+	"github.com/omec-project/nas/v2"
+	"github.com/omec-project/nas/v2/nasConvert"
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/openapi/v2"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/factory"
+)
+
+func TestSelectSscMode(t *testing.T) {
+	sscModes := models.SscModes{
+		DefaultSscMode:  models.SSCMODE_SSC_MODE_1,
+		AllowedSscModes: []models.SscMode{models.SSCMODE_SSC_MODE_1, models.SSCMODE_SSC_MODE_3},
+	}
+	tests := []struct {
+		name      string
+		sscModes  models.SscModes
+		requested uint8
+		expected  uint8
+	}{
+		{name: "allowed requested mode", sscModes: sscModes, requested: SscMode3, expected: SscMode3},
+		{name: "requested mode not allowed", sscModes: sscModes, requested: SscMode2, expected: SscMode1},
+		{name: "no requested mode", sscModes: models.SscModes{DefaultSscMode: models.SSCMODE_SSC_MODE_2}, expected: SscMode2},
+		{name: "no subscribed mode", requested: SscMode3, expected: SscMode1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			smContext := &SMContext{}
+			smContext.initLogTags()
+			smContext.DnnConfiguration.SscModes = tc.sscModes
+			smContext.selectSscMode(tc.requested)
+			if smContext.SscMode != tc.expected {
+				t.Errorf("expected SSC mode %d, got %d", tc.expected, smContext.SscMode)
+			}
+		})
+	}
+}
+
+func TestPsaRelocationRequired(t *testing.T) {
+	originalDnai := smfContext.DnaiInfo
+	originalUpi := smfContext.UserPlaneInformation
+	t.Cleanup(func() {
+		smfContext.DnaiInfo = originalDnai
+		smfContext.UserPlaneInformation = originalUpi
+	})
+	smfContext.DnaiInfo = []factory.DnaiInfo{
+		{Dnai: "edge1", Tais: []string{"208-93-000001"}},
+		{Dnai: "edge2", Tais: []string{"208-93-000002"}},
+		{Dnai: "edge3", Tais: []string{"208-93-000003"}},
+	}
+	an := &UPNode{Type: UPNODE_AN, NodeID: *NewNodeID("192.168.1.1")}
+	edge1 := newDnaiUPNode("10.0.4.1", []string{"edge1"}, an)
+	edge2 := newDnaiUPNode("10.0.4.2", []string{"edge2"}, an)
+	edge1.UPF.UPFStatus = AssociatedSetUpSuccess
+	edge2.UPF.UPFStatus = AssociatedSetUpSuccess
+	smfContext.UserPlaneInformation = &UserPlaneInformation{
+		UPNodes:       map[string]*UPNode{"gnb": an, "edge1": edge1, "edge2": edge2},
+		UPFs:          map[string]*UPNode{"edge1": edge1, "edge2": edge2},
+		AccessNetwork: map[string]*UPNode{"gnb": an},
+	}
+
+	newSmContext := func(sscMode uint8, tac string) *SMContext {
+		return &SMContext{
+			Dnn:     "internet",
+			Snssai:  &models.Snssai{Sst: 1, Sd: openapi.PtrString("010203")},
+			SscMode: sscMode,
+			upPath:  UPPath{edge1},
+			UeLocation: &models.UserLocation{NrLocation: &models.NrLocation{
+				Tai: models.Tai{PlmnId: models.PlmnId{Mcc: "208", Mnc: "93"}, Tac: tac},
+			}},
+		}
+	}
+
+	if newSmContext(SscMode3, "000001").PsaRelocationRequired() {
+		t.Errorf("expected no relocation in the DNAI of the PSA")
+	}
+	if newSmContext(SscMode1, "000002").PsaRelocationRequired() {
+		t.Errorf("expected no relocation in SSC mode 1")
+	}
+	if newSmContext(SscMode3, "000003").PsaRelocationRequired() {
+		t.Errorf("expected no relocation to a DNAI without UPF")
+	}
+
+	smContext := newSmContext(SscMode2, "000002")
+	if !smContext.PsaRelocationRequired() {
+		t.Fatalf("expected relocation to the UPF of the new DNAI")
+	}
+	if !smContext.StartPsaRelocation() {
+		t.Fatalf("expected the relocation to start")
+	}
+	if smContext.PsaRelocationRequired() || smContext.StartPsaRelocation() {
+		t.Errorf("expected a single ongoing relocation")
+	}
+}
+
+func TestBuildGSMPDUSessionAddressLifetimeCommand(t *testing.T) {
+	smContext := &SMContext{PDUSessionID: 5}
+	buf, err := BuildGSMPDUSessionAddressLifetimeCommand(smContext, 2*time.Minute)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	m := nas.NewMessage()
+	if err = m.PlainNasDecode(&buf); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	cmd := m.PDUSessionModificationCommand
+	if cmd.Cause5GSM == nil || cmd.GetCauseValue() != nasMessage.Cause5GSMReactivationRequested {
+		t.Errorf("expected cause reactivation requested")
+	}
+	if cmd.ExtendedProtocolConfigurationOptions == nil {
+		t.Fatalf("expected an ePCO")
+	}
+	pco := nasConvert.NewProtocolConfigurationOptions()
+	if err = pco.UnMarshal(cmd.GetExtendedProtocolConfigurationOptionsContents()); err != nil {
+		t.Fatalf("decode ePCO: %v", err)
+	}
+	if len(pco.ProtocolOrContainerList) != 1 {
+		t.Fatalf("expected one container, got %d", len(pco.ProtocolOrContainerList))
+	}
+	container := pco.ProtocolOrContainerList[0]
+	if container.ProtocolOrContainerID != nasMessage.PDUSessionAddressLifetimeDL ||
+		len(container.Contents) != 1 || container.Contents[0] != gprsTimer3ToNas(120) {
+		t.Errorf("unexpected address lifetime container %+v", container)
+	}
+}
@@ -0,0 +1,230 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/factory"
+	"github.com/omec-project/smf/logger"
+	"github.com/omec-project/util/mongoapi"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const StickyIpCol = "smf.data.stickyIp"
+
+// StickyIp is the last address of a UE in a DNN, held for the UE after the
+// release of its PDU session and reassigned on its next PDU session.
+type StickyIp struct {
+	Expiry time.Time `json:"expiry" yaml:"expiry" bson:"expiry"`
+	Supi   string    `json:"supi" yaml:"supi" bson:"supi"`
+	Dnn    string    `json:"dnn" yaml:"dnn" bson:"dnn"`
+	Sd     string    `json:"sd" yaml:"sd" bson:"sd"`
+	Ip     string    `json:"ip" yaml:"ip" bson:"ip"`
+	Pool   string    `json:"pool,omitempty" yaml:"pool" bson:"pool,omitempty"`
+	Sst    int32     `json:"sst" yaml:"sst" bson:"sst"`
+}
+
+func (s StickyIp) key() string {
+	return fmt.Sprintf("%s/%s/%d/%s", s.Supi, s.Dnn, s.Sst, s.Sd)
+}
+
+func (s StickyIp) snssai() models.Snssai {
+	snssai := models.Snssai{Sst: s.Sst}
+	if s.Sd != "" {
+		snssai.SetSd(s.Sd)
+	}
+	return snssai
+}
+
+type stickyIpHold struct {
+	timer *time.Timer
+	StickyIp
+}
+
+var stickyIps = struct {
+	holds map[string]*stickyIpHold
+	mu    sync.Mutex
+}{
+	holds: make(map[string]*stickyIpHold),
+}
+
+// stickyIpHoldTime returns how long the address of a UE is held in the DNN,
+// 0 if the DNN is not in sticky mode
+func stickyIpHoldTime(dnn string) time.Duration {
+	for _, info := range smfContext.StickyIpInfo {
+		if info.Dnn == dnn {
+			return time.Duration(info.HoldTime) * time.Second
+		}
+	}
+	return 0
+}
+
+func (smContext *SMContext) stickyIpKey() StickyIp {
+	sticky := StickyIp{Supi: smContext.Supi, Dnn: smContext.Dnn}
+	if smContext.Snssai != nil {
+		sticky.Sst, sticky.Sd = smContext.Snssai.GetSst(), smContext.Snssai.GetSd()
+	}
+	return sticky
+}
+
+// holdStickyIp keeps the address of the released PDU session blocked in the
+// pool for the UE during the hold time of the DNN
+func (smContext *SMContext) holdStickyIp(ip net.IP) bool {
+	holdTime := stickyIpHoldTime(smContext.Dnn)
+	if holdTime <= 0 || smContext.Supi == "" || smContext.staticUeIpAddr() != nil ||
+		smContext.subscribedStaticIp() != nil || smContext.DnAaaUeIpAddr() != nil {
+		return false
+	}
+	sticky := smContext.stickyIpKey()
+	sticky.Ip = ip.String()
+	sticky.Pool = smContext.PDUAddress.Pool
+	sticky.Expiry = time.Now().Add(holdTime)
+	armStickyIp(sticky)
+	if factory.SmfConfig.Configuration.EnableDbStore {
+		storeStickyIpInDB(sticky)
+	}
+	smContext.SubPduSessLog.Infof("IP[%s] held for %v", sticky.Ip, holdTime)
+	return true
+}
+
+// takeStickyIp returns the address held for the UE, still blocked in the pool
+func (smContext *SMContext) takeStickyIp() (net.IP, string) {
+	if stickyIpHoldTime(smContext.Dnn) <= 0 {
+		return nil, ""
+	}
+	key := smContext.stickyIpKey().key()
+	stickyIps.mu.Lock()
+	hold, ok := stickyIps.holds[key]
+	if ok {
+		hold.timer.Stop()
+		delete(stickyIps.holds, key)
+	}
+	stickyIps.mu.Unlock()
+	if !ok {
+		return nil, ""
+	}
+	if factory.SmfConfig.Configuration.EnableDbStore {
+		deleteStickyIpInDB(hold.StickyIp)
+	}
+	return net.ParseIP(hold.Ip).To4(), hold.Pool
+}
+
+func armStickyIp(sticky StickyIp) {
+	stickyIps.mu.Lock()
+	defer stickyIps.mu.Unlock()
+	if hold, ok := stickyIps.holds[sticky.key()]; ok {
+		hold.timer.Stop()
+	}
+	hold := &stickyIpHold{StickyIp: sticky}
+	hold.timer = time.AfterFunc(time.Until(sticky.Expiry), func() {
+		expireStickyIp(hold)
+	})
+	stickyIps.holds[sticky.key()] = hold
+}
+
+// expireStickyIp releases the held address to its pool
+func expireStickyIp(hold *stickyIpHold) {
+	stickyIps.mu.Lock()
+	if stickyIps.holds[hold.key()] != hold {
+		// taken meanwhile
+		stickyIps.mu.Unlock()
+		return
+	}
+	delete(stickyIps.holds, hold.key())
+	stickyIps.mu.Unlock()
+
+	if factory.SmfConfig.Configuration.EnableDbStore {
+		deleteStickyIpInDB(hold.StickyIp)
+	}
+	ip := net.ParseIP(hold.Ip).To4()
+	dnnInfo := RetrieveDnnInformation(hold.snssai(), hold.Dnn)
+	switch {
+	case ip == nil || dnnInfo == nil:
+	case dnnInfo.UeIPPools != nil:
+		dnnInfo.UeIPPools.Release(hold.Supi, hold.Pool, ip)
+	case dnnInfo.UeIPAllocator != nil:
+		dnnInfo.UeIPAllocator.Release(hold.Supi, ip)
+	}
+	logger.CtxLog.Infof("IP[%s] held for %s in DNN %s released", hold.Ip, hold.Supi, hold.Dnn)
+}
+
+// blockStickyIps blocks the held addresses in the pools, e.g. after the pools
+// are rebuilt from a configuration update
+func blockStickyIps(snssaiInfos []SnssaiSmfInfo) {
+	stickyIps.mu.Lock()
+	defer stickyIps.mu.Unlock()
+	for _, hold := range stickyIps.holds {
+		ip := net.ParseIP(hold.Ip).To4()
+		if ip == nil {
+			continue
+		}
+		lookup := SNssai{Sst: hold.Sst, Sd: hold.Sd}
+		for _, snssaiInfo := range snssaiInfos {
+			dnnInfo, ok := snssaiInfo.DnnInfos[hold.Dnn]
+			if !ok || !snssaiInfo.Snssai.Equal(&lookup) {
+				continue
+			}
+			if dnnInfo.UeIPPools != nil {
+				dnnInfo.UeIPPools.Block(ip)
+			} else if dnnInfo.UeIPAllocator != nil && dnnInfo.UeIPAllocator.Contains(ip) {
+				dnnInfo.UeIPAllocator.BlockIp(ip)
+			}
+		}
+	}
+}
+
+// RestoreStickyIps re-arms the held addresses kept in the DB, e.g. after a
+// restart. Holds which expired meanwhile are released at once.
+func RestoreStickyIps() {
+	results, err := mongoapi.CommonDBClient.RestfulAPIGetMany(StickyIpCol, bson.M{})
+	if err != nil {
+		logger.DataRepoLog.Warnln(err)
+		return
+	}
+
+	for _, result := range results {
+		var sticky StickyIp
+		if err := json.Unmarshal(mapToByte(result), &sticky); err != nil {
+			logger.DataRepoLog.Errorf("sticky IP unmarshall error: %v", err)
+			continue
+		}
+		logger.DataRepoLog.Infof("restore IP[%s] held for %s in DNN %s", sticky.Ip, sticky.Supi, sticky.Dnn)
+		armStickyIp(sticky)
+	}
+
+	smfContext.RLock()
+	defer smfContext.RUnlock()
+	blockStickyIps(smfContext.SnssaiInfos)
+}
+
+func storeStickyIpInDB(sticky StickyIp) {
+	tmp, err := json.Marshal(sticky)
+	if err != nil {
+		logger.DataRepoLog.Errorf("sticky IP marshall error: %v", err)
+		return
+	}
+	var data bson.M
+	if err = json.Unmarshal(tmp, &data); err != nil {
+		logger.DataRepoLog.Errorf("sticky IP unmarshall error: %v", err)
+		return
+	}
+
+	filter := bson.M{"supi": sticky.Supi, "dnn": sticky.Dnn, "sst": sticky.Sst, "sd": sticky.Sd}
+	if _, err = mongoapi.CommonDBClient.RestfulAPIPost(StickyIpCol, filter, data); err != nil {
+		logger.DataRepoLog.Warnln(err)
+	}
+}
+
+func deleteStickyIpInDB(sticky StickyIp) {
+	filter := bson.M{"supi": sticky.Supi, "dnn": sticky.Dnn, "sst": sticky.Sst, "sd": sticky.Sd}
+	if err := mongoapi.CommonDBClient.RestfulAPIDeleteOne(StickyIpCol, filter); err != nil {
+		logger.DataRepoLog.Warnln(err)
+	}
+}
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/omec-project/openapi/v2"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/factory"
+)
+
+func setupStickyDnn(t *testing.T) *SnssaiSmfDnnInfo {
+	t.Helper()
+	allocator, err := NewIPAllocator("10.60.0.0/29")
+	if err != nil {
+		t.Fatalf("new allocator: %v", err)
+	}
+	dnnInfo := &SnssaiSmfDnnInfo{UeIPAllocator: allocator}
+
+	originalCfg := factory.SmfConfig.Configuration
+	originalInfos, originalSticky := smfContext.SnssaiInfos, smfContext.StickyIpInfo
+	t.Cleanup(func() {
+		factory.SmfConfig.Configuration = originalCfg
+		smfContext.SnssaiInfos, smfContext.StickyIpInfo = originalInfos, originalSticky
+		stickyIps.mu.Lock()
+		for key, hold := range stickyIps.holds {
+			hold.timer.Stop()
+			delete(stickyIps.holds, key)
+		}
+		stickyIps.mu.Unlock()
+	})
+	factory.SmfConfig.Configuration = &factory.Configuration{}
+	smfContext.SnssaiInfos = []SnssaiSmfInfo{{
+		Snssai:   SNssai{Sst: 1, Sd: "010203"},
+		DnnInfos: map[string]*SnssaiSmfDnnInfo{"iot": dnnInfo},
+	}}
+	smfContext.StickyIpInfo = []factory.StickyIpInfo{{Dnn: "iot", HoldTime: 3600}}
+	return dnnInfo
+}
+
+func TestStickyIpReassigned(t *testing.T) {
+	dnnInfo := setupStickyDnn(t)
+
+	first := newTestSMContext(t, "imsi-1", "iot")
+	first.Snssai = &models.Snssai{Sst: 1, Sd: openapi.PtrString("010203")}
+	first.DNNInfo = dnnInfo
+	if err := first.AllocateUeIpAddr(); err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	held := first.PDUAddress.Ip
+	if err := first.ReleaseUeIpAddr(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if _, allocated := dnnInfo.UeIPAllocator.Usage(); allocated != 1 {
+		t.Errorf("expected the address to be held, %d allocated", allocated)
+	}
+
+	other := newTestSMContext(t, "imsi-2", "iot")
+	other.Snssai = &models.Snssai{Sst: 1, Sd: openapi.PtrString("010203")}
+	other.DNNInfo = dnnInfo
+	if err := other.AllocateUeIpAddr(); err != nil || other.PDUAddress.Ip.Equal(held) {
+		t.Errorf("expected another address for imsi-2, got %v %v", other.PDUAddress, err)
+	}
+
+	again := newTestSMContext(t, "imsi-1", "iot")
+	again.Snssai = &models.Snssai{Sst: 1, Sd: openapi.PtrString("010203")}
+	again.DNNInfo = dnnInfo
+	if err := again.AllocateUeIpAddr(); err != nil || !again.PDUAddress.Ip.Equal(held) {
+		t.Errorf("expected held address %v, got %v %v", held, again.PDUAddress, err)
+	}
+	if ip, _ := again.takeStickyIp(); ip != nil {
+		t.Errorf("expected the hold to be taken, got %v", ip)
+	}
+}
+
+func TestStickyIpExpiry(t *testing.T) {
+	dnnInfo := setupStickyDnn(t)
+
+	smContext := newTestSMContext(t, "imsi-1", "iot")
+	smContext.Snssai = &models.Snssai{Sst: 1, Sd: openapi.PtrString("010203")}
+	smContext.DNNInfo = dnnInfo
+	if err := smContext.AllocateUeIpAddr(); err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	sticky := smContext.stickyIpKey()
+	sticky.Ip = smContext.PDUAddress.Ip.String()
+	sticky.Expiry = time.Now().Add(10 * time.Millisecond)
+	armStickyIp(sticky)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, allocated := dnnInfo.UeIPAllocator.Usage(); allocated == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("held address not released on expiry")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if ip, _ := smContext.takeStickyIp(); ip != nil {
+		t.Errorf("expected no hold after expiry, got %v", ip)
+	}
+}
+
+func TestBlockStickyIps(t *testing.T) {
+	dnnInfo := setupStickyDnn(t)
+	armStickyIp(StickyIp{
+		Supi:   "imsi-1",
+		Dnn:    "iot",
+		Sst:    1,
+		Sd:     "010203",
+		Ip:     "10.60.0.1",
+		Expiry: time.Now().Add(time.Hour),
+	})
+
+	// pools rebuilt from a configuration update
+	blockStickyIps(smfContext.SnssaiInfos)
+	ip, err := dnnInfo.UeIPAllocator.Allocate("imsi-2")
+	if err != nil || ip.Equal(net.ParseIP("10.60.0.1")) {
+		t.Errorf("expected the held address to be blocked, allocated %v %v", ip, err)
+	}
+}
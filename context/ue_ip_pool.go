@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/omec-project/smf/factory"
+	"github.com/omec-project/smf/logger"
+	"github.com/omec-project/smf/metrics"
+)
+
+// UE address pool selection policies of a DNN
+const (
+	UeIpPoolSelectionUpf        = "upf"
+	UeIpPoolSelectionEnterprise = "enterprise"
+	UeIpPoolSelectionTai        = "tai"
+)
+
+// UeIPPool is a UE address pool of a DNN, overflowing to its secondary pool
+// when exhausted
+type UeIPPool struct {
+	allocator *IPAllocator
+	Name      string
+	secondary string
+	keys      []string
+}
+
+// UeIPPools are the UE address pools of a DNN, selected by UPF, enterprise or TAI
+type UeIPPools struct {
+	dnn       string
+	Selection string
+	pools     []*UeIPPool
+}
+
+// findUeIpPoolInfo returns the pools configured for the DNN of the slice
+func findUeIpPoolInfo(infos []factory.UeIpPoolInfo, dnn string, snssai SNssai) *factory.UeIpPoolInfo {
+	for i := range infos {
+		info := &infos[i]
+		if info.Dnn != dnn {
+			continue
+		}
+		if info.Sst != 0 && (info.Sst != snssai.Sst || info.Sd != snssai.Sd) {
+			continue
+		}
+		return info
+	}
+	return nil
+}
+
+func NewUeIPPools(info *factory.UeIpPoolInfo, staticIpInfo []factory.StaticIpInfo,
+	allocation *factory.UeIpAllocation,
+) (*UeIPPools, error) {
+	switch info.Selection {
+	case UeIpPoolSelectionUpf, UeIpPoolSelectionEnterprise, UeIpPoolSelectionTai:
+	default:
+		return nil, fmt.Errorf("unknown pool selection %q", info.Selection)
+	}
+
+	p := &UeIPPools{dnn: info.Dnn, Selection: info.Selection}
+	for i := range info.Pools {
+		poolInfo := &info.Pools[i]
+		if p.pool(poolInfo.Name) != nil {
+			return nil, fmt.Errorf("duplicate pool %s", poolInfo.Name)
+		}
+		allocator, err := newConfiguredIPAllocator(poolInfo.Cidr, allocation, poolInfo)
+		if err != nil {
+			return nil, fmt.Errorf("pool %s: %w", poolInfo.Name, err)
+		}
+		// block the static addresses of the DNN falling in the pool
+		staticIps := map[string]string{}
+		for _, static := range staticIpInfo {
+			if static.Dnn != info.Dnn {
+				continue
+			}
+			for imsi, ipStr := range static.ImsiIpInfo {
+				if ip := net.ParseIP(ipStr); ip != nil && allocator.Contains(ip) {
+					staticIps[imsi] = ipStr
+				}
+			}
+		}
+		allocator.ReserveStaticIps(&staticIps)
+
+		pool := &UeIPPool{
+			allocator: allocator,
+			Name:      poolInfo.Name,
+			secondary: poolInfo.Secondary,
+			keys:      poolInfo.Keys,
+		}
+		p.pools = append(p.pools, pool)
+		p.updateStats(pool)
+	}
+	for _, pool := range p.pools {
+		if pool.secondary != "" && p.pool(pool.secondary) == nil {
+			return nil, fmt.Errorf("unknown secondary pool %s of pool %s", pool.secondary, pool.Name)
+		}
+	}
+	if len(p.pools) == 0 {
+		return nil, fmt.Errorf("no pool")
+	}
+	return p, nil
+}
+
+func (p *UeIPPools) pool(name string) *UeIPPool {
+	for _, pool := range p.pools {
+		if pool.Name == name {
+			return pool
+		}
+	}
+	return nil
+}
+
+// selectPool returns the pool of the key, else the first pool without keys
+func (p *UeIPPools) selectPool(key string) *UeIPPool {
+	var fallback *UeIPPool
+	for _, pool := range p.pools {
+		if key != "" && slices.Contains(pool.keys, key) {
+			return pool
+		}
+		if fallback == nil && len(pool.keys) == 0 {
+			fallback = pool
+		}
+	}
+	return fallback
+}
+
+// Allocate allocates an address of the pool selected by the key and returns
+// it with the name of the pool it was allocated from
+func (p *UeIPPools) Allocate(imsi, key string) (net.IP, string, error) {
+	primary := p.selectPool(key)
+	if primary == nil {
+		return nil, "", fmt.Errorf("no UE IP pool of DNN %s for %s %q", p.dnn, p.Selection, key)
+	}
+	visited := map[string]bool{}
+	for pool := primary; pool != nil && !visited[pool.Name]; pool = p.pool(pool.secondary) {
+		visited[pool.Name] = true
+		ip, err := pool.allocator.Allocate(imsi)
+		if err != nil {
+			logger.CtxLog.Warnf("UE IP pool %s of DNN %s exhausted: %v", pool.Name, p.dnn, err)
+			continue
+		}
+		if pool != primary {
+			logger.CtxLog.Infof("UE IP pool %s of DNN %s exhausted, IP[%s] allocated from pool %s",
+				primary.Name, p.dnn, ip.String(), pool.Name)
+		}
+		p.updateStats(pool)
+		return ip, pool.Name, nil
+	}
+	return nil, "", fmt.Errorf("UE IP pool %s of DNN %s and its secondary pools exhausted", primary.Name, p.dnn)
+}
+
+// ReserveSubscribedIp blocks the static address of the UE subscription data in
+// the pool it belongs to and returns the name of the pool
+func (p *UeIPPools) ReserveSubscribedIp(imsi string, ip net.IP) (string, error) {
+	for _, pool := range p.pools {
+		if !pool.allocator.Contains(ip) {
+			continue
+		}
+		if err := pool.allocator.ReserveSubscribedIp(imsi, ip); err != nil {
+			return "", err
+		}
+		p.updateStats(pool)
+		return pool.Name, nil
+	}
+	return "", fmt.Errorf("%w: IP[%s] outside of the UE IP pools of DNN %s", ErrStaticIpConflict, ip.String(), p.dnn)
+}
+
+// Contains reports whether the address belongs to one of the pools
+func (p *UeIPPools) Contains(ip net.IP) bool {
+	for _, pool := range p.pools {
+		if pool.allocator.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Block blocks the address in the pool it belongs to
+func (p *UeIPPools) Block(ip net.IP) {
+	for _, pool := range p.pools {
+		if pool.allocator.Contains(ip) {
+			pool.allocator.BlockIp(ip)
+			p.updateStats(pool)
+			return
+		}
+	}
+}
+
+// Release releases the address to the pool it was allocated from
+func (p *UeIPPools) Release(imsi, name string, ip net.IP) {
+	pool := p.pool(name)
+	if pool == nil {
+		for _, candidate := range p.pools {
+			if candidate.allocator.Contains(ip) {
+				pool = candidate
+				break
+			}
+		}
+	}
+	if pool == nil {
+		logger.CtxLog.Warnf("IP[%s] outside of the UE IP pools of DNN %s", ip.String(), p.dnn)
+		return
+	}
+	pool.allocator.Release(imsi, ip)
+	p.updateStats(pool)
+}
+
+func (p *UeIPPools) updateStats(pool *UeIPPool) {
+	size, allocated := pool.allocator.Usage()
+	metrics.SetUeIpPoolStats(p.dnn, pool.Name, size, allocated)
+}
+
+// ueIpPoolKey returns the UPF, enterprise or TAI selecting the UE address pool
+func (smContext *SMContext) ueIpPoolKey(selection string) string {
+	switch selection {
+	case UeIpPoolSelectionUpf:
+		return smContext.anchorUpfName()
+	case UeIpPoolSelectionEnterprise:
+		return smContext.enterprise()
+	case UeIpPoolSelectionTai:
+		return smContext.ueTai()
+	}
+	return ""
+}
+
+// ueTai returns the TAI of the UE as mcc-mnc-tac
+func (smContext *SMContext) ueTai() string {
+	if loc := smContext.UeLocation; loc != nil && loc.NrLocation != nil {
+		tai := loc.NrLocation.Tai
+		return tai.PlmnId.Mcc + "-" + tai.PlmnId.Mnc + "-" + strings.ToLower(tai.Tac)
+	}
+	return ""
+}
+
+// anchorUpfName returns the name of the anchor UPF selected for the PDU session
+func (smContext *SMContext) anchorUpfName() string {
+	upi := GetUserPlaneInformation()
+	if upi == nil || smContext.Snssai == nil {
+		return ""
+	}
+	path := smContext.UserPlanePath()
+	if len(path) == 0 {
+		return ""
+	}
+	return upi.upfName(path[len(path)-1])
+}
+
+// upfName returns the name of the UPF node
+func (upi *UserPlaneInformation) upfName(upf *UPNode) string {
+	for name, node := range upi.UPFs {
+		if node == upf {
+			return name
+		}
+	}
+	return ""
+}
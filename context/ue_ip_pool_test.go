@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"net"
+	"testing"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/factory"
+)
+
+func TestUeIPPoolsOverflow(t *testing.T) {
+	info := &factory.UeIpPoolInfo{
+		Dnn:       "internet",
+		Selection: UeIpPoolSelectionUpf,
+		Pools: []factory.UeIpPool{
+			{Name: "upf1-pool", Cidr: "10.250.0.0/30", Keys: []string{"upf1"}, Secondary: "shared-pool"},
+			{Name: "shared-pool", Cidr: "10.251.0.0/29"},
+		},
+	}
+	pools, err := NewUeIPPools(info, nil, nil)
+	if err != nil {
+		t.Fatalf("new pools: %v", err)
+	}
+
+	// a /30 pool holds 2 UE addresses
+	upf1 := &net.IPNet{IP: net.ParseIP("10.250.0.0"), Mask: net.CIDRMask(30, 32)}
+	for i := range 2 {
+		ip, pool, err := pools.Allocate("imsi-1", "upf1")
+		if err != nil || pool != "upf1-pool" || !upf1.Contains(ip) {
+			t.Fatalf("allocation %d: unexpected IP[%v] from pool %s: %v", i, ip, pool, err)
+		}
+	}
+	ip, pool, err := pools.Allocate("imsi-1", "upf1")
+	if err != nil || pool != "shared-pool" {
+		t.Fatalf("expected overflow to the secondary pool, got IP[%v] from pool %s: %v", ip, pool, err)
+	}
+	if size, allocated := pools.pool("shared-pool").allocator.Usage(); size != 6 || allocated != 1 {
+		t.Errorf("unexpected usage %d/%d", allocated, size)
+	}
+
+	pools.Release("imsi-1", pool, ip)
+	if _, allocated := pools.pool("shared-pool").allocator.Usage(); allocated != 0 {
+		t.Errorf("expected the address to be released, %d allocated", allocated)
+	}
+
+	ip, pool, err = pools.Allocate("imsi-2", "upf2")
+	if err != nil || pool != "shared-pool" {
+		t.Errorf("expected the pool without keys for an unknown UPF, got IP[%v] from pool %s: %v", ip, pool, err)
+	}
+}
+
+func TestUeIPPoolsExhausted(t *testing.T) {
+	info := &factory.UeIpPoolInfo{
+		Dnn:       "internet",
+		Selection: UeIpPoolSelectionTai,
+		Pools: []factory.UeIpPool{
+			{Name: "a", Cidr: "10.250.0.0/30", Keys: []string{"208-93-000001"}, Secondary: "b"},
+			{Name: "b", Cidr: "10.251.0.0/30", Secondary: "a"},
+		},
+	}
+	pools, err := NewUeIPPools(info, nil, nil)
+	if err != nil {
+		t.Fatalf("new pools: %v", err)
+	}
+	for range 4 {
+		if _, _, err := pools.Allocate("imsi-1", "208-93-000001"); err != nil {
+			t.Fatalf("allocate: %v", err)
+		}
+	}
+	if _, _, err := pools.Allocate("imsi-1", "208-93-000001"); err == nil {
+		t.Errorf("expected error when the pools are exhausted")
+	}
+}
+
+func TestNewUeIPPoolsInvalid(t *testing.T) {
+	for name, info := range map[string]*factory.UeIpPoolInfo{
+		"selection": {Selection: "random", Pools: []factory.UeIpPool{{Name: "a", Cidr: "10.0.0.0/24"}}},
+		"cidr":      {Selection: UeIpPoolSelectionUpf, Pools: []factory.UeIpPool{{Name: "a", Cidr: "10.0.0.0"}}},
+		"duplicate": {Selection: UeIpPoolSelectionUpf, Pools: []factory.UeIpPool{{Name: "a", Cidr: "10.0.0.0/24"}, {Name: "a", Cidr: "10.1.0.0/24"}}},
+		"secondary": {Selection: UeIpPoolSelectionUpf, Pools: []factory.UeIpPool{{Name: "a", Cidr: "10.0.0.0/24", Secondary: "b"}}},
+	} {
+		if _, err := NewUeIPPools(info, nil, nil); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestAllocateUeIpAddrFromPools(t *testing.T) {
+	info := &factory.UeIpPoolInfo{
+		Dnn:       "internet",
+		Selection: UeIpPoolSelectionTai,
+		Pools: []factory.UeIpPool{
+			{Name: "north", Cidr: "10.250.0.0/24", Keys: []string{"208-93-00000a"}},
+			{Name: "default", Cidr: "10.251.0.0/24"},
+		},
+	}
+	static := []factory.StaticIpInfo{{Dnn: "internet", ImsiIpInfo: map[string]string{"imsi-2": "10.250.0.1"}}}
+	pools, err := NewUeIPPools(info, static, nil)
+	if err != nil {
+		t.Fatalf("new pools: %v", err)
+	}
+
+	smContext := &SMContext{
+		Supi:    "imsi-1",
+		Dnn:     "internet",
+		DNNInfo: &SnssaiSmfDnnInfo{UeIPPools: pools},
+		UeLocation: &models.UserLocation{NrLocation: &models.NrLocation{Tai: models.Tai{
+			PlmnId: models.PlmnId{Mcc: "208", Mnc: "93"},
+			Tac:    "00000A",
+		}}},
+	}
+	smContext.initLogTags()
+	if err := smContext.AllocateUeIpAddr(); err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	// the static address of imsi-2 is blocked in the pool
+	if smContext.PDUAddress.Pool != "north" || !smContext.PDUAddress.Ip.Equal(net.ParseIP("10.250.0.2")) {
+		t.Errorf("unexpected PDU address %+v", smContext.PDUAddress)
+	}
+	if err := smContext.ReleaseUeIpAddr(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if _, allocated := pools.pool("north").allocator.Usage(); allocated != 1 {
+		t.Errorf("expected only the static address allocated, got %d", allocated)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/omec-project/openapi/v2/models"
 	"github.com/omec-project/smf/factory"
 	"github.com/omec-project/smf/logger"
+	"github.com/omec-project/smf/qos"
 	"github.com/omec-project/util/idgenerator"
 )
 
@@ -66,16 +67,18 @@ type UPF struct {
 	N9Interfaces       []UPFInterfaceInfo
 	UPFunctionFeatures *UPFunctionFeatures
 
-	pdrPool sync.Map
-	farPool sync.Map
-	barPool sync.Map
-	qerPool sync.Map
-	// urrPool        sync.Map
+	pdrPool        sync.Map
+	farPool        sync.Map
+	barPool        sync.Map
+	qerPool        sync.Map
+	urrPool        sync.Map
+	marPool        sync.Map
 	pdrIDGenerator *idgenerator.IDGenerator
 	farIDGenerator *idgenerator.IDGenerator
 	barIDGenerator *idgenerator.IDGenerator
 	urrIDGenerator *idgenerator.IDGenerator
 	qerIDGenerator *idgenerator.IDGenerator
+	marIDGenerator *idgenerator.IDGenerator
 
 	RecoveryTimeStamp RecoveryTimeStamp
 	NodeID            NodeID
@@ -83,6 +86,17 @@ type UPF struct {
 	uuid              uuid.UUID
 	Port              uint16
 	NHeartBeat        uint8
+	// LoadMetric is the load of the UPF in percent reported in the PFCP Load
+	// Control Information
+	LoadMetric         uint8
+	LoadSequenceNumber uint32
+	// OverloadReductionMetric is the percentage of new PFCP sessions to
+	// throttle towards the UPF until OverloadValidUntil, reported in the PFCP
+	// Overload Control Information
+	OverloadReductionMetric uint8
+	OverloadSequenceNumber  uint32
+	OverloadValidUntil      time.Time
+	overloadCredit          int
 
 	// lock
 	UpfLock sync.RWMutex
@@ -93,6 +107,10 @@ type UPFSelectionParams struct {
 	Dnn    string
 	SNssai *SNssai
 	Dnai   string
+	// AccessType of the PDU session and AccessNode, the name of the AN
+	// serving the UE if known, select the AN of the path
+	AccessType models.AccessType
+	AccessNode string
 }
 
 // UPFInterfaceInfo store the UPF interface information
@@ -179,6 +197,14 @@ func (upfSelectionParams *UPFSelectionParams) String() string {
 		str += fmt.Sprintf("DNAI: %s\n", Dnai)
 	}
 
+	if upfSelectionParams.AccessType == models.ACCESSTYPE_NON_3_GPP_ACCESS {
+		str += fmt.Sprintf("Access: %s\n", upfSelectionParams.AccessType)
+	}
+
+	if AccessNode := upfSelectionParams.AccessNode; AccessNode != "" {
+		str += fmt.Sprintf("AN: %s\n", AccessNode)
+	}
+
 	return str
 }
 
@@ -225,6 +251,7 @@ func NewUPF(nodeID *NodeID, ifaces []factory.InterfaceUpfInfoItem) (upf *UPF) {
 	upf.barIDGenerator = idgenerator.NewGenerator(1, math.MaxUint8)
 	upf.qerIDGenerator = idgenerator.NewGenerator(1, math.MaxUint32)
 	upf.urrIDGenerator = idgenerator.NewGenerator(1, math.MaxUint32)
+	upf.marIDGenerator = idgenerator.NewGenerator(1, math.MaxUint16)
 
 	upf.N3Interfaces = make([]UPFInterfaceInfo, 0)
 	upf.N9Interfaces = make([]UPFInterfaceInfo, 0)
@@ -399,10 +426,47 @@ func (upf *UPF) qerID() (uint32, error) {
 	return qerID, nil
 }
 
+func (upf *UPF) urrID() (uint32, error) {
+	if upf.UPFStatus != AssociatedSetUpSuccess {
+		err := fmt.Errorf("this upf not associate with smf")
+		return 0, err
+	}
+
+	var urrID uint32
+	if tmpID, err := upf.urrIDGenerator.Allocate(); err != nil {
+		return 0, err
+	} else {
+		urrID = uint32(tmpID)
+	}
+
+	return urrID, nil
+}
+
+func (upf *UPF) marID() (uint16, error) {
+	if upf.UPFStatus != AssociatedSetUpSuccess {
+		err := fmt.Errorf("this upf not associate with smf")
+		return 0, err
+	}
+
+	var marID uint16
+	if tmpID, err := upf.marIDGenerator.Allocate(); err != nil {
+		return 0, err
+	} else {
+		marID = uint16(tmpID)
+	}
+
+	return marID, nil
+}
+
 func (upf *UPF) BuildCreatePdrFromPccRule(rule *models.PccRule) (*PDR, error) {
 	var pdr *PDR
 	var err error
 
+	// refuse the rule the UE would not get a QoS rule for
+	if _, err = qos.GetPacketFiltersFromPccRule(rule); err != nil {
+		return nil, err
+	}
+
 	// create empty PDR
 	if pdr, err = upf.AddPDR(); err != nil {
 		return nil, err
@@ -427,21 +491,27 @@ func (upf *UPF) BuildCreatePdrFromPccRule(rule *models.PccRule) (*PDR, error) {
 	}
 
 	// ToS Traffic Class
-	if flow.TosTrafficClass.IsSet() {
+	if tos, err := qos.DecodeTosTrafficClass(flow.GetTosTrafficClass()); err != nil {
+		return nil, err
+	} else if tos != nil {
 		sdfFilter.Ttc = true
-		sdfFilter.TosTrafficClass = []byte(flow.GetTosTrafficClass())
+		sdfFilter.TosTrafficClass = tos
 	}
 
 	// Flow Label
-	if flow.FlowLabel.IsSet() {
+	if fl, err := qos.DecodeFlowLabel(flow.GetFlowLabel()); err != nil {
+		return nil, err
+	} else if fl != nil {
 		sdfFilter.Fl = true
-		sdfFilter.FlowLabel = []byte(flow.GetFlowLabel())
+		sdfFilter.FlowLabel = fl
 	}
 
 	// Security Parameter Index
-	if flow.Spi.IsSet() {
+	if spi, err := qos.DecodeSpi(flow.GetSpi()); err != nil {
+		return nil, err
+	} else if spi != nil {
 		sdfFilter.Spi = true
-		sdfFilter.SecurityParameterIndex = []byte(flow.GetSpi())
+		sdfFilter.SecurityParameterIndex = spi
 	}
 
 	pdi := PDI{
@@ -528,6 +598,40 @@ func (upf *UPF) AddQER() (*QER, error) {
 	return qer, nil
 }
 
+func (upf *UPF) AddURR() (*URR, error) {
+	if upf.UPFStatus != AssociatedSetUpSuccess {
+		err := fmt.Errorf("this upf do not associate with smf")
+		return nil, err
+	}
+
+	urr := new(URR)
+	if URRID, err := upf.urrID(); err != nil {
+		return nil, err
+	} else {
+		urr.URRID = URRID
+		upf.urrPool.Store(urr.URRID, urr)
+	}
+
+	return urr, nil
+}
+
+func (upf *UPF) AddMAR() (*MAR, error) {
+	if upf.UPFStatus != AssociatedSetUpSuccess {
+		err := fmt.Errorf("this upf do not associate with smf")
+		return nil, err
+	}
+
+	mar := new(MAR)
+	if MARID, err := upf.marID(); err != nil {
+		return nil, err
+	} else {
+		mar.MARID = MARID
+		upf.marPool.Store(mar.MARID, mar)
+	}
+
+	return mar, nil
+}
+
 // *** add unit test ***//
 func (upf *UPF) RemovePDR(pdr *PDR) (err error) {
 	if upf.UPFStatus != AssociatedSetUpSuccess {
@@ -576,6 +680,29 @@ func (upf *UPF) RemoveQER(qer *QER) (err error) {
 	return nil
 }
 
+// *** add unit test ***//
+func (upf *UPF) RemoveURR(urr *URR) (err error) {
+	if upf.UPFStatus != AssociatedSetUpSuccess {
+		err = fmt.Errorf("this upf not associate with smf")
+		return err
+	}
+
+	upf.urrIDGenerator.FreeID(int64(urr.URRID))
+	upf.urrPool.Delete(urr.URRID)
+	return nil
+}
+
+func (upf *UPF) RemoveMAR(mar *MAR) (err error) {
+	if upf.UPFStatus != AssociatedSetUpSuccess {
+		err = fmt.Errorf("this upf not associate with smf")
+		return err
+	}
+
+	upf.marIDGenerator.FreeID(int64(mar.MARID))
+	upf.marPool.Delete(mar.MARID)
+	return nil
+}
+
 func (upf *UPF) isSupportSnssai(snssai *SNssai) bool {
 	for _, snssaiInfo := range upf.SNssaiInfos {
 		if snssaiInfo.SNssai.Equal(snssai) {
@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"fmt"
+	"sync"
+)
+
+// UPF failure policies of a DNN
+const (
+	// UpfFailurePolicyRelease releases the PDU sessions of the failed UPF, the
+	// default
+	UpfFailurePolicyRelease = "release"
+	// UpfFailurePolicyReanchor moves the PDU sessions of the failed UPF to
+	// another UPF of the DNN keeping the UE address
+	UpfFailurePolicyReanchor = "reanchor"
+)
+
+// UpfFailureHandler handles a PDU session with a PFCP session on a UPF which
+// stopped answering the heartbeats.
+type UpfFailureHandler func(smContext *SMContext, upf *UPF)
+
+var upfFailure struct {
+	handler UpfFailureHandler
+	mu      sync.RWMutex
+}
+
+func SetUpfFailureHandler(handler UpfFailureHandler) {
+	upfFailure.mu.Lock()
+	defer upfFailure.mu.Unlock()
+	upfFailure.handler = handler
+}
+
+// RetrieveUpfFailurePolicy returns the UPF failure policy of the DNN
+func RetrieveUpfFailurePolicy(dnn string) string {
+	for _, info := range smfContext.UpfFailureInfo {
+		if info.Dnn == dnn && info.Policy != "" {
+			return info.Policy
+		}
+	}
+	return UpfFailurePolicyRelease
+}
+
+// HandleUpfFailure hands the PDU sessions with a PFCP session on the failed
+// UPF to the UPF failure handler
+func HandleUpfFailure(upf *UPF) {
+	upfFailure.mu.RLock()
+	handler := upfFailure.handler
+	upfFailure.mu.RUnlock()
+	if handler == nil {
+		return
+	}
+	nodeIP := upf.NodeID.ResolveNodeIdToIp().String()
+	smContextPool.Range(func(key, value any) bool {
+		smContext := value.(*SMContext)
+		smContext.SMLock.Lock()
+		_, ok := smContext.PFCPContext[nodeIP]
+		smContext.SMLock.Unlock()
+		if ok {
+			smContext.SubPduSessLog.Warnf("UPF[%s] of the PDU session failed", nodeIP)
+			go handler(smContext, upf)
+		}
+		return true
+	})
+}
+
+// AlternateUserPlanePath selects the path to a healthy UPF replacing the
+// failed UPF of the PDU session, nil if no UPF of the DNN keeps the UE
+// address or the PDU session spans several UPFs. The caller holds the SMLock.
+func (smContext *SMContext) AlternateUserPlanePath(failed *UPF) UPPath {
+	upi := GetUserPlaneInformation()
+	if upi == nil || len(smContext.PFCPContext) != 1 {
+		return nil
+	}
+	path := upi.SelectUserPlanePath(smContext.UPFSelectionParams())
+	if len(path) == 0 {
+		return nil
+	}
+	for _, node := range path {
+		if node.UPF == failed {
+			return nil
+		}
+	}
+	anchor := path[len(path)-1]
+	if !anchor.healthy() || !smContext.keepsUeIpAddr(upi.upfName(anchor)) {
+		return nil
+	}
+	return path
+}
+
+// keepsUeIpAddr reports whether the UE address of the PDU session belongs to
+// the pool of the UPF
+func (smContext *SMContext) keepsUeIpAddr(upfName string) bool {
+	addr := smContext.PDUAddress
+	if addr == nil || addr.UpfProvided {
+		return false
+	}
+	if smContext.DNNInfo == nil || addr.Pool == "" {
+		return true
+	}
+	pools := smContext.DNNInfo.UeIPPools
+	if pools == nil || pools.Selection != UeIpPoolSelectionUpf {
+		return true
+	}
+	pool := pools.selectPool(upfName)
+	return pool != nil && pool.Name == addr.Pool
+}
+
+// Reanchor replaces the tunnel of the PDU session on the failed UPF by one
+// along the path. The PFCP session on the failed UPF is dropped without
+// signalling and the PFCP rules of the new tunnel are then to be sent. The
+// caller holds the SMLock.
+func (smContext *SMContext) Reanchor(failed *UPF, path UPPath) error {
+	dataPath := GenerateDataPath(path)
+	if dataPath == nil {
+		return fmt.Errorf("no data path to the alternate UPF")
+	}
+	previous := smContext.Tunnel
+	for _, oldPath := range previous.DataPathPool {
+		oldPath.DeactivateTunnelAndPDR(smContext)
+	}
+	for nodeIP, pfcpSessionContext := range smContext.PFCPContext {
+		dropPFCPSession(nodeIP, pfcpSessionContext)
+		delete(smContext.PFCPContext, nodeIP)
+	}
+
+	smContext.Tunnel = NewUPTunnel()
+	smContext.Tunnel.ANInformation = previous.ANInformation
+	smContext.upPath = path
+	dataPath.IsDefaultPath = true
+	smContext.Tunnel.AddDataPath(dataPath)
+	if err := dataPath.ActivateTunnelAndPDR(smContext, 255); err != nil {
+		return err
+	}
+	// the downlink keeps going to the AN tunnel
+	if anIP := previous.ANInformation.IPAddress; anIP != nil {
+		for _, pdr := range dataPath.FirstDPNode.DownLinkTunnel.PDR {
+			if pdr.FAR.ForwardingParameters == nil {
+				continue
+			}
+			pdr.FAR.ForwardingParameters.OuterHeaderCreation = &OuterHeaderCreation{
+				OuterHeaderCreationDescription: OuterHeaderCreationGtpUUdpIpv4,
+				Teid:                           previous.ANInformation.TEID,
+				Ipv4Address:                    anIP.To4(),
+			}
+		}
+	}
+	smContext.reanchoring = true
+	smContext.SubPduSessLog.Infof("PDU session re-anchored from UPF[%s] to UPF[%s]", failed.NodeID.ResolveNodeIdToIp(),
+		path[len(path)-1].NodeID.ResolveNodeIdToIp())
+	return nil
+}
+
+// IsReanchoring reports whether the PFCP session of the re-anchored PDU
+// session is being established on the alternate UPF. The caller holds the
+// SMLock.
+func (smContext *SMContext) IsReanchoring() bool {
+	return smContext.reanchoring
+}
+
+// StopReanchoring ends the re-anchoring of the PDU session, once the
+// alternate UPF answered or did not in time. The caller holds the SMLock.
+func (smContext *SMContext) StopReanchoring() {
+	smContext.reanchoring = false
+}
+
+// DropFailedPFCPSessions forgets without signalling the PFCP session of the
+// PDU session on the failed UPF and those the UPFs did not establish, only
+// the PFCP sessions left being to delete. The caller holds the SMLock.
+func (smContext *SMContext) DropFailedPFCPSessions(failed *UPF) {
+	failedIP := failed.NodeID.ResolveNodeIdToIp().String()
+	for nodeIP, pfcpSessionContext := range smContext.PFCPContext {
+		if nodeIP == failedIP || pfcpSessionContext.RemoteSEID == 0 {
+			dropPFCPSession(nodeIP, pfcpSessionContext)
+			delete(smContext.PFCPContext, nodeIP)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/omec-project/openapi/v2"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/factory"
+)
+
+func TestRetrieveUpfFailurePolicy(t *testing.T) {
+	original := smfContext.UpfFailureInfo
+	t.Cleanup(func() { smfContext.UpfFailureInfo = original })
+	smfContext.UpfFailureInfo = []factory.UpfFailureInfo{{Dnn: "internet", Policy: UpfFailurePolicyReanchor}}
+
+	if policy := RetrieveUpfFailurePolicy("internet"); policy != UpfFailurePolicyReanchor {
+		t.Errorf("expected %s, got %s", UpfFailurePolicyReanchor, policy)
+	}
+	if policy := RetrieveUpfFailurePolicy("iot"); policy != UpfFailurePolicyRelease {
+		t.Errorf("expected %s by default, got %s", UpfFailurePolicyRelease, policy)
+	}
+}
+
+func TestAlternateUserPlanePath(t *testing.T) {
+	an := &UPNode{Type: UPNODE_AN, NodeID: *NewNodeID("192.168.1.1")}
+	failed := newDnaiUPNode("10.0.5.1", nil, an)
+	shared := newDnaiUPNode("10.0.5.2", nil, an)
+	separate := newDnaiUPNode("10.0.5.3", nil, an)
+	shared.UPF.UPFStatus = AssociatedSetUpSuccess
+	separate.UPF.UPFStatus = AssociatedSetUpSuccess
+	upi := &UserPlaneInformation{
+		UPNodes:       map[string]*UPNode{"gnb": an, "upf1": failed, "upf2": shared, "upf3": separate},
+		UPFs:          map[string]*UPNode{"upf1": failed, "upf2": shared, "upf3": separate},
+		AccessNetwork: map[string]*UPNode{"gnb": an},
+	}
+	original := smfContext.UserPlaneInformation
+	t.Cleanup(func() { smfContext.UserPlaneInformation = original })
+	smfContext.UserPlaneInformation = upi
+
+	pools, err := NewUeIPPools(&factory.UeIpPoolInfo{
+		Dnn:       "internet",
+		Selection: UeIpPoolSelectionUpf,
+		Pools: []factory.UeIpPool{
+			{Name: "pool1", Cidr: "10.60.0.0/24", Keys: []string{"upf1", "upf2"}},
+			{Name: "pool3", Cidr: "10.61.0.0/24", Keys: []string{"upf3"}},
+		},
+	}, nil, nil)
+	if err != nil {
+		t.Fatalf("new pools: %v", err)
+	}
+	smContext := &SMContext{
+		Dnn:         "internet",
+		Snssai:      &models.Snssai{Sst: 1, Sd: openapi.PtrString("010203")},
+		DNNInfo:     &SnssaiSmfDnnInfo{UeIPPools: pools},
+		PDUAddress:  &UeIpAddr{Ip: net.ParseIP("10.60.0.1"), Pool: "pool1"},
+		PFCPContext: map[string]*PFCPSessionContext{"10.0.5.1": {}},
+	}
+
+	// upf3 does not keep the UE address, only upf2 is a valid alternate
+	found := false
+	for range 4 {
+		path := smContext.AlternateUserPlanePath(failed.UPF)
+		if len(path) == 0 {
+			continue
+		}
+		if anchor := path[len(path)-1]; anchor != shared {
+			t.Fatalf("expected the UPF sharing the UE IP pool, got %s", anchor.NodeID.ResolveNodeIdToIp())
+		}
+		found = true
+	}
+	if !found {
+		t.Errorf("expected the UPF sharing the UE IP pool selected")
+	}
+
+	shared.UPF.UPFStatus = NotAssociated
+	separate.UPF.UPFStatus = NotAssociated
+	if path := smContext.AlternateUserPlanePath(failed.UPF); path != nil {
+		t.Errorf("expected no alternate without healthy UPF, got %v", path)
+	}
+}
+
+func TestHandleUpfFailure(t *testing.T) {
+	upf := &UPF{NodeID: *NewNodeID("10.0.6.1")}
+	affected := &SMContext{Ref: "upf-failure-1", PFCPContext: map[string]*PFCPSessionContext{"10.0.6.1": {}}}
+	other := &SMContext{Ref: "upf-failure-2", PFCPContext: map[string]*PFCPSessionContext{"10.0.6.2": {}}}
+	for _, smContext := range []*SMContext{affected, other} {
+		smContext.initLogTags()
+		smContextPool.Store(smContext.Ref, smContext)
+	}
+	t.Cleanup(func() {
+		smContextPool.Delete(affected.Ref)
+		smContextPool.Delete(other.Ref)
+		SetUpfFailureHandler(nil)
+	})
+
+	handled := make(chan *SMContext, 2)
+	SetUpfFailureHandler(func(smContext *SMContext, failed *UPF) {
+		if failed == upf {
+			handled <- smContext
+		}
+	})
+	HandleUpfFailure(upf)
+
+	select {
+	case smContext := <-handled:
+		if smContext != affected {
+			t.Errorf("expected the PDU session on the failed UPF, got %s", smContext.Ref)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the PDU session on the failed UPF handled")
+	}
+	select {
+	case smContext := <-handled:
+		t.Errorf("unexpected PDU session %s handled", smContext.Ref)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDropFailedPFCPSessions(t *testing.T) {
+	originalCfg := factory.SmfConfig.Configuration
+	t.Cleanup(func() { factory.SmfConfig.Configuration = originalCfg })
+	factory.SmfConfig.Configuration = &factory.Configuration{}
+	failed := &UPF{NodeID: *NewNodeID("10.0.6.1")}
+	smContext := &SMContext{PFCPContext: map[string]*PFCPSessionContext{
+		"10.0.6.1": {LocalSEID: 61, RemoteSEID: 1},
+		"10.0.6.2": {LocalSEID: 62},
+		"10.0.6.3": {LocalSEID: 63, RemoteSEID: 3},
+	}}
+	smContext.DropFailedPFCPSessions(failed)
+	if len(smContext.PFCPContext) != 1 || smContext.PFCPContext["10.0.6.3"] == nil {
+		t.Errorf("expected only the PFCP session established on a healthy UPF left, got %v", smContext.PFCPContext)
+	}
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"time"
+)
+
+// maxMetric is the highest load or reduction metric, in percent
+const maxMetric = 100
+
+// sequenceNumberNewer reports whether the sequence number is newer than the
+// stored one, the sequence numbers wrapping around after 2^32 - 1, RFC 1982
+func sequenceNumberNewer(sequenceNumber, stored uint32) bool {
+	return int32(sequenceNumber-stored) > 0
+}
+
+// UpdateLoadControl stores the load reported in a PFCP Load Control
+// Information, TS 29.244 6.2.2. Information older than the stored one is
+// discarded. The caller holds the UpfLock.
+func (upf *UPF) UpdateLoadControl(sequenceNumber uint32, metric uint8) bool {
+	if upf.LoadSequenceNumber != 0 && !sequenceNumberNewer(sequenceNumber, upf.LoadSequenceNumber) {
+		return false
+	}
+	upf.LoadSequenceNumber = sequenceNumber
+	upf.LoadMetric = min(metric, maxMetric)
+	return true
+}
+
+// UpdateOverloadControl stores the reduction metric reported in a PFCP
+// Overload Control Information for its validity period, TS 29.244 6.2.3.
+// A zero period stops the overload control. Information older than the
+// stored one is discarded. The caller holds the UpfLock.
+func (upf *UPF) UpdateOverloadControl(sequenceNumber uint32, reductionMetric uint8, period time.Duration) bool {
+	if upf.OverloadSequenceNumber != 0 && !sequenceNumberNewer(sequenceNumber, upf.OverloadSequenceNumber) {
+		return false
+	}
+	upf.OverloadSequenceNumber = sequenceNumber
+	if period <= 0 {
+		upf.OverloadReductionMetric = 0
+		upf.OverloadValidUntil = time.Time{}
+		return true
+	}
+	upf.OverloadReductionMetric = min(reductionMetric, maxMetric)
+	upf.OverloadValidUntil = time.Now().Add(period)
+	return true
+}
+
+// ResetLoadControl discards the load and overload control information of a
+// previous PFCP association. The caller holds the UpfLock.
+func (upf *UPF) ResetLoadControl() {
+	upf.LoadMetric = 0
+	upf.LoadSequenceNumber = 0
+	upf.OverloadReductionMetric = 0
+	upf.OverloadSequenceNumber = 0
+	upf.OverloadValidUntil = time.Time{}
+	upf.overloadCredit = 0
+}
+
+func (upf *UPF) overloadReduction(now time.Time) uint8 {
+	if now.After(upf.OverloadValidUntil) {
+		return 0
+	}
+	return upf.OverloadReductionMetric
+}
+
+// throttled reports whether a new PFCP session towards the UPF is throttled.
+// Out of every 100 new sessions towards an overloaded UPF, as many as the
+// reduction metric are throttled.
+func (upf *UPF) throttled() bool {
+	upf.UpfLock.Lock()
+	defer upf.UpfLock.Unlock()
+	reduction := upf.overloadReduction(time.Now())
+	if reduction == 0 {
+		upf.overloadCredit = 0
+		return false
+	}
+	upf.overloadCredit += int(reduction)
+	if upf.overloadCredit >= maxMetric {
+		upf.overloadCredit -= maxMetric
+		return true
+	}
+	return false
+}
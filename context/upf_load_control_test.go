@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestUpdateLoadControlSequenceNumber(t *testing.T) {
+	upf := &UPF{}
+	if !upf.UpdateLoadControl(7, 30) || upf.LoadMetric != 30 {
+		t.Fatalf("expected the first load stored, got %d", upf.LoadMetric)
+	}
+	if upf.UpdateLoadControl(7, 60) || upf.UpdateLoadControl(6, 60) {
+		t.Errorf("expected outdated load discarded")
+	}
+	if !upf.UpdateLoadControl(8, 150) || upf.LoadMetric != maxMetric {
+		t.Errorf("expected load capped to %d, got %d", maxMetric, upf.LoadMetric)
+	}
+
+	upf.LoadSequenceNumber = math.MaxUint32
+	if !upf.UpdateLoadControl(2, 20) || upf.LoadMetric != 20 {
+		t.Errorf("expected the load after the sequence number wrapped stored, got %d", upf.LoadMetric)
+	}
+	if upf.UpdateLoadControl(math.MaxUint32-1, 60) {
+		t.Errorf("expected the load before the sequence number wrapped discarded")
+	}
+
+	upf.ResetLoadControl()
+	if !upf.UpdateLoadControl(1, 10) {
+		t.Errorf("expected the load of a new association stored")
+	}
+}
+
+func TestOverloadThrottling(t *testing.T) {
+	upf := &UPF{}
+	upf.UpdateOverloadControl(1, 25, time.Minute)
+
+	throttled := 0
+	for range 100 {
+		if upf.throttled() {
+			throttled++
+		}
+	}
+	if throttled != 25 {
+		t.Errorf("expected 25 of 100 sessions throttled, got %d", throttled)
+	}
+
+	upf.OverloadValidUntil = time.Now().Add(-time.Second)
+	if upf.throttled() {
+		t.Errorf("expected no throttling once the overload control expired")
+	}
+}
+
+func TestSelectUserPlanePathThrottlesOverloadedUPF(t *testing.T) {
+	an := &UPNode{Type: UPNODE_AN, NodeID: *NewNodeID("192.168.1.1")}
+	overloaded := newDnaiUPNode("10.0.4.1", nil, an)
+	other := newDnaiUPNode("10.0.4.2", nil, an)
+	overloaded.UPF.UPFStatus = AssociatedSetUpSuccess
+	other.UPF.UPFStatus = AssociatedSetUpSuccess
+	overloaded.UPF.UpdateOverloadControl(1, 100, time.Minute)
+	upi := &UserPlaneInformation{
+		UPNodes:       map[string]*UPNode{"gnb": an, "overloaded": overloaded, "other": other},
+		UPFs:          map[string]*UPNode{"overloaded": overloaded, "other": other},
+		AccessNetwork: map[string]*UPNode{"gnb": an},
+	}
+	selection := &UPFSelectionParams{Dnn: "internet", SNssai: &SNssai{Sst: 1, Sd: "010203"}}
+
+	for range 4 {
+		path := upi.SelectUserPlanePath(selection)
+		if len(path) == 0 || path[len(path)-1] != other {
+			t.Fatalf("expected the UPF out of overload, got path %v", path)
+		}
+	}
+
+	// sessions are rejected when all UPFs throttle them
+	other.UPF.UpdateOverloadControl(1, 100, time.Minute)
+	if path := upi.SelectUserPlanePath(selection); len(path) != 0 {
+		t.Errorf("expected no path, got %v", path)
+	}
+}
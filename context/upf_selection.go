@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/omec-project/smf/factory"
+	"github.com/omec-project/smf/logger"
+)
+
+// Selection strategies among the UPFs matching a PDU session
+const (
+	// UpfSelectionRoundRobin is a weighted round robin, the default
+	UpfSelectionRoundRobin = "round-robin"
+	// UpfSelectionLeastSessions selects the UPF with the fewest active PFCP
+	// sessions relative to its weight
+	UpfSelectionLeastSessions = "least-sessions"
+	// UpfSelectionLoad selects the UPF with the lowest load reported in the
+	// PFCP Load Control Information, TS 29.244 5.22.2
+	UpfSelectionLoad = "load"
+)
+
+// maxHeartbeatLoss is the number of unanswered heartbeats after which a UPF
+// is no longer selected for new PDU sessions
+const maxHeartbeatLoss = 2
+
+// UPFSelector selects the UPF of a PDU session among the healthy UPFs
+// matching its DNN, S-NSSAI and DNAI. The key identifies the selection
+// parameters.
+type UPFSelector interface {
+	Select(key string, candidates []*UPNode) *UPNode
+}
+
+var upfSelectors = struct {
+	factories map[string]func() UPFSelector
+	mu        sync.RWMutex
+}{
+	factories: map[string]func() UPFSelector{
+		UpfSelectionRoundRobin:    func() UPFSelector { return newRoundRobinSelector() },
+		UpfSelectionLeastSessions: func() UPFSelector { return leastSessionsSelector{} },
+		UpfSelectionLoad:          func() UPFSelector { return loadSelector{} },
+	},
+}
+
+// RegisterUPFSelector makes a UPF selection strategy available to the
+// configuration under its name
+func RegisterUPFSelector(name string, newSelector func() UPFSelector) {
+	upfSelectors.mu.Lock()
+	defer upfSelectors.mu.Unlock()
+	upfSelectors.factories[name] = newSelector
+}
+
+// NewUPFSelector returns the UPF selection strategy of the name, the weighted
+// round robin if the name is empty
+func NewUPFSelector(name string) (UPFSelector, error) {
+	if name == "" {
+		name = UpfSelectionRoundRobin
+	}
+	upfSelectors.mu.RLock()
+	newSelector, ok := upfSelectors.factories[name]
+	upfSelectors.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown UPF selection strategy %q", name)
+	}
+	return newSelector(), nil
+}
+
+// upfSessions counts the active PFCP sessions per UPF node IP
+var upfSessions sync.Map
+
+func upfSessionCounter(nodeIP string) *atomic.Int64 {
+	counter, _ := upfSessions.LoadOrStore(nodeIP, new(atomic.Int64))
+	return counter.(*atomic.Int64)
+}
+
+// UPFSessionCount returns the number of active PFCP sessions of the UPF
+func UPFSessionCount(upf *UPF) int64 {
+	return upfSessionCounter(upf.NodeID.ResolveNodeIdToIp().String()).Load()
+}
+
+// upfWeight returns the configured weight of the UPF, 1 if none
+func upfWeight(upfName string) int {
+	if selection := smfContext.UpfSelection; selection != nil {
+		if weight, ok := selection.Weights[upfName]; ok && weight > 0 {
+			return weight
+		}
+	}
+	return 1
+}
+
+func (node *UPNode) weight() int64 {
+	if node.Weight <= 0 {
+		return 1
+	}
+	return int64(node.Weight)
+}
+
+// healthy reports whether the UPF is associated and answers the heartbeats
+func (node *UPNode) healthy() bool {
+	node.UPF.UpfLock.RLock()
+	defer node.UPF.UpfLock.RUnlock()
+	return node.UPF.UPFStatus == AssociatedSetUpSuccess && node.UPF.NHeartBeat < maxHeartbeatLoss
+}
+
+// roundRobinSelector is a smooth weighted round robin per selection key
+type roundRobinSelector struct {
+	current map[string]map[*UPNode]int64
+	mu      sync.Mutex
+}
+
+func newRoundRobinSelector() *roundRobinSelector {
+	return &roundRobinSelector{current: make(map[string]map[*UPNode]int64)}
+}
+
+func (s *roundRobinSelector) Select(key string, candidates []*UPNode) *UPNode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// keep the current weights of the candidates only
+	previous := s.current[key]
+	current := make(map[*UPNode]int64, len(candidates))
+	s.current[key] = current
+	var selected *UPNode
+	var total int64
+	for _, node := range candidates {
+		current[node] = previous[node] + node.weight()
+		total += node.weight()
+		if selected == nil || current[node] > current[selected] {
+			selected = node
+		}
+	}
+	if selected != nil {
+		current[selected] -= total
+	}
+	return selected
+}
+
+// leastSessionsSelector selects the UPF with the fewest sessions per weight
+type leastSessionsSelector struct{}
+
+func (leastSessionsSelector) Select(key string, candidates []*UPNode) *UPNode {
+	var selected *UPNode
+	var selectedSessions int64
+	for _, node := range candidates {
+		sessions := UPFSessionCount(node.UPF)
+		// sessions/weight < selectedSessions/selected.weight
+		if selected == nil || sessions*selected.weight() < selectedSessions*node.weight() {
+			selected, selectedSessions = node, sessions
+		}
+	}
+	return selected
+}
+
+// loadSelector selects the UPF with the lowest reported load, then the
+// fewest sessions per weight
+type loadSelector struct{}
+
+func (loadSelector) Select(key string, candidates []*UPNode) *UPNode {
+	var lowest []*UPNode
+	var lowestLoad uint8
+	for _, node := range candidates {
+		node.UPF.UpfLock.RLock()
+		load := node.UPF.LoadMetric
+		node.UPF.UpfLock.RUnlock()
+		switch {
+		case len(lowest) == 0 || load < lowestLoad:
+			lowest, lowestLoad = []*UPNode{node}, load
+		case load == lowestLoad:
+			lowest = append(lowest, node)
+		}
+	}
+	return leastSessionsSelector{}.Select(key, lowest)
+}
+
+// UserPlanePath returns the path to the UPF of the PDU session, selected on
+// the first call
+func (smContext *SMContext) UserPlanePath() UPPath {
+	if smContext.upPath == nil {
+		if upi := GetUserPlaneInformation(); upi != nil {
+			smContext.upPath = upi.SelectUserPlanePath(smContext.UPFSelectionParams())
+		}
+	}
+	return smContext.upPath
+}
+
+// initUPFSelection sets the UPF selection strategy of the configuration
+func initUPFSelection(selection *factory.UpfSelection) {
+	var strategy string
+	if selection != nil {
+		strategy = selection.Strategy
+	}
+	selector, err := NewUPFSelector(strategy)
+	if err != nil {
+		logger.CtxLog.Errorf("%v, using %s", err, UpfSelectionRoundRobin)
+		selector, _ = NewUPFSelector(UpfSelectionRoundRobin)
+	}
+	smfContext.UpfSelection = selection
+	smfContext.UPFSelector = selector
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"testing"
+)
+
+func newSelectionUPNode(ip string, weight int, status UPFStatus) *UPNode {
+	return &UPNode{
+		Type:   UPNODE_UPF,
+		NodeID: *NewNodeID(ip),
+		Weight: weight,
+		UPF:    &UPF{NodeID: *NewNodeID(ip), UPFStatus: status},
+	}
+}
+
+func TestRoundRobinSelectorWeights(t *testing.T) {
+	upf1 := newSelectionUPNode("10.0.0.1", 2, AssociatedSetUpSuccess)
+	upf2 := newSelectionUPNode("10.0.0.2", 1, AssociatedSetUpSuccess)
+	selector, err := NewUPFSelector("")
+	if err != nil {
+		t.Fatalf("new selector: %v", err)
+	}
+
+	var got []*UPNode
+	for range 6 {
+		got = append(got, selector.Select("internet", []*UPNode{upf1, upf2}))
+	}
+	expected := []*UPNode{upf1, upf2, upf1, upf1, upf2, upf1}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("selection %d: expected %s, got %s", i, expected[i].NodeID.ResolveNodeIdToIp(), got[i].NodeID.ResolveNodeIdToIp())
+		}
+	}
+	// another selection key has its own rotation
+	if selected := selector.Select("iot", []*UPNode{upf2}); selected != upf2 {
+		t.Errorf("expected the only candidate")
+	}
+}
+
+func TestLeastSessionsSelector(t *testing.T) {
+	upf1 := newSelectionUPNode("10.0.1.1", 1, AssociatedSetUpSuccess)
+	upf2 := newSelectionUPNode("10.0.1.2", 4, AssociatedSetUpSuccess)
+	t.Cleanup(func() {
+		upfSessions.Delete("10.0.1.1")
+		upfSessions.Delete("10.0.1.2")
+	})
+	upfSessionCounter("10.0.1.1").Add(2)
+	upfSessionCounter("10.0.1.2").Add(6)
+
+	selector, err := NewUPFSelector(UpfSelectionLeastSessions)
+	if err != nil {
+		t.Fatalf("new selector: %v", err)
+	}
+	// 6 sessions for a weight of 4 is less than 2 sessions for a weight of 1
+	if selected := selector.Select("internet", []*UPNode{upf1, upf2}); selected != upf2 {
+		t.Errorf("expected UPF with the fewest sessions per weight")
+	}
+	upfSessionCounter("10.0.1.2").Add(4)
+	if selected := selector.Select("internet", []*UPNode{upf1, upf2}); selected != upf1 {
+		t.Errorf("expected UPF with the fewest sessions per weight")
+	}
+}
+
+func TestLoadSelector(t *testing.T) {
+	upf1 := newSelectionUPNode("10.0.2.1", 1, AssociatedSetUpSuccess)
+	upf2 := newSelectionUPNode("10.0.2.2", 1, AssociatedSetUpSuccess)
+	upf1.UPF.LoadMetric = 70
+	upf2.UPF.LoadMetric = 30
+
+	selector, err := NewUPFSelector(UpfSelectionLoad)
+	if err != nil {
+		t.Fatalf("new selector: %v", err)
+	}
+	if selected := selector.Select("internet", []*UPNode{upf1, upf2}); selected != upf2 {
+		t.Errorf("expected the least loaded UPF")
+	}
+}
+
+func TestNewUPFSelectorUnknown(t *testing.T) {
+	if _, err := NewUPFSelector("fastest"); err == nil {
+		t.Errorf("expected an error for an unknown strategy")
+	}
+}
+
+func TestSelectUserPlanePathSkipsUnhealthyUPFs(t *testing.T) {
+	an := &UPNode{Type: UPNODE_AN, NodeID: *NewNodeID("192.168.1.1")}
+	healthy := newDnaiUPNode("10.0.3.1", nil, an)
+	lost := newDnaiUPNode("10.0.3.2", nil, an)
+	healthy.UPF.UPFStatus = AssociatedSetUpSuccess
+	lost.UPF.UPFStatus = AssociatedSetUpSuccess
+	lost.UPF.NHeartBeat = maxHeartbeatLoss
+	upi := &UserPlaneInformation{
+		UPNodes:       map[string]*UPNode{"gnb": an, "healthy": healthy, "lost": lost},
+		UPFs:          map[string]*UPNode{"healthy": healthy, "lost": lost},
+		AccessNetwork: map[string]*UPNode{"gnb": an},
+	}
+	selection := &UPFSelectionParams{Dnn: "internet", SNssai: &SNssai{Sst: 1, Sd: "010203"}}
+
+	for range 3 {
+		path := upi.SelectUserPlanePath(selection)
+		if len(path) == 0 || path[len(path)-1] != healthy {
+			t.Fatalf("expected the healthy UPF, got path %v", path)
+		}
+	}
+
+	// without healthy UPF the association is recovered at establishment
+	healthy.UPF.UPFStatus = NotAssociated
+	if path := upi.SelectUserPlanePath(selection); len(path) == 0 {
+		t.Errorf("expected a path to an unhealthy UPF rather than none")
+	}
+}
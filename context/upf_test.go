@@ -30,3 +30,38 @@ func TestGetInterfaceReturnsActualSliceElement(t *testing.T) {
 		t.Fatal("expected N9 interface match")
 	}
 }
+
+func TestBuildCreatePdrFromPccRuleSDFFilter(t *testing.T) {
+	upf := NewUPF(NewNodeID("10.0.0.1"), nil)
+	upf.UPFStatus = AssociatedSetUpSuccess
+
+	flow := models.FlowInformation{}
+	flow.SetFlowDescription("permit out 17 from 2001:db8::1/64 to assigned")
+	flow.SetPackFiltId("1")
+	flow.SetTosTrafficClass("b8fc")
+	flow.SetSpi("0000abcd")
+	flow.SetFlowLabel("012345")
+	rule := &models.PccRule{PccRuleId: "1", FlowInfos: []models.FlowInformation{flow}}
+
+	pdr, err := upf.BuildCreatePdrFromPccRule(rule)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sdfFilter := pdr.PDI.SDFFilter
+	if !sdfFilter.Ttc || string(sdfFilter.TosTrafficClass) != "\xb8\xfc" {
+		t.Errorf("unexpected ToS traffic class %x", sdfFilter.TosTrafficClass)
+	}
+	if !sdfFilter.Spi || string(sdfFilter.SecurityParameterIndex) != "\x00\x00\xab\xcd" {
+		t.Errorf("unexpected security parameter index %x", sdfFilter.SecurityParameterIndex)
+	}
+	if !sdfFilter.Fl || string(sdfFilter.FlowLabel) != "\x01\x23\x45" {
+		t.Errorf("unexpected flow label %x", sdfFilter.FlowLabel)
+	}
+
+	flow.SetSpi("abcd")
+	rule.FlowInfos[0] = flow
+	if _, err := upf.BuildCreatePdrFromPccRule(rule); err == nil {
+		t.Errorf("expected error for invalid security parameter index")
+	}
+}
@@ -0,0 +1,337 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context
+
+import (
+	"slices"
+
+	"github.com/omec-project/openapi/v2/models"
+)
+
+// Measurement Method. 8.2.40
+type MeasurementMethod struct {
+	Event bool
+	Volum bool
+	Durat bool
+}
+
+// Reporting Triggers. 8.2.19
+type ReportingTriggers struct {
+	Perio bool
+	Volth bool
+	Timth bool
+}
+
+// Volume Threshold in octets. 8.2.13
+// A zero volume is not monitored.
+type VolumeThreshold struct {
+	TotalVolume    uint64
+	UplinkVolume   uint64
+	DownlinkVolume uint64
+}
+
+// Usage Report Trigger. 8.2.41
+type UsageReportTrigger struct {
+	Perio bool
+	Volth bool
+	Timth bool
+	Termr bool
+	Immer bool
+}
+
+// Volume Measurement in octets. 8.2.44
+type VolumeMeasurement struct {
+	TotalVolume    uint64
+	UplinkVolume   uint64
+	DownlinkVolume uint64
+}
+
+// UsageReport is the usage reported by the UPF for a URR. 7.5.8.3-1
+type UsageReport struct {
+	VolumeMeasurement  *VolumeMeasurement
+	UsageReportTrigger UsageReportTrigger
+	// DurationMeasurement in seconds
+	DurationMeasurement uint32
+	URRID               uint32
+}
+
+// SetUsageMonitoringData sets the measurement method, reporting triggers and
+// thresholds of the URR from the PCF usage monitoring data (TS 29.512 5.6.2.12).
+// It reports whether the URR changed.
+func (urr *URR) SetUsageMonitoringData(um *models.UsageMonitoringData) bool {
+	var method MeasurementMethod
+	var triggers ReportingTriggers
+	var volThreshold *VolumeThreshold
+
+	vol := VolumeThreshold{
+		TotalVolume:    uint64(max(um.GetVolumeThreshold(), 0)),
+		UplinkVolume:   uint64(max(um.GetVolumeThresholdUplink(), 0)),
+		DownlinkVolume: uint64(max(um.GetVolumeThresholdDownlink(), 0)),
+	}
+	if vol != (VolumeThreshold{}) {
+		method.Volum = true
+		triggers.Volth = true
+		volThreshold = &vol
+	}
+
+	timeThreshold := uint32(max(um.GetTimeThreshold(), 0))
+	if timeThreshold > 0 {
+		method.Durat = true
+		triggers.Timth = true
+	}
+
+	changed := urr.MeasurementMethod != method || urr.ReportingTriggers != triggers ||
+		urr.TimeThreshold != timeThreshold ||
+		(urr.VolumeThreshold == nil) != (volThreshold == nil) ||
+		(volThreshold != nil && *urr.VolumeThreshold != *volThreshold)
+
+	urr.MeasurementMethod = method
+	urr.ReportingTriggers = triggers
+	urr.VolumeThreshold = volThreshold
+	urr.TimeThreshold = timeThreshold
+	return changed
+}
+
+// UsageMonitoringData returns the usage monitoring data of the session, the
+// latest policy decision taking precedence over the SM context.
+func (smContext *SMContext) UsageMonitoringData() map[string]*models.UsageMonitoringData {
+	umData := make(map[string]*models.UsageMonitoringData)
+	for name, um := range smContext.SmPolicyData.SmCtxtUsageMonData.UsageMonData {
+		umData[name] = um
+	}
+	if len(smContext.SmPolicyUpdates) > 0 && smContext.SmPolicyUpdates[0].SmPolicyDecision != nil {
+		for name, pcfUm := range smContext.SmPolicyUpdates[0].SmPolicyDecision.GetUmDecs() {
+			um := pcfUm
+			if um.GetUmId() == "" {
+				delete(umData, name)
+				continue
+			}
+			umData[name] = &um
+		}
+	}
+	return umData
+}
+
+// sessionRuleUmId returns the usage monitoring data referred by the active session rule.
+func (smContext *SMContext) sessionRuleUmId() string {
+	if len(smContext.SmPolicyUpdates) > 0 {
+		if upd := smContext.SmPolicyUpdates[0].SessRuleUpdate; upd != nil && upd.ActiveSessRule != nil {
+			return upd.ActiveSessRule.GetRefUmData()
+		}
+	}
+	if rule := smContext.SmPolicyData.SmCtxtSessionRules.ActiveRule; rule != nil {
+		return rule.GetRefUmData()
+	}
+	return ""
+}
+
+// pccRule returns the PCC rule, the latest policy decision taking precedence over the SM context.
+func (smContext *SMContext) pccRule(ruleName string) *models.PccRule {
+	if len(smContext.SmPolicyUpdates) > 0 && smContext.SmPolicyUpdates[0].SmPolicyDecision != nil {
+		if rule, ok := smContext.SmPolicyUpdates[0].SmPolicyDecision.GetPccRules()[ruleName]; ok && rule.GetPccRuleId() != "" {
+			return &rule
+		}
+	}
+	return smContext.SmPolicyData.SmCtxtPccRules.PccRules[ruleName]
+}
+
+// pdrUmIds returns the usage monitoring data applying to the PDR of the PCC rule.
+func (smContext *SMContext) pdrUmIds(ruleName string, umData map[string]*models.UsageMonitoringData) []string {
+	umIds := make([]string, 0)
+	rule := smContext.pccRule(ruleName)
+
+	if sessUmId := smContext.sessionRuleUmId(); sessUmId != "" {
+		if um, ok := umData[sessUmId]; ok {
+			excluded := rule != nil && slices.Contains(um.GetExUsagePccRuleIds(), rule.GetPccRuleId())
+			if !excluded {
+				umIds = append(umIds, sessUmId)
+			}
+		}
+	}
+
+	if rule != nil {
+		for _, umId := range rule.RefUmData {
+			if _, ok := umData[umId]; ok && !slices.Contains(umIds, umId) {
+				umIds = append(umIds, umId)
+			}
+		}
+	}
+	return umIds
+}
+
+// UpdateUsageMonitoringURRs reconciles the URRs of the PDRs on the anchor UPFs
+// with the usage monitoring data. Session level usage monitoring data apply to
+// all the PDRs but those of the excluded PCC rules, PCC rule level ones to the
+// PDRs of the rules referring to them. It returns the PDRs whose URRs changed.
+// Installed PDRs with a changed list of URRs are marked for a PFCP Update PDR,
+// URRs no longer monitored are marked for removal.
+func (smContext *SMContext) UpdateUsageMonitoringURRs() []*PDR {
+	umData := smContext.UsageMonitoringData()
+	pdrList := make([]*PDR, 0)
+
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		if !dataPath.Activated || dataPath.FirstDPNode == nil || dataPath.FirstDPNode.UPF == nil {
+			continue
+		}
+		node := dataPath.FirstDPNode
+		tunnels := []*GTPTunnel{node.UpLinkTunnel, node.DownLinkTunnel}
+
+		// URRs already allocated on the UPF for the session
+		urrs := make(map[string]*URR)
+		for _, tunnel := range tunnels {
+			if tunnel == nil {
+				continue
+			}
+			for _, pdr := range tunnel.PDR {
+				for _, urr := range pdr.URR {
+					if urr.State != RULE_REMOVE {
+						urrs[urr.MonitoringKey] = urr
+					}
+				}
+			}
+		}
+
+		// allocate and update the monitored URRs
+		wanted := make(map[*PDR][]*URR)
+		monitored := make(map[string]bool)
+		for _, tunnel := range tunnels {
+			if tunnel == nil {
+				continue
+			}
+			for name, pdr := range tunnel.PDR {
+				for _, umId := range smContext.pdrUmIds(name, umData) {
+					urr, ok := urrs[umId]
+					if !ok {
+						var err error
+						if urr, err = node.UPF.AddURR(); err != nil {
+							smContext.SubQosLog.Errorf("usage monitoring data [%s] URR allocation failed: %v", umId, err)
+							continue
+						}
+						urr.MonitoringKey = umId
+						urrs[umId] = urr
+					}
+					if !monitored[umId] {
+						monitored[umId] = true
+						if urr.SetUsageMonitoringData(umData[umId]) && urr.State == RULE_CREATE {
+							urr.State = RULE_UPDATE
+						}
+					}
+					wanted[pdr] = append(wanted[pdr], urr)
+				}
+			}
+		}
+
+		// URRs no longer monitored are removed, once the new URRs got their IDs
+		for umId, urr := range urrs {
+			if monitored[umId] {
+				continue
+			}
+			smContext.SubQosLog.Infof("usage monitoring data [%s] removed, URR [%d]", umId, urr.URRID)
+			if urr.State != RULE_INITIAL {
+				urr.State = RULE_REMOVE
+			}
+			if err := node.UPF.RemoveURR(urr); err != nil {
+				smContext.SubQosLog.Warnf("usage monitoring data [%s] URR release failed: %v", umId, err)
+			}
+		}
+
+		// associate the PDRs with their URRs
+		for _, tunnel := range tunnels {
+			if tunnel == nil {
+				continue
+			}
+			for _, pdr := range tunnel.PDR {
+				urrList := wanted[pdr]
+				changed := !sameURRs(pdr.URR, urrList)
+				for _, urr := range urrList {
+					if urr.State != RULE_CREATE {
+						changed = true
+					}
+				}
+				for _, urr := range pdr.URR {
+					// keep removed URRs until the removal is sent to the UPF
+					if urr.State == RULE_REMOVE && !slices.Contains(urrList, urr) {
+						urrList = append(urrList, urr)
+						changed = true
+					}
+				}
+				if !changed {
+					continue
+				}
+
+				if !sameURRs(pdr.URR, urrList) && pdr.State == RULE_CREATE {
+					pdr.State = RULE_UPDATE
+				}
+				pdr.URR = urrList
+				pdrList = append(pdrList, pdr)
+			}
+		}
+	}
+
+	return pdrList
+}
+
+// sameURRs reports whether the PDR is associated with the same installed URRs
+func sameURRs(current, wanted []*URR) bool {
+	ids := func(urrs []*URR) []uint32 {
+		list := make([]uint32, 0, len(urrs))
+		for _, urr := range urrs {
+			if urr.State != RULE_REMOVE {
+				list = append(list, urr.URRID)
+			}
+		}
+		slices.Sort(list)
+		return list
+	}
+	return slices.Equal(ids(current), ids(wanted))
+}
+
+// BuildAccuUsageReports maps the usage reported by the UPF for the session
+// URRs to the accumulated usage reports of the usage monitoring data (TS 29.512
+// 5.6.2.18) to be reported to the PCF.
+func (smContext *SMContext) BuildAccuUsageReports(reports []*UsageReport) []models.AccuUsageReport {
+	urrs := make(map[uint32]*URR)
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		if !dataPath.Activated || dataPath.FirstDPNode == nil {
+			continue
+		}
+		for _, tunnel := range []*GTPTunnel{dataPath.FirstDPNode.UpLinkTunnel, dataPath.FirstDPNode.DownLinkTunnel} {
+			if tunnel == nil {
+				continue
+			}
+			for _, pdr := range tunnel.PDR {
+				for _, urr := range pdr.URR {
+					urrs[urr.URRID] = urr
+				}
+			}
+		}
+	}
+
+	accuReports := make([]models.AccuUsageReport, 0)
+	index := make(map[string]int)
+	for _, report := range reports {
+		urr, ok := urrs[report.URRID]
+		if !ok || urr.MonitoringKey == "" {
+			smContext.SubQosLog.Warnf("usage report for unknown URR [%d]", report.URRID)
+			continue
+		}
+
+		i, ok := index[urr.MonitoringKey]
+		if !ok {
+			i = len(accuReports)
+			index[urr.MonitoringKey] = i
+			accuReports = append(accuReports, *models.NewAccuUsageReport(urr.MonitoringKey))
+		}
+		accuReport := &accuReports[i]
+		if vol := report.VolumeMeasurement; vol != nil {
+			accuReport.SetVolUsage(accuReport.GetVolUsage() + int64(vol.TotalVolume))
+			accuReport.SetVolUsageUplink(accuReport.GetVolUsageUplink() + int64(vol.UplinkVolume))
+			accuReport.SetVolUsageDownlink(accuReport.GetVolUsageDownlink() + int64(vol.DownlinkVolume))
+		}
+		if urr.MeasurementMethod.Durat {
+			accuReport.SetTimeUsage(max(accuReport.GetTimeUsage(), int32(report.DurationMeasurement)))
+		}
+	}
+	return accuReports
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package context_test
+
+import (
+	"testing"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/context"
+)
+
+func TestURRSetUsageMonitoringData(t *testing.T) {
+	urr := &context.URR{}
+	um := models.NewUsageMonitoringData("um-1")
+	um.SetVolumeThreshold(1000)
+	um.SetTimeThreshold(60)
+
+	if !urr.SetUsageMonitoringData(um) {
+		t.Errorf("expected URR to change")
+	}
+	if !urr.MeasurementMethod.Volum || !urr.MeasurementMethod.Durat {
+		t.Errorf("expected volume and duration measurement, got %+v", urr.MeasurementMethod)
+	}
+	if !urr.ReportingTriggers.Volth || !urr.ReportingTriggers.Timth || urr.ReportingTriggers.Perio {
+		t.Errorf("expected volume and time threshold triggers, got %+v", urr.ReportingTriggers)
+	}
+	if urr.VolumeThreshold == nil || urr.VolumeThreshold.TotalVolume != 1000 {
+		t.Errorf("expected total volume threshold 1000, got %v", urr.VolumeThreshold)
+	}
+	if urr.TimeThreshold != 60 {
+		t.Errorf("expected time threshold 60, got %v", urr.TimeThreshold)
+	}
+
+	if urr.SetUsageMonitoringData(um) {
+		t.Errorf("expected URR to be unchanged")
+	}
+
+	um.UnsetVolumeThreshold()
+	if !urr.SetUsageMonitoringData(um) {
+		t.Errorf("expected URR to change")
+	}
+	if urr.VolumeThreshold != nil || urr.MeasurementMethod.Volum {
+		t.Errorf("expected no volume monitoring, got %+v", urr)
+	}
+}
+
+func TestBuildAccuUsageReports(t *testing.T) {
+	smContext := context.NewSMContext("imsi-208930000000001", 1)
+
+	sessURR := &context.URR{URRID: 1, MonitoringKey: "um-sess", MeasurementMethod: context.MeasurementMethod{Volum: true}}
+	ruleURR := &context.URR{URRID: 2, MonitoringKey: "um-rule", MeasurementMethod: context.MeasurementMethod{Durat: true}}
+
+	node := context.NewDataPathNode()
+	node.UpLinkTunnel.PDR["default"] = &context.PDR{PDRID: 1, URR: []*context.URR{sessURR}}
+	node.DownLinkTunnel.PDR["default"] = &context.PDR{PDRID: 2, URR: []*context.URR{sessURR, ruleURR}}
+	dataPath := context.NewDataPath()
+	dataPath.Activated = true
+	dataPath.FirstDPNode = node
+	smContext.Tunnel = &context.UPTunnel{DataPathPool: context.DataPathPool{1: dataPath}}
+
+	reports := []*context.UsageReport{
+		{URRID: 1, VolumeMeasurement: &context.VolumeMeasurement{TotalVolume: 300, UplinkVolume: 100, DownlinkVolume: 200}},
+		{URRID: 2, DurationMeasurement: 45},
+		{URRID: 9, DurationMeasurement: 10},
+	}
+
+	accuReports := smContext.BuildAccuUsageReports(reports)
+	if len(accuReports) != 2 {
+		t.Fatalf("expected 2 accumulated usage reports, got %v", len(accuReports))
+	}
+	if accuReports[0].RefUmIds != "um-sess" || accuReports[0].GetVolUsage() != 300 ||
+		accuReports[0].GetVolUsageUplink() != 100 || accuReports[0].GetVolUsageDownlink() != 200 {
+		t.Errorf("unexpected session usage report %+v", accuReports[0])
+	}
+	if accuReports[1].RefUmIds != "um-rule" || accuReports[1].GetTimeUsage() != 45 || accuReports[1].HasVolUsage() {
+		t.Errorf("unexpected PCC rule usage report %+v", accuReports[1])
+	}
+}
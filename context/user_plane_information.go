@@ -9,6 +9,8 @@ package context
 import (
 	"net"
 	"reflect"
+	"slices"
+	"strings"
 
 	"github.com/omec-project/openapi/v2"
 	"github.com/omec-project/openapi/v2/models"
@@ -44,6 +46,8 @@ type UPNode struct {
 	Dnn    string
 	Links  []*UPNode
 	Port   uint16
+	// Weight of the UPF in the selection among equivalent UPFs
+	Weight int
 }
 
 // UPPath represent User Plane Sequence of this path
@@ -115,7 +119,7 @@ func BuildUserPlaneInformationFromSessionManagement(existing *UserPlaneInformati
 		upfName := sm.Upf.GetHostname()
 		nodeID := CreateNodeIDFromHostname(upfName)
 		snssai := sm.GetSnssai()
-		dnnList := convertIpDomainsToDnnList(sm.IpDomain)
+		dnnList := convertIpDomainsToDnnList(sm.IpDomain, upfDnaiList(upfName))
 		logger.CtxLog.Infof("creating UPF node: %s, nodeID: %+v, DNNs: %+v, SNSSAI: %+v", upfName, nodeID, dnnList, snssai)
 		snssaiInfo := SnssaiUPFInfo{
 			SNssai: SNssai{
@@ -129,6 +133,7 @@ func BuildUserPlaneInformationFromSessionManagement(existing *UserPlaneInformati
 		node := &factory.UPNode{
 			NodeID:      nodeIDStr,
 			SNssaiInfos: []models.SnssaiUpfInfoItem{snssaiInfoModel},
+			Weight:      upfWeight(upfName),
 		}
 		var interfaceInfoList []factory.InterfaceUpfInfoItem
 		ipStr := nodeID.ResolveNodeIdToIp().String()
@@ -291,6 +296,7 @@ func getOrCreateUpfNode(existing *UserPlaneInformation, name string, node *facto
 		for _, newSnssaiInfo := range node.SNssaiInfos {
 			updateSNssaiInfo(upNode, newSnssaiInfo)
 		}
+		upNode.Weight = node.Weight
 		return upNode
 	}
 
@@ -302,6 +308,7 @@ func getOrCreateUpfNode(existing *UserPlaneInformation, name string, node *facto
 		upNode.Type = UPNodeType(node.Type)
 	}
 	upNode.Port = node.Port
+	upNode.Weight = node.Weight
 
 	switch upNode.Type {
 	case UPNODE_AN:
@@ -387,12 +394,12 @@ func resolvePfcpPort(p int32) uint16 {
 	return DefaultPfcpPort
 }
 
-func convertIpDomainsToDnnList(ipDomains []nfConfigApi.IpDomain) []DnnUPFInfoItem {
+func convertIpDomainsToDnnList(ipDomains []nfConfigApi.IpDomain, dnaiList []string) []DnnUPFInfoItem {
 	dnnList := []DnnUPFInfoItem{}
 	for _, domain := range ipDomains {
 		dnnList = append(dnnList, DnnUPFInfoItem{
 			Dnn:             domain.DnnName,
-			DnaiList:        []string{""},
+			DnaiList:        dnaiList,
 			PduSessionTypes: []models.PduSessionType{models.PDUSESSIONTYPE_IPV4},
 		})
 	}
@@ -448,6 +455,13 @@ func (upi *UserPlaneInformation) GetDefaultUserPlanePathByDNN(selection *UPFSele
 	if pathExist {
 		return upi.DefaultUserPlanePath[selection.String()]
 	}
+	if selection.Dnai != "" {
+		// no UPF serving the DNAI, fall back to the UPFs of the DNN
+		logger.CtxLog.Infof("no UPF serving DNAI[%s], selecting a UPF of DNN[%s]", selection.Dnai, selection.Dnn)
+		fallback := *selection
+		fallback.Dnai = ""
+		return upi.GetDefaultUserPlanePathByDNN(&fallback)
+	}
 	logger.CtxLog.Warnln("unable to find or generate default path for selection:", selection.String())
 	return nil
 }
@@ -495,27 +509,35 @@ func (upi *UserPlaneInformation) RebuildUPFMaps() {
 		for _, snssaiInfo := range node.UPF.SNssaiInfos {
 			for _, dnnInfo := range snssaiInfo.DnnList {
 				dnn := dnnInfo.Dnn
-				selection := &UPFSelectionParams{
-					Dnn: dnn,
-					SNssai: &SNssai{
-						Sst: snssaiInfo.SNssai.Sst,
-						Sd:  snssaiInfo.SNssai.Sd,
-					},
+				// a UPF serving DNAIs is selected for the UEs located in them only
+				dnaiList := dnnInfo.DnaiList
+				if len(dnaiList) == 0 {
+					dnaiList = []string{""}
 				}
-				key := selection.String()
-				foundLink := false
-				for _, an := range node.Links {
-					if an == nil || an.Type != UPNODE_AN {
-						continue
+				for _, dnai := range dnaiList {
+					selection := &UPFSelectionParams{
+						Dnn: dnn,
+						SNssai: &SNssai{
+							Sst: snssaiInfo.SNssai.Sst,
+							Sd:  snssaiInfo.SNssai.Sd,
+						},
+						Dnai: dnai,
 					}
-					if _, exists := upi.DefaultUserPlanePath[key]; !exists {
-						upi.DefaultUserPlanePath[key] = []*UPNode{an, node}
-						logger.CtxLog.Debugf("default path added: AN %s -> UPF %s for key %s", string(an.NodeID.NodeIdValue), name, key)
+					key := selection.String()
+					foundLink := false
+					for _, an := range node.Links {
+						if an == nil || an.Type != UPNODE_AN {
+							continue
+						}
+						if _, exists := upi.DefaultUserPlanePath[key]; !exists {
+							upi.DefaultUserPlanePath[key] = []*UPNode{an, node}
+							logger.CtxLog.Debugf("default path added: AN %s -> UPF %s for key %s", string(an.NodeID.NodeIdValue), name, key)
+						}
+						foundLink = true
+					}
+					if !foundLink {
+						logger.CtxLog.Warnf("no AN linked to UPF %s for SNSSAI %+v and DNN %s — default path not created", name, snssaiInfo.SNssai, dnn)
 					}
-					foundLink = true
-				}
-				if !foundLink {
-					logger.CtxLog.Warnf("no AN linked to UPF %s for SNSSAI %+v and DNN %s — default path not created", name, snssaiInfo.SNssai, dnn)
 				}
 			}
 		}
@@ -565,15 +587,13 @@ func GenerateDataPath(upPath UPPath) *DataPath {
 }
 
 func (upi *UserPlaneInformation) GenerateDefaultPath(selection *UPFSelectionParams) (pathExist bool) {
-	var source *UPNode
-	var destinations []*UPNode
 	for len(upi.AccessNetwork) == 0 {
 		logger.CtxLog.Errorf("there is no AN Node in config file")
 		return false
 	}
 	logger.CtxLog.Infof("UPFs registered: %v", upi.UPFs)
 	logger.CtxLog.Infof("accessNetworks registered: %v", upi.AccessNetwork)
-	destinations = upi.selectMatchUPF(selection)
+	destinations := upi.selectMatchUPF(selection)
 	logger.CtxLog.Debugf("destinations: %+v", destinations)
 	logger.CtxLog.Debugf("selectionParams: %+v, count: %d", selection, len(destinations))
 	if len(destinations) == 0 {
@@ -584,32 +604,90 @@ func (upi *UserPlaneInformation) GenerateDefaultPath(selection *UPFSelectionPara
 	logger.CtxLog.Debugf("found UPF with DNN[%s] S-NSSAI[sst: %d sd: %s] DNAI[%s]", selection.Dnn,
 		selection.SNssai.Sst, selection.SNssai.Sd, selection.Dnai)
 
+	path, pathExist := upi.pathToUPF(destinations[0], selection)
+	if pathExist {
+		upi.DefaultUserPlanePath[selection.String()] = path
+	}
+	return pathExist
+}
+
+// pathToUPF returns a path from an AN to the UPF, without the AN
+func (upi *UserPlaneInformation) pathToUPF(upf *UPNode, selection *UPFSelectionParams) (UPPath, bool) {
 	visited := make(map[*UPNode]bool)
 	for _, upNode := range upi.UPNodes {
 		visited[upNode] = false
 	}
 
 	for anName, node := range upi.AccessNetwork {
-		if node.Type == UPNODE_AN {
-			source = node
-			var path []*UPNode
-			path, pathExist = getPathBetween(source, destinations[0], visited, selection)
-
-			if pathExist {
-				if path[0].Type == UPNODE_AN {
-					path = path[1:]
-				}
-				upi.DefaultUserPlanePath[selection.String()] = path
-				logger.CtxLog.Debugf("path successfully generated: path: %+v, upf: %s, anName: %s", path, string(destinations[0].NodeID.NodeIdValue), anName)
-				break
-			} else {
-				logger.CtxLog.Debugf("no path between an-node[%v] and upf[%v]", anName, string(destinations[0].NodeID.NodeIdValue))
-				continue
-			}
+		if node.Type != UPNODE_AN || !selection.allowsAccessNode(anName) {
+			continue
+		}
+		path, pathExist := getPathBetween(node, upf, visited, selection)
+		if !pathExist {
+			logger.CtxLog.Debugf("no path between an-node[%v] and upf[%v]", anName, string(upf.NodeID.NodeIdValue))
+			continue
+		}
+		if path[0].Type == UPNODE_AN {
+			path = path[1:]
 		}
+		logger.CtxLog.Debugf("path successfully generated: path: %+v, upf: %s, anName: %s", path, string(upf.NodeID.NodeIdValue), anName)
+		return path, true
 	}
+	return nil, false
+}
 
-	return pathExist
+// SelectUserPlanePath selects the UPF of a PDU session among the healthy UPFs
+// matching the selection with the UPF selection strategy and returns the
+// path to it. A DNAI without UPF falls back to the UPFs of the DNN. Sessions
+// throttled by the overload control of a UPF go to the other UPFs.
+func (upi *UserPlaneInformation) SelectUserPlanePath(selection *UPFSelectionParams) UPPath {
+	if len(upi.AccessNetwork) == 0 {
+		logger.CtxLog.Errorf("there is no AN Node in config file")
+		return nil
+	}
+	candidates := upi.selectMatchUPF(selection)
+	if len(candidates) == 0 {
+		if selection.Dnai != "" {
+			logger.CtxLog.Infof("no UPF serving DNAI[%s], selecting a UPF of DNN[%s]", selection.Dnai, selection.Dnn)
+			fallback := *selection
+			fallback.Dnai = ""
+			return upi.SelectUserPlanePath(&fallback)
+		}
+		logger.CtxLog.Errorf("can not find UPF with DNN[%s] S-NSSAI[sst: %d sd: %s]", selection.Dnn,
+			selection.SNssai.Sst, selection.SNssai.Sd)
+		return nil
+	}
+	// the map order of the UPFs must not bias the selection
+	slices.SortFunc(candidates, func(a, b *UPNode) int {
+		return strings.Compare(a.NodeID.ResolveNodeIdToIp().String(), b.NodeID.ResolveNodeIdToIp().String())
+	})
+	healthy := slices.DeleteFunc(slices.Clone(candidates), func(node *UPNode) bool {
+		return !node.healthy()
+	})
+	if len(healthy) == 0 {
+		// the association is recovered when the session is established
+		logger.CtxLog.Warnf("no healthy UPF with DNN[%s] S-NSSAI[sst: %d sd: %s] DNAI[%s]", selection.Dnn,
+			selection.SNssai.Sst, selection.SNssai.Sd, selection.Dnai)
+		healthy = candidates
+	}
+
+	selector := SMF_Self().UPFSelector
+	if selector == nil {
+		selector, _ = NewUPFSelector(UpfSelectionRoundRobin)
+		SMF_Self().UPFSelector = selector
+	}
+	for len(healthy) > 0 {
+		upf := selector.Select(selection.String(), healthy)
+		if upf.UPF.throttled() {
+			logger.CtxLog.Infof("UPF[%s] overloaded, new session throttled", upf.NodeID.ResolveNodeIdToIp())
+		} else if path, ok := upi.pathToUPF(upf, selection); ok {
+			logger.CtxLog.Infof("selected UPF[%s] for DNN[%s] S-NSSAI[sst: %d sd: %s] DNAI[%s]", upf.NodeID.ResolveNodeIdToIp(),
+				selection.Dnn, selection.SNssai.Sst, selection.SNssai.Sd, selection.Dnai)
+			return path
+		}
+		healthy = slices.DeleteFunc(healthy, func(node *UPNode) bool { return node == upf })
+	}
+	return nil
 }
 
 func (upi *UserPlaneInformation) selectMatchUPF(selection *UPFSelectionParams) []*UPNode {
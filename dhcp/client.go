@@ -0,0 +1,459 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package dhcp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTimeout = 3 * time.Second
+	DefaultRetries = 2
+)
+
+// ErrNak is returned when the DHCP server declines to lease the address
+var ErrNak = errors.New("address declined by DHCP server")
+
+// Lease is an address leased by the DHCP server to a UE
+type Lease struct {
+	Obtained time.Time
+	IP       net.IP
+	DNS      []net.IP
+	// ServerID is the DHCPv4 server identifier or the DHCPv6 server DUID
+	ServerID      []byte
+	ClientID      []byte
+	LeaseTime     time.Duration
+	RenewalTime   time.Duration
+	RebindingTime time.Duration
+	IAID          uint32
+}
+
+// RenewAt returns when the lease is to be renewed, at T1, RFC 2131 4.4.5
+func (l *Lease) RenewAt() time.Time {
+	if l.RenewalTime > 0 {
+		return l.Obtained.Add(l.RenewalTime)
+	}
+	return l.Obtained.Add(l.LeaseTime / 2)
+}
+
+// Expiry returns when the lease expires
+func (l *Lease) Expiry() time.Time {
+	return l.Obtained.Add(l.LeaseTime)
+}
+
+// transport exchanges the messages of the relay agent with the DHCP server on a
+// single socket, the replies are dispatched by transaction ID
+type transport struct {
+	conn       net.PacketConn
+	serverAddr net.Addr
+	pending    map[uint32]chan []byte
+	xidOf      func(b []byte) (uint32, bool)
+	// Server is the host:port of the DHCP server
+	Server string
+	// RelayAddr is the local ip:port the relay agent receives the replies on
+	RelayAddr string
+	Timeout   time.Duration
+	Retries   int
+	mu        sync.Mutex
+}
+
+func (t *transport) open() (net.PacketConn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn != nil {
+		return t.conn, nil
+	}
+	serverAddr, err := net.ResolveUDPAddr("udp", t.Server)
+	if err != nil {
+		return nil, fmt.Errorf("resolve DHCP server %s: %w", t.Server, err)
+	}
+	conn, err := net.ListenPacket("udp", t.RelayAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listen on DHCP relay address %s: %w", t.RelayAddr, err)
+	}
+	if ip := conn.LocalAddr().(*net.UDPAddr).IP; ip.IsUnspecified() {
+		conn.Close()
+		return nil, fmt.Errorf("DHCP relay address %s is not a unicast address", t.RelayAddr)
+	}
+	t.conn = conn
+	t.serverAddr = serverAddr
+	if t.pending == nil {
+		t.pending = map[uint32]chan []byte{}
+	}
+	go t.read(conn)
+	return conn, nil
+}
+
+func (t *transport) read(conn net.PacketConn) {
+	buf := make([]byte, maxMessageLen)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.mu.Lock()
+			if t.conn == conn {
+				t.conn = nil
+			}
+			t.mu.Unlock()
+			return
+		}
+		xid, ok := t.xidOf(buf[:n])
+		if !ok {
+			continue
+		}
+		t.mu.Lock()
+		ch := t.pending[xid]
+		t.mu.Unlock()
+		if ch == nil {
+			continue
+		}
+		select {
+		case ch <- append([]byte{}, buf[:n]...):
+		default:
+		}
+	}
+}
+
+func (t *transport) localIP() net.IP {
+	conn, err := t.open()
+	if err != nil {
+		return nil
+	}
+	return conn.LocalAddr().(*net.UDPAddr).IP
+}
+
+// exchange sends the message and waits for the reply accepted by the caller,
+// retransmitting the message on timeout
+func (t *transport) exchange(raw []byte, xid uint32, accept func(b []byte) bool) ([]byte, error) {
+	conn, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	retries := t.Retries
+	if retries <= 0 {
+		retries = DefaultRetries
+	}
+
+	ch := make(chan []byte, 4)
+	t.mu.Lock()
+	t.pending[xid] = ch
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, xid)
+		t.mu.Unlock()
+	}()
+
+	for attempt := 0; attempt <= retries; attempt++ {
+		if _, err := conn.WriteTo(raw, t.serverAddr); err != nil {
+			return nil, fmt.Errorf("send to DHCP server %s: %w", t.Server, err)
+		}
+		timer := time.NewTimer(timeout)
+	wait:
+		for {
+			select {
+			case b := <-ch:
+				if accept(b) {
+					timer.Stop()
+					return b, nil
+				}
+			case <-timer.C:
+				break wait
+			}
+		}
+	}
+	return nil, fmt.Errorf("no reply from DHCP server %s after %d attempts", t.Server, retries+1)
+}
+
+func (t *transport) send(raw []byte) error {
+	conn, err := t.open()
+	if err != nil {
+		return err
+	}
+	_, err = conn.WriteTo(raw, t.serverAddr)
+	return err
+}
+
+// Close closes the socket of the relay agent
+func (t *transport) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+}
+
+// Client obtains DHCPv4 leases for the UEs as a relay agent, RFC 2131 4.1
+type Client struct {
+	transport
+}
+
+func NewClient(server, relayAddr string, timeout time.Duration, retries int) *Client {
+	c := &Client{transport{Server: server, RelayAddr: relayAddr, Timeout: timeout, Retries: retries}}
+	c.xidOf = func(b []byte) (uint32, bool) {
+		m, err := Decode(b)
+		if err != nil || m.Op != opBootReply {
+			return 0, false
+		}
+		return m.Xid, true
+	}
+	return c
+}
+
+func (c *Client) newMessage(t MessageType, clientID []byte) (*Message, error) {
+	m, err := NewMessage(t)
+	if err != nil {
+		return nil, err
+	}
+	m.Hops = 1
+	m.GIAddr = c.localIP()
+	m.CHAddr = HardwareAddr(clientID)
+	// type 0, identifier other than a hardware address, RFC 2132 9.14
+	m.Options[OptionClientIdentifier] = append([]byte{0}, clientID...)
+	return m, nil
+}
+
+func (c *Client) exchangeMessage(m *Message, expected ...MessageType) (*Message, error) {
+	raw, err := m.Encode()
+	if err != nil {
+		return nil, err
+	}
+	var reply *Message
+	_, err = c.exchange(raw, m.Xid, func(b []byte) bool {
+		r, err := Decode(b)
+		if err != nil {
+			return false
+		}
+		for _, t := range expected {
+			if r.Type() == t {
+				reply = r
+				return true
+			}
+		}
+		return false
+	})
+	return reply, err
+}
+
+// Acquire obtains a lease for the client, DHCPDISCOVER then DHCPREQUEST of the offered address
+func (c *Client) Acquire(clientID []byte) (*Lease, error) {
+	discover, err := c.newMessage(Discover, clientID)
+	if err != nil {
+		return nil, err
+	}
+	discover.Options[OptionParameterRequestList] = []byte{
+		uint8(OptionSubnetMask), uint8(OptionRouter), uint8(OptionDNS),
+		uint8(OptionLeaseTime), uint8(OptionRenewalTime), uint8(OptionRebindingTime),
+	}
+	offer, err := c.exchangeMessage(discover, Offer)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := c.newMessage(Request, clientID)
+	if err != nil {
+		return nil, err
+	}
+	request.Options[OptionParameterRequestList] = discover.Options[OptionParameterRequestList]
+	request.SetIP(OptionRequestedIP, offer.YIAddr)
+	request.Options[OptionServerIdentifier] = offer.Options[OptionServerIdentifier]
+	return c.request(request, clientID)
+}
+
+// Renew extends the lease with the server which granted it, RFC 2131 4.3.2
+func (c *Client) Renew(lease *Lease) (*Lease, error) {
+	request, err := c.newMessage(Request, lease.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	request.CIAddr = lease.IP
+	return c.request(request, lease.ClientID)
+}
+
+func (c *Client) request(request *Message, clientID []byte) (*Lease, error) {
+	obtained := time.Now()
+	ack, err := c.exchangeMessage(request, Ack, Nak)
+	if err != nil {
+		return nil, err
+	}
+	if ack.Type() == Nak {
+		return nil, ErrNak
+	}
+	lease := &Lease{
+		IP:            ack.YIAddr.To4(),
+		ServerID:      ack.Options[OptionServerIdentifier],
+		ClientID:      clientID,
+		DNS:           ack.GetIPs(OptionDNS),
+		Obtained:      obtained,
+		LeaseTime:     ack.GetDuration(OptionLeaseTime),
+		RenewalTime:   ack.GetDuration(OptionRenewalTime),
+		RebindingTime: ack.GetDuration(OptionRebindingTime),
+	}
+	if lease.IP == nil || lease.IP.IsUnspecified() {
+		return nil, fmt.Errorf("no address in %s", ack.Type())
+	}
+	return lease, nil
+}
+
+// Release relinquishes the lease, the server does not reply, RFC 2131 4.4.6
+func (c *Client) Release(lease *Lease) error {
+	release, err := c.newMessage(Release, lease.ClientID)
+	if err != nil {
+		return err
+	}
+	release.CIAddr = lease.IP
+	release.Options[OptionServerIdentifier] = lease.ServerID
+	raw, err := release.Encode()
+	if err != nil {
+		return err
+	}
+	return c.send(raw)
+}
+
+// Client6 obtains DHCPv6 leases for the UEs as a relay agent, RFC 8415 19
+type Client6 struct {
+	transport
+}
+
+func NewClient6(server, relayAddr string, timeout time.Duration, retries int) *Client6 {
+	c := &Client6{transport{Server: server, RelayAddr: relayAddr, Timeout: timeout, Retries: retries}}
+	c.xidOf = func(b []byte) (uint32, bool) {
+		r, err := DecodeRelayMessage6(b)
+		if err != nil || r.Type != RelayReply {
+			return 0, false
+		}
+		m, err := r.Relayed()
+		if err != nil {
+			return 0, false
+		}
+		return m.Xid, true
+	}
+	return c
+}
+
+func (c *Client6) newMessage(t MessageType6, clientID []byte) (*Message6, error) {
+	m, err := NewMessage6(t)
+	if err != nil {
+		return nil, err
+	}
+	m.Add(Option6ClientID, DUID(clientID))
+	m.Add(Option6ElapsedTime, []byte{0, 0})
+	return m, nil
+}
+
+func (c *Client6) exchangeMessage(m *Message6, clientID []byte, expected MessageType6) (*Message6, error) {
+	duid := DUID(clientID)
+	relay := &RelayMessage6{
+		Type:     RelayForward,
+		LinkAddr: c.localIP(),
+		// link-local address of the UE derived from its DUID
+		PeerAddr: net.IP(append([]byte{0xfe, 0x80, 0, 0, 0, 0, 0, 0}, duid[len(duid)-8:]...)),
+		Options: []Option6Value{
+			{Code: Option6RelayMsg, Value: m.Encode()},
+			{Code: Option6InterfaceID, Value: clientID},
+		},
+	}
+	var reply *Message6
+	_, err := c.exchange(relay.Encode(), m.Xid, func(b []byte) bool {
+		r, err := DecodeRelayMessage6(b)
+		if err != nil {
+			return false
+		}
+		if reply, err = r.Relayed(); err != nil {
+			return false
+		}
+		return reply.Type == expected
+	})
+	return reply, err
+}
+
+// Acquire obtains a lease for the client, Solicit then Request of the advertised address
+func (c *Client6) Acquire(clientID []byte) (*Lease, error) {
+	solicit, err := c.newMessage(Solicit, clientID)
+	if err != nil {
+		return nil, err
+	}
+	solicit.Add(Option6ORO, []byte{0, uint8(Option6DNS)})
+	ia := &IANA{IAID: 1}
+	solicit.Add(Option6IANA, ia.Encode())
+	advertise, err := c.exchangeMessage(solicit, clientID, Advertise)
+	if err != nil {
+		return nil, err
+	}
+	offered, err := DecodeIANA(advertise.Get(Option6IANA))
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := c.newMessage(Request6, clientID)
+	if err != nil {
+		return nil, err
+	}
+	request.Add(Option6ServerID, advertise.Get(Option6ServerID))
+	request.Add(Option6ORO, []byte{0, uint8(Option6DNS)})
+	request.Add(Option6IANA, offered.Encode())
+	return c.request(request, clientID)
+}
+
+// Renew extends the lease with the server which granted it, RFC 8415 18.2.4
+func (c *Client6) Renew(lease *Lease) (*Lease, error) {
+	renew, err := c.newMessage(Renew6, lease.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	renew.Add(Option6ServerID, lease.ServerID)
+	ia := &IANA{IAID: lease.IAID, Addr: lease.IP}
+	renew.Add(Option6IANA, ia.Encode())
+	return c.request(renew, lease.ClientID)
+}
+
+func (c *Client6) request(request *Message6, clientID []byte) (*Lease, error) {
+	obtained := time.Now()
+	reply, err := c.exchangeMessage(request, clientID, Reply6)
+	if err != nil {
+		return nil, err
+	}
+	ia, err := DecodeIANA(reply.Get(Option6IANA))
+	if err != nil {
+		return nil, err
+	}
+	if ia.Status != StatusSuccess || ia.Addr == nil {
+		return nil, fmt.Errorf("%w: status %d", ErrNak, ia.Status)
+	}
+	lease := &Lease{
+		IP:            ia.Addr,
+		ServerID:      reply.Get(Option6ServerID),
+		ClientID:      clientID,
+		Obtained:      obtained,
+		LeaseTime:     ia.ValidTime,
+		RenewalTime:   ia.T1,
+		RebindingTime: ia.T2,
+		IAID:          ia.IAID,
+	}
+	for dns := reply.Get(Option6DNS); len(dns) >= net.IPv6len; dns = dns[net.IPv6len:] {
+		lease.DNS = append(lease.DNS, net.IP(dns[:net.IPv6len]))
+	}
+	return lease, nil
+}
+
+// Release relinquishes the lease, RFC 8415 18.2.7
+func (c *Client6) Release(lease *Lease) error {
+	release, err := c.newMessage(Release6, lease.ClientID)
+	if err != nil {
+		return err
+	}
+	release.Add(Option6ServerID, lease.ServerID)
+	ia := &IANA{IAID: lease.IAID, Addr: lease.IP}
+	release.Add(Option6IANA, ia.Encode())
+	_, err = c.exchangeMessage(release, lease.ClientID, Reply6)
+	return err
+}
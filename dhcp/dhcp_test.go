@@ -0,0 +1,233 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package dhcp_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/omec-project/smf/dhcp"
+)
+
+func listen(t *testing.T, network, addr string) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket(network, addr)
+	if err != nil {
+		t.Skipf("listen %s: %v", addr, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestEncodeDecode(t *testing.T) {
+	m, err := dhcp.NewMessage(dhcp.Discover)
+	if err != nil {
+		t.Fatalf("new message: %v", err)
+	}
+	m.GIAddr = net.ParseIP("10.0.0.1")
+	m.CHAddr = dhcp.HardwareAddr([]byte("imsi-208930000000001"))
+	m.SetIP(dhcp.OptionRequestedIP, net.ParseIP("10.1.2.3"))
+	m.SetDuration(dhcp.OptionLeaseTime, time.Hour)
+
+	raw, err := m.Encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	decoded, err := dhcp.Decode(raw)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.Type() != dhcp.Discover || decoded.Xid != m.Xid {
+		t.Errorf("unexpected %s xid %x", decoded.Type(), decoded.Xid)
+	}
+	if !decoded.GIAddr.Equal(m.GIAddr) || !bytes.Equal(decoded.CHAddr, m.CHAddr) {
+		t.Errorf("unexpected giaddr %v chaddr %v", decoded.GIAddr, decoded.CHAddr)
+	}
+	if !decoded.GetIP(dhcp.OptionRequestedIP).Equal(net.ParseIP("10.1.2.3")) ||
+		decoded.GetDuration(dhcp.OptionLeaseTime) != time.Hour {
+		t.Errorf("unexpected options %v", decoded.Options)
+	}
+	if m.CHAddr[0]&0x03 != 0x02 {
+		t.Errorf("expected locally administered unicast hardware address, got %v", m.CHAddr)
+	}
+
+	if _, err := dhcp.Decode(raw[:100]); err == nil {
+		t.Errorf("expected error for short message")
+	}
+}
+
+func TestEncodeDecode6(t *testing.T) {
+	m, err := dhcp.NewMessage6(dhcp.Request6)
+	if err != nil {
+		t.Fatalf("new message: %v", err)
+	}
+	ia := &dhcp.IANA{IAID: 1, T1: time.Minute, T2: 2 * time.Minute, Addr: net.ParseIP("2001:db8::1"), ValidTime: time.Hour}
+	m.Add(dhcp.Option6IANA, ia.Encode())
+	relay := &dhcp.RelayMessage6{
+		Type:     dhcp.RelayForward,
+		LinkAddr: net.ParseIP("2001:db8::ffff"),
+		PeerAddr: net.ParseIP("fe80::1"),
+		Options:  []dhcp.Option6Value{{Code: dhcp.Option6RelayMsg, Value: m.Encode()}},
+	}
+
+	decodedRelay, err := dhcp.DecodeRelayMessage6(relay.Encode())
+	if err != nil {
+		t.Fatalf("decode relay: %v", err)
+	}
+	if !decodedRelay.LinkAddr.Equal(relay.LinkAddr) || !decodedRelay.PeerAddr.Equal(relay.PeerAddr) {
+		t.Errorf("unexpected relay addresses %v %v", decodedRelay.LinkAddr, decodedRelay.PeerAddr)
+	}
+	decoded, err := decodedRelay.Relayed()
+	if err != nil {
+		t.Fatalf("relayed: %v", err)
+	}
+	if decoded.Type != dhcp.Request6 || decoded.Xid != m.Xid {
+		t.Errorf("unexpected %s xid %x", decoded.Type, decoded.Xid)
+	}
+	decodedIA, err := dhcp.DecodeIANA(decoded.Get(dhcp.Option6IANA))
+	if err != nil {
+		t.Fatalf("decode IA_NA: %v", err)
+	}
+	if decodedIA.IAID != 1 || decodedIA.T1 != time.Minute || !decodedIA.Addr.Equal(ia.Addr) || decodedIA.ValidTime != time.Hour {
+		t.Errorf("unexpected IA_NA %+v", decodedIA)
+	}
+}
+
+func TestClient(t *testing.T) {
+	serverConn := listen(t, "udp4", "127.0.0.1:0")
+	released := make(chan net.IP, 1)
+	server := &dhcp.Server{Handler: func(request *dhcp.Message) *dhcp.Message {
+		if request.GIAddr.IsUnspecified() || string(request.Options[dhcp.OptionClientIdentifier][1:]) != "imsi-1" {
+			return nil
+		}
+		switch request.Type() {
+		case dhcp.Discover:
+			reply := request.Reply(dhcp.Offer)
+			reply.YIAddr = net.ParseIP("10.1.2.3")
+			reply.SetIP(dhcp.OptionServerIdentifier, net.ParseIP("127.0.0.1"))
+			return reply
+		case dhcp.Request:
+			if !request.CIAddr.IsUnspecified() && !request.CIAddr.Equal(net.ParseIP("10.1.2.3")) {
+				return request.Reply(dhcp.Nak)
+			}
+			reply := request.Reply(dhcp.Ack)
+			reply.YIAddr = net.ParseIP("10.1.2.3")
+			reply.SetIP(dhcp.OptionServerIdentifier, net.ParseIP("127.0.0.1"))
+			reply.SetIP(dhcp.OptionDNS, net.ParseIP("8.8.8.8"))
+			reply.SetDuration(dhcp.OptionLeaseTime, time.Hour)
+			return reply
+		case dhcp.Release:
+			released <- request.CIAddr
+		}
+		return nil
+	}}
+	go func() { _ = server.Serve(serverConn) }()
+
+	client := dhcp.NewClient(serverConn.LocalAddr().String(), "127.0.0.1:0", time.Second, 1)
+	defer client.Close()
+
+	lease, err := client.Acquire([]byte("imsi-1"))
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if !lease.IP.Equal(net.ParseIP("10.1.2.3")) || lease.LeaseTime != time.Hour ||
+		len(lease.DNS) != 1 || !lease.DNS[0].Equal(net.ParseIP("8.8.8.8")) {
+		t.Errorf("unexpected lease %+v", lease)
+	}
+	if renewAt := lease.RenewAt(); renewAt != lease.Obtained.Add(30*time.Minute) {
+		t.Errorf("expected renewal at half the lease time, got %v", renewAt.Sub(lease.Obtained))
+	}
+
+	renewed, err := client.Renew(lease)
+	if err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	if !renewed.IP.Equal(lease.IP) {
+		t.Errorf("unexpected renewed address %v", renewed.IP)
+	}
+
+	lease.IP = net.ParseIP("10.9.9.9").To4()
+	if _, err := client.Renew(lease); !errors.Is(err, dhcp.ErrNak) {
+		t.Errorf("expected NAK, got %v", err)
+	}
+
+	if err := client.Release(renewed); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	select {
+	case ip := <-released:
+		if !ip.Equal(renewed.IP) {
+			t.Errorf("unexpected released address %v", ip)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("no DHCPRELEASE received")
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	serverConn := listen(t, "udp4", "127.0.0.1:0")
+	server := &dhcp.Server{Handler: func(request *dhcp.Message) *dhcp.Message { return nil }}
+	go func() { _ = server.Serve(serverConn) }()
+
+	client := dhcp.NewClient(serverConn.LocalAddr().String(), "127.0.0.1:0", 50*time.Millisecond, 1)
+	defer client.Close()
+	if _, err := client.Acquire([]byte("imsi-1")); err == nil {
+		t.Errorf("expected timeout error")
+	}
+}
+
+func TestClientUnspecifiedRelayAddr(t *testing.T) {
+	client := dhcp.NewClient("127.0.0.1:67", "0.0.0.0:0", 50*time.Millisecond, 1)
+	defer client.Close()
+	if _, err := client.Acquire([]byte("imsi-1")); err == nil {
+		t.Errorf("expected error for unspecified relay address")
+	}
+}
+
+func TestClient6(t *testing.T) {
+	serverConn := listen(t, "udp6", "[::1]:0")
+	serverID := []byte{0, 4, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	server := &dhcp.Server6{Handler: func(request *dhcp.Message6) *dhcp.Message6 {
+		if request.Get(dhcp.Option6ClientID) == nil {
+			return nil
+		}
+		ia := &dhcp.IANA{IAID: 1, T1: 30 * time.Minute, T2: 45 * time.Minute,
+			Addr: net.ParseIP("2001:db8::10"), PreferredTime: time.Hour, ValidTime: time.Hour}
+		var reply *dhcp.Message6
+		switch request.Type {
+		case dhcp.Solicit:
+			reply = request.Reply(dhcp.Advertise)
+		case dhcp.Request6, dhcp.Renew6, dhcp.Release6:
+			reply = request.Reply(dhcp.Reply6)
+		default:
+			return nil
+		}
+		reply.Add(dhcp.Option6ServerID, serverID)
+		reply.Add(dhcp.Option6IANA, ia.Encode())
+		reply.Add(dhcp.Option6DNS, net.ParseIP("2001:4860:4860::8888"))
+		return reply
+	}}
+	go func() { _ = server.Serve(serverConn) }()
+
+	client := dhcp.NewClient6(serverConn.LocalAddr().String(), "[::1]:0", time.Second, 1)
+	defer client.Close()
+
+	lease, err := client.Acquire([]byte("imsi-1"))
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if !lease.IP.Equal(net.ParseIP("2001:db8::10")) || lease.RenewalTime != 30*time.Minute ||
+		!bytes.Equal(lease.ServerID, serverID) || len(lease.DNS) != 1 {
+		t.Errorf("unexpected lease %+v", lease)
+	}
+	if _, err := client.Renew(lease); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	if err := client.Release(lease); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+}
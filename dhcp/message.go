@@ -0,0 +1,252 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+// Package dhcp implements the DHCPv4 and DHCPv6 relay clients used by the SMF to
+// obtain the UE addresses of a DNN from an external DHCP server, TS 29.561
+// clause 10 (RFC 2131, RFC 3046 and RFC 8415).
+package dhcp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+type MessageType uint8
+
+// DHCPv4 message types, RFC 2132 9.6
+const (
+	Discover MessageType = 1
+	Offer    MessageType = 2
+	Request  MessageType = 3
+	Decline  MessageType = 4
+	Ack      MessageType = 5
+	Nak      MessageType = 6
+	Release  MessageType = 7
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case Discover:
+		return "DHCPDISCOVER"
+	case Offer:
+		return "DHCPOFFER"
+	case Request:
+		return "DHCPREQUEST"
+	case Decline:
+		return "DHCPDECLINE"
+	case Ack:
+		return "DHCPACK"
+	case Nak:
+		return "DHCPNAK"
+	case Release:
+		return "DHCPRELEASE"
+	default:
+		return fmt.Sprintf("MessageType(%d)", uint8(t))
+	}
+}
+
+// Option is the DHCPv4 option code
+type Option uint8
+
+// DHCPv4 options, RFC 2132
+const (
+	OptionPad                  Option = 0
+	OptionSubnetMask           Option = 1
+	OptionRouter               Option = 3
+	OptionDNS                  Option = 6
+	OptionRequestedIP          Option = 50
+	OptionLeaseTime            Option = 51
+	OptionMessageType          Option = 53
+	OptionServerIdentifier     Option = 54
+	OptionParameterRequestList Option = 55
+	OptionRenewalTime          Option = 58
+	OptionRebindingTime        Option = 59
+	OptionClientIdentifier     Option = 61
+	OptionEnd                  Option = 255
+)
+
+const (
+	opBootRequest uint8 = 1
+	opBootReply   uint8 = 2
+	htypeEthernet uint8 = 1
+	headerLen           = 236
+	maxMessageLen       = 1500
+)
+
+var magicCookie = []byte{99, 130, 83, 99}
+
+// Message is a DHCPv4 message, RFC 2131 2
+type Message struct {
+	Options map[Option][]byte
+	CIAddr  net.IP
+	YIAddr  net.IP
+	GIAddr  net.IP
+	CHAddr  net.HardwareAddr
+	Xid     uint32
+	Op      uint8
+	Hops    uint8
+}
+
+// NewMessage returns a client message of the type with a random transaction ID
+func NewMessage(t MessageType) (*Message, error) {
+	var xid [4]byte
+	if _, err := rand.Read(xid[:]); err != nil {
+		return nil, err
+	}
+	m := &Message{
+		Op:      opBootRequest,
+		Xid:     binary.BigEndian.Uint32(xid[:]),
+		Options: map[Option][]byte{},
+	}
+	m.Options[OptionMessageType] = []byte{uint8(t)}
+	return m, nil
+}
+
+// Reply returns the server reply of the type to the message
+func (m *Message) Reply(t MessageType) *Message {
+	return &Message{
+		Op:      opBootReply,
+		Xid:     m.Xid,
+		GIAddr:  m.GIAddr,
+		CHAddr:  m.CHAddr,
+		Hops:    m.Hops,
+		Options: map[Option][]byte{OptionMessageType: {uint8(t)}},
+	}
+}
+
+func (m *Message) Type() MessageType {
+	if v := m.Options[OptionMessageType]; len(v) == 1 {
+		return MessageType(v[0])
+	}
+	return 0
+}
+
+func (m *Message) SetIP(o Option, ip net.IP) {
+	m.Options[o] = append([]byte{}, ip.To4()...)
+}
+
+func (m *Message) GetIP(o Option) net.IP {
+	if v := m.Options[o]; len(v) >= net.IPv4len {
+		return net.IP(v[:net.IPv4len])
+	}
+	return nil
+}
+
+func (m *Message) GetIPs(o Option) []net.IP {
+	var ips []net.IP
+	v := m.Options[o]
+	for ; len(v) >= net.IPv4len; v = v[net.IPv4len:] {
+		ips = append(ips, net.IP(v[:net.IPv4len]))
+	}
+	return ips
+}
+
+func (m *Message) SetDuration(o Option, d time.Duration) {
+	m.Options[o] = binary.BigEndian.AppendUint32(nil, uint32(d/time.Second))
+}
+
+func (m *Message) GetDuration(o Option) time.Duration {
+	if v := m.Options[o]; len(v) == 4 {
+		return time.Duration(binary.BigEndian.Uint32(v)) * time.Second
+	}
+	return 0
+}
+
+func putIP(b []byte, ip net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		copy(b, ip4)
+	}
+}
+
+func (m *Message) Encode() ([]byte, error) {
+	b := make([]byte, headerLen, maxMessageLen)
+	b[0] = m.Op
+	b[1] = htypeEthernet
+	b[2] = uint8(len(m.CHAddr))
+	b[3] = m.Hops
+	binary.BigEndian.PutUint32(b[4:8], m.Xid)
+	putIP(b[12:16], m.CIAddr)
+	putIP(b[16:20], m.YIAddr)
+	putIP(b[24:28], m.GIAddr)
+	copy(b[28:44], m.CHAddr)
+	b = append(b, magicCookie...)
+	// message type first, RFC 2132 9.6
+	for _, o := range append([]Option{OptionMessageType}, sortedOptions(m.Options)...) {
+		v, ok := m.Options[o]
+		if !ok {
+			continue
+		}
+		if len(v) > 255 {
+			return nil, fmt.Errorf("option %d too long: %d", o, len(v))
+		}
+		b = append(b, uint8(o), uint8(len(v)))
+		b = append(b, v...)
+	}
+	b = append(b, uint8(OptionEnd))
+	if len(b) > maxMessageLen {
+		return nil, fmt.Errorf("message too long: %d", len(b))
+	}
+	return b, nil
+}
+
+func sortedOptions(options map[Option][]byte) []Option {
+	var codes []Option
+	for o := Option(1); o < OptionEnd; o++ {
+		if _, ok := options[o]; ok && o != OptionMessageType {
+			codes = append(codes, o)
+		}
+	}
+	return codes
+}
+
+func Decode(b []byte) (*Message, error) {
+	if len(b) < headerLen+len(magicCookie) {
+		return nil, fmt.Errorf("message too short: %d", len(b))
+	}
+	if string(b[headerLen:headerLen+4]) != string(magicCookie) {
+		return nil, fmt.Errorf("invalid magic cookie")
+	}
+	hlen := int(b[2])
+	if hlen > 16 {
+		return nil, fmt.Errorf("invalid hardware address length: %d", hlen)
+	}
+	m := &Message{
+		Op:      b[0],
+		Hops:    b[3],
+		Xid:     binary.BigEndian.Uint32(b[4:8]),
+		CIAddr:  net.IP(append([]byte{}, b[12:16]...)),
+		YIAddr:  net.IP(append([]byte{}, b[16:20]...)),
+		GIAddr:  net.IP(append([]byte{}, b[24:28]...)),
+		CHAddr:  net.HardwareAddr(append([]byte{}, b[28:28+hlen]...)),
+		Options: map[Option][]byte{},
+	}
+	for opts := b[headerLen+4:]; len(opts) > 0; {
+		o := Option(opts[0])
+		if o == OptionEnd {
+			break
+		}
+		if o == OptionPad {
+			opts = opts[1:]
+			continue
+		}
+		if len(opts) < 2 || len(opts) < 2+int(opts[1]) {
+			return nil, fmt.Errorf("option %d too long", o)
+		}
+		m.Options[o] = append(m.Options[o], opts[2:2+int(opts[1])]...)
+		opts = opts[2+int(opts[1]):]
+	}
+	return m, nil
+}
+
+// HardwareAddr derives the client hardware address of a UE, which has none on
+// the N6 interface, as a locally administered unicast MAC address
+func HardwareAddr(clientID []byte) net.HardwareAddr {
+	sum := sha256.Sum256(clientID)
+	mac := net.HardwareAddr(sum[:6])
+	mac[0] = mac[0]&0xfc | 0x02
+	return mac
+}
@@ -0,0 +1,261 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package dhcp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+type MessageType6 uint8
+
+// DHCPv6 message types, RFC 8415 7.3
+const (
+	Solicit      MessageType6 = 1
+	Advertise    MessageType6 = 2
+	Request6     MessageType6 = 3
+	Renew6       MessageType6 = 5
+	Reply6       MessageType6 = 7
+	Release6     MessageType6 = 8
+	RelayForward MessageType6 = 12
+	RelayReply   MessageType6 = 13
+)
+
+func (t MessageType6) String() string {
+	switch t {
+	case Solicit:
+		return "Solicit"
+	case Advertise:
+		return "Advertise"
+	case Request6:
+		return "Request"
+	case Renew6:
+		return "Renew"
+	case Reply6:
+		return "Reply"
+	case Release6:
+		return "Release"
+	case RelayForward:
+		return "Relay-forward"
+	case RelayReply:
+		return "Relay-reply"
+	default:
+		return fmt.Sprintf("MessageType6(%d)", uint8(t))
+	}
+}
+
+// Option6 is the DHCPv6 option code
+type Option6 uint16
+
+// DHCPv6 options, RFC 8415 21 and RFC 3646
+const (
+	Option6ClientID    Option6 = 1
+	Option6ServerID    Option6 = 2
+	Option6IANA        Option6 = 3
+	Option6IAAddr      Option6 = 5
+	Option6ORO         Option6 = 6
+	Option6ElapsedTime Option6 = 8
+	Option6RelayMsg    Option6 = 9
+	Option6StatusCode  Option6 = 13
+	Option6InterfaceID Option6 = 18
+	Option6DNS         Option6 = 23
+)
+
+// StatusSuccess is the Success status code, RFC 8415 21.13
+const StatusSuccess uint16 = 0
+
+const relayHeaderLen = 34
+
+// Option6Value is a DHCPv6 option
+type Option6Value struct {
+	Value []byte
+	Code  Option6
+}
+
+// Message6 is a DHCPv6 client/server message, RFC 8415 8
+type Message6 struct {
+	Options []Option6Value
+	Type    MessageType6
+	Xid     uint32
+}
+
+// RelayMessage6 is a DHCPv6 relay agent/server message, RFC 8415 9
+type RelayMessage6 struct {
+	LinkAddr net.IP
+	PeerAddr net.IP
+	Options  []Option6Value
+	Type     MessageType6
+	Hops     uint8
+}
+
+// NewMessage6 returns a client message of the type with a random transaction ID
+func NewMessage6(t MessageType6) (*Message6, error) {
+	var xid [4]byte
+	if _, err := rand.Read(xid[1:]); err != nil {
+		return nil, err
+	}
+	return &Message6{Type: t, Xid: binary.BigEndian.Uint32(xid[:])}, nil
+}
+
+// Reply returns the server reply of the type to the message
+func (m *Message6) Reply(t MessageType6) *Message6 {
+	return &Message6{Type: t, Xid: m.Xid}
+}
+
+func (m *Message6) Add(code Option6, value []byte) {
+	m.Options = append(m.Options, Option6Value{Code: code, Value: value})
+}
+
+func (m *Message6) Get(code Option6) []byte {
+	return getOption6(m.Options, code)
+}
+
+func getOption6(options []Option6Value, code Option6) []byte {
+	for _, o := range options {
+		if o.Code == code {
+			return o.Value
+		}
+	}
+	return nil
+}
+
+func (m *Message6) Encode() []byte {
+	b := binary.BigEndian.AppendUint32(nil, m.Xid)
+	b[0] = uint8(m.Type)
+	return encodeOptions6(b, m.Options)
+}
+
+func encodeOptions6(b []byte, options []Option6Value) []byte {
+	for _, o := range options {
+		b = binary.BigEndian.AppendUint16(b, uint16(o.Code))
+		b = binary.BigEndian.AppendUint16(b, uint16(len(o.Value)))
+		b = append(b, o.Value...)
+	}
+	return b
+}
+
+func decodeOptions6(b []byte) ([]Option6Value, error) {
+	var options []Option6Value
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, fmt.Errorf("option header too short: %d", len(b))
+		}
+		code := Option6(binary.BigEndian.Uint16(b[0:2]))
+		optLen := int(binary.BigEndian.Uint16(b[2:4]))
+		if len(b) < 4+optLen {
+			return nil, fmt.Errorf("option %d too long: %d", code, optLen)
+		}
+		options = append(options, Option6Value{Code: code, Value: append([]byte{}, b[4:4+optLen]...)})
+		b = b[4+optLen:]
+	}
+	return options, nil
+}
+
+func DecodeMessage6(b []byte) (*Message6, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("message too short: %d", len(b))
+	}
+	options, err := decodeOptions6(b[4:])
+	if err != nil {
+		return nil, err
+	}
+	return &Message6{
+		Type:    MessageType6(b[0]),
+		Xid:     binary.BigEndian.Uint32(b[0:4]) & 0xffffff,
+		Options: options,
+	}, nil
+}
+
+func (m *RelayMessage6) Encode() []byte {
+	b := make([]byte, relayHeaderLen)
+	b[0] = uint8(m.Type)
+	b[1] = m.Hops
+	copy(b[2:18], m.LinkAddr.To16())
+	copy(b[18:34], m.PeerAddr.To16())
+	return encodeOptions6(b, m.Options)
+}
+
+func DecodeRelayMessage6(b []byte) (*RelayMessage6, error) {
+	if len(b) < relayHeaderLen {
+		return nil, fmt.Errorf("relay message too short: %d", len(b))
+	}
+	options, err := decodeOptions6(b[relayHeaderLen:])
+	if err != nil {
+		return nil, err
+	}
+	return &RelayMessage6{
+		Type:     MessageType6(b[0]),
+		Hops:     b[1],
+		LinkAddr: net.IP(append([]byte{}, b[2:18]...)),
+		PeerAddr: net.IP(append([]byte{}, b[18:34]...)),
+		Options:  options,
+	}, nil
+}
+
+// Relayed returns the message relayed in the Relay Message option
+func (m *RelayMessage6) Relayed() (*Message6, error) {
+	relayed := getOption6(m.Options, Option6RelayMsg)
+	if relayed == nil {
+		return nil, fmt.Errorf("no Relay Message option")
+	}
+	return DecodeMessage6(relayed)
+}
+
+// IANA is an Identity Association for Non-temporary Addresses, RFC 8415 21.4
+type IANA struct {
+	Addr          net.IP
+	T1            time.Duration
+	T2            time.Duration
+	PreferredTime time.Duration
+	ValidTime     time.Duration
+	IAID          uint32
+	Status        uint16
+}
+
+func (ia *IANA) Encode() []byte {
+	b := binary.BigEndian.AppendUint32(nil, ia.IAID)
+	b = binary.BigEndian.AppendUint32(b, uint32(ia.T1/time.Second))
+	b = binary.BigEndian.AppendUint32(b, uint32(ia.T2/time.Second))
+	if ia.Addr == nil {
+		return b
+	}
+	addr := append([]byte{}, ia.Addr.To16()...)
+	addr = binary.BigEndian.AppendUint32(addr, uint32(ia.PreferredTime/time.Second))
+	addr = binary.BigEndian.AppendUint32(addr, uint32(ia.ValidTime/time.Second))
+	return encodeOptions6(b, []Option6Value{{Code: Option6IAAddr, Value: addr}})
+}
+
+func DecodeIANA(b []byte) (*IANA, error) {
+	if len(b) < 12 {
+		return nil, fmt.Errorf("IA_NA too short: %d", len(b))
+	}
+	ia := &IANA{
+		IAID: binary.BigEndian.Uint32(b[0:4]),
+		T1:   time.Duration(binary.BigEndian.Uint32(b[4:8])) * time.Second,
+		T2:   time.Duration(binary.BigEndian.Uint32(b[8:12])) * time.Second,
+	}
+	options, err := decodeOptions6(b[12:])
+	if err != nil {
+		return nil, err
+	}
+	if status := getOption6(options, Option6StatusCode); len(status) >= 2 {
+		ia.Status = binary.BigEndian.Uint16(status)
+	}
+	if addr := getOption6(options, Option6IAAddr); len(addr) >= 24 {
+		ia.Addr = net.IP(addr[0:16])
+		ia.PreferredTime = time.Duration(binary.BigEndian.Uint32(addr[16:20])) * time.Second
+		ia.ValidTime = time.Duration(binary.BigEndian.Uint32(addr[20:24])) * time.Second
+	}
+	return ia, nil
+}
+
+// DUID derives the DHCP Unique Identifier of a UE as a DUID-UUID, RFC 6355
+func DUID(clientID []byte) []byte {
+	sum := sha256.Sum256(clientID)
+	return append([]byte{0, 4}, sum[:16]...)
+}
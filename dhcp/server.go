@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package dhcp
+
+import (
+	"net"
+)
+
+// Handler returns the reply to the message, nil to discard the message
+type Handler func(request *Message) *Message
+
+// Server is a minimal DHCPv4 server, e.g. a local stand-in for the DHCP server
+// of a DNN. Replies are sent to the relay agent the messages come from.
+type Server struct {
+	Handler Handler
+}
+
+// Serve answers the messages received on the connection until it is closed
+func (s *Server) Serve(conn net.PacketConn) error {
+	buf := make([]byte, maxMessageLen)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		request, err := Decode(buf[:n])
+		if err != nil || request.Op != opBootRequest {
+			continue
+		}
+		reply := s.Handler(request)
+		if reply == nil {
+			continue
+		}
+		raw, err := reply.Encode()
+		if err != nil {
+			continue
+		}
+		if _, err := conn.WriteTo(raw, addr); err != nil {
+			return err
+		}
+	}
+}
+
+// Handler6 returns the reply to the relayed message, nil to discard the message
+type Handler6 func(request *Message6) *Message6
+
+// Server6 is a minimal DHCPv6 server, e.g. a local stand-in for the DHCP server
+// of a DNN, answering the messages relayed in Relay-forward messages
+type Server6 struct {
+	Handler Handler6
+}
+
+// Serve answers the messages received on the connection until it is closed
+func (s *Server6) Serve(conn net.PacketConn) error {
+	buf := make([]byte, maxMessageLen)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		relay, err := DecodeRelayMessage6(buf[:n])
+		if err != nil || relay.Type != RelayForward {
+			continue
+		}
+		request, err := relay.Relayed()
+		if err != nil {
+			continue
+		}
+		reply := s.Handler(request)
+		if reply == nil {
+			continue
+		}
+		relayReply := &RelayMessage6{
+			Type:     RelayReply,
+			Hops:     relay.Hops,
+			LinkAddr: relay.LinkAddr,
+			PeerAddr: relay.PeerAddr,
+			Options:  []Option6Value{{Code: Option6RelayMsg, Value: reply.Encode()}},
+		}
+		if interfaceID := getOption6(relay.Options, Option6InterfaceID); interfaceID != nil {
+			relayReply.Options = append(relayReply.Options, Option6Value{Code: Option6InterfaceID, Value: interfaceID})
+		}
+		if _, err := conn.WriteTo(relayReply.Encode(), addr); err != nil {
+			return err
+		}
+	}
+}
@@ -73,6 +73,39 @@ type Configuration struct {
 	EnableUpfAdapter         bool              `yaml:"enableUPFAdapter,omitempty"`
 	ULCL                     bool              `yaml:"ulcl,omitempty"`
 	PCSCFInfo                PCSCFInfo         `yaml:"pcscfInfos,omitempty"`
+	// RQTimer is the reflective QoS timer in seconds sent to the UE, TS 24.501 9.11.2.3
+	RQTimer int `yaml:"rqTimer,omitempty"`
+	// CongestionControl holds the 5GSM congestion control back-off timers, TS 24.501 6.2.7
+	CongestionControl *CongestionControl `yaml:"congestionControl,omitempty"`
+	// DnAaaInfo configures the DN-AAA server for secondary authentication per DNN, TS 29.561 11
+	DnAaaInfo []DnAaaInfo `yaml:"dnAaaInfo,omitempty"`
+	// DhcpInfo configures the external DHCP server of the UE addresses per DNN, TS 29.561 10
+	DhcpInfo []DhcpInfo `yaml:"dhcpInfo,omitempty"`
+	// UeIpPoolInfo configures several UE address pools per DNN, replacing the
+	// single UE subnet of the DNN
+	UeIpPoolInfo []UeIpPoolInfo `yaml:"ueIpPoolInfo,omitempty"`
+	// UeIpAllocation configures the allocation of the UE addresses of all pools
+	UeIpAllocation *UeIpAllocation `yaml:"ueIpAllocation,omitempty"`
+	// StickyIpInfo holds the last UE address per DNN for its next PDU session
+	StickyIpInfo []StickyIpInfo `yaml:"stickyIpInfo,omitempty"`
+	// LadnInfo configures the service area of the LADN DNNs, TS 23.501 5.6.5
+	LadnInfo []LadnInfo `yaml:"ladnInfo,omitempty"`
+	// DnaiInfo maps the UE locations to DNAIs and the DNAIs to their UPFs
+	DnaiInfo []DnaiInfo `yaml:"dnaiInfo,omitempty"`
+	// UpfSelection configures the selection among the UPFs matching a PDU session
+	UpfSelection *UpfSelection `yaml:"upfSelection,omitempty"`
+	// UpfFailureInfo configures the handling of the PDU sessions of a DNN
+	// when their UPF stops answering the heartbeats
+	UpfFailureInfo []UpfFailureInfo `yaml:"upfFailureInfo,omitempty"`
+	// SscModeInfo configures the PSA relocation of the SSC mode 3 PDU
+	// sessions of a DNN, TS 23.501 5.6.9.2.3
+	SscModeInfo []SscModeInfo `yaml:"sscModeInfo,omitempty"`
+	// NonThreeGppAnInfo configures the N3IWFs and TNGFs among the ANs of the
+	// UPFs, which then serve the non-3GPP access PDU sessions only
+	NonThreeGppAnInfo []NonThreeGppAnInfo `yaml:"nonThreeGppAnInfo,omitempty"`
+	// RedundantTransmissionInfo configures the redundant N3 transmission of
+	// the URLLC QoS flows of a DNN, TS 23.501 5.33.2.2
+	RedundantTransmissionInfo []RedundantTransmissionInfo `yaml:"redundantTransmissionInfo,omitempty"`
 }
 
 type StaticIpInfo struct {
@@ -80,6 +113,107 @@ type StaticIpInfo struct {
 	Dnn        string            `yaml:"dnn"`
 }
 
+type UeIpPoolInfo struct {
+	Dnn string `yaml:"dnn"`
+	// Sst and Sd limit the pools to a slice, all slices if Sst is 0
+	Sst int32  `yaml:"sst,omitempty"`
+	Sd  string `yaml:"sd,omitempty"`
+	// Selection is "upf", "enterprise" or "tai"
+	Selection string     `yaml:"selection"`
+	Pools     []UeIpPool `yaml:"pools"`
+}
+
+type UeIpPool struct {
+	Name string `yaml:"name"`
+	Cidr string `yaml:"cidr"`
+	// Keys select the pool: UPF names, enterprise names or TAIs as mcc-mnc-tac.
+	// A pool without keys is used when no other pool matches.
+	Keys []string `yaml:"keys,omitempty"`
+	// Secondary is the pool of the DNN used when this pool is exhausted
+	Secondary string `yaml:"secondary,omitempty"`
+	// Strategy overrides the allocation strategy and ExcludedRanges add to the
+	// excluded ranges of UeIpAllocation
+	Strategy       string   `yaml:"strategy,omitempty"`
+	ExcludedRanges []string `yaml:"excludedRanges,omitempty"`
+}
+
+type StickyIpInfo struct {
+	Dnn string `yaml:"dnn"`
+	// HoldTime in seconds the address of a released PDU session is kept for
+	// the UE
+	HoldTime int `yaml:"holdTime"`
+}
+
+type LadnInfo struct {
+	Dnn string `yaml:"dnn"`
+	// Tais is the LADN service area as TAIs mcc-mnc-tac
+	Tais []string `yaml:"tais"`
+	// ReleaseTimer in seconds the PDU session is kept with its UP connection
+	// deactivated once the UE leaves the service area, 0 keeps it until the
+	// UE is back in the area
+	ReleaseTimer int `yaml:"releaseTimer,omitempty"`
+}
+
+type DnaiInfo struct {
+	Dnai string `yaml:"dnai"`
+	// Tais as mcc-mnc-tac and NrCellIds as hex NR cell identities located in
+	// the DNAI, a cell takes precedence over a TAI
+	Tais      []string `yaml:"tais,omitempty"`
+	NrCellIds []string `yaml:"nrCellIds,omitempty"`
+	// Upfs are the hostnames of the UPFs serving the DNAI, which are then
+	// selected for the UEs located in their DNAIs only
+	Upfs []string `yaml:"upfs,omitempty"`
+}
+
+type UpfSelection struct {
+	// Strategy is "round-robin" (default), "least-sessions" or "load"
+	Strategy string `yaml:"strategy,omitempty"`
+	// Weights of the UPFs by hostname, 1 if not set
+	Weights map[string]int `yaml:"weights,omitempty"`
+}
+
+type UpfFailureInfo struct {
+	Dnn string `yaml:"dnn"`
+	// Policy is "release" (default) to release the PDU sessions, or
+	// "reanchor" to move them to another UPF of the DNN keeping the UE
+	// address, else they are released
+	Policy string `yaml:"policy,omitempty"`
+}
+
+type SscModeInfo struct {
+	Dnn string `yaml:"dnn"`
+	// AddressLifetime in seconds the UE keeps the PDU session of the previous
+	// PSA once asked to establish a PDU session on the new PSA
+	AddressLifetime int `yaml:"addressLifetime,omitempty"`
+}
+
+type NonThreeGppAnInfo struct {
+	// Name of the N3IWF or TNGF among the gNB names of the UPFs
+	Name string `yaml:"name"`
+	// Type is "n3iwf" (default) for untrusted or "tngf" for trusted
+	// non-3GPP access
+	Type string `yaml:"type,omitempty"`
+	// N3iwfId as hex digits selects the AN for the UEs located behind the
+	// N3IWF
+	N3iwfId string `yaml:"n3iwfId,omitempty"`
+}
+
+type RedundantTransmissionInfo struct {
+	Dnn string `yaml:"dnn"`
+	// FiveQis of the QoS flows transmitted over two N3 tunnels, all the QoS
+	// flows of the DNN if empty
+	FiveQis []int32 `yaml:"fiveQis,omitempty"`
+}
+
+type UeIpAllocation struct {
+	// Strategy is "sequential" (default), "random" or "sticky" to allocate
+	// again the last address of the UE when free
+	Strategy string `yaml:"strategy,omitempty"`
+	// ExcludedRanges are never allocated, as CIDRs, addresses or first-last
+	// address ranges, e.g. the gateway addresses
+	ExcludedRanges []string `yaml:"excludedRanges,omitempty"`
+}
+
 type Sbi struct {
 	Scheme       string `yaml:"scheme"`
 	TLS          *TLS   `yaml:"tls"`
@@ -167,6 +301,7 @@ type UPNode struct {
 	SNssaiInfos          []models.SnssaiUpfInfoItem `yaml:"sNssaiUpfInfos,omitempty"`
 	InterfaceUpfInfoList []InterfaceUpfInfoItem     `yaml:"interfaces,omitempty"`
 	Port                 uint16                     `yaml:"port"`
+	Weight               int                        `yaml:"weight,omitempty"`
 }
 
 type InterfaceUpfInfoItem struct {
@@ -180,6 +315,45 @@ type UPLink struct {
 	B string `yaml:"B"`
 }
 
+// CongestionControl back-off timer values are in seconds
+type CongestionControl struct {
+	// DnnBackoffTimer is the T3396 value sent on DNN based congestion
+	DnnBackoffTimer int `yaml:"dnnBackoffTimer,omitempty"`
+	// SnssaiBackoffTimer is the T3584/T3585 value sent on S-NSSAI based congestion
+	SnssaiBackoffTimer int `yaml:"snssaiBackoffTimer,omitempty"`
+}
+
+type DnAaaInfo struct {
+	Dnn string `yaml:"dnn"`
+	// AuthMethod is "pap", "chap" or "eap"
+	AuthMethod string `yaml:"authMethod"`
+	// AuthServer and AcctServer are the host:port of the RADIUS servers,
+	// accounting is disabled without AcctServer
+	AuthServer    string `yaml:"authServer"`
+	AcctServer    string `yaml:"acctServer,omitempty"`
+	Secret        string `yaml:"secret"`
+	NasIdentifier string `yaml:"nasIdentifier,omitempty"`
+	// Timeout in seconds of a request, retransmitted Retries times
+	Timeout int `yaml:"timeout,omitempty"`
+	Retries int `yaml:"retries,omitempty"`
+}
+
+type DhcpInfo struct {
+	Dnn string `yaml:"dnn"`
+	// Mode is "dhcpv4" or "dhcpv6"
+	Mode string `yaml:"mode"`
+	// Server is the host:port of the DHCP server and RelayAddr the local
+	// ip:port of the SMF relay agent the server replies to
+	Server    string `yaml:"server"`
+	RelayAddr string `yaml:"relayAddr"`
+	// OnUeRequest limits the DHCPv4 allocation to the UEs requesting it in the
+	// PCO, the other UEs get an address of the DNN pool
+	OnUeRequest bool `yaml:"onUeRequest,omitempty"`
+	// Timeout in seconds of a request, retransmitted Retries times
+	Timeout int `yaml:"timeout,omitempty"`
+	Retries int `yaml:"retries,omitempty"`
+}
+
 type PCSCFInfo struct {
 	IPv4Addr string `yaml:"ipv4,omitempty"`
 	IPv6Addr string `yaml:"ipv6,omitempty"`
@@ -58,3 +58,23 @@ func TestWebuiUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateRQTimer(t *testing.T) {
+	tests := map[int]bool{
+		0:     true,
+		2:     true,
+		62:    true,
+		64:    false,
+		90:    false,
+		1860:  true,
+		2160:  true,
+		11160: true,
+		11520: false,
+		-60:   false,
+	}
+	for seconds, valid := range tests {
+		if err := validateRQTimer(seconds); (err == nil) != valid {
+			t.Errorf("rqTimer %d: expected valid %v, got %v", seconds, valid, err)
+		}
+	}
+}
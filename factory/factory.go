@@ -46,6 +46,10 @@ func InitConfigFactory(f string) error {
 		SmfConfig.Configuration.KafkaInfo.EnableKafka = &enableKafka
 	}
 
+	if err = validateRQTimer(SmfConfig.Configuration.RQTimer); err != nil {
+		return err
+	}
+
 	if SmfConfig.Configuration.WebuiUri == "" {
 		SmfConfig.Configuration.WebuiUri = "http://webui:5001"
 		logger.CfgLog.Infof("webuiUri not set in configuration file. Using %v", SmfConfig.Configuration.WebuiUri)
@@ -69,6 +73,21 @@ func validateWebuiUri(uri string) error {
 	return nil
 }
 
+// validateRQTimer checks that the RQ timer is sent to the UE as configured, a
+// GPRS timer 2 counting up to 31 units of 2 seconds, 1 minute or 6 minutes,
+// TS 24.008 10.5.7.4. Zero selects the default RQ timer.
+func validateRQTimer(seconds int) error {
+	switch {
+	case seconds == 0:
+		return nil
+	case seconds > 0 && seconds <= 31*2 && seconds%2 == 0,
+		seconds > 0 && seconds <= 31*60 && seconds%60 == 0,
+		seconds > 0 && seconds <= 31*360 && seconds%360 == 0:
+		return nil
+	}
+	return fmt.Errorf("rqTimer %d s is not a multiple of 2 s up to 62 s, of 1 min up to 31 min or of 6 min up to 186 min", seconds)
+}
+
 func InitRoutingConfigFactory(f string) error {
 	if content, err := os.ReadFile(f); err != nil {
 		return err
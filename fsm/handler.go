@@ -30,6 +30,7 @@ const (
 	SmEventPduSessN1N2Transfer
 	SmEventPduSessN1N2TransferFailureIndication
 	SmEventPolicyUpdateNotify
+	SmEventPduSessAuthentication
 	SmEventMax
 )
 
@@ -64,6 +65,10 @@ func InitFsm() {
 	SmfFsmHandler[smf_context.SmStateActive][SmEventPduSessRelease] = HandleStateActiveEventPduSessRelease
 	SmfFsmHandler[smf_context.SmStateActive][SmEventPduSessN1N2TransferFailureIndication] = HandleStateActiveEventPduSessN1N2TransFailInd
 	SmfFsmHandler[smf_context.SmStateActive][SmEventPolicyUpdateNotify] = HandleStateActiveEventPolicyUpdateNotify
+	SmfFsmHandler[smf_context.SmStateSecondaryAuthPending][SmEventPduSessAuthentication] = HandleStateSecondaryAuthPendingEventPduSessAuthentication
+	SmfFsmHandler[smf_context.SmStateSecondaryAuthPending][SmEventPduSessModify] = HandleStateSecondaryAuthPendingEventPduSessModify
+	SmfFsmHandler[smf_context.SmStateSecondaryAuthPending][SmEventPduSessRelease] = HandleStateSecondaryAuthPendingEventPduSessRelease
+	SmfFsmHandler[smf_context.SmStateSecondaryAuthPending][SmEventPduSessN1N2TransferFailureIndication] = HandleStateSecondaryAuthPendingEventPduSessN1N2TransFailInd
 }
 
 func HandleEvent(smContext *smf_context.SMContext, event SmEvent, eventData SmEventData) error {
@@ -108,9 +113,60 @@ func HandleStateInitEventPduSessCreate(event SmEvent, eventData *SmEventData) (s
 	if err != nil {
 		logger.FsmLog.Errorf("error while publishing pdu session create response success, %v", err.Error())
 	}
+	txn := eventData.Txn.(*transaction.Transaction)
+	if txn.Ctxt.(*smf_context.SMContext).IsSecondaryAuthPending() {
+		return smf_context.SmStateSecondaryAuthPending, nil
+	}
+	return smf_context.SmStatePfcpCreatePending, nil
+}
+
+func HandleStateSecondaryAuthPendingEventPduSessAuthentication(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.SendPduSessAuthenticationCommand(smCtxt); err != nil {
+		smCtxt.SubFsmLog.Errorf("PDU session authentication command failure error, %v ", err.Error())
+		return smf_context.SmStateInit, fmt.Errorf("PDU session authentication command failure error, %v ", err.Error())
+	}
+	return smf_context.SmStateSecondaryAuthPending, nil
+}
+
+func HandleStateSecondaryAuthPendingEventPduSessModify(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.HandlePDUSessionAuthenticationComplete(eventData.Txn); err != nil {
+		smCtxt.SubFsmLog.Errorf("PDU session authentication complete error, %v ", err.Error())
+		return smf_context.SmStateInit, err
+	}
+	if smCtxt.IsSecondaryAuthPending() {
+		return smf_context.SmStateSecondaryAuthPending, nil
+	}
 	return smf_context.SmStatePfcpCreatePending, nil
 }
 
+func HandleStateSecondaryAuthPendingEventPduSessRelease(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.HandleSecondaryAuthRelease(eventData.Txn); err != nil {
+		smCtxt.SubFsmLog.Errorf("sm context release error, %v ", err.Error())
+		return smf_context.SmStateInit, err
+	}
+	return smf_context.SmStateInit, nil
+}
+
+func HandleStateSecondaryAuthPendingEventPduSessN1N2TransFailInd(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
+	txn := eventData.Txn.(*transaction.Transaction)
+	smCtxt := txn.Ctxt.(*smf_context.SMContext)
+
+	if err := producer.HandleSecondaryAuthN1N2TransFailInd(eventData.Txn); err != nil {
+		smCtxt.SubFsmLog.Errorf("error while processing HandleSecondaryAuthN1N2TransFailInd, %v ", err.Error())
+		return smf_context.SmStateInit, err
+	}
+	return smf_context.SmStateInit, nil
+}
+
 func HandleStatePfcpCreatePendingEventPfcpSessCreate(event SmEvent, eventData *SmEventData) (smf_context.SMContextState, error) {
 	txn := eventData.Txn.(*transaction.Transaction)
 	smCtxt := txn.Ctxt.(*smf_context.SMContext)
@@ -65,6 +65,8 @@ func (SmfTxnFsm) TxnLoadCtxt(txn *transaction.Transaction) (transaction.TxnEvent
 		// Pre-loaded- No action
 	case svcmsgtypes.PfcpSessCreateFailure:
 		// Pre-loaded- No action
+	case svcmsgtypes.PduSessAuthentication:
+		// Pre-loaded- No action
 	case svcmsgtypes.N1N2MessageTransferFailureNotification:
 		txn.Ctxt = smf_context.GetSMContext(txn.CtxtKey)
 	default:
@@ -156,6 +158,8 @@ func (SmfTxnFsm) TxnProcess(txn *transaction.Transaction) (transaction.TxnEvent,
 		event = SmEventPduSessN1N2TransferFailureIndication
 	case svcmsgtypes.SmPolicyUpdateNotification:
 		event = SmEventPolicyUpdateNotify
+	case svcmsgtypes.PduSessAuthentication:
+		event = SmEventPduSessAuthentication
 	default:
 		event = SmEventInvalid
 	}
@@ -185,6 +189,19 @@ func (SmfTxnFsm) TxnSuccess(txn *transaction.Transaction) (transaction.TxnEvent,
 			// nextTxn.StartTxnLifeCycle(SmfTxnFsmHandle)
 			<-nextTxn.Status
 		}(nextTxn)
+	case svcmsgtypes.UpdateSmContext:
+		// UE authorized by the DN-AAA server, resume the PDU session establishment
+		smContext := txn.Ctxt.(*smf_context.SMContext)
+		if smContext.SMContextState == smf_context.SmStatePfcpCreatePending {
+			nextTxn := transaction.NewTransaction(nil, nil, svcmsgtypes.PfcpSessCreate)
+			nextTxn.Ctxt = txn.Ctxt
+			smContext.SMTxnBusLock.Lock()
+			smContext.TxnBus = smContext.TxnBus.AddTxn(nextTxn)
+			smContext.SMTxnBusLock.Unlock()
+			go func(nextTxn *transaction.Transaction) {
+				<-nextTxn.Status
+			}(nextTxn)
+		}
 	}
 
 	// put Success Rsp
@@ -24,6 +24,8 @@ func (e SmEvent) String() string {
 		return "SmEventPfcpSessCreateFailure"
 	case SmEventPduSessN1N2TransferFailureIndication:
 		return "SmEventPduSessN1N2TransferFailureIndication"
+	case SmEventPduSessAuthentication:
+		return "SmEventPduSessAuthentication"
 	default:
 		return "invalid SM event"
 	}
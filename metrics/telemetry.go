@@ -26,6 +26,7 @@ type SmfStats struct {
 	svcUdmMsg   *prometheus.CounterVec
 	sessions    *prometheus.GaugeVec
 	sessProfile *prometheus.GaugeVec
+	ueIpPool    *prometheus.GaugeVec
 }
 
 var smfStats *SmfStats
@@ -66,6 +67,11 @@ func initSmfStats() *SmfStats {
 			Name: "smf_pdu_session_profile",
 			Help: "SMF PDU session Profile",
 		}, []string{"id", "ip", "state", "upf", "enterprise"}),
+
+		ueIpPool: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "smf_ue_ip_pool_addresses",
+			Help: "Number of UE addresses of the SMF address pools",
+		}, []string{"dnn", "pool", "state"}),
 	}
 }
 
@@ -91,6 +97,9 @@ func (ps *SmfStats) register() error {
 	if err := prometheus.Register(ps.sessProfile); err != nil {
 		return err
 	}
+	if err := prometheus.Register(ps.ueIpPool); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -145,3 +154,9 @@ func SetSessStats(nodeId string, count uint64) {
 func SetSessProfileStats(id, ip, state, upf, enterprise string, count uint64) {
 	smfStats.sessProfile.WithLabelValues(id, ip, state, upf, enterprise).Set(float64(count))
 }
+
+// SetUeIpPoolStats maintains the allocated and free addresses of a UE address pool
+func SetUeIpPoolStats(dnn, pool string, size, allocated int64) {
+	smfStats.ueIpPool.WithLabelValues(dnn, pool, "allocated").Set(float64(allocated))
+	smfStats.ueIpPool.WithLabelValues(dnn, pool, "free").Set(float64(size - allocated))
+}
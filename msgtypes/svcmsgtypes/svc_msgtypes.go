@@ -41,6 +41,7 @@ const (
 	N1N2MessageTransfer                    SmfMsgType = "N1N2MessageTransfer"
 	PfcpSessCreateFailure                  SmfMsgType = "PfcpSessCreateFailure"
 	N1N2MessageTransferFailureNotification SmfMsgType = "N1N2MessageTransferFailureNotification"
+	PduSessAuthentication                  SmfMsgType = "PduSessAuthentication"
 
 	// PFCP
 	PfcpSessCreate  SmfMsgType = "PfcpSessCreate"
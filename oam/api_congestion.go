@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package oam
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omec-project/openapi/v2"
+	"github.com/omec-project/openapi/v2/utils"
+	"github.com/omec-project/smf/context"
+	"github.com/omec-project/smf/logger"
+	"github.com/omec-project/smf/producer"
+)
+
+// Get /congestion
+func GetCongestion(c *gin.Context) {
+	HTTPResponse := producer.HandleOAMGetCongestion()
+
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+}
+
+// Put /congestion
+func PutCongestion(c *gin.Context) {
+	congestion, ok := decodeCongestion(c)
+	if !ok {
+		return
+	}
+	HTTPResponse := producer.HandleOAMSetCongestion(congestion)
+
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+}
+
+// Delete /congestion
+func DeleteCongestion(c *gin.Context) {
+	congestion, ok := decodeCongestion(c)
+	if !ok {
+		return
+	}
+	HTTPResponse := producer.HandleOAMClearCongestion(congestion)
+
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+}
+
+func decodeCongestion(c *gin.Context) (context.Congestion, bool) {
+	var congestion context.Congestion
+
+	requestBody, err := c.GetRawData()
+	if err != nil {
+		logger.AppLog.Errorf("get Request Body error: %+v", err)
+		problemDetail := utils.ProblemDetailsSystemFailure(err.Error())
+		c.JSON(http.StatusInternalServerError, problemDetail)
+		return congestion, false
+	}
+
+	err = openapi.Decode(&congestion, requestBody, "application/json")
+	if err != nil {
+		problemDetail := "[Request Body] " + err.Error()
+		rsp := utils.ProblemDetailsMalformedRequestSyntax(problemDetail)
+		logger.AppLog.Errorln(problemDetail)
+		c.JSON(http.StatusBadRequest, rsp)
+		return congestion, false
+	}
+	return congestion, true
+}
@@ -0,0 +1,16 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package oam
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/omec-project/smf/producer"
+)
+
+// Put /psa-relocation/:smContextRef
+func PutPsaRelocation(c *gin.Context) {
+	HTTPResponse := producer.HandleOAMRelocatePsa(c.Params.ByName("smContextRef"))
+
+	c.JSON(HTTPResponse.Status, HTTPResponse.Body)
+}
@@ -47,6 +47,10 @@ func AddService(engine *gin.Engine) *gin.RouterGroup {
 		switch route.Method {
 		case http.MethodGet:
 			group.GET(route.Pattern, route.HandlerFunc)
+		case http.MethodPut:
+			group.PUT(route.Pattern, route.HandlerFunc)
+		case http.MethodDelete:
+			group.DELETE(route.Pattern, route.HandlerFunc)
 		case http.MethodOptions:
 			group.OPTIONS(route.Pattern, route.HandlerFunc)
 		}
@@ -73,5 +77,29 @@ func getRoutes() []Route {
 			"/ue-pdu-session-info/:smContextRef",
 			GetUePduSessionInfo,
 		},
+		{
+			"Relocate PSA",
+			"PUT",
+			"/psa-relocation/:smContextRef",
+			PutPsaRelocation,
+		},
+		{
+			"Get Congestion",
+			"GET",
+			"/congestion",
+			GetCongestion,
+		},
+		{
+			"Set Congestion",
+			"PUT",
+			"/congestion",
+			PutCongestion,
+		},
+		{
+			"Clear Congestion",
+			"DELETE",
+			"/congestion",
+			DeleteCongestion,
+		},
 	}
 }
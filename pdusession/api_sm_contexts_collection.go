@@ -126,7 +126,12 @@ func HTTPPostSmContexts(c *gin.Context) {
 			return
 		}
 		if HTTPResponse.Status == http.StatusCreated {
-			txn = transaction.NewTransaction(nil, nil, svcmsgtypes.PfcpSessCreate)
+			msgType := svcmsgtypes.PfcpSessCreate
+			if smContext.SMContextState == smf_context.SmStateSecondaryAuthPending {
+				// the PDU session is established once the UE is authenticated by the DN-AAA server
+				msgType = svcmsgtypes.PduSessAuthentication
+			}
+			txn = transaction.NewTransaction(nil, nil, msgType)
 			txn.Ctxt = smContext
 			go txn.StartTxnLifeCycle(fsm.SmfTxnFsmHandle)
 			<-txn.Status
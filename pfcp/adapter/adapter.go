@@ -10,6 +10,7 @@ import (
 
 	"github.com/omec-project/smf/context"
 	"github.com/omec-project/smf/logger"
+	"github.com/omec-project/smf/pfcp/ies"
 	"github.com/omec-project/smf/pfcp/udp"
 	"github.com/wmnsk/go-pfcp/ie"
 	"github.com/wmnsk/go-pfcp/message"
@@ -173,6 +174,11 @@ func HandlePfcpHeartbeatResponse(msg *udp.Message) {
 		return
 	}
 
+	lci, oci := ies.FindLoadAndOverloadControl(rsp.IEs)
+	upf.UpfLock.Lock()
+	ies.UpdateLoadAndOverloadControl(upf, lci, oci)
+	upf.UpfLock.Unlock()
+
 	if rsp.RecoveryTimeStamp == nil {
 		logger.PfcpLog.Errorln("pfcp heartbeat response has no RecoveryTimeStamp")
 		return
@@ -231,6 +237,7 @@ func HandlePfcpSessionEstablishmentResponse(msg *udp.Message) {
 		logger.PfcpLog.Errorf("no pending pfcp session establishment response for sequence no: %v", seq)
 		return
 	}
+	ies.UpdateUpfLoadAndOverloadControl(*nodeID, rsp.LoadControlInformation, rsp.OverloadControlInformation)
 
 	if rsp.UPFSEID != nil {
 		NodeIDtoIP := nodeID.ResolveNodeIdToIp().String()
@@ -365,6 +372,7 @@ func HandlePfcpSessionModificationResponse(msg *udp.Message) {
 		logger.PfcpLog.Warnf("PFCP Session Modification Response found SM context nil for SEID %d, response discarded", SEID)
 		return
 	}
+	ies.UpdateUpfLoadAndOverloadControl(smContext.GetNodeIDByLocalSEID(SEID), pfcpRsp.LoadControlInformation, pfcpRsp.OverloadControlInformation)
 
 	if causeValue == ie.CauseRequestAccepted {
 		smContext.SubPduSessLog.Infoln("PFCP Modification Response Accept")
@@ -416,6 +424,7 @@ func HandlePfcpSessionDeletionResponse(msg *udp.Message) {
 		logger.PfcpLog.Warnln("PFCP Session Deletion Response found SM context nil, response discarded")
 		return
 	}
+	ies.UpdateUpfLoadAndOverloadControl(smContext.GetNodeIDByLocalSEID(SEID), pfcpRsp.LoadControlInformation, pfcpRsp.OverloadControlInformation)
 
 	cause := pfcpRsp.Cause
 	if cause == nil {
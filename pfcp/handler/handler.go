@@ -48,6 +48,83 @@ func FindFTEID(createdPDRIEs []*ie.IE) (*ie.FTEIDFields, error) {
 	return nil, fmt.Errorf("FTEID not found in CreatedPDR")
 }
 
+// storeCreatedFTEIDs stores the F-TEIDs allocated by the UPF in the tunnels
+// of the PDRs of the data path and returns the uplink F-TEID, nil if none
+// of the created PDRs is an uplink PDR of the data path
+func storeCreatedFTEIDs(dataPath *smf_context.DataPath, nodeID smf_context.NodeID, createdPDRIEs []*ie.IE) *ie.FTEIDFields {
+	var uplink *ie.FTEIDFields
+	for _, createdPDRIE := range createdPDRIEs {
+		pdrID, err := createdPDRIE.PDRID()
+		if err != nil {
+			continue
+		}
+		fteid, err := createdPDRIE.FTEID()
+		if err != nil {
+			continue
+		}
+		node, tunnel := dataPath.TunnelOfPDR(nodeID, pdrID)
+		if tunnel == nil {
+			continue
+		}
+		tunnel.TEID = fteid.TEID
+		if tunnel == node.UpLinkTunnel {
+			uplink = fteid
+		}
+	}
+	return uplink
+}
+
+// storeRedundantFTEID stores the second F-TEID, for the redundant
+// transmission on N3, of the created PDRs
+func storeRedundantFTEID(smContext *smf_context.SMContext, nodeID smf_context.NodeID, createdPDRIEs []*ie.IE) {
+	for _, createdPDRIE := range createdPDRIEs {
+		pdrID, err := createdPDRIE.PDRID()
+		if err != nil {
+			continue
+		}
+		ies, err := createdPDRIE.CreatedPDR()
+		if err != nil {
+			continue
+		}
+		var fteids []*ie.FTEIDFields
+		for _, child := range ies {
+			if child.Type != ie.FTEID {
+				continue
+			}
+			if fteid, err := child.FTEID(); err == nil {
+				fteids = append(fteids, fteid)
+			}
+		}
+		if len(fteids) < 2 {
+			continue
+		}
+		if smContext.StoreRedundantFTEID(nodeID, pdrID, fteids[1].TEID, fteids[1].IPv4Address) {
+			smContext.SubPfcpLog.Infof("redundant transmission F-TEID: %+v", fteids[1])
+		}
+	}
+}
+
+// storeForwardingFTEID stores the F-TEID allocated by the UPF to the indirect
+// forwarding tunnel of an N2 handover, or to the second access of an MA PDU
+// session
+func storeForwardingFTEID(smContext *smf_context.SMContext, nodeID smf_context.NodeID, createdPDRIEs []*ie.IE) {
+	for _, createdPDRIE := range createdPDRIEs {
+		pdrID, err := createdPDRIE.PDRID()
+		if err != nil {
+			continue
+		}
+		fteid, err := createdPDRIE.FTEID()
+		if err != nil {
+			continue
+		}
+		if smContext.StoreForwardingFTEID(nodeID, pdrID, fteid.TEID, fteid.IPv4Address) {
+			smContext.SubPfcpLog.Infof("indirect forwarding tunnel F-TEID: %+v", fteid)
+		} else if smContext.StoreAccessLegFTEID(nodeID, pdrID, fteid.TEID, fteid.IPv4Address) {
+			smContext.SubPfcpLog.Infof("MA PDU session access leg F-TEID: %+v", fteid)
+		}
+	}
+}
+
 func HandlePfcpHeartbeatRequest(msg *udp.Message) {
 	_, ok := msg.PfcpMessage.(*message.HeartbeatRequest)
 	if !ok {
@@ -125,6 +202,9 @@ func HandlePfcpHeartbeatResponse(msg *udp.Message) {
 		}
 	}
 
+	lci, oci := ies.FindLoadAndOverloadControl(rsp.IEs)
+	ies.UpdateLoadAndOverloadControl(upf, lci, oci)
+
 	upf.NHeartBeat = 0 // reset Heartbeat attempt to 0
 }
 
@@ -193,6 +273,7 @@ func HandlePfcpAssociationSetupRequest(msg *udp.Message) {
 		RecoveryTimeStamp: recoveryTimestamp,
 	}
 	upf.NHeartBeat = 0 // reset Heartbeat attempt to 0
+	upf.ResetLoadControl()
 
 	// Response with PFCP Association Setup Response
 	err = pfcp_message.SendPfcpAssociationSetupResponse(*nodeID, ie.CauseRequestAccepted, upf.Port)
@@ -251,6 +332,7 @@ func HandlePfcpAssociationSetupResponse(msg *udp.Message) {
 		defer upf.UpfLock.Unlock()
 
 		upf.UPFStatus = smf_context.AssociatedSetUpSuccess
+		upf.ResetLoadControl()
 		logger.PfcpLog.Infof("upf status updated to %v for NodeID[%s]", upf.UPFStatus, nodeIDStr)
 
 		recoveryTimestamp, err := rsp.RecoveryTimeStamp.RecoveryTimeStamp()
@@ -425,6 +507,7 @@ func HandlePfcpSessionEstablishmentResponse(msg *udp.Message) {
 		logger.PfcpLog.Errorf("no pending pfcp response for sequence no: %v", seq)
 		return
 	}
+	ies.UpdateUpfLoadAndOverloadControl(*nodeID, rsp.LoadControlInformation, rsp.OverloadControlInformation)
 
 	if rsp.UPFSEID != nil {
 		// NodeIDtoIP := rsp.NodeID.ResolveNodeIdToIp().String()
@@ -463,13 +546,17 @@ func HandlePfcpSessionEstablishmentResponse(msg *udp.Message) {
 		}
 
 		// Store F-TEID created by UPF
-		fteid, err := FindFTEID(rsp.CreatedPDR)
-		if err != nil {
-			logger.PfcpLog.Errorf("failed to parse TEID IE: %+v", err)
-			return
+		fteid := storeCreatedFTEIDs(defaultPath, *nodeID, rsp.CreatedPDR)
+		storeRedundantFTEID(smContext, *nodeID, rsp.CreatedPDR)
+		if fteid == nil {
+			var err error
+			if fteid, err = FindFTEID(rsp.CreatedPDR); err != nil {
+				logger.PfcpLog.Errorf("failed to parse TEID IE: %+v", err)
+				return
+			}
+			ANUPF.UpLinkTunnel.TEID = fteid.TEID
 		}
 		logger.PfcpLog.Infof("created PDR FTEID: %+v", fteid)
-		ANUPF.UpLinkTunnel.TEID = fteid.TEID
 		upf := smf_context.RetrieveUPFNodeByNodeID(*nodeID)
 		if upf == nil {
 			logger.PfcpLog.Errorf("can't find UPF[%s]", nodeID.ResolveNodeIdToIp().String())
@@ -551,8 +638,13 @@ func HandlePfcpSessionModificationResponse(msg *udp.Message) {
 		}
 	}
 	smContext := smf_context.GetSMContextBySEID(SEID)
+	if smContext == nil {
+		logger.PfcpLog.Warnln("PFCP Session Modification Response found SM context nil, response discarded")
+		return
+	}
 
 	logger.PfcpLog.Infoln("in HandlePfcpSessionModificationResponse")
+	ies.UpdateUpfLoadAndOverloadControl(smContext.GetNodeIDByLocalSEID(SEID), rsp.LoadControlInformation, rsp.OverloadControlInformation)
 
 	if smf_context.SMF_Self().ULCLSupport && smContext.BPManager != nil {
 		if smContext.BPManager.BPStatus == smf_context.AddingPSA {
@@ -576,6 +668,7 @@ func HandlePfcpSessionModificationResponse(msg *udp.Message) {
 
 	if causeValue == ie.CauseRequestAccepted {
 		smContext.SubPduSessLog.Infoln("PFCP Modification Response Accept")
+		storeForwardingFTEID(smContext, smContext.GetNodeIDByLocalSEID(SEID), rsp.CreatedPDR)
 		if smContext.SMContextState == smf_context.SmStatePfcpModify {
 			upfNodeID := smContext.GetNodeIDByLocalSEID(SEID)
 			upfIP := upfNodeID.ResolveNodeIdToIp().String()
@@ -634,6 +727,7 @@ func HandlePfcpSessionDeletionResponse(msg *udp.Message) {
 		return
 		// TODO fix: SEID should be the value sent by UPF but now the SEID value is from sm context
 	}
+	ies.UpdateUpfLoadAndOverloadControl(smContext.GetNodeIDByLocalSEID(SEID), rsp.LoadControlInformation, rsp.OverloadControlInformation)
 
 	if rsp.Cause == nil {
 		logger.PfcpLog.Errorln("PFCP Session Deletion Response missing Cause")
@@ -785,6 +879,34 @@ func HandlePfcpSessionReportRequest(msg *udp.Message) {
 		}
 	}
 
+	// TS 29.244 7.5.8.3 usage reports of the URRs whose thresholds were reached
+	if req.ReportType.HasUSAR() {
+		reports := make([]*smf_context.UsageReport, 0, len(req.UsageReport))
+		for _, usageReport := range req.UsageReport {
+			report, err := ies.UnmarshallUsageReport(usageReport)
+			if err != nil {
+				smContext.SubPfcpLog.Warnf("invalid usage report: %v", err)
+				continue
+			}
+			smContext.SubPfcpLog.Infof("usage report URR [%d], trigger %+v, volume %+v, duration [%d]s",
+				report.URRID, report.UsageReportTrigger, report.VolumeMeasurement, report.DurationMeasurement)
+			reports = append(reports, report)
+		}
+
+		// the usage is reported to the PCF once the SM context is unlocked and Active
+		if len(reports) > 0 {
+			go producer.HandleUsageReport(smContext, reports)
+		}
+
+		// downlink data reports of idle sessions were already answered
+		if !req.ReportType.HasDLDR() || smContext.UpCnxState != models.UPCNXSTATE_DEACTIVATED {
+			err := pfcp_message.SendPfcpSessionReportResponse(msg.RemoteAddr, ie.CauseRequestAccepted, pfcpSRflag, seqFromUPF, SEID)
+			if err != nil {
+				logger.PfcpLog.Errorf("failed to send PFCP Session Report Response: %+v", err)
+			}
+		}
+	}
+
 	// TS 23.502 4.2.3.3 2b. Send Data Notification Ack, SMF->UPF
 	//	cause.CauseValue = ie.CauseRequestAccepted
 	// TODO fix: SEID should be the value sent by UPF but now the SEID value is from sm context
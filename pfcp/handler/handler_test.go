@@ -284,3 +284,105 @@ func TestHandlePfcpSessionEstablishmentResponseNilTunnel(t *testing.T) {
 		t.Errorf("expected pending PFCP txn for seq %d to be consumed on the nil-Tunnel ignore path, but it was still present", seq)
 	}
 }
+
+// TestHandlePfcpSessionEstablishmentResponseIUpf checks the F-TEIDs of the
+// uplink and downlink PDRs of an I-UPF are stored in their tunnels
+func TestHandlePfcpSessionEstablishmentResponseIUpf(t *testing.T) {
+	if factory.SmfConfig.Configuration == nil {
+		factory.SmfConfig = factory.Config{
+			Configuration: &factory.Configuration{
+				KafkaInfo: factory.KafkaInfo{EnableKafka: boolPointer(false)},
+			},
+		}
+	}
+
+	nodeID := context.NewNodeID("3.3.3.3")
+	smContext := context.NewSMContext("imsi-123456789012398", 30)
+	iupf := context.NewDataPathNode()
+	iupf.UPF = &context.UPF{NodeID: *nodeID}
+	iupf.UpLinkTunnel.PDR["default"] = &context.PDR{PDRID: 1}
+	iupf.DownLinkTunnel.PDR["default"] = &context.PDR{PDRID: 2}
+	psa := context.NewDataPathNode()
+	psa.UPF = &context.UPF{NodeID: *context.NewNodeID("3.3.3.4")}
+	psa.UpLinkTunnel.PDR["default"] = &context.PDR{PDRID: 1}
+	iupf.AddNext(psa)
+	psa.AddPrev(iupf)
+	dataPath := &context.DataPath{IsDefaultPath: true, FirstDPNode: iupf}
+	smContext.Tunnel = context.NewUPTunnel()
+	smContext.Tunnel.AddDataPath(dataPath)
+	smContext.AllocateLocalSEIDForDataPath(dataPath)
+
+	const seq uint32 = 0x434343
+	pfcp_message.InsertPfcpTxn(seq, nodeID)
+	rsp := message.NewSessionEstablishmentResponse(
+		0,
+		0,
+		smContext.PFCPContext["3.3.3.3"].LocalSEID,
+		seq,
+		0,
+		ie.NewCause(ie.CauseRequestAccepted),
+		ie.NewNodeID("3.3.3.3", "", ""),
+		ie.NewCreatedPDR(ie.NewPDRID(2), ie.NewFTEID(0x01, 2222, net.ParseIP("10.0.9.1"), nil, 0)),
+		ie.NewCreatedPDR(ie.NewPDRID(1), ie.NewFTEID(0x01, 1111, net.ParseIP("10.0.9.1"), nil, 0)),
+	)
+	handler.HandlePfcpSessionEstablishmentResponse(&udp.Message{
+		RemoteAddr:  &net.UDPAddr{IP: net.ParseIP("3.3.3.3"), Port: 8805},
+		PfcpMessage: rsp,
+	})
+
+	if iupf.UpLinkTunnel.TEID != 1111 {
+		t.Errorf("expected uplink TEID 1111, got %d", iupf.UpLinkTunnel.TEID)
+	}
+	if iupf.DownLinkTunnel.TEID != 2222 {
+		t.Errorf("expected downlink TEID 2222, got %d", iupf.DownLinkTunnel.TEID)
+	}
+	if psa.UpLinkTunnel.TEID != 0 {
+		t.Errorf("expected the PSA tunnel untouched, got TEID %d", psa.UpLinkTunnel.TEID)
+	}
+}
+
+func TestHandlePfcpHeartbeatResponseLoadAndOverloadControl(t *testing.T) {
+	factory.SmfConfig = factory.Config{
+		Configuration: &factory.Configuration{
+			KafkaInfo: factory.KafkaInfo{EnableKafka: boolPointer(false)},
+		},
+	}
+	upNodeID := context.NewNodeID("2.2.2.2")
+	upf := context.NewUPF(upNodeID, nil)
+	t.Cleanup(func() { context.RemoveUPFNodeByNodeID(*upNodeID) })
+
+	heartbeat := func(seq uint32, ies ...*ie.IE) {
+		pfcp_message.InsertPfcpTxn(seq, upNodeID)
+		msg := message.NewHeartbeatResponse(seq, ie.NewRecoveryTimeStamp(time.Now()), ies...)
+		handler.HandlePfcpHeartbeatResponse(&udp.Message{
+			RemoteAddr:  &net.UDPAddr{IP: net.ParseIP("2.2.2.2"), Port: 8805},
+			PfcpMessage: msg,
+		})
+	}
+
+	heartbeat(10,
+		ie.NewLoadControlInformation(ie.NewSequenceNumber(3), ie.NewMetric(40)),
+		ie.NewOverloadControlInformation(ie.NewSequenceNumber(5), ie.NewMetric(50), ie.NewTimer(time.Minute)),
+	)
+	if upf.LoadMetric != 40 || upf.LoadSequenceNumber != 3 {
+		t.Errorf("expected load 40 with sequence number 3, got %d with %d", upf.LoadMetric, upf.LoadSequenceNumber)
+	}
+	if upf.OverloadReductionMetric != 50 || upf.OverloadSequenceNumber != 5 {
+		t.Errorf("expected reduction 50 with sequence number 5, got %d with %d", upf.OverloadReductionMetric, upf.OverloadSequenceNumber)
+	}
+	if !upf.OverloadValidUntil.After(time.Now().Add(50 * time.Second)) {
+		t.Errorf("expected the overload control valid for a minute, until %v", upf.OverloadValidUntil)
+	}
+
+	// outdated information is discarded, a stopped timer ends the overload
+	heartbeat(11,
+		ie.NewLoadControlInformation(ie.NewSequenceNumber(2), ie.NewMetric(90)),
+		ie.NewOverloadControlInformation(ie.NewSequenceNumber(6), ie.NewMetric(50), ie.NewTimer(0)),
+	)
+	if upf.LoadMetric != 40 {
+		t.Errorf("expected outdated load discarded, got %d", upf.LoadMetric)
+	}
+	if upf.OverloadReductionMetric != 0 || !upf.OverloadValidUntil.IsZero() {
+		t.Errorf("expected overload control stopped, got reduction %d", upf.OverloadReductionMetric)
+	}
+}
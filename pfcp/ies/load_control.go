@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package ies
+
+import (
+	"github.com/omec-project/smf/context"
+	"github.com/omec-project/smf/logger"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// FindLoadAndOverloadControl returns the Load and Overload Control
+// Information among the IEs of a message
+func FindLoadAndOverloadControl(ies []*ie.IE) (lci, oci *ie.IE) {
+	for _, i := range ies {
+		switch i.Type {
+		case ie.LoadControlInformation:
+			lci = i
+		case ie.OverloadControlInformation:
+			oci = i
+		}
+	}
+	return lci, oci
+}
+
+// UpdateLoadAndOverloadControl stores the Load and Overload Control
+// Information reported by the UPF, TS 29.244 6.2.2 and 6.2.3. The caller
+// holds the UpfLock.
+func UpdateLoadAndOverloadControl(upf *context.UPF, lci, oci *ie.IE) {
+	if lci != nil {
+		sequenceNumber, err := lci.SequenceNumber()
+		if err != nil {
+			logger.PfcpLog.Errorf("failed to parse Load Control Information sequence number: %+v", err)
+		} else if metric, err := lci.Metric(); err != nil {
+			logger.PfcpLog.Errorf("failed to parse Load Control Information metric: %+v", err)
+		} else if upf.UpdateLoadControl(sequenceNumber, metric) {
+			logger.PfcpLog.Debugf("UPF[%s] load %d%%", upf.NodeID.ResolveNodeIdToIp(), upf.LoadMetric)
+		}
+	}
+	if oci != nil {
+		sequenceNumber, err := oci.SequenceNumber()
+		if err != nil {
+			logger.PfcpLog.Errorf("failed to parse Overload Control Information sequence number: %+v", err)
+			return
+		}
+		metric, err := oci.Metric()
+		if err != nil {
+			logger.PfcpLog.Errorf("failed to parse Overload Control Information metric: %+v", err)
+			return
+		}
+		period, err := oci.Timer()
+		if err != nil {
+			logger.PfcpLog.Errorf("failed to parse Overload Control Information timer: %+v", err)
+			return
+		}
+		if upf.UpdateOverloadControl(sequenceNumber, metric, period) {
+			logger.PfcpLog.Infof("UPF[%s] overload reduction %d%% until %v", upf.NodeID.ResolveNodeIdToIp(),
+				upf.OverloadReductionMetric, upf.OverloadValidUntil)
+		}
+	}
+}
+
+// UpdateUpfLoadAndOverloadControl stores the Load and Overload Control
+// Information of a session response of the UPF
+func UpdateUpfLoadAndOverloadControl(nodeID context.NodeID, lci, oci *ie.IE) {
+	if lci == nil && oci == nil {
+		return
+	}
+	upf := context.RetrieveUPFNodeByNodeID(nodeID)
+	if upf == nil {
+		logger.PfcpLog.Errorf("can not find UPF[%s]", nodeID.ResolveNodeIdToIp().String())
+		return
+	}
+	upf.UpfLock.Lock()
+	defer upf.UpfLock.Unlock()
+	UpdateLoadAndOverloadControl(upf, lci, oci)
+}
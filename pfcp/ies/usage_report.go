@@ -0,0 +1,84 @@
+// Copyright 2024 Canonical Ltd.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// This file exists because go-pfcp does not look up the URR ID within a Usage Report,
+// nor decode the threshold bits of the Usage Report Trigger.
+
+package ies
+
+import (
+	"fmt"
+
+	"github.com/omec-project/smf/context"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+// UnmarshallUsageReport returns the usage reported by the UPF for a URR
+func UnmarshallUsageReport(usageReport *ie.IE) (*context.UsageReport, error) {
+	childIEs, err := usageReport.UsageReport()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &context.UsageReport{}
+	hasURRID := false
+	for _, childIE := range childIEs {
+		switch childIE.Type {
+		case ie.URRID:
+			if report.URRID, err = childIE.URRID(); err != nil {
+				return nil, err
+			}
+			hasURRID = true
+		case ie.UsageReportTrigger:
+			triggers, err := childIE.UsageReportTrigger()
+			if err != nil {
+				return nil, err
+			}
+			report.UsageReportTrigger = unmarshallUsageReportTrigger(triggers)
+		case ie.VolumeMeasurement:
+			vol, err := childIE.VolumeMeasurement()
+			if err != nil {
+				return nil, err
+			}
+			report.VolumeMeasurement = &context.VolumeMeasurement{}
+			if vol.HasTOVOL() {
+				report.VolumeMeasurement.TotalVolume = vol.TotalVolume
+			}
+			if vol.HasULVOL() {
+				report.VolumeMeasurement.UplinkVolume = vol.UplinkVolume
+			}
+			if vol.HasDLVOL() {
+				report.VolumeMeasurement.DownlinkVolume = vol.DownlinkVolume
+			}
+		case ie.DurationMeasurement:
+			duration, err := childIE.DurationMeasurement()
+			if err != nil {
+				return nil, err
+			}
+			report.DurationMeasurement = uint32(duration.Seconds())
+		}
+	}
+
+	if !hasURRID {
+		return nil, fmt.Errorf("URR ID missing in usage report")
+	}
+	return report, nil
+}
+
+// unmarshallUsageReportTrigger decodes the Usage Report Trigger, TS 29.244 8.2.41
+func unmarshallUsageReportTrigger(data []byte) context.UsageReportTrigger {
+	var triggers context.UsageReportTrigger
+	// Octet 5
+	if len(data) > 0 {
+		triggers.Perio = data[0]&0x01 != 0
+		triggers.Volth = data[0]&0x02 != 0
+		triggers.Timth = data[0]&0x04 != 0
+		triggers.Immer = data[0]&0x80 != 0
+	}
+	// Octet 6
+	if len(data) > 1 {
+		triggers.Termr = data[1]&0x08 != 0
+	}
+	return triggers
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Canonical Ltd.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ies_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/omec-project/smf/pfcp/ies"
+	"github.com/wmnsk/go-pfcp/ie"
+)
+
+func TestUnmarshallUsageReport(t *testing.T) {
+	usageReport := ie.NewUsageReportWithinSessionReportRequest(
+		ie.NewURRID(5),
+		ie.NewURSEQN(1),
+		ie.NewUsageReportTrigger(0x02, 0x00),
+		ie.NewVolumeMeasurement(0x07, 3000, 1000, 2000, 0, 0, 0),
+		ie.NewDurationMeasurement(90*time.Second),
+	)
+
+	report, err := ies.UnmarshallUsageReport(usageReport)
+	if err != nil {
+		t.Fatalf("error unmarshalling usage report: %v", err)
+	}
+
+	if report.URRID != 5 {
+		t.Errorf("expected URR ID 5, got %v", report.URRID)
+	}
+	if !report.UsageReportTrigger.Volth || report.UsageReportTrigger.Perio || report.UsageReportTrigger.Termr {
+		t.Errorf("expected volume threshold trigger only, got %+v", report.UsageReportTrigger)
+	}
+	if report.VolumeMeasurement == nil {
+		t.Fatalf("expected volume measurement")
+	}
+	if report.VolumeMeasurement.TotalVolume != 3000 || report.VolumeMeasurement.UplinkVolume != 1000 ||
+		report.VolumeMeasurement.DownlinkVolume != 2000 {
+		t.Errorf("unexpected volume measurement %+v", *report.VolumeMeasurement)
+	}
+	if report.DurationMeasurement != 90 {
+		t.Errorf("expected duration 90, got %v", report.DurationMeasurement)
+	}
+}
+
+func TestUnmarshallUsageReportWithoutURRID(t *testing.T) {
+	usageReport := ie.NewUsageReportWithinSessionReportRequest(
+		ie.NewUsageReportTrigger(0x00, 0x08),
+	)
+
+	if _, err := ies.UnmarshallUsageReport(usageReport); err == nil {
+		t.Errorf("expected error for usage report without URR ID")
+	}
+}
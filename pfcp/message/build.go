@@ -17,6 +17,12 @@ import (
 
 type Flag uint8
 
+// CP function features supported by the SMF, TS 29.244 8.2.58
+const (
+	CPFunctionFeatureLoad uint8 = 1 << iota // load control
+	CPFunctionFeatureOvrl                   // overload control
+)
+
 func BuildPfcpHeartbeatRequest(sequenceNumber uint32, recoveryTimeStamp time.Time) *message.HeartbeatRequest {
 	return message.NewHeartbeatRequest(
 		sequenceNumber,
@@ -37,7 +43,7 @@ func BuildPfcpAssociationSetupRequest(sequenceNumber uint32, recoveryTimeStamp t
 		sequenceNumber,
 		ie.NewNodeIDHeuristic(nodeID),
 		ie.NewRecoveryTimeStamp(recoveryTimeStamp),
-		ie.NewCPFunctionFeatures(0),
+		ie.NewCPFunctionFeatures(CPFunctionFeatureLoad|CPFunctionFeatureOvrl),
 	)
 }
 
@@ -47,7 +53,7 @@ func BuildPfcpAssociationSetupResponse(cause uint8, recoveryTimeStamp time.Time,
 		ie.NewNodeIDHeuristic(nodeID),
 		ie.NewCause(cause),
 		ie.NewRecoveryTimeStamp(recoveryTimeStamp),
-		ie.NewCPFunctionFeatures(0),
+		ie.NewCPFunctionFeatures(CPFunctionFeatureLoad|CPFunctionFeatureOvrl),
 	)
 }
 
@@ -79,20 +85,7 @@ func createPDIIE(pdi *context.PDI) *ie.IE {
 	)
 
 	if pdi.LocalFTeid != nil {
-		fteidFlags := new(Flag)
-		fteidFlags.setBit(1, pdi.LocalFTeid.V4)
-		fteidFlags.setBit(2, pdi.LocalFTeid.V6)
-		fteidFlags.setBit(3, pdi.LocalFTeid.Ch)
-		fteidFlags.setBit(4, pdi.LocalFTeid.Chid)
-		createPDIIes = append(createPDIIes,
-			ie.NewFTEID(
-				uint8(*fteidFlags),
-				pdi.LocalFTeid.Teid,
-				pdi.LocalFTeid.Ipv4Address,
-				pdi.LocalFTeid.Ipv6Address,
-				pdi.LocalFTeid.ChooseId,
-			),
-		)
+		createPDIIes = append(createPDIIes, fteidIE(pdi.LocalFTeid))
 	}
 
 	createPDIIes = append(createPDIIes,
@@ -121,6 +114,10 @@ func createPDIIE(pdi *context.PDI) *ie.IE {
 		createPDIIes = append(createPDIIes, ie.NewApplicationID(pdi.ApplicationID))
 	}
 
+	if pdi.TgppInterfaceType != 0 {
+		createPDIIes = append(createPDIIes, ie.NewTGPPInterfaceType(pdi.TgppInterfaceType))
+	}
+
 	if pdi.SDFFilter != nil {
 		createPDIIes = append(createPDIIes, ie.NewSDFFilter(
 			string(pdi.SDFFilter.FlowDescription),
@@ -132,9 +129,48 @@ func createPDIIE(pdi *context.PDI) *ie.IE {
 		)
 	}
 
+	if rt := pdi.RedundantTransmission; rt != nil && rt.LocalFTeid != nil {
+		createPDIIes = append(createPDIIes, ie.NewRedundantTransmissionParametersInPDI(
+			fteidIE(rt.LocalFTeid), ie.NewNetworkInstance(string(rt.NetworkInstance)),
+		))
+	}
+
 	return ie.NewPDI(createPDIIes...)
 }
 
+func fteidIE(fteid *context.FTEID) *ie.IE {
+	fteidFlags := new(Flag)
+	fteidFlags.setBit(1, fteid.V4)
+	fteidFlags.setBit(2, fteid.V6)
+	fteidFlags.setBit(3, fteid.Ch)
+	fteidFlags.setBit(4, fteid.Chid)
+	return ie.NewFTEID(uint8(*fteidFlags), fteid.Teid, fteid.Ipv4Address, fteid.Ipv6Address, fteid.ChooseId)
+}
+
+func outerHeaderCreationIE(ohc *context.OuterHeaderCreation) *ie.IE {
+	return ie.NewOuterHeaderCreation(
+		ohc.OuterHeaderCreationDescription,
+		ohc.Teid,
+		ohc.Ipv4Address.String(),
+		ohc.Ipv6Address.String(),
+		ohc.PortNumber,
+		0,
+		0,
+	)
+}
+
+// redundantForwardingParametersIE returns the second N3 tunnel the UPF
+// duplicates the downlink packets of the FAR on, TS 29.244 5.24
+func redundantForwardingParametersIE(far *context.FAR) *ie.IE {
+	rfp := far.RedundantForwardingParameters
+	if rfp == nil || rfp.OuterHeaderCreation == nil {
+		return nil
+	}
+	return ie.NewRedundantTransmissionForwardingParameters(
+		outerHeaderCreationIE(rfp.OuterHeaderCreation), ie.NewNetworkInstance(string(rfp.NetworkInstance)),
+	)
+}
+
 func pdrToCreatePDR(pdr *context.PDR) *ie.IE {
 	ies := make([]*ie.IE, 0)
 	ies = append(ies, ie.NewPDRID(pdr.PDRID))
@@ -143,7 +179,9 @@ func pdrToCreatePDR(pdr *context.PDR) *ie.IE {
 	if pdr.OuterHeaderRemoval != nil {
 		ies = append(ies, ie.NewOuterHeaderRemoval(pdr.OuterHeaderRemoval.OuterHeaderRemovalDescription, 0))
 	}
-	if pdr.FAR != nil {
+	if pdr.MAR != nil && pdr.MAR.State != context.RULE_REMOVE {
+		ies = append(ies, ie.NewMARID(pdr.MAR.MARID))
+	} else if pdr.FAR != nil {
 		ies = append(ies, ie.NewFARID(pdr.FAR.FARID))
 	}
 	for _, qer := range pdr.QER {
@@ -151,6 +189,11 @@ func pdrToCreatePDR(pdr *context.PDR) *ie.IE {
 			ies = append(ies, ie.NewQERID(qer.QERID))
 		}
 	}
+	for _, urr := range pdr.URR {
+		if urr != nil && urr.State != context.RULE_REMOVE {
+			ies = append(ies, ie.NewURRID(urr.URRID))
+		}
+	}
 	return ie.NewCreatePDR(ies...)
 }
 
@@ -172,22 +215,24 @@ func farToCreateFAR(far *context.FAR) *ie.IE {
 		forwardingParametersIEs = append(forwardingParametersIEs, ie.NewDestinationInterface(far.ForwardingParameters.DestinationInterface.InterfaceValue))
 		forwardingParametersIEs = append(forwardingParametersIEs, ie.NewNetworkInstance(string(far.ForwardingParameters.NetworkInstance)))
 		if far.ForwardingParameters.OuterHeaderCreation != nil {
-			forwardingParametersIEs = append(forwardingParametersIEs, ie.NewOuterHeaderCreation(
-				far.ForwardingParameters.OuterHeaderCreation.OuterHeaderCreationDescription,
-				far.ForwardingParameters.OuterHeaderCreation.Teid,
-				far.ForwardingParameters.OuterHeaderCreation.Ipv4Address.String(),
-				far.ForwardingParameters.OuterHeaderCreation.Ipv6Address.String(),
-				far.ForwardingParameters.OuterHeaderCreation.PortNumber,
-				0,
-				0,
-			))
+			forwardingParametersIEs = append(forwardingParametersIEs, outerHeaderCreationIE(far.ForwardingParameters.OuterHeaderCreation))
+		}
+
+		if ri := far.ForwardingParameters.RedirectInformation; ri != nil {
+			forwardingParametersIEs = append(forwardingParametersIEs, ie.NewRedirectInformation(ri.RedirectAddressType, ri.RedirectServerAddress))
 		}
 
 		if far.ForwardingParameters.ForwardingPolicyID != "" {
 			forwardingParametersIEs = append(forwardingParametersIEs, ie.NewForwardingPolicy(far.ForwardingParameters.ForwardingPolicyID))
 		}
+		if far.ForwardingParameters.TgppInterfaceType != 0 {
+			forwardingParametersIEs = append(forwardingParametersIEs, ie.NewTGPPInterfaceType(far.ForwardingParameters.TgppInterfaceType))
+		}
 		createFARies = append(createFARies, ie.NewForwardingParameters(forwardingParametersIEs...))
 	}
+	if rfpIE := redundantForwardingParametersIE(far); rfpIE != nil {
+		createFARies = append(createFARies, rfpIE)
+	}
 	return ie.NewCreateFAR(createFARies...)
 }
 
@@ -204,9 +249,188 @@ func qerToCreateQER(qer *context.QER) *ie.IE {
 	if qer.GBR != nil {
 		createQERies = append(createQERies, ie.NewGBR(qer.GBR.ULGBR, qer.GBR.DLGBR))
 	}
+	if qer.RQI {
+		createQERies = append(createQERies, ie.NewRQI(1))
+	}
 	return ie.NewCreateQER(createQERies...)
 }
 
+func qerToUpdateQER(qer *context.QER) *ie.IE {
+	updateQERies := make([]*ie.IE, 0)
+	updateQERies = append(updateQERies, ie.NewQERID(qer.QERID))
+	if qer.GateStatus != nil {
+		updateQERies = append(updateQERies, ie.NewGateStatus(qer.GateStatus.ULGate, qer.GateStatus.DLGate))
+	}
+	if qer.MBR != nil {
+		updateQERies = append(updateQERies, ie.NewMBR(qer.MBR.ULMBR, qer.MBR.DLMBR))
+	}
+	if qer.GBR != nil {
+		updateQERies = append(updateQERies, ie.NewGBR(qer.GBR.ULGBR, qer.GBR.DLGBR))
+	}
+	updateQERies = append(updateQERies, ie.NewRQI(uint8(boolToInt(qer.RQI))))
+	return ie.NewUpdateQER(updateQERies...)
+}
+
+func urrIEs(urr *context.URR) []*ie.IE {
+	urrIEs := make([]*ie.IE, 0)
+	urrIEs = append(urrIEs, ie.NewURRID(urr.URRID))
+	urrIEs = append(urrIEs, ie.NewMeasurementMethod(
+		boolToInt(urr.MeasurementMethod.Event),
+		boolToInt(urr.MeasurementMethod.Volum),
+		boolToInt(urr.MeasurementMethod.Durat),
+	))
+	reportingTriggersFlag := new(Flag)
+	reportingTriggersFlag.setBit(1, urr.ReportingTriggers.Perio)
+	reportingTriggersFlag.setBit(2, urr.ReportingTriggers.Volth)
+	reportingTriggersFlag.setBit(3, urr.ReportingTriggers.Timth)
+	urrIEs = append(urrIEs, ie.NewReportingTriggers(uint8(*reportingTriggersFlag), 0))
+	if vol := urr.VolumeThreshold; vol != nil {
+		volumeFlag := new(Flag)
+		volumeFlag.setBit(1, vol.TotalVolume > 0)
+		volumeFlag.setBit(2, vol.UplinkVolume > 0)
+		volumeFlag.setBit(3, vol.DownlinkVolume > 0)
+		urrIEs = append(urrIEs, ie.NewVolumeThreshold(uint8(*volumeFlag), vol.TotalVolume, vol.UplinkVolume, vol.DownlinkVolume))
+	}
+	if urr.TimeThreshold > 0 {
+		urrIEs = append(urrIEs, ie.NewTimeThreshold(time.Duration(urr.TimeThreshold)*time.Second))
+	}
+	return urrIEs
+}
+
+func urrToCreateURR(urr *context.URR) *ie.IE {
+	return ie.NewCreateURR(urrIEs(urr)...)
+}
+
+func urrToUpdateURR(urr *context.URR) *ie.IE {
+	return ie.NewUpdateURR(urrIEs(urr)...)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// pdrURRs returns the URRs the PDRs are associated with, without duplicates
+func pdrURRs(pdrLists ...[]*context.PDR) []*context.URR {
+	urrList := make([]*context.URR, 0)
+	seen := make(map[uint32]bool)
+	for _, pdrList := range pdrLists {
+		for _, pdr := range pdrList {
+			if pdr == nil {
+				continue
+			}
+			for _, urr := range pdr.URR {
+				if urr != nil && !seen[urr.URRID] {
+					seen[urr.URRID] = true
+					urrList = append(urrList, urr)
+				}
+			}
+		}
+	}
+	return urrList
+}
+
+// detachRemovedURRs drops the URRs whose removal was sent from the PDRs
+func detachRemovedURRs(pdrLists ...[]*context.PDR) {
+	for _, pdrList := range pdrLists {
+		for _, pdr := range pdrList {
+			if pdr == nil {
+				continue
+			}
+			urrList := pdr.URR[:0]
+			for _, urr := range pdr.URR {
+				if urr.State != context.RULE_REMOVE {
+					urrList = append(urrList, urr)
+				}
+			}
+			pdr.URR = urrList
+		}
+	}
+}
+
+func accessForwardingActionIEs(action *context.AccessForwardingAction, steeringMode uint8) []*ie.IE {
+	ies := make([]*ie.IE, 0)
+	ies = append(ies, ie.NewFARID(action.FAR.FARID))
+	if steeringMode == context.SteeringModeLoadBalancing {
+		ies = append(ies, ie.NewWeight(action.Weight))
+	}
+	if steeringMode == context.SteeringModeActiveStandby || steeringMode == context.SteeringModePriorityBased {
+		ies = append(ies, ie.NewPriority(action.Priority))
+	}
+	return ies
+}
+
+func marToCreateMAR(mar *context.MAR) *ie.IE {
+	createMARies := make([]*ie.IE, 0)
+	createMARies = append(createMARies, ie.NewMARID(mar.MARID))
+	createMARies = append(createMARies, ie.NewSteeringFunctionality(mar.SteeringFunctionality))
+	createMARies = append(createMARies, ie.NewSteeringMode(mar.SteeringMode))
+	if mar.TgppAccess != nil {
+		createMARies = append(createMARies, ie.NewTGPPAccessForwardingActionInformation(
+			accessForwardingActionIEs(mar.TgppAccess, mar.SteeringMode)...))
+	}
+	if mar.NonTgppAccess != nil {
+		createMARies = append(createMARies, ie.NewNonTGPPAccessForwardingActionInformation(
+			accessForwardingActionIEs(mar.NonTgppAccess, mar.SteeringMode)...))
+	}
+	return ie.NewCreateMAR(createMARies...)
+}
+
+func marToUpdateMAR(mar *context.MAR) *ie.IE {
+	updateMARies := make([]*ie.IE, 0)
+	updateMARies = append(updateMARies, ie.NewMARID(mar.MARID))
+	updateMARies = append(updateMARies, ie.NewSteeringFunctionality(mar.SteeringFunctionality))
+	updateMARies = append(updateMARies, ie.NewSteeringMode(mar.SteeringMode))
+	if mar.TgppAccess != nil {
+		updateMARies = append(updateMARies, ie.NewUpdateTGPPAccessForwardingActionInformation(
+			accessForwardingActionIEs(mar.TgppAccess, mar.SteeringMode)...))
+	}
+	if mar.NonTgppAccess != nil {
+		updateMARies = append(updateMARies, ie.NewUpdateNonTGPPAccessForwardingActionInformation(
+			accessForwardingActionIEs(mar.NonTgppAccess, mar.SteeringMode)...))
+	}
+	return ie.NewUpdateMAR(updateMARies...)
+}
+
+// pdrMARs returns the MARs the PDRs are associated with
+func pdrMARs(pdrLists ...[]*context.PDR) []*context.MAR {
+	marList := make([]*context.MAR, 0)
+	seen := make(map[uint16]bool)
+	for _, pdrList := range pdrLists {
+		for _, pdr := range pdrList {
+			if pdr != nil && pdr.MAR != nil && !seen[pdr.MAR.MARID] {
+				seen[pdr.MAR.MARID] = true
+				marList = append(marList, pdr.MAR)
+			}
+		}
+	}
+	return marList
+}
+
+// detachRemovedMARs drops the MARs whose removal was sent from the PDRs
+func detachRemovedMARs(pdrLists ...[]*context.PDR) {
+	for _, pdrList := range pdrLists {
+		for _, pdr := range pdrList {
+			if pdr != nil && pdr.MAR != nil && pdr.MAR.State == context.RULE_REMOVE {
+				pdr.MAR = nil
+			}
+		}
+	}
+}
+
+// provideATSSSControlInformation requests the UPF to provide the ATSSS-LL
+// functionality for the MARs created, TS 29.244 7.5.2.10
+func provideATSSSControlInformation(marList []*context.MAR) *ie.IE {
+	for _, mar := range marList {
+		if mar.State == context.RULE_INITIAL && mar.SteeringFunctionality == context.SteeringFunctionalityATSSSLL {
+			return ie.NewProvideATSSSControlInformation(ie.NewATSSSLLControlInformation(1))
+		}
+	}
+	return nil
+}
+
 func pdrToUpdatePDR(pdr *context.PDR) *ie.IE {
 	updatePDRies := make([]*ie.IE, 0)
 	updatePDRies = append(updatePDRies, ie.NewPDRID(pdr.PDRID))
@@ -215,7 +439,9 @@ func pdrToUpdatePDR(pdr *context.PDR) *ie.IE {
 	if pdr.OuterHeaderRemoval != nil {
 		updatePDRies = append(updatePDRies, ie.NewOuterHeaderRemoval(pdr.OuterHeaderRemoval.OuterHeaderRemovalDescription, 0))
 	}
-	if pdr.FAR != nil {
+	if pdr.MAR != nil && pdr.MAR.State != context.RULE_REMOVE {
+		updatePDRies = append(updatePDRies, ie.NewMARID(pdr.MAR.MARID))
+	} else if pdr.FAR != nil {
 		updatePDRies = append(updatePDRies, ie.NewFARID(pdr.FAR.FARID))
 	}
 	for _, qer := range pdr.QER {
@@ -223,6 +449,11 @@ func pdrToUpdatePDR(pdr *context.PDR) *ie.IE {
 			updatePDRies = append(updatePDRies, ie.NewQERID(qer.QERID))
 		}
 	}
+	for _, urr := range pdr.URR {
+		if urr != nil && urr.State != context.RULE_REMOVE {
+			updatePDRies = append(updatePDRies, ie.NewURRID(urr.URRID))
+		}
+	}
 	return ie.NewUpdatePDR(updatePDRies...)
 }
 
@@ -247,15 +478,7 @@ func farToUpdateFAR(far *context.FAR) *ie.IE {
 		forwardingParametersIEs = append(forwardingParametersIEs, ie.NewDestinationInterface(far.ForwardingParameters.DestinationInterface.InterfaceValue))
 		forwardingParametersIEs = append(forwardingParametersIEs, ie.NewNetworkInstance(string(far.ForwardingParameters.NetworkInstance)))
 		if far.ForwardingParameters.OuterHeaderCreation != nil {
-			forwardingParametersIEs = append(forwardingParametersIEs, ie.NewOuterHeaderCreation(
-				far.ForwardingParameters.OuterHeaderCreation.OuterHeaderCreationDescription,
-				far.ForwardingParameters.OuterHeaderCreation.Teid,
-				far.ForwardingParameters.OuterHeaderCreation.Ipv4Address.String(),
-				far.ForwardingParameters.OuterHeaderCreation.Ipv6Address.String(),
-				far.ForwardingParameters.OuterHeaderCreation.PortNumber,
-				0,
-				0,
-			))
+			forwardingParametersIEs = append(forwardingParametersIEs, outerHeaderCreationIE(far.ForwardingParameters.OuterHeaderCreation))
 		}
 		if far.ForwardingParameters.PFCPSMReqFlags != nil {
 			pfcpSMReqFlag := new(Flag)
@@ -266,12 +489,21 @@ func farToUpdateFAR(far *context.FAR) *ie.IE {
 			// reset original far sndem flag
 			far.ForwardingParameters.PFCPSMReqFlags = nil
 		}
+		if ri := far.ForwardingParameters.RedirectInformation; ri != nil {
+			forwardingParametersIEs = append(forwardingParametersIEs, ie.NewRedirectInformation(ri.RedirectAddressType, ri.RedirectServerAddress))
+		}
 
 		if far.ForwardingParameters.ForwardingPolicyID != "" {
 			forwardingParametersIEs = append(forwardingParametersIEs, ie.NewForwardingPolicy(far.ForwardingParameters.ForwardingPolicyID))
 		}
+		if far.ForwardingParameters.TgppInterfaceType != 0 {
+			forwardingParametersIEs = append(forwardingParametersIEs, ie.NewTGPPInterfaceType(far.ForwardingParameters.TgppInterfaceType))
+		}
 		updateFARies = append(updateFARies, ie.NewUpdateForwardingParameters(forwardingParametersIEs...))
 	}
+	if rfpIE := redundantForwardingParametersIE(far); rfpIE != nil {
+		updateFARies = append(updateFARies, rfpIE)
+	}
 	return ie.NewUpdateFAR(updateFARies...)
 }
 
@@ -312,6 +544,24 @@ func BuildPfcpSessionEstablishmentRequest(
 		filteredQER.State = context.RULE_CREATE
 	}
 
+	for _, urr := range pdrURRs(pdrList) {
+		if urr.State == context.RULE_INITIAL {
+			ies = append(ies, urrToCreateURR(urr))
+			urr.State = context.RULE_CREATE
+		}
+	}
+
+	marList := pdrMARs(pdrList)
+	if atsssControl := provideATSSSControlInformation(marList); atsssControl != nil {
+		ies = append(ies, atsssControl)
+	}
+	for _, mar := range marList {
+		if mar.State == context.RULE_INITIAL {
+			ies = append(ies, marToCreateMAR(mar))
+			mar.State = context.RULE_CREATE
+		}
+	}
+
 	ies = append(ies, ie.NewPDNType(ie.PDNTypeIPv4))
 
 	return message.NewSessionEstablishmentRequest(
@@ -340,6 +590,13 @@ func BuildPfcpSessionModificationRequest(
 	ies := make([]*ie.IE, 0)
 	ies = append(ies, ie.NewFSEID(localSEID, fseidIPv4Address, nil))
 
+	// URRs and MARs are provisioned along with the PDRs they are associated with
+	urrList := pdrURRs(pdrList, removePDR)
+	marList := pdrMARs(pdrList, removePDR)
+	if atsssControl := provideATSSSControlInformation(marList); atsssControl != nil {
+		ies = append(ies, atsssControl)
+	}
+
 	for _, pdr := range pdrList {
 		switch pdr.State {
 		case context.RULE_INITIAL:
@@ -357,17 +614,24 @@ func BuildPfcpSessionModificationRequest(
 		case context.RULE_INITIAL:
 			ies = append(ies, farToCreateFAR(far))
 		case context.RULE_UPDATE:
-			ies = append(ies, farToUpdateFAR(far))
+			if far.Recreate {
+				ies = append(ies, ie.NewRemoveFAR(ie.NewFARID(far.FARID)), farToCreateFAR(far))
+			} else {
+				ies = append(ies, farToUpdateFAR(far))
+			}
 		case context.RULE_REMOVE:
 			ies = append(ies, ie.NewRemoveFAR(ie.NewFARID(far.FARID)))
 		}
 		far.State = context.RULE_CREATE
+		far.Recreate = false
 	}
 
 	for _, qer := range qerList {
 		switch qer.State {
 		case context.RULE_INITIAL:
 			ies = append(ies, qerToCreateQER(qer))
+		case context.RULE_UPDATE:
+			ies = append(ies, qerToUpdateQER(qer))
 		}
 		qer.State = context.RULE_CREATE
 	}
@@ -389,6 +653,35 @@ func BuildPfcpSessionModificationRequest(
 			ies = append(ies, buildRemoveQERIE(qer))
 		}
 	}
+
+	for _, urr := range urrList {
+		switch urr.State {
+		case context.RULE_INITIAL:
+			ies = append(ies, urrToCreateURR(urr))
+		case context.RULE_UPDATE:
+			ies = append(ies, urrToUpdateURR(urr))
+		case context.RULE_REMOVE:
+			ies = append(ies, buildRemoveURRIE(urr))
+			continue
+		}
+		urr.State = context.RULE_CREATE
+	}
+	detachRemovedURRs(pdrList, removePDR)
+
+	for _, mar := range marList {
+		switch mar.State {
+		case context.RULE_INITIAL:
+			ies = append(ies, marToCreateMAR(mar))
+		case context.RULE_UPDATE:
+			ies = append(ies, marToUpdateMAR(mar))
+		case context.RULE_REMOVE:
+			ies = append(ies, buildRemoveMARIE(mar))
+			continue
+		}
+		mar.State = context.RULE_CREATE
+	}
+	detachRemovedMARs(pdrList, removePDR)
+
 	return message.NewSessionModificationRequest(
 		0,
 		0,
@@ -442,3 +735,11 @@ func buildRemoveFARIE(far *context.FAR) *ie.IE {
 func buildRemoveQERIE(qer *context.QER) *ie.IE {
 	return ie.NewRemoveQER(ie.NewQERID(qer.QERID))
 }
+
+func buildRemoveURRIE(urr *context.URR) *ie.IE {
+	return ie.NewRemoveURR(ie.NewURRID(urr.URRID))
+}
+
+func buildRemoveMARIE(mar *context.MAR) *ie.IE {
+	return ie.NewRemoveMAR(ie.NewMARID(mar.MARID))
+}
@@ -168,6 +168,10 @@ func TestBuildPfcpAssociationSetupRequest(t *testing.T) {
 	if nodeID != cpNodeID {
 		t.Errorf("expected NodeID to be %v got %v", cpNodeID, nodeID)
 	}
+
+	if !req.CPFunctionFeatures.HasLOAD() || !req.CPFunctionFeatures.HasOVRL() {
+		t.Errorf("expected load and overload control advertised in CP function features")
+	}
 }
 
 func TestBuildPfcpAssociationSetupResponse(t *testing.T) {
@@ -455,6 +459,197 @@ func TestBuildPfcpSessionModificationRequestNoOuterHeader(t *testing.T) {
 	}
 }
 
+// redirectInformationPayload returns the payload of the Redirect Information IE
+// found in the forwarding parameters of the given FAR IE.
+func redirectInformationPayload(farIE *ie.IE) []byte {
+	for _, x := range farIE.ChildIEs {
+		if x.Type != ie.ForwardingParameters && x.Type != ie.UpdateForwardingParameters {
+			continue
+		}
+		for _, y := range x.ChildIEs {
+			if y.Type == ie.RedirectInformation {
+				return y.Payload
+			}
+		}
+	}
+	return nil
+}
+
+func TestBuildPfcpSessionModificationRequestRedirectInformation(t *testing.T) {
+	createFar := &context.FAR{
+		ForwardingParameters: &context.ForwardingParameters{
+			RedirectInformation: &context.RedirectInformation{
+				RedirectAddressType:   context.RedirectAddressURL,
+				RedirectServerAddress: "http://portal.example.com",
+			},
+		},
+		State: context.RULE_INITIAL,
+		FARID: 1,
+	}
+	updateFar := &context.FAR{
+		ForwardingParameters: &context.ForwardingParameters{
+			RedirectInformation: &context.RedirectInformation{
+				RedirectAddressType:   context.RedirectAddressIPv4,
+				RedirectServerAddress: "10.1.1.1",
+			},
+		},
+		State: context.RULE_UPDATE,
+		FARID: 2,
+	}
+	// redirection lifted by the PCF
+	liftedFar := &context.FAR{
+		ForwardingParameters: &context.ForwardingParameters{},
+		State:                context.RULE_UPDATE,
+		FARID:                3,
+		Recreate:             true,
+	}
+
+	msg, err := message.BuildPfcpSessionModificationRequest(64, 1, 2, net.ParseIP("2.3.4.5"), nil,
+		[]*context.FAR{createFar, updateFar, liftedFar}, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error building PFCP session modification request: %v", err)
+	}
+
+	buf := make([]byte, msg.MarshalLen())
+	if err = msg.MarshalTo(buf); err != nil {
+		t.Fatalf("error marshalling PFCP session modification request: %v", err)
+	}
+
+	req, err := pfcp_message.ParseSessionModificationRequest(buf)
+	if err != nil {
+		t.Fatalf("error parsing PFCP session modification request: %v", err)
+	}
+
+	if len(req.CreateFAR) != 2 {
+		t.Fatalf("expected 2 CreateFAR, got %v", len(req.CreateFAR))
+	}
+	payload := redirectInformationPayload(req.CreateFAR[0])
+	if payload == nil {
+		t.Fatalf("expected Redirect Information in CreateFAR")
+	}
+	if payload[0] != context.RedirectAddressURL {
+		t.Errorf("expected redirect address type %v, got %v", context.RedirectAddressURL, payload[0])
+	}
+	if addr := string(payload[3 : 3+int(payload[1])<<8+int(payload[2])]); addr != "http://portal.example.com" {
+		t.Errorf("expected redirect server address http://portal.example.com, got %v", addr)
+	}
+
+	if len(req.UpdateFAR) != 1 {
+		t.Fatalf("expected 1 UpdateFAR, got %v", len(req.UpdateFAR))
+	}
+	payload = redirectInformationPayload(req.UpdateFAR[0])
+	if payload == nil {
+		t.Fatalf("expected Redirect Information in UpdateFAR")
+	}
+	if payload[0] != context.RedirectAddressIPv4 {
+		t.Errorf("expected redirect address type %v, got %v", context.RedirectAddressIPv4, payload[0])
+	}
+
+	// an Update FAR without Redirect Information keeps the UPF redirecting
+	if len(req.RemoveFAR) != 1 {
+		t.Fatalf("expected the FAR whose redirection is lifted removed, got %v RemoveFAR", len(req.RemoveFAR))
+	}
+	if farID, err := req.RemoveFAR[0].FARID(); err != nil || farID != 3 {
+		t.Errorf("expected RemoveFAR of FAR 3, got %v %v", farID, err)
+	}
+	if farID, err := req.CreateFAR[1].FARID(); err != nil || farID != 3 {
+		t.Errorf("expected FAR 3 created again, got %v %v", farID, err)
+	}
+	if payload = redirectInformationPayload(req.CreateFAR[1]); payload != nil {
+		t.Errorf("expected no Redirect Information in the FAR created again once redirection is lifted")
+	}
+	if liftedFar.Recreate || liftedFar.State != context.RULE_CREATE {
+		t.Errorf("expected the recreated FAR installed, got state %v recreate %v", liftedFar.State, liftedFar.Recreate)
+	}
+	if updateFar.ForwardingParameters.RedirectInformation == nil {
+		t.Errorf("expected the FAR left unchanged by the builder")
+	}
+}
+
+func TestBuildPfcpSessionModificationRequestUpdateQER(t *testing.T) {
+	qerList := []*context.QER{
+		{
+			QERID:      7,
+			State:      context.RULE_UPDATE,
+			GateStatus: &context.GateStatus{ULGate: context.GateOpen, DLGate: context.GateClose},
+		},
+	}
+
+	msg, err := message.BuildPfcpSessionModificationRequest(64, 1, 2, net.ParseIP("2.3.4.5"), nil, nil, qerList, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error building PFCP session modification request: %v", err)
+	}
+
+	buf := make([]byte, msg.MarshalLen())
+	if err = msg.MarshalTo(buf); err != nil {
+		t.Fatalf("error marshalling PFCP session modification request: %v", err)
+	}
+
+	req, err := pfcp_message.ParseSessionModificationRequest(buf)
+	if err != nil {
+		t.Fatalf("error parsing PFCP session modification request: %v", err)
+	}
+
+	if len(req.CreateQER) != 0 {
+		t.Errorf("expected no CreateQER, got %v", len(req.CreateQER))
+	}
+	if len(req.UpdateQER) != 1 {
+		t.Fatalf("expected 1 UpdateQER, got %v", len(req.UpdateQER))
+	}
+
+	qerID, err := req.UpdateQER[0].QERID()
+	if err != nil || qerID != 7 {
+		t.Errorf("expected QER ID 7, got %v (%v)", qerID, err)
+	}
+	gateStatus, err := req.UpdateQER[0].GateStatus()
+	if err != nil {
+		t.Fatalf("error reading gate status: %v", err)
+	}
+	if gateStatus != 0x01 {
+		t.Errorf("expected UL gate open and DL gate closed, got %x", gateStatus)
+	}
+	if qerList[0].State != context.RULE_CREATE {
+		t.Errorf("expected QER state to be reset, got %v", qerList[0].State)
+	}
+}
+
+func TestBuildPfcpSessionModificationRequestReflectiveQoS(t *testing.T) {
+	qerList := []*context.QER{
+		{
+			QERID: 8,
+			QFI:   context.QFI{QFI: 5},
+			State: context.RULE_INITIAL,
+			RQI:   true,
+		},
+	}
+
+	msg, err := message.BuildPfcpSessionModificationRequest(66, 1, 2, net.ParseIP("2.3.4.5"), nil, nil, qerList, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error building PFCP session modification request: %v", err)
+	}
+
+	buf := make([]byte, msg.MarshalLen())
+	if err = msg.MarshalTo(buf); err != nil {
+		t.Fatalf("error marshalling PFCP session modification request: %v", err)
+	}
+
+	req, err := pfcp_message.ParseSessionModificationRequest(buf)
+	if err != nil {
+		t.Fatalf("error parsing PFCP session modification request: %v", err)
+	}
+
+	if len(req.CreateQER) != 1 {
+		t.Fatalf("expected 1 CreateQER, got %v", len(req.CreateQER))
+	}
+	rqi, err := req.CreateQER[0].RQI()
+	if err != nil {
+		t.Fatalf("error reading RQI: %v", err)
+	}
+	if rqi != 1 {
+		t.Errorf("expected RQI to be set, got %v", rqi)
+	}
+}
+
 func TestBuildPfcpSessionDeletionRequest(t *testing.T) {
 	msg := message.BuildPfcpSessionDeletionRequest(12, 2, 3, net.ParseIP("2.2.2.2"))
 
@@ -515,3 +710,249 @@ func TestBuildPfcpSessionReportResponse(t *testing.T) {
 		t.Errorf("expected PFCPSRRspFlags to be 1, got %v", flags)
 	}
 }
+
+func TestBuildPfcpSessionModificationRequestURR(t *testing.T) {
+	createdURR := &context.URR{
+		URRID:             3,
+		State:             context.RULE_INITIAL,
+		MonitoringKey:     "um-1",
+		MeasurementMethod: context.MeasurementMethod{Volum: true},
+		ReportingTriggers: context.ReportingTriggers{Volth: true},
+		VolumeThreshold:   &context.VolumeThreshold{TotalVolume: 1000},
+	}
+	removedURR := &context.URR{
+		URRID: 4,
+		State: context.RULE_REMOVE,
+	}
+	pdr := &context.PDR{
+		PDRID: 1,
+		State: context.RULE_UPDATE,
+		URR:   []*context.URR{createdURR, removedURR},
+	}
+
+	msg, err := message.BuildPfcpSessionModificationRequest(65, 1, 2, net.ParseIP("2.3.4.5"), []*context.PDR{pdr}, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error building PFCP session modification request: %v", err)
+	}
+
+	buf := make([]byte, msg.MarshalLen())
+	if err = msg.MarshalTo(buf); err != nil {
+		t.Fatalf("error marshalling PFCP session modification request: %v", err)
+	}
+
+	req, err := pfcp_message.ParseSessionModificationRequest(buf)
+	if err != nil {
+		t.Fatalf("error parsing PFCP session modification request: %v", err)
+	}
+
+	if len(req.CreateURR) != 1 {
+		t.Fatalf("expected 1 CreateURR, got %v", len(req.CreateURR))
+	}
+	urrID, err := req.CreateURR[0].URRID()
+	if err != nil || urrID != 3 {
+		t.Errorf("expected URR ID 3, got %v (%v)", urrID, err)
+	}
+	volThreshold, err := req.CreateURR[0].VolumeThreshold()
+	if err != nil {
+		t.Fatalf("error reading volume threshold: %v", err)
+	}
+	if volThreshold.TotalVolume != 1000 {
+		t.Errorf("expected total volume threshold 1000, got %v", volThreshold.TotalVolume)
+	}
+
+	if len(req.RemoveURR) != 1 {
+		t.Fatalf("expected 1 RemoveURR, got %v", len(req.RemoveURR))
+	}
+	if urrID, err = req.RemoveURR[0].URRID(); err != nil || urrID != 4 {
+		t.Errorf("expected removed URR ID 4, got %v (%v)", urrID, err)
+	}
+
+	if len(req.UpdatePDR) != 1 {
+		t.Fatalf("expected 1 UpdatePDR, got %v", len(req.UpdatePDR))
+	}
+	if urrID, err = req.UpdatePDR[0].URRID(); err != nil || urrID != 3 {
+		t.Errorf("expected PDR to refer to URR ID 3, got %v (%v)", urrID, err)
+	}
+
+	if createdURR.State != context.RULE_CREATE {
+		t.Errorf("expected URR state to be created, got %v", createdURR.State)
+	}
+	if len(pdr.URR) != 1 || pdr.URR[0] != createdURR {
+		t.Errorf("expected removed URR to be detached from the PDR, got %v", pdr.URR)
+	}
+}
+
+func TestBuildPfcpSessionModificationRequestMAR(t *testing.T) {
+	tgppFAR := &context.FAR{FARID: 1, State: context.RULE_CREATE}
+	nonTgppFAR := &context.FAR{FARID: 2, State: context.RULE_INITIAL, ApplyAction: context.ApplyAction{Forw: true}}
+	createdMAR := &context.MAR{
+		MARID:                 5,
+		State:                 context.RULE_INITIAL,
+		SteeringFunctionality: context.SteeringFunctionalityATSSSLL,
+		SteeringMode:          context.SteeringModeLoadBalancing,
+		TgppAccess:            &context.AccessForwardingAction{FAR: tgppFAR, Weight: 70},
+		NonTgppAccess:         &context.AccessForwardingAction{FAR: nonTgppFAR, Weight: 30},
+	}
+	removedMAR := &context.MAR{MARID: 6, State: context.RULE_REMOVE}
+	pdr := &context.PDR{PDRID: 1, State: context.RULE_UPDATE, FAR: tgppFAR, MAR: createdMAR}
+	otherPDR := &context.PDR{PDRID: 2, State: context.RULE_UPDATE, FAR: tgppFAR, MAR: removedMAR}
+
+	msg, err := message.BuildPfcpSessionModificationRequest(66, 1, 2, net.ParseIP("2.3.4.5"),
+		[]*context.PDR{pdr, otherPDR}, []*context.FAR{nonTgppFAR}, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error building PFCP session modification request: %v", err)
+	}
+
+	buf := make([]byte, msg.MarshalLen())
+	if err = msg.MarshalTo(buf); err != nil {
+		t.Fatalf("error marshalling PFCP session modification request: %v", err)
+	}
+
+	req, err := pfcp_message.ParseSessionModificationRequest(buf)
+	if err != nil {
+		t.Fatalf("error parsing PFCP session modification request: %v", err)
+	}
+
+	if len(req.CreateMAR) != 1 {
+		t.Fatalf("expected 1 CreateMAR, got %v", len(req.CreateMAR))
+	}
+	if marID, err := req.CreateMAR[0].MARID(); err != nil || marID != 5 {
+		t.Errorf("expected MAR ID 5, got %v (%v)", marID, err)
+	}
+	if mode, err := req.CreateMAR[0].SteeringMode(); err != nil || mode != context.SteeringModeLoadBalancing {
+		t.Errorf("expected load balancing steering mode, got %v (%v)", mode, err)
+	}
+	if req.ProvideATSSSControlInformation == nil {
+		t.Errorf("expected Provide ATSSS Control Information")
+	}
+
+	if len(req.RemoveMAR) != 1 {
+		t.Fatalf("expected 1 RemoveMAR, got %v", len(req.RemoveMAR))
+	}
+	if marID, err := req.RemoveMAR[0].MARID(); err != nil || marID != 6 {
+		t.Errorf("expected removed MAR ID 6, got %v (%v)", marID, err)
+	}
+
+	if len(req.UpdatePDR) != 2 {
+		t.Fatalf("expected 2 UpdatePDR, got %v", len(req.UpdatePDR))
+	}
+	updatePDRIEs, err := req.UpdatePDR[0].UpdatePDR()
+	if err != nil {
+		t.Fatalf("error reading UpdatePDR: %v", err)
+	}
+	var marID uint16
+	for _, i := range updatePDRIEs {
+		if i.Type == ie.MARID {
+			marID, _ = i.MARID()
+		}
+	}
+	if marID != 5 {
+		t.Errorf("expected PDR to refer to MAR ID 5, got %v", marID)
+	}
+	if farID, err := req.UpdatePDR[1].FARID(); err != nil || farID != 1 {
+		t.Errorf("expected PDR to refer back to FAR ID 1, got %v (%v)", farID, err)
+	}
+
+	if createdMAR.State != context.RULE_CREATE {
+		t.Errorf("expected MAR state to be created, got %v", createdMAR.State)
+	}
+	if otherPDR.MAR != nil {
+		t.Errorf("expected removed MAR to be detached from the PDR")
+	}
+}
+
+func TestBuildPfcpSessionModificationRequestRedundantTransmission(t *testing.T) {
+	far := &context.FAR{
+		FARID:       3,
+		State:       context.RULE_INITIAL,
+		ApplyAction: context.ApplyAction{Forw: true},
+		RedundantForwardingParameters: &context.RedundantTransmissionForwardingParameters{
+			OuterHeaderCreation: &context.OuterHeaderCreation{
+				OuterHeaderCreationDescription: context.OuterHeaderCreationGtpUUdpIpv4,
+				Teid:                           9,
+				Ipv4Address:                    net.ParseIP("192.168.2.2").To4(),
+			},
+			NetworkInstance: nasType.Dnn("factory"),
+		},
+	}
+	pdr := &context.PDR{
+		PDRID: 1,
+		State: context.RULE_INITIAL,
+		FAR:   far,
+		PDI: context.PDI{
+			LocalFTeid: &context.FTEID{Ch: true},
+			RedundantTransmission: &context.RedundantTransmissionParameters{
+				LocalFTeid:      &context.FTEID{Ch: true},
+				NetworkInstance: nasType.Dnn("factory"),
+			},
+		},
+	}
+
+	msg, err := message.BuildPfcpSessionModificationRequest(66, 1, 2, net.ParseIP("2.3.4.5"),
+		[]*context.PDR{pdr}, []*context.FAR{far}, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error building PFCP session modification request: %v", err)
+	}
+
+	buf := make([]byte, msg.MarshalLen())
+	if err = msg.MarshalTo(buf); err != nil {
+		t.Fatalf("error marshalling PFCP session modification request: %v", err)
+	}
+
+	req, err := pfcp_message.ParseSessionModificationRequest(buf)
+	if err != nil {
+		t.Fatalf("error parsing PFCP session modification request: %v", err)
+	}
+
+	if len(req.CreatePDR) != 1 {
+		t.Fatalf("expected 1 CreatePDR, got %v", len(req.CreatePDR))
+	}
+	pdiIEs, err := req.CreatePDR[0].PDI()
+	if err != nil {
+		t.Fatalf("error reading PDI: %v", err)
+	}
+	var redundantFTEID *ie.FTEIDFields
+	for _, i := range pdiIEs {
+		if i.Type != ie.RedundantTransmissionParameters {
+			continue
+		}
+		rtIEs, err := i.RedundantTransmissionParameters()
+		if err != nil {
+			t.Fatalf("error reading Redundant Transmission Parameters: %v", err)
+		}
+		for _, rtIE := range rtIEs {
+			if rtIE.Type == ie.FTEID {
+				redundantFTEID, _ = rtIE.FTEID()
+			}
+		}
+	}
+	if redundantFTEID == nil || !redundantFTEID.HasCh() {
+		t.Errorf("expected a redundant F-TEID chosen by the UPF, got %+v", redundantFTEID)
+	}
+
+	if len(req.CreateFAR) != 1 {
+		t.Fatalf("expected 1 CreateFAR, got %v", len(req.CreateFAR))
+	}
+	farIEs, err := req.CreateFAR[0].CreateFAR()
+	if err != nil {
+		t.Fatalf("error reading CreateFAR: %v", err)
+	}
+	var ohc *ie.OuterHeaderCreationFields
+	for _, i := range farIEs {
+		if i.Type != ie.RedundantTransmissionForwardingParameters {
+			continue
+		}
+		rfpIEs, err := i.RedundantTransmissionForwardingParameters()
+		if err != nil {
+			t.Fatalf("error reading Redundant Transmission Forwarding Parameters: %v", err)
+		}
+		for _, rfpIE := range rfpIEs {
+			if rfpIE.Type == ie.OuterHeaderCreation {
+				ohc, _ = rfpIE.OuterHeaderCreation()
+			}
+		}
+	}
+	if ohc == nil || ohc.TEID != 9 || !ohc.IPv4Address.Equal(net.ParseIP("192.168.2.2")) {
+		t.Errorf("expected the DL packets duplicated to the redundant AN tunnel, got %+v", ohc)
+	}
+}
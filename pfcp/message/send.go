@@ -20,7 +20,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/omec-project/nas/v2/nasMessage"
 	"github.com/omec-project/openapi/v2/models"
 	"github.com/omec-project/smf/consumer"
 	smf_context "github.com/omec-project/smf/context"
@@ -471,6 +470,14 @@ func handleSendPfcpSessEstReqError(msg message.Message, pfcpErr error) {
 		return
 	}
 	smContext.SubPfcpLog.Errorf("PFCP Session Establishment send failure, %v", pfcpErr.Error())
+	smContext.SMLock.Lock()
+	reanchoring := smContext.IsReanchoring()
+	smContext.SMLock.Unlock()
+	if reanchoring {
+		// the established PDU session is released by the re-anchoring
+		smContext.SBIPFCPCommunicationChan <- smf_context.SessionEstablishFailed
+		return
+	}
 	// N1N2 Request towards AMF
 	n1n2Request := models.NewN1N2MessageTransferRequest()
 
@@ -483,8 +490,7 @@ func handleSendPfcpSessEstReqError(msg message.Message, pfcpErr error) {
 	n1n2Request.SetJsonData(*jsonData)
 	defer util.CleanupMultipartTempFiles(n1n2Request)
 
-	if smNasBuf, err := smf_context.BuildGSMPDUSessionEstablishmentReject(smContext,
-		nasMessage.Cause5GSMRequestRejectedUnspecified); err != nil {
+	if smNasBuf, err := smf_context.BuildGSMPDUSessionEstablishmentRejectDnnUnavailable(smContext); err != nil {
 		smContext.SubPduSessLog.Errorf("Build GSM PDUSessionEstablishmentReject failed: %s", err)
 		smContext.ChangeState(smf_context.SmStateInit)
 		smContext.SubCtxLog.Debugln("SMContextState Change State:", smContext.SMContextState.String())
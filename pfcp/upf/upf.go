@@ -43,6 +43,10 @@ func InitPfcpHeartbeatRequest() {
 				logger.PfcpLog.Errorf("pfcp heartbeat failure for UPF: [%v]", upf.NodeID)
 				heartbeatRequest := pfcp_message.HeartbeatRequest{}
 				metrics.IncrementN4MsgStats(context.SMF_Self().NfInstanceID, heartbeatRequest.MessageTypeName(), "Out", "Failure", "Timeout")
+				if upf.UPF.UPFStatus == context.AssociatedSetUpSuccess {
+					// the sessions of the UPF are released or re-anchored
+					go context.HandleUpfFailure(upf.UPF)
+				}
 				upf.UPF.UPFStatus = context.NotAssociated
 			}
 
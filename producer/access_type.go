@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package producer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/consumer"
+	smf_context "github.com/omec-project/smf/context"
+	"github.com/omec-project/smf/transaction"
+	"github.com/omec-project/smf/util"
+)
+
+// HandleUpdateAccessType moves the PDU session to the access type the AMF
+// sends on a handover between the 3GPP and the non-3GPP access, TS 23.502
+// 4.9.2.3. The AN of the new access gets the PDU Session Resource Setup
+// Request, the PCF the access type change.
+func HandleUpdateAccessType(txn *transaction.Transaction, response *models.UpdateSmContext200Response,
+	pfcpAction *pfcpAction, pfcpParam *pfcpParam,
+) error {
+	body := txn.Req.(models.UpdateSmContextRequest)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+	smContextUpdateData := body.JsonData
+
+	anType := smContextUpdateData.GetAnType()
+	if anType == "" || anType == smContext.AnType || smContext.Tunnel == nil {
+		return nil
+	}
+	if smContext.MaPdu != nil {
+		// an MA PDU session is served over both accesses
+		return nil
+	}
+	smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, access type change from %s to %s", smContext.AnType, anType)
+	if smContext.SMContextState != smf_context.SmStateActive {
+		smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, SMContext state[%v] should be SmStateActive",
+			smContext.SMContextState.String())
+	}
+	smContext.ChangeState(smf_context.SmStateModify)
+	smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
+	smContext.ChangeAccessType(anType, smContextUpdateData.GetRatType())
+
+	if smContextUpdateData.GetUpCnxState() != models.UPCNXSTATE_ACTIVATING {
+		// otherwise set up along with the UP connection activation
+		n2Buf, err := smf_context.BuildPDUSessionResourceSetupRequestTransfer(smContext)
+		if err != nil {
+			smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build PDUSession Resource Setup Request Transfer Error(%s)", err.Error())
+			return err
+		}
+		tmpFile, err := util.CreatePayloadTempFile(n2Buf)
+		if err != nil {
+			smContext.SubPduSessLog.Errorln(err)
+			return err
+		}
+		smContext.UpCnxState = models.UPCNXSTATE_ACTIVATING
+		response.BinaryDataN2SmInformation = &tmpFile
+		response.JsonData.N2SmInfo = &models.RefToBinaryData{ContentId: "PDUSessionResourceSetupRequestTransfer"}
+		response.JsonData.N2SmInfoType = models.N2SMINFOTYPE_PDU_RES_SETUP_REQ.Ptr()
+		response.JsonData.UpCnxState = models.UPCNXSTATE_ACTIVATING.Ptr()
+	}
+
+	pdrs, fars := smContext.SetAccessInterfaceType()
+	if defaultPath := smContext.Tunnel.DataPathPool.GetDefaultPath(); defaultPath != nil && (len(pdrs) > 0 || len(fars) > 0) {
+		pfcpParam.pdrList = append(pfcpParam.pdrList, pdrs...)
+		pfcpParam.farList = append(pfcpParam.farList, fars...)
+		if smContext.PendingUPF == nil {
+			smContext.PendingUPF = make(smf_context.PendingUPF)
+		}
+		smContext.PendingUPF[defaultPath.FirstDPNode.GetNodeIP()] = true
+		pfcpAction.sendPfcpModify = true
+		smContext.ChangeState(smf_context.SmStatePfcpModify)
+		smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
+	}
+
+	if smContext.SmPolicyData.IsAccessTypeChangeReportRequired() {
+		go reportAccessTypeChange(smContext, anType, smContext.RatType)
+	}
+	return nil
+}
+
+// reportAccessTypeChange reports the access type change to the PCF, then
+// enforces the SM policy decision returned by the PCF
+func reportAccessTypeChange(smContext *smf_context.SMContext, anType models.AccessType, ratType models.RatType) {
+	smPolicyDecision, httpStatus, err := consumer.SendSMPolicyAssociationUpdateByAccessTypeChange(smContext, anType, ratType)
+	if err != nil {
+		smContext.SubQosLog.Errorf("access type change report to PCF failed, status [%d]: %v", httpStatus, err)
+		return
+	}
+	if smPolicyDecision == nil {
+		return
+	}
+
+	smContext.SMLock.Lock()
+	if !hasPolicyData(smPolicyDecision) {
+		if smPolicyDecision.PolicyCtrlReqTriggers != nil {
+			smContext.SmPolicyData.PolicyCtrlReqTriggers = smPolicyDecision.PolicyCtrlReqTriggers
+		}
+		smContext.SMLock.Unlock()
+		return
+	}
+	if err := enforceSmPolicyDecision(smContext, smPolicyDecision); err != nil {
+		smContext.SubQosLog.Errorf("SM policy decision after access type change not enforced: %v", err)
+	}
+}
+
+// releaseSourceAccess releases the N2 resources of the PDU session in the
+// access it left, once the AN of the new access set up its tunnel
+func releaseSourceAccess(smContext *smf_context.SMContext, source models.AccessType) {
+	if err := sendSourceAccessReleaseN1N2Transfer(smContext, source); err != nil {
+		smContext.SubPduSessLog.Errorf("release of the %s resources failed: %v", source, err)
+	}
+}
+
+func sendSourceAccessReleaseN1N2Transfer(smContext *smf_context.SMContext, source models.AccessType) error {
+	n1n2Request := models.NewN1N2MessageTransferRequest()
+	defer util.CleanupMultipartTempFiles(n1n2Request)
+
+	smContext.SMLock.Lock()
+	n2Pdu, err := smf_context.BuildPDUSessionResourceReleaseCommandTransfer(smContext)
+	smContext.SMLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("build PDUSessionResourceReleaseCommandTransfer failed: %w", err)
+	}
+	tmpFile, err := util.CreatePayloadTempFile(n2Pdu)
+	if err != nil {
+		return err
+	}
+	n1n2Request.SetBinaryDataN2Information(tmpFile)
+
+	jsonData := models.NewN1N2MessageTransferReqData()
+	jsonData.SetPduSessionId(smContext.PDUSessionID)
+	jsonData.SetTargetAccess(source)
+	n2InfoContent := models.NewN2InfoContent(models.RefToBinaryData{ContentId: "N2SmInformation"})
+	n2InfoContent.SetNgapIeType(models.NGAPIETYPE_PDU_RES_REL_CMD)
+	smInfo := models.NewN2SmInformation(smContext.PDUSessionID)
+	smInfo.SetN2InfoContent(*n2InfoContent)
+	if smContext.Snssai != nil {
+		smInfo.SetSNssai(*smContext.Snssai)
+	}
+	n2InfoContainer := models.NewN2InfoContainer(models.N2INFORMATIONCLASS_SM)
+	n2InfoContainer.SetSmInfo(*smInfo)
+	jsonData.SetN2InfoContainer(*n2InfoContainer)
+	n1n2Request.SetJsonData(*jsonData)
+
+	smContext.SMLock.Lock()
+	rspData, err := consumer.SendN1N2TransferWithRediscovery(context.Background(), smContext, n1n2Request)
+	smContext.SMLock.Unlock()
+	if err != nil {
+		return err
+	}
+	if rspData.GetCause() == models.N1N2MESSAGETRANSFERCAUSE_N1_MSG_NOT_TRANSFERRED {
+		return fmt.Errorf("N1N2MessageTransfer failure, %v", rspData.Cause)
+	}
+	return nil
+}
@@ -6,8 +6,10 @@ package producer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/omec-project/nas/v2/nasType"
@@ -17,6 +19,7 @@ import (
 	"github.com/omec-project/smf/consumer"
 	smfContext "github.com/omec-project/smf/context"
 	"github.com/omec-project/smf/logger"
+	pfcp_message "github.com/omec-project/smf/pfcp/message"
 	"github.com/omec-project/smf/qos"
 	"github.com/omec-project/smf/transaction"
 	"github.com/omec-project/smf/util"
@@ -28,6 +31,8 @@ var (
 	SendRemoveSubscription              = consumer.SendRemoveSubscription
 )
 
+var errPfcpSessionModify = errors.New("pfcp session modify error")
+
 func HandleSMPolicyUpdateNotify(eventData interface{}) error {
 	txn := eventData.(*transaction.Transaction)
 	request := txn.Req.(models.SmPolicyNotification)
@@ -37,6 +42,26 @@ func HandleSMPolicyUpdateNotify(eventData interface{}) error {
 
 	smContext.SMLock.Lock()
 
+	if err := enforceSmPolicyDecision(smContext, request.SmPolicyDecision); err != nil {
+		if errors.Is(err, errPfcpSessionModify) {
+			txn.Rsp = makePduCtxtModifyErrRsp(smContext, err.Error())
+		}
+		txn.Err = err
+		return err
+	}
+
+	txn.Rsp = &httpwrapper.Response{
+		Status: http.StatusOK,
+		Body:   nil,
+	}
+
+	return nil
+}
+
+// enforceSmPolicyDecision applies the SM policy decision received from the PCF
+// on the UPF and, unless only the user plane is concerned, towards the UE and RAN.
+// It is called with the SM context locked and returns with it unlocked.
+func enforceSmPolicyDecision(smContext *smfContext.SMContext, smPolicyDecision *models.SmPolicyDecision) error {
 	if smContext.SMContextState != smfContext.SmStateActive {
 		logger.PduSessLog.Warnf("SMContext[%s-%02d] should be SmStateActive, but actual %s",
 			smContext.Supi, smContext.PDUSessionID, smContext.SMContextState.String())
@@ -45,10 +70,14 @@ func HandleSMPolicyUpdateNotify(eventData interface{}) error {
 	logger.PduSessLog.Infof("Building SM Policy Update for UE [%s], PDU Session ID [%d]",
 		smContext.Supi, smContext.PDUSessionID)
 
-	policyUpdates := qos.BuildSmPolicyUpdate(&smContext.SmPolicyData, request.SmPolicyDecision)
+	policyUpdates := qos.BuildSmPolicyUpdate(&smContext.SmPolicyData, smPolicyDecision)
 
 	smContext.SmPolicyUpdates = append(smContext.SmPolicyUpdates[:0], policyUpdates)
 
+	// Flow status and usage monitoring changes are enforced by the UPF alone,
+	// the UE and RAN are not involved
+	userPlaneOnly := policyUpdates.IsUserPlaneOnlyUpdate(&smContext.SmPolicyData)
+
 	// Build PFCP params while locked (if it reads shared state)
 	pfcpParam := BuildPfcpParam(smContext)
 
@@ -57,7 +86,11 @@ func HandleSMPolicyUpdateNotify(eventData interface{}) error {
 
 	smContext.SMLock.Unlock()
 
-	if err := SendPfcpSessionModifyReq(smContext, pfcpParam); err != nil {
+	sendModifyReq := SendPfcpSessionModifyReq
+	if userPlaneOnly {
+		sendModifyReq = sendUserPlaneModifyReq
+	}
+	if err := sendModifyReq(smContext, pfcpParam); err != nil {
 		smContext.SMLock.Lock()
 
 		smContext.SubCtxLog.Errorf("PFCP session modify error: %v", err)
@@ -67,19 +100,22 @@ func HandleSMPolicyUpdateNotify(eventData interface{}) error {
 
 		smContext.SMLock.Unlock()
 
-		httpResponse := makePduCtxtModifyErrRsp(smContext, err.Error())
-		txn.Err = err
-		txn.Rsp = httpResponse
-		return err
+		return fmt.Errorf("%w: %v", errPfcpSessionModify, err)
 	}
 
 	logger.PduSessLog.Infof("PFCP modify successful for UE [%s], PDU Session ID [%d]",
 		smContext.Supi, smContext.PDUSessionID)
 
-	if err := BuildAndSendQosN1N2TransferMsg(smContext); err != nil {
-		logger.PduSessLog.Errorf("Failed to build/send N1/N2 QoS transfer message: %v", err)
-		txn.Err = err
-		return err
+	if !userPlaneOnly {
+		if err := BuildAndSendQosN1N2TransferMsg(smContext); err != nil {
+			logger.PduSessLog.Errorf("Failed to build/send N1/N2 QoS transfer message: %v", err)
+			return err
+		}
+	}
+
+	// Commit the enforced decision, arming the timers of the PCC rule conditions
+	if err := smContext.CommitSmPolicyDecision(true); err != nil {
+		smContext.SubPfcpLog.Errorf("CommitSmPolicyDecision failed, %v", err)
 	}
 
 	smContext.SMLock.Lock()
@@ -90,11 +126,6 @@ func HandleSMPolicyUpdateNotify(eventData interface{}) error {
 
 	smContext.SMLock.Unlock()
 
-	txn.Rsp = &httpwrapper.Response{
-		Status: http.StatusOK,
-		Body:   nil,
-	}
-
 	return nil
 }
 
@@ -119,6 +150,22 @@ func BuildPfcpParam(smContext *smfContext.SMContext) *pfcpParam {
 	// Initialize map to track UPFs pending PFCP configuration
 	smContext.PendingUPF = make(smfContext.PendingUPF)
 
+	// A flow status change only needs the gates of the installed QERs updated,
+	// a usage monitoring change the URRs of the installed PDRs
+	if len(smContext.SmPolicyUpdates) > 0 &&
+		smContext.SmPolicyUpdates[0].IsUserPlaneOnlyUpdate(&smContext.SmPolicyData) {
+		if smContext.SmPolicyUpdates[0].TCUpdate != nil {
+			pfcpParam.qerList = smContext.UpdatePccRuleGateStatus(smContext.SmPolicyUpdates[0].TCUpdate.GetModified())
+		}
+		pfcpParam.pdrList = installedPDRs(smContext.UpdateUsageMonitoringURRs())
+		logger.PduSessLog.Infof("[BuildPfcpParam] user plane update, %d QER(s) and %d PDR(s) to update",
+			len(pfcpParam.qerList), len(pfcpParam.pdrList))
+		for nodeIP := range splitUserPlaneUpdate(smContext, pfcpParam) {
+			smContext.PendingUPF[nodeIP] = true
+		}
+		return pfcpParam
+	}
+
 	// Determine if we only need to release existing rules (no new policy).
 	// A valid rule is one where both the map key and PccRuleId are non-empty.
 	// Release-only when PccRules is present but contains no valid rules.
@@ -143,6 +190,13 @@ func BuildPfcpParam(smContext *smfContext.SMContext) *pfcpParam {
 	}
 	logger.PduSessLog.Infof("[BuildPfcpParam] Using PCC RuleId=%s, releaseOnly=%v", ruleid, shouldSendReleaseOnly)
 
+	// PCC rules outside their condition data time window are prepared but
+	// installed on the UPF only once the activation time is reached
+	ruleActive := shouldSendReleaseOnly || smContext.IsPccRuleActive(ruleid)
+	if !ruleActive {
+		logger.PduSessLog.Infof("[BuildPfcpParam] PCC RuleId=%s not active yet, deferring installation", ruleid)
+	}
+
 	// Iterate over all active data paths in the SM context
 	for dpIndex, dataPath := range smContext.Tunnel.DataPathPool {
 		logger.PduSessLog.Infof("[BuildPfcpParam] Processing DataPath[%d], Activated=%v", dpIndex, dataPath.Activated)
@@ -164,6 +218,11 @@ func BuildPfcpParam(smContext *smfContext.SMContext) *pfcpParam {
 			} else {
 				logger.PduSessLog.Infof("[BuildPfcpParam] Created %d dedicated QER(s)", len(dedQERs))
 			}
+			// Gate the dedicated QERs as per the PCC rule flow status
+			gateStatus := smContext.PccRuleGateStatus(ruleid)
+			for _, qer := range dedQERs {
+				qer.GateStatus = &smfContext.GateStatus{ULGate: gateStatus.ULGate, DLGate: gateStatus.DLGate}
+			}
 
 			if err := dataPath.ActivateUlDlTunnel(smContext); err != nil {
 				logger.PduSessLog.Errorf("activate UL/DL tunnel error %v", err.Error())
@@ -225,19 +284,21 @@ func BuildPfcpParam(smContext *smfContext.SMContext) *pfcpParam {
 			}
 
 			// Append to PFCP param lists
-			pfcpParam.pdrList = append(pfcpParam.pdrList, dlPDR)
-			if dlFAR != nil {
-				pfcpParam.farList = append(pfcpParam.farList, dlFAR)
-			} else {
-				logger.PduSessLog.Errorf("dlPDR.FAR is nil")
-			}
-			if len(dedQERs) > 0 {
-				pfcpParam.qerList = append(pfcpParam.qerList, dedQERs...)
-			} else {
-				logger.PduSessLog.Errorf("dedicated QER is nil")
-			}
+			if ruleActive {
+				pfcpParam.pdrList = append(pfcpParam.pdrList, dlPDR)
+				if dlFAR != nil {
+					pfcpParam.farList = append(pfcpParam.farList, dlFAR)
+				} else {
+					logger.PduSessLog.Errorf("dlPDR.FAR is nil")
+				}
+				if len(dedQERs) > 0 {
+					pfcpParam.qerList = append(pfcpParam.qerList, dedQERs...)
+				} else {
+					logger.PduSessLog.Errorf("dedicated QER is nil")
+				}
 
-			smContext.PendingUPF[ANUPF.GetNodeIP()] = true
+				smContext.PendingUPF[ANUPF.GetNodeIP()] = true
+			}
 		}
 
 		// ----------------------
@@ -278,13 +339,24 @@ func BuildPfcpParam(smContext *smfContext.SMContext) *pfcpParam {
 			}
 			ulFAR := ulPDR.FAR
 			if ulFAR != nil {
+				var redirectInfo *smfContext.RedirectInformation
+				if ulFAR.ForwardingParameters != nil {
+					redirectInfo = ulFAR.ForwardingParameters.RedirectInformation
+				}
 				ulFAR.ApplyAction = smfContext.ApplyAction{Forw: true}
 				ulFAR.ForwardingParameters = &smfContext.ForwardingParameters{
 					DestinationInterface: smfContext.DestinationInterface{
 						InterfaceValue: smfContext.DestinationInterfaceCore,
 					},
-					NetworkInstance: []byte(smContext.Dnn),
+					NetworkInstance:     []byte(smContext.Dnn),
+					RedirectInformation: redirectInfo,
 				}
+				// Install or withdraw HTTP redirection as requested by the PCF
+				ulFAR.UpdateRedirectInformation(smContext.PccRuleRedirectInformation(ruleid))
+			}
+
+			if !ruleActive {
+				continue
 			}
 
 			// Append to PFCP param lists
@@ -300,9 +372,105 @@ func BuildPfcpParam(smContext *smfContext.SMContext) *pfcpParam {
 		}
 	}
 
+	// Installed PDRs whose URRs changed as per the usage monitoring data
+	for _, pdr := range installedPDRs(smContext.UpdateUsageMonitoringURRs()) {
+		if !slices.Contains(pfcpParam.pdrList, pdr) && !slices.Contains(pfcpParam.removePDR, pdr) {
+			pfcpParam.pdrList = append(pfcpParam.pdrList, pdr)
+			if defaultPath := smContext.Tunnel.DataPathPool.GetDefaultPath(); defaultPath != nil && defaultPath.FirstDPNode != nil {
+				smContext.PendingUPF[defaultPath.FirstDPNode.GetNodeIP()] = true
+			}
+		}
+	}
+
 	return pfcpParam
 }
 
+// userPlaneUpdate is the part of a user plane only update held by a UPF
+type userPlaneUpdate struct {
+	node  *smfContext.DataPathNode
+	param *pfcpParam
+}
+
+// splitUserPlaneUpdate splits the QERs and PDRs of a user plane only update
+// per UPF IP, over every node of the activated data paths such as the ULCL,
+// the I-UPF or the PSA
+func splitUserPlaneUpdate(smContext *smfContext.SMContext, param *pfcpParam) map[string]*userPlaneUpdate {
+	qers := make(map[*smfContext.QER]bool, len(param.qerList))
+	for _, qer := range param.qerList {
+		qers[qer] = true
+	}
+	pdrs := make(map[*smfContext.PDR]bool, len(param.pdrList))
+	for _, pdr := range param.pdrList {
+		pdrs[pdr] = true
+	}
+
+	updates := make(map[string]*userPlaneUpdate)
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		if !dataPath.Activated {
+			continue
+		}
+		for node := dataPath.FirstDPNode; node != nil; node = node.Next() {
+			if node.UPF == nil {
+				continue
+			}
+			for _, tunnel := range []*smfContext.GTPTunnel{node.UpLinkTunnel, node.DownLinkTunnel} {
+				if tunnel == nil {
+					continue
+				}
+				for _, pdr := range tunnel.PDR {
+					update := updates[node.GetNodeIP()]
+					if update == nil {
+						update = &userPlaneUpdate{node: node, param: &pfcpParam{}}
+					}
+					if pdrs[pdr] {
+						delete(pdrs, pdr)
+						update.param.pdrList = append(update.param.pdrList, pdr)
+					}
+					for _, qer := range pdr.QER {
+						if qers[qer] {
+							delete(qers, qer)
+							update.param.qerList = append(update.param.qerList, qer)
+						}
+					}
+					if len(update.param.pdrList) > 0 || len(update.param.qerList) > 0 {
+						updates[node.GetNodeIP()] = update
+					}
+				}
+			}
+		}
+	}
+	return updates
+}
+
+// sendUserPlaneModifyReq sends the QERs and PDRs of a user plane only update
+// to each UPF holding them and waits for all of them to answer
+func sendUserPlaneModifyReq(smContext *smfContext.SMContext, param *pfcpParam) error {
+	updates := splitUserPlaneUpdate(smContext, param)
+	if len(updates) == 0 {
+		return nil
+	}
+	for nodeIP, update := range updates {
+		upf := update.node.UPF
+		if err := pfcp_message.SendPfcpSessionModificationRequest(upf.NodeID, smContext, update.param.pdrList,
+			nil, nil, update.param.qerList, nil, nil, nil, upf.Port); err != nil {
+			smContext.SubCtxLog.Errorf("pfcp session modification of UPF [%s] failure: %+v", nodeIP, err)
+		}
+	}
+	return waitPfcpSessionModifyRsp(smContext)
+}
+
+// installedPDRs filters out the PDRs not yet created on the UPF, their URRs
+// are provisioned when they get created.
+func installedPDRs(pdrList []*smfContext.PDR) []*smfContext.PDR {
+	installed := make([]*smfContext.PDR, 0, len(pdrList))
+	for _, pdr := range pdrList {
+		if pdr.State != smfContext.RULE_INITIAL {
+			installed = append(installed, pdr)
+		}
+	}
+	return installed
+}
+
 // 3GPP Reference: TS 23.502 §4.3.3.4 – "PDU Session Modification" procedure
 func BuildAndSendQosN1N2TransferMsg(smContext *smfContext.SMContext) error {
 	// -------------------------------
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package producer
+
+import (
+	"testing"
+
+	smf_context "github.com/omec-project/smf/context"
+)
+
+func TestSplitUserPlaneUpdate(t *testing.T) {
+	iupfQER := &smf_context.QER{QERID: 1}
+	psaQER := &smf_context.QER{QERID: 2}
+	psaPDR := &smf_context.PDR{PDRID: 2, QER: []*smf_context.QER{psaQER}}
+
+	iupf := smf_context.NewDataPathNode()
+	iupf.UPF = &smf_context.UPF{NodeID: *smf_context.NewNodeID("10.0.0.1")}
+	iupf.UpLinkTunnel.PDR["rule-1"] = &smf_context.PDR{PDRID: 1, QER: []*smf_context.QER{iupfQER}}
+	psa := smf_context.NewDataPathNode()
+	psa.UPF = &smf_context.UPF{NodeID: *smf_context.NewNodeID("10.0.0.2")}
+	psa.UpLinkTunnel.PDR["rule-1"] = psaPDR
+	iupf.AddNext(psa)
+	psa.AddPrev(iupf)
+
+	smContext := &smf_context.SMContext{Tunnel: smf_context.NewUPTunnel()}
+	smContext.Tunnel.AddDataPath(&smf_context.DataPath{Activated: true, IsDefaultPath: true, FirstDPNode: iupf})
+
+	updates := splitUserPlaneUpdate(smContext, &pfcpParam{
+		qerList: []*smf_context.QER{iupfQER, psaQER},
+		pdrList: []*smf_context.PDR{psaPDR},
+	})
+	if len(updates) != 2 {
+		t.Fatalf("expected the update split over the I-UPF and the PSA, got %d UPF(s)", len(updates))
+	}
+	if update := updates["10.0.0.1"]; update == nil || len(update.param.qerList) != 1 ||
+		update.param.qerList[0] != iupfQER || len(update.param.pdrList) != 0 {
+		t.Errorf("expected the I-UPF QER alone on the I-UPF, got %+v", update)
+	}
+	if update := updates["10.0.0.2"]; update == nil || len(update.param.qerList) != 1 ||
+		update.param.qerList[0] != psaQER || len(update.param.pdrList) != 1 {
+		t.Errorf("expected the PSA QER and PDR on the PSA, got %+v", update)
+	}
+}
@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package producer
+
+import (
+	"fmt"
+
+	smfContext "github.com/omec-project/smf/context"
+	"github.com/omec-project/smf/logger"
+)
+
+// HandleConditionEvent installs or removes on the UPF the PCC rules referring
+// to the condition data once its activation or deactivation time is reached.
+// The event waits for the PDU session to be Active and is dropped on release.
+func HandleConditionEvent(smContext *smfContext.SMContext, condId string, activate bool) {
+	reason := fmt.Sprintf("condition data [%s] event", condId)
+	whenActive(smContext, reason, smfContext.SmStatePfcpModify, func() {
+		applyConditionEvent(smContext, condId, activate)
+	})
+}
+
+func applyConditionEvent(smContext *smfContext.SMContext, condId string, activate bool) {
+	smContext.SMLock.Lock()
+	pfcpParam := buildConditionPfcpParam(smContext, condId, activate)
+	if len(pfcpParam.pdrList) == 0 && len(pfcpParam.removePDR) == 0 {
+		smContext.SubQosLog.Infof("condition data [%s] event, no PCC rule to update", condId)
+		smContext.ChangeState(smfContext.SmStateActive)
+		smContext.SMLock.Unlock()
+		return
+	}
+	smContext.SMLock.Unlock()
+
+	err := SendPfcpSessionModifyReq(smContext, pfcpParam)
+
+	smContext.SMLock.Lock()
+	if err != nil {
+		smContext.SubQosLog.Errorf("condition data [%s] PFCP session modify error: %v", condId, err)
+		if activate {
+			// not created on the UPF, the next activation creates them again
+			resetConditionRules(pfcpParam.pdrList, pfcpParam.farList, pfcpParam.qerList)
+		}
+	} else {
+		logger.PduSessLog.Infof("condition data [%s] activate [%v] applied for UE [%s], PDU Session ID [%d]",
+			condId, activate, smContext.Supi, smContext.PDUSessionID)
+		if !activate {
+			// removed from the UPF, a later activation creates them again
+			resetConditionRules(pfcpParam.removePDR, pfcpParam.removeFAR, pfcpParam.removeQER)
+		}
+	}
+	if smContext.SMContextState == smfContext.SmStatePfcpModify {
+		smContext.ChangeState(smfContext.SmStateActive)
+	}
+	smContext.SMLock.Unlock()
+}
+
+// buildConditionPfcpParam collects the PDRs, FARs and QERs of the PCC rules
+// referring to the condition data, to be created on activation or removed on
+// deactivation. Their state is left to the PFCP session modification result.
+func buildConditionPfcpParam(smContext *smfContext.SMContext, condId string, activate bool) *pfcpParam {
+	pfcpParam := &pfcpParam{
+		pdrList:   []*smfContext.PDR{},
+		farList:   []*smfContext.FAR{},
+		qerList:   []*smfContext.QER{},
+		removePDR: []*smfContext.PDR{},
+		removeFAR: []*smfContext.FAR{},
+		removeQER: []*smfContext.QER{},
+	}
+	smContext.PendingUPF = make(smfContext.PendingUPF)
+
+	for _, ruleName := range smContext.PccRulesWithCondData(condId) {
+		// the condition may have been updated since the timer was armed
+		if smContext.IsPccRuleActive(ruleName) != activate {
+			continue
+		}
+
+		for _, dataPath := range smContext.Tunnel.DataPathPool {
+			if !dataPath.Activated {
+				continue
+			}
+			ANUPF := dataPath.FirstDPNode
+			for _, tunnel := range []*smfContext.GTPTunnel{ANUPF.UpLinkTunnel, ANUPF.DownLinkTunnel} {
+				pdr, ok := tunnel.PDR[ruleName]
+				if !ok || pdr == nil {
+					continue
+				}
+
+				if activate {
+					if pdr.State != smfContext.RULE_INITIAL {
+						continue
+					}
+					pfcpParam.pdrList = append(pfcpParam.pdrList, pdr)
+					if pdr.FAR != nil {
+						pfcpParam.farList = append(pfcpParam.farList, pdr.FAR)
+					}
+					for _, qer := range pdr.QER {
+						// the QERs shared with other PDRs are already installed
+						if qer.State == smfContext.RULE_INITIAL {
+							pfcpParam.qerList = append(pfcpParam.qerList, qer)
+						}
+					}
+				} else {
+					if pdr.State == smfContext.RULE_INITIAL {
+						continue
+					}
+					pfcpParam.removePDR = append(pfcpParam.removePDR, pdr)
+					pfcpParam.removeQER = append(pfcpParam.removeQER, tunnel.PccRuleQERs(ruleName)...)
+					if pdr.FAR != nil {
+						pfcpParam.removeFAR = append(pfcpParam.removeFAR, pdr.FAR)
+					}
+				}
+				smContext.PendingUPF[ANUPF.GetNodeIP()] = true
+			}
+		}
+	}
+
+	return pfcpParam
+}
+
+// resetConditionRules sets the rules back to their initial state, no longer
+// or not yet installed on the UPF
+func resetConditionRules(pdrs []*smfContext.PDR, fars []*smfContext.FAR, qers []*smfContext.QER) {
+	for _, pdr := range pdrs {
+		pdr.State = smfContext.RULE_INITIAL
+	}
+	for _, far := range fars {
+		far.State = smfContext.RULE_INITIAL
+	}
+	for _, qer := range qers {
+		qer.State = smfContext.RULE_INITIAL
+	}
+}
@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package producer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/omec-project/openapi/v2/models"
+	smf_context "github.com/omec-project/smf/context"
+)
+
+func TestBuildConditionPfcpParamKeepsRuleStates(t *testing.T) {
+	smContext := smf_context.NewSMContext("imsi-208930000000001", 1)
+	past := models.NewConditionData("cond-1")
+	past.SetDeactivationTime(time.Now().Add(-time.Hour))
+	smContext.SmPolicyData.SmCtxtCondData.CondData["cond-1"] = past
+	smContext.SmPolicyData.SmCtxtPccRules.PccRules["rule-1"] = &models.PccRule{PccRuleId: "rule-1"}
+	smContext.SmPolicyData.SmCtxtPccRules.PccRules["rule-1"].SetRefCondData("cond-1")
+
+	qer := &smf_context.QER{QERID: 1, State: smf_context.RULE_CREATE}
+	far := &smf_context.FAR{FARID: 1, State: smf_context.RULE_CREATE}
+	pdr := &smf_context.PDR{PDRID: 1, FAR: far, QER: []*smf_context.QER{qer}, State: smf_context.RULE_CREATE}
+	node := smf_context.NewDataPathNode()
+	node.UPF = &smf_context.UPF{NodeID: *smf_context.NewNodeID("10.0.0.1")}
+	node.UpLinkTunnel.PDR["rule-1"] = pdr
+	smContext.Tunnel = smf_context.NewUPTunnel()
+	smContext.Tunnel.AddDataPath(&smf_context.DataPath{Activated: true, IsDefaultPath: true, FirstDPNode: node})
+
+	param := buildConditionPfcpParam(smContext, "cond-1", false)
+	if len(param.removePDR) != 1 || len(param.removeFAR) != 1 || len(param.removeQER) != 1 {
+		t.Fatalf("expected the PCC rule removed, got %+v", param)
+	}
+	if pdr.State != smf_context.RULE_CREATE || far.State != smf_context.RULE_CREATE || qer.State != smf_context.RULE_CREATE {
+		t.Errorf("expected the rules left installed until the UPF answers")
+	}
+
+	resetConditionRules(param.removePDR, param.removeFAR, param.removeQER)
+	if pdr.State != smf_context.RULE_INITIAL || far.State != smf_context.RULE_INITIAL || qer.State != smf_context.RULE_INITIAL {
+		t.Errorf("expected the removed rules back to their initial state")
+	}
+}
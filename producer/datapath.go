@@ -22,6 +22,9 @@ type PFCPState struct {
 func SendPFCPRules(smContext *context.SMContext) {
 	pfcpPool := make(map[string]*PFCPState)
 
+	// Associate the PDRs with the URRs of the PCF usage monitoring data
+	smContext.UpdateUsageMonitoringURRs()
+
 	for _, dataPath := range smContext.Tunnel.DataPathPool {
 		if dataPath.Activated {
 			for curDataPathNode := dataPath.FirstDPNode; curDataPathNode != nil; curDataPathNode = curDataPathNode.Next() {
@@ -30,7 +33,11 @@ func SendPFCPRules(smContext *context.SMContext) {
 				qerList := make([]*context.QER, 0, 2)
 
 				if curDataPathNode.UpLinkTunnel != nil && curDataPathNode.UpLinkTunnel.PDR != nil {
-					for _, pdr := range curDataPathNode.UpLinkTunnel.PDR {
+					for name, pdr := range curDataPathNode.UpLinkTunnel.PDR {
+						// PCC rules outside their condition data time window are installed later
+						if !smContext.IsPccRuleActive(name) {
+							continue
+						}
 						pdrList = append(pdrList, pdr)
 						farList = append(farList, pdr.FAR)
 						if pdr.QER != nil {
@@ -39,7 +46,11 @@ func SendPFCPRules(smContext *context.SMContext) {
 					}
 				}
 				if curDataPathNode.DownLinkTunnel != nil && curDataPathNode.DownLinkTunnel.PDR != nil {
-					for _, pdr := range curDataPathNode.DownLinkTunnel.PDR {
+					for name, pdr := range curDataPathNode.DownLinkTunnel.PDR {
+						// PCC rules outside their condition data time window are installed later
+						if !smContext.IsPccRuleActive(name) {
+							continue
+						}
 						pdrList = append(pdrList, pdr)
 						farList = append(farList, pdr.FAR)
 
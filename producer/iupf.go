@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package producer
+
+import (
+	"time"
+
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/openapi/v2/models"
+	smf_context "github.com/omec-project/smf/context"
+	"github.com/omec-project/smf/pfcp/message"
+)
+
+// iUpfChangeRetryInterval is the interval between the attempts to change the
+// I-UPF of a PDU session whose handover is not over
+const iUpfChangeRetryInterval = 500 * time.Millisecond
+
+// checkIUpfChange starts the change of the I-UPF of the PDU session if the
+// UPF serving the previous AN does not serve the AN of the path switch or
+// handover. The caller holds the SMLock.
+func checkIUpfChange(smContext *smf_context.SMContext) {
+	if smContext.TargetUserPlanePath(smContext.Tunnel.ANInformation.IPAddress) == nil {
+		return
+	}
+	go changeIUpf(smContext)
+}
+
+// changeIUpf inserts, relocates or removes the I-UPF between the AN and the
+// PSA of the PDU session, TS 23.502 4.9.1.3. The PFCP session of the new
+// I-UPF is established first, the downlink of the PSA is then moved to it
+// and the AN gets its uplink tunnel before the PFCP session of the previous
+// I-UPF is deleted.
+func changeIUpf(smContext *smf_context.SMContext) {
+	smContext.SMLock.Lock()
+	state := smContext.SMContextState
+	if state == smf_context.SmStateRelease || smContext.Tunnel == nil {
+		smContext.SMLock.Unlock()
+		return
+	}
+	if state != smf_context.SmStateActive {
+		smContext.SMLock.Unlock()
+		smContext.SubPduSessLog.Debugf("I-UPF change in state %s, retry in %v", state.String(), iUpfChangeRetryInterval)
+		time.AfterFunc(iUpfChangeRetryInterval, func() {
+			changeIUpf(smContext)
+		})
+		return
+	}
+	path := smContext.TargetUserPlanePath(smContext.Tunnel.ANInformation.IPAddress)
+	if path == nil {
+		smContext.SMLock.Unlock()
+		return
+	}
+	change, err := smContext.ChangeIUpf(path)
+	if err != nil {
+		smContext.SMLock.Unlock()
+		smContext.SubPduSessLog.Errorf("I-UPF change failed: %v", err)
+		return
+	}
+
+	if inserted := change.Inserted; inserted != nil {
+		pdrs, fars, qers := dataPathNodeRules(inserted)
+		smContext.ChangeState(smf_context.SmStatePfcpCreatePending)
+		smContext.SMLock.Unlock()
+		smContext.SubPduSessLog.Infof("inserting I-UPF[%s]", inserted.GetNodeIP())
+		result := smf_context.SessionEstablishFailed
+		if err = message.SendPfcpSessionEstablishmentRequest(inserted.UPF.NodeID, smContext, pdrs, fars, nil, qers,
+			inserted.UPF.Port); err != nil {
+			smContext.SubPduSessLog.Errorf("send PFCP session establishment request failed: %v", err)
+		} else {
+			result = <-smContext.SBIPFCPCommunicationChan
+		}
+		smContext.SMLock.Lock()
+		if result != smf_context.SessionEstablishSuccess {
+			smContext.SubPduSessLog.Errorf("I-UPF[%s] insertion failed", inserted.GetNodeIP())
+			smContext.RevertIUpfChange(change)
+			smContext.ChangeState(smf_context.SmStateActive)
+			smContext.SMLock.Unlock()
+			return
+		}
+	}
+
+	anchor := change.Anchor
+	fars, err := smContext.UpdateAnchorDownlink(change)
+	if err != nil {
+		smContext.ChangeState(smf_context.SmStateActive)
+		smContext.SMLock.Unlock()
+		smContext.SubPduSessLog.Errorf("PSA downlink update failed: %v", err)
+		releasePDUSessionByNetwork(smContext, "I-UPF change failure", nasMessage.Cause5GSMReactivationRequested)
+		return
+	}
+	smContext.PendingUPF = smf_context.PendingUPF{anchor.GetNodeIP(): true}
+	smContext.ChangeState(smf_context.SmStatePfcpModify)
+	smContext.SMLock.Unlock()
+	result := smf_context.SessionUpdateFailed
+	if err = message.SendPfcpSessionModificationRequest(anchor.UPF.NodeID, smContext, nil, fars, nil, nil, nil, nil, nil,
+		anchor.UPF.Port); err != nil {
+		smContext.SubPduSessLog.Errorf("send PFCP session modification request failed: %v", err)
+	} else {
+		result = <-smContext.SBIPFCPCommunicationChan
+	}
+
+	smContext.SMLock.Lock()
+	smContext.ChangeState(smf_context.SmStateActive)
+	upCnxState := smContext.UpCnxState
+	smContext.SMLock.Unlock()
+	if result != smf_context.SessionUpdateSuccess {
+		// the user plane of the PDU session is left inconsistent
+		releasePDUSessionByNetwork(smContext, "I-UPF change failure", nasMessage.Cause5GSMReactivationRequested)
+		return
+	}
+	if upCnxState != models.UPCNXSTATE_DEACTIVATED {
+		if err = sendUlTunnelModifyN1N2Transfer(smContext); err != nil {
+			smContext.SubPduSessLog.Errorf("I-UPF change, N1N2 transfer failed: %v", err)
+		}
+	}
+
+	if removed := change.Removed; removed != nil {
+		smContext.SMLock.Lock()
+		smContext.PendingUPF = smf_context.PendingUPF{removed.GetNodeIP(): true}
+		smContext.ChangeState(smf_context.SmStatePfcpRelease)
+		smContext.SMLock.Unlock()
+		smContext.SubPduSessLog.Infof("removing I-UPF[%s]", removed.GetNodeIP())
+		if err = message.SendPfcpSessionDeletionRequest(removed.UPF.NodeID, smContext, removed.UPF.Port); err != nil {
+			smContext.SubPduSessLog.Errorf("send PFCP session deletion request failed: %v", err)
+		} else {
+			<-smContext.SBIPFCPCommunicationChan
+		}
+		smContext.SMLock.Lock()
+		smContext.ReleaseIUpf(removed)
+		smContext.ChangeState(smf_context.SmStateActive)
+		smContext.SMLock.Unlock()
+	}
+}
+
+// dataPathNodeRules returns the PFCP rules of the uplink and downlink
+// tunnels of the node
+func dataPathNodeRules(node *smf_context.DataPathNode) ([]*smf_context.PDR, []*smf_context.FAR, []*smf_context.QER) {
+	pdrs := make([]*smf_context.PDR, 0, 2)
+	fars := make([]*smf_context.FAR, 0, 2)
+	qers := make([]*smf_context.QER, 0, 2)
+	for _, tunnel := range []*smf_context.GTPTunnel{node.UpLinkTunnel, node.DownLinkTunnel} {
+		for _, pdr := range tunnel.PDR {
+			pdrs = append(pdrs, pdr)
+			fars = append(fars, pdr.FAR)
+			qers = append(qers, pdr.QER...)
+		}
+	}
+	return pdrs, fars, qers
+}
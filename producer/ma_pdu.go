@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package producer
+
+import (
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/consumer"
+	smf_context "github.com/omec-project/smf/context"
+	"github.com/omec-project/smf/transaction"
+	"github.com/omec-project/smf/util"
+)
+
+// handleMaPduEstablishmentRequest sets up the user plane of the MA PDU
+// session over the access the UE sent the PDU Session Establishment Request
+// over, TS 23.502 4.22.7. The UPF allocates the tunnel endpoint of the access
+// in the PFCP Session Modification Response, the PDU Session Establishment
+// Accept is sent once it is received.
+func handleMaPduEstablishmentRequest(txn *transaction.Transaction, response *models.UpdateSmContext200Response,
+	pfcpAction *pfcpAction, pfcpParam *pfcpParam, pti uint8,
+) {
+	body := txn.Req.(models.UpdateSmContextRequest)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+	smContextUpdateData := body.JsonData
+
+	anType := smContextUpdateData.GetAnType()
+	smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, MA PDU session request over %s", anType)
+	if smContext.Tunnel == nil {
+		rejectMaPduEstablishmentRequest(smContext, response, pti)
+		return
+	}
+	pdrs, fars, err := smContext.AddAccessLeg(anType, smContextUpdateData.GetRatType(), pti)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, user plane over %s not set up: %v", anType, err)
+		rejectMaPduEstablishmentRequest(smContext, response, pti)
+		return
+	}
+
+	pfcpParam.pdrList = append(pfcpParam.pdrList, pdrs...)
+	pfcpParam.farList = append(pfcpParam.farList, fars...)
+	smContext.PendingUPF = make(smf_context.PendingUPF)
+	smContext.PendingUPF[smContext.AccessLeg(anType).Node.GetNodeIP()] = true
+	pfcpAction.sendPfcpModify = true
+	pfcpAction.buildAccessLegAccept = true
+	smContext.ChangeState(smf_context.SmStatePfcpModify)
+	smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
+}
+
+func rejectMaPduEstablishmentRequest(smContext *smf_context.SMContext, response *models.UpdateSmContext200Response, pti uint8) {
+	smContext.Pti = pti
+	buf, err := smf_context.BuildGSMPDUSessionEstablishmentReject(smContext, nasMessage.Cause5GSMInsufficientResources)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build GSM PDUSessionEstablishmentReject failed: %+v", err)
+		return
+	}
+	tmpFile, err := util.CreatePayloadTempFile(buf)
+	if err != nil {
+		smContext.SubPduSessLog.Errorln(err)
+		return
+	}
+	response.BinaryDataN1SmMessage = &tmpFile
+	response.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: "PDUSessionEstablishmentReject"}
+	smContext.ChangeState(smf_context.SmStateModify)
+	smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
+}
+
+// setAccessLegEstablishmentAccept adds the PDU Session Establishment Accept
+// and the PDU Session Resource Setup Request Transfer of the access leg to
+// the response, then reports the access to the PCF
+func setAccessLegEstablishmentAccept(txn *transaction.Transaction, response *models.UpdateSmContext200Response) {
+	body := txn.Req.(models.UpdateSmContextRequest)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	leg := smContext.AccessLeg(body.JsonData.GetAnType())
+	if leg == nil {
+		return
+	}
+	if buf, err := smf_context.BuildGSMAccessLegEstablishmentAccept(smContext, leg); err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build GSM PDUSessionEstablishmentAccept failed: %+v", err)
+	} else if tmpFile, err := util.CreatePayloadTempFile(buf); err != nil {
+		smContext.SubPduSessLog.Errorln(err)
+	} else {
+		response.BinaryDataN1SmMessage = &tmpFile
+		response.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: "PDUSessionEstablishmentAccept"}
+	}
+
+	if buf, err := smf_context.BuildAccessLegResourceSetupRequestTransfer(smContext, leg); err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build PDUSession Resource Setup Request Transfer Error(%s)", err.Error())
+	} else if tmpFile, err := util.CreatePayloadTempFile(buf); err != nil {
+		smContext.SubPduSessLog.Errorln(err)
+	} else {
+		response.BinaryDataN2SmInformation = &tmpFile
+		response.JsonData.N2SmInfo = &models.RefToBinaryData{ContentId: "PDUSessionResourceSetupRequestTransfer"}
+		response.JsonData.N2SmInfoType = models.N2SMINFOTYPE_PDU_RES_SETUP_REQ.Ptr()
+		response.JsonData.UpCnxState = models.UPCNXSTATE_ACTIVATING.Ptr()
+		leg.UpCnxState = models.UPCNXSTATE_ACTIVATING
+	}
+	response.JsonData.SetMaAcceptedInd(true)
+
+	go reportMaPduAccess(smContext, leg.AnType, leg.RatType, false)
+}
+
+// activateUpCnxOverAccessLeg answers the UP connection activation over the
+// access of the access leg with the PDU Session Resource Setup Request
+// Transfer to its AN
+func activateUpCnxOverAccessLeg(smContext *smf_context.SMContext, response *models.UpdateSmContext200Response,
+	leg *smf_context.AccessLeg,
+) error {
+	n2Buf, err := smf_context.BuildAccessLegResourceSetupRequestTransfer(smContext, leg)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build PDUSession Resource Setup Request Transfer Error(%s)", err.Error())
+		return err
+	}
+	tmpFile, err := util.CreatePayloadTempFile(n2Buf)
+	if err != nil {
+		smContext.SubPduSessLog.Errorln(err)
+		return err
+	}
+	smContext.ChangeState(smf_context.SmStateModify)
+	smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
+	leg.UpCnxState = models.UPCNXSTATE_ACTIVATING
+	response.BinaryDataN2SmInformation = &tmpFile
+	response.JsonData.N2SmInfo = &models.RefToBinaryData{ContentId: "PDUSessionResourceSetupRequestTransfer"}
+	response.JsonData.N2SmInfoType = models.N2SMINFOTYPE_PDU_RES_SETUP_REQ.Ptr()
+	response.JsonData.UpCnxState = models.UPCNXSTATE_ACTIVATING.Ptr()
+	return nil
+}
+
+// activateAccessLeg handles the PDU Session Resource Setup Response Transfer
+// of the AN of the access leg
+func activateAccessLeg(txn *transaction.Transaction, pfcpAction *pfcpAction, pfcpParam *pfcpParam, leg *smf_context.AccessLeg) error {
+	body := txn.Req.(models.UpdateSmContextRequest)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	fileBytes, err := readBinaryN2SmInformation(body.BinaryDataN2SmInformation)
+	if err != nil {
+		smContext.SubCtxLog.Errorf("failed to read file: %v", err)
+		return err
+	}
+	pdrs, fars, err := smContext.ActivateAccessLeg(leg, fileBytes)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, handle PDUSessionResourceSetupResponseTransfer over %s failed: %+v",
+			leg.AnType, err)
+		return nil
+	}
+	setAccessLegPfcpModify(smContext, pfcpAction, pfcpParam, leg, pdrs, fars)
+	return nil
+}
+
+// deactivateAccessLeg buffers the downlink data of the access leg in the UPF
+// while its UP connection is deactivated
+func deactivateAccessLeg(smContext *smf_context.SMContext, pfcpAction *pfcpAction, pfcpParam *pfcpParam,
+	leg *smf_context.AccessLeg,
+) {
+	pdrs, fars := smContext.DeactivateAccessLeg(leg)
+	setAccessLegPfcpModify(smContext, pfcpAction, pfcpParam, leg, pdrs, fars)
+}
+
+func setAccessLegPfcpModify(smContext *smf_context.SMContext, pfcpAction *pfcpAction, pfcpParam *pfcpParam,
+	leg *smf_context.AccessLeg, pdrs []*smf_context.PDR, fars []*smf_context.FAR,
+) {
+	pfcpParam.pdrList = append(pfcpParam.pdrList, pdrs...)
+	pfcpParam.farList = append(pfcpParam.farList, fars...)
+	if smContext.PendingUPF == nil {
+		smContext.PendingUPF = make(smf_context.PendingUPF)
+	}
+	smContext.PendingUPF[leg.Node.GetNodeIP()] = true
+	pfcpAction.sendPfcpModify = true
+	smContext.ChangeState(smf_context.SmStatePfcpModify)
+	smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
+}
+
+// HandleUpdateMaRelease releases the user plane of the MA PDU session over
+// the access the AMF indicates, TS 23.502 4.22.7. The PDU session stays
+// over the other access.
+func HandleUpdateMaRelease(txn *transaction.Transaction, response *models.UpdateSmContext200Response,
+	pfcpAction *pfcpAction, pfcpParam *pfcpParam,
+) {
+	body := txn.Req.(models.UpdateSmContextRequest)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	var anType models.AccessType
+	switch body.JsonData.GetMaReleaseInd() {
+	case models.MARELEASEINDICATION_REL_MAPDU_OVER_3_GPP:
+		anType = models.ACCESSTYPE__3_GPP_ACCESS
+	case models.MARELEASEINDICATION_REL_MAPDU_OVER_N3_GPP:
+		anType = models.ACCESSTYPE_NON_3_GPP_ACCESS
+	default:
+		return
+	}
+	if smContext.MaPdu == nil || smContext.Tunnel == nil {
+		return
+	}
+	leg := smContext.AccessLeg(anType)
+	if leg == nil && anType == smContext.AnType {
+		leg = smContext.AccessLeg(otherAccessType(anType))
+	}
+	if leg == nil {
+		// no user plane over the access, or it is the only one left
+		return
+	}
+	smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, release MA PDU session over %s", anType)
+	node := leg.Node
+	ratType := smContext.RatType
+	if anType == leg.AnType {
+		ratType = leg.RatType
+	}
+
+	pdrs, fars, removePDRs, removeFARs := smContext.ReleaseAccessLeg(anType)
+	pfcpParam.pdrList = append(pfcpParam.pdrList, pdrs...)
+	pfcpParam.farList = append(pfcpParam.farList, fars...)
+	pfcpParam.removePDR = append(pfcpParam.removePDR, removePDRs...)
+	pfcpParam.removeFAR = append(pfcpParam.removeFAR, removeFARs...)
+	if smContext.PendingUPF == nil {
+		smContext.PendingUPF = make(smf_context.PendingUPF)
+	}
+	smContext.PendingUPF[node.GetNodeIP()] = true
+	pfcpAction.sendPfcpModify = true
+	smContext.ChangeState(smf_context.SmStatePfcpModify)
+	smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
+	response.JsonData.UpCnxState = smContext.UpCnxState.Ptr()
+
+	go reportMaPduAccess(smContext, anType, ratType, true)
+}
+
+func otherAccessType(anType models.AccessType) models.AccessType {
+	if anType == models.ACCESSTYPE_NON_3_GPP_ACCESS {
+		return models.ACCESSTYPE__3_GPP_ACCESS
+	}
+	return models.ACCESSTYPE_NON_3_GPP_ACCESS
+}
+
+// reportMaPduAccess reports the access added to or released from the MA PDU
+// session to the PCF, then enforces the SM policy decision returned by the
+// PCF
+func reportMaPduAccess(smContext *smf_context.SMContext, anType models.AccessType, ratType models.RatType, release bool) {
+	smPolicyDecision, httpStatus, err := consumer.SendSMPolicyAssociationUpdateByMaPduAccess(smContext, anType, ratType, release)
+	if err != nil {
+		smContext.SubQosLog.Errorf("MA PDU access report to PCF failed, status [%d]: %v", httpStatus, err)
+		return
+	}
+	if smPolicyDecision == nil {
+		return
+	}
+
+	smContext.SMLock.Lock()
+	if !hasPolicyData(smPolicyDecision) {
+		if smPolicyDecision.PolicyCtrlReqTriggers != nil {
+			smContext.SmPolicyData.PolicyCtrlReqTriggers = smPolicyDecision.PolicyCtrlReqTriggers
+		}
+		smContext.SMLock.Unlock()
+		return
+	}
+	if err := enforceSmPolicyDecision(smContext, smPolicyDecision); err != nil {
+		smContext.SubQosLog.Errorf("SM policy decision after MA PDU access change not enforced: %v", err)
+	}
+}
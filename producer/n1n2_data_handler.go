@@ -13,6 +13,7 @@ import (
 	"os"
 
 	"github.com/omec-project/nas/v2"
+	"github.com/omec-project/nas/v2/nasMessage"
 	"github.com/omec-project/openapi/v2/models"
 	"github.com/omec-project/smf/consumer"
 	"github.com/omec-project/smf/context"
@@ -24,6 +25,12 @@ import (
 
 type pfcpAction struct {
 	sendPfcpModify, sendPfcpDelete bool
+	// the Handover Command carries the tunnel endpoints the UPF allocates
+	// in the PFCP Session Modification Response
+	buildHandoverCommand bool
+	// the PDU Session Establishment Accept over the second access of an MA
+	// PDU session carries the tunnel endpoint the UPF allocates
+	buildAccessLegAccept bool
 }
 
 type pfcpParam struct {
@@ -43,7 +50,8 @@ func buildAccessForwardingParameters(smContext *context.SMContext,
 		DestinationInterface: context.DestinationInterface{
 			InterfaceValue: context.DestinationInterfaceAccess,
 		},
-		NetworkInstance: []byte(smContext.Dnn),
+		NetworkInstance:   []byte(smContext.Dnn),
+		TgppInterfaceType: smContext.AccessInterfaceType(),
 	}
 
 	if current != nil {
@@ -107,7 +115,7 @@ func readBinaryN2SmInformation(file **os.File) ([]byte, error) {
 	return io.ReadAll(*file)
 }
 
-func HandleUpdateN1Msg(txn *transaction.Transaction, response *models.UpdateSmContext200Response, pfcpAction *pfcpAction) error {
+func HandleUpdateN1Msg(txn *transaction.Transaction, response *models.UpdateSmContext200Response, pfcpAction *pfcpAction, pfcpParam *pfcpParam) error {
 	body := txn.Req.(models.UpdateSmContextRequest)
 	smContext := txn.Ctxt.(*context.SMContext)
 
@@ -167,6 +175,14 @@ func HandleUpdateN1Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 			return err
 		}
 		switch m.GsmHeader.GetMessageType() {
+		case nas.MsgTypePDUSessionEstablishmentRequest:
+			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N1 Msg PDU Session Establishment Request received")
+			anType := body.JsonData.GetAnType()
+			if smContext.MaPdu == nil || !body.JsonData.GetMaRequestInd() || anType == "" || anType == smContext.AnType {
+				smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, PDU Session Establishment Request over %s not for an MA PDU session", anType)
+				break
+			}
+			handleMaPduEstablishmentRequest(txn, response, pfcpAction, pfcpParam, m.PDUSessionEstablishmentRequest.GetPTI())
 		case nas.MsgTypePDUSessionReleaseRequest:
 			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N1 Msg PDU Session Release Request received")
 			pduSessIDRelReq := int32(m.PDUSessionReleaseRequest.GetPDUSessionID())
@@ -180,7 +196,7 @@ func HandleUpdateN1Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 			}
 			if pduSessIDRelReq == pduSessIDSmCxt {
 				smContext.HandlePDUSessionReleaseRequest(m.PDUSessionReleaseRequest)
-				if buf, err := context.BuildGSMPDUSessionReleaseCommand(smContext); err != nil {
+				if buf, err := context.BuildGSMPDUSessionReleaseCommand(smContext, nasMessage.Cause5GSMRegularDeactivation); err != nil {
 					smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build GSM PDUSessionReleaseCommand failed: %+v", err)
 				} else {
 					tmpFile, err := util.CreatePayloadTempFile(buf)
@@ -260,6 +276,15 @@ func HandleUpCnxState(txn *transaction.Transaction, response *models.UpdateSmCon
 	switch smContextUpdateData.GetUpCnxState() {
 	case models.UPCNXSTATE_ACTIVATING:
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, UP cnx state %v received", smContextUpdateData.UpCnxState)
+		if leg := smContext.AccessLeg(smContextUpdateData.GetAnType()); leg != nil {
+			return activateUpCnxOverAccessLeg(smContext, response, leg)
+		}
+		if !smContext.InLadnServiceArea() {
+			// no UP connection out of the LADN service area, TS 23.502 4.2.3.2
+			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, UE out of LADN service area, UP connection not activated")
+			response.JsonData.UpCnxState = models.UPCNXSTATE_DEACTIVATED.Ptr()
+			return nil
+		}
 		if smContext.SMContextState != context.SmStateActive {
 			// Wait till the state becomes SmStateActive again
 			// TODO: implement sleep wait in concurrent architecture
@@ -292,46 +317,110 @@ func HandleUpCnxState(txn *transaction.Transaction, response *models.UpdateSmCon
 			// TODO: implement sleep wait in concurrent architecture
 			smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, SMContext State[%v] should be Active State", smContext.SMContextState.String())
 		}
+		if leg := smContext.AccessLeg(smContextUpdateData.GetAnType()); leg != nil {
+			response.JsonData.UpCnxState = models.UPCNXSTATE_DEACTIVATED.Ptr()
+			deactivateAccessLeg(smContext, pfcpAction, pfcpParam, leg)
+			return nil
+		}
 		if smContext.Tunnel != nil {
 			smContext.ChangeState(context.SmStateModify)
 			smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
 			response.JsonData.UpCnxState = models.UPCNXSTATE_DEACTIVATED.Ptr()
 			smContext.UpCnxState = body.JsonData.GetUpCnxState()
 			smContext.UeLocation = body.JsonData.UeLocation
-			// TODO: Deactivate N2 downlink tunnel
-			// Set FAR and An, N3 Release Info
-			farList := []*context.FAR{}
-			smContext.PendingUPF = make(context.PendingUPF)
-			for _, dataPath := range smContext.Tunnel.DataPathPool {
-				ANUPF := dataPath.FirstDPNode
-				for _, DLPDR := range ANUPF.DownLinkTunnel.PDR {
-					if DLPDR == nil {
-						smContext.SubPduSessLog.Errorf("AN Release Error")
-					} else {
-						DLPDR.FAR.State = context.RULE_UPDATE
-						DLPDR.FAR.ApplyAction.Forw = false
-						DLPDR.FAR.ApplyAction.Buff = true
-						DLPDR.FAR.ApplyAction.Nocp = true
-						// Set DL Tunnel info to nil
-						if DLPDR.FAR.ForwardingParameters != nil {
-							DLPDR.FAR.ForwardingParameters.OuterHeaderCreation = nil
-						}
-						smContext.PendingUPF[ANUPF.GetNodeIP()] = true
-						farList = append(farList, DLPDR.FAR)
-					}
-				}
-			}
+			deactivateUpConnection(smContext, pfcpAction, pfcpParam)
+		}
+	}
+	return nil
+}
 
-			pfcpParam.farList = append(pfcpParam.farList, farList...)
+// HandleUpdateUeLocation stores the UE location reported by the AMF and
+// relocates the PSA of the PDU session when the UE left the DNAI of its PSA
+func HandleUpdateUeLocation(txn *transaction.Transaction) {
+	body := txn.Req.(models.UpdateSmContextRequest)
+	smContext := txn.Ctxt.(*context.SMContext)
 
-			pfcpAction.sendPfcpModify = true
-			smContext.ChangeState(context.SmStatePfcpModify)
-			smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
-		}
+	if body.JsonData.UeLocation == nil {
+		return
+	}
+	smContext.UeLocation = body.JsonData.UeLocation
+	if smContext.PsaRelocationRequired() && smContext.StartPsaRelocation() {
+		smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, UE out of the DNAI of the PSA, relocate PSA")
+		go relocatePsa(smContext)
 	}
+}
+
+// HandleUpdatePresenceInLadn deactivates the UP connection of a LADN PDU
+// session when the UE leaves the LADN service area, TS 23.501 5.6.5
+func HandleUpdatePresenceInLadn(txn *transaction.Transaction, response *models.UpdateSmContext200Response, pfcpAction *pfcpAction, pfcpParam *pfcpParam) error {
+	body := txn.Req.(models.UpdateSmContextRequest)
+	smContext := txn.Ctxt.(*context.SMContext)
+	smContextUpdateData := body.JsonData
+
+	if !smContext.UpdatePresenceInLadn(smContextUpdateData.GetPresenceInLadn()) {
+		return nil
+	}
+	if smContext.Tunnel == nil || smContext.UpCnxState == models.UPCNXSTATE_DEACTIVATED || smContextUpdateData.UpCnxState != nil {
+		// deactivated already or along with the UP cnx state of the request
+		return nil
+	}
+	smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, UE out of LADN service area, deactivate UP connection")
+
+	buf, err := context.BuildPDUSessionResourceReleaseCommandTransfer(smContext)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("build PDU Session Resource Release Command Transfer failed: %+v", err)
+		return err
+	}
+	tmpFile, err := util.CreatePayloadTempFile(buf)
+	if err != nil {
+		smContext.SubPduSessLog.Error(err)
+		return err
+	}
+	response.BinaryDataN2SmInformation = &tmpFile
+	response.JsonData.N2SmInfo = &models.RefToBinaryData{ContentId: "PDUResourceReleaseCommand"}
+	response.JsonData.N2SmInfoType = models.N2SMINFOTYPE_PDU_RES_REL_CMD.Ptr()
+	response.JsonData.UpCnxState = models.UPCNXSTATE_DEACTIVATED.Ptr()
+	smContext.UpCnxState = models.UPCNXSTATE_DEACTIVATED
+	deactivateUpConnection(smContext, pfcpAction, pfcpParam)
 	return nil
 }
 
+// deactivateUpConnection buffers the downlink data of the PDU session in the
+// UPF while its UP connection is deactivated
+func deactivateUpConnection(smContext *context.SMContext, pfcpAction *pfcpAction, pfcpParam *pfcpParam) {
+	// TODO: Deactivate N2 downlink tunnel
+	// Set FAR and An, N3 Release Info
+	farList := []*context.FAR{}
+	smContext.PendingUPF = make(context.PendingUPF)
+	for _, dataPath := range smContext.Tunnel.DataPathPool {
+		ANUPF := dataPath.FirstDPNode
+		for _, DLPDR := range ANUPF.DownLinkTunnel.PDR {
+			if DLPDR == nil {
+				smContext.SubPduSessLog.Errorf("AN Release Error")
+			} else {
+				DLPDR.FAR.State = context.RULE_UPDATE
+				DLPDR.FAR.ApplyAction.Forw = false
+				DLPDR.FAR.ApplyAction.Buff = true
+				DLPDR.FAR.ApplyAction.Nocp = true
+				// Set DL Tunnel info to nil
+				if DLPDR.FAR.ForwardingParameters != nil {
+					DLPDR.FAR.ForwardingParameters.OuterHeaderCreation = nil
+				}
+				smContext.PendingUPF[ANUPF.GetNodeIP()] = true
+				farList = append(farList, DLPDR.FAR)
+			}
+		}
+	}
+
+	pfcpParam.farList = append(pfcpParam.farList, farList...)
+	// the downlink traffic moves to the other access of an MA PDU session
+	pfcpParam.pdrList = append(pfcpParam.pdrList, smContext.SteerDownlink()...)
+
+	pfcpAction.sendPfcpModify = true
+	smContext.ChangeState(context.SmStatePfcpModify)
+	smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
+}
+
 func HandleUpdateHoState(txn *transaction.Transaction, response *models.UpdateSmContext200Response, pfcpAction *pfcpAction, pfcpParam *pfcpParam) error {
 	body := txn.Req.(models.UpdateSmContextRequest)
 	smContext := txn.Ctxt.(*context.SMContext)
@@ -403,6 +492,12 @@ func HandleUpdateHoState(txn *transaction.Transaction, response *models.UpdateSm
 		// The FAR OuterHeaderCreation fields were just populated by
 		// HandleHandoverRequestAcknowledgeTransfer above.
 		pendingUPF := collectHoFARsForPFCPModify(smContext.Tunnel, pfcpParam)
+		if forwarding := smContext.IndirectForwarding(); forwarding != nil && forwarding.PDR.State == context.RULE_INITIAL {
+			pfcpParam.pdrList = append(pfcpParam.pdrList, forwarding.PDR)
+			pfcpParam.farList = append(pfcpParam.farList, forwarding.PDR.FAR)
+			pendingUPF[forwarding.Node.GetNodeIP()] = true
+			pfcpAction.buildHandoverCommand = true
+		}
 		if len(pendingUPF) > 0 {
 			if smContext.PendingUPF == nil {
 				smContext.PendingUPF = make(context.PendingUPF)
@@ -413,19 +508,8 @@ func HandleUpdateHoState(txn *transaction.Transaction, response *models.UpdateSm
 			smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
 		}
 
-		if n2Buf, err := context.BuildHandoverCommandTransfer(smContext); err != nil {
-			smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build PDUSession Resource Setup Request Transfer Error(%s)", err.Error())
-		} else {
-			tmpFile, err := util.CreatePayloadTempFile(n2Buf)
-			if err != nil {
-				smContext.SubPduSessLog.Errorf("failed to create temp file: %v", err)
-			} else {
-				response.BinaryDataN2SmInformation = &tmpFile
-				response.JsonData.N2SmInfoType = models.N2SMINFOTYPE_HANDOVER_CMD.Ptr()
-				response.JsonData.N2SmInfo = &models.RefToBinaryData{
-					ContentId: "HANDOVER_CMD",
-				}
-			}
+		if !pfcpAction.buildHandoverCommand {
+			setHandoverCommandTransfer(smContext, response)
 		}
 	case models.HOSTATE_COMPLETED:
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, Ho state %v received", smContextUpdateData.HoState)
@@ -440,10 +524,88 @@ func HandleUpdateHoState(txn *transaction.Transaction, response *models.UpdateSm
 		smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
 		smContext.HoState = models.HOSTATE_COMPLETED
 		response.JsonData.HoState = models.HOSTATE_COMPLETED.Ptr()
+		smContext.CompleteHandover()
+		releaseIndirectForwarding(smContext, pfcpAction, pfcpParam)
+		checkIUpfChange(smContext)
+	case models.HOSTATE_CANCELLED:
+		smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, Ho state %v received", smContextUpdateData.HoState)
+		cancelHandover(smContext, response, pfcpAction, pfcpParam)
 	}
 	return nil
 }
 
+// cancelHandover returns the PDU session to the source AN after the handover
+// was cancelled or the target AN failed to allocate its resources
+func cancelHandover(smContext *context.SMContext, response *models.UpdateSmContext200Response,
+	pfcpAction *pfcpAction, pfcpParam *pfcpParam,
+) {
+	if smContext.HoState == models.HOSTATE_CANCELLED {
+		return
+	}
+	if smContext.SMContextState != context.SmStateActive {
+		smContext.SubPduSessLog.Warnf("PDUSessionSMContextUpdate, SMContext state[%v] should be SmStateActive",
+			smContext.SMContextState.String())
+	}
+	smContext.ChangeState(context.SmStateModify)
+	smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
+	smContext.HoState = models.HOSTATE_CANCELLED
+	response.JsonData.HoState = models.HOSTATE_CANCELLED.Ptr()
+
+	releaseIndirectForwarding(smContext, pfcpAction, pfcpParam)
+	if !smContext.CancelHandover() {
+		return
+	}
+	pendingUPF := collectHoFARsForPFCPModify(smContext.Tunnel, pfcpParam)
+	if len(pendingUPF) == 0 {
+		return
+	}
+	if smContext.PendingUPF == nil {
+		smContext.PendingUPF = make(context.PendingUPF)
+	}
+	maps.Copy(smContext.PendingUPF, pendingUPF)
+	pfcpAction.sendPfcpModify = true
+	smContext.ChangeState(context.SmStatePfcpModify)
+	smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
+}
+
+// setHandoverCommandTransfer sets the Handover Command Transfer of the
+// handover to the target AN in the response
+func setHandoverCommandTransfer(smContext *context.SMContext, response *models.UpdateSmContext200Response) {
+	n2Buf, err := context.BuildHandoverCommandTransfer(smContext)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build Handover Command Transfer Error(%s)", err.Error())
+		return
+	}
+	tmpFile, err := util.CreatePayloadTempFile(n2Buf)
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("failed to create temp file: %v", err)
+		return
+	}
+	response.BinaryDataN2SmInformation = &tmpFile
+	response.JsonData.N2SmInfoType = models.N2SMINFOTYPE_HANDOVER_CMD.Ptr()
+	response.JsonData.N2SmInfo = &models.RefToBinaryData{
+		ContentId: "HANDOVER_CMD",
+	}
+}
+
+// releaseIndirectForwarding removes the indirect forwarding tunnel of the
+// handover from the UPF serving the source AN
+func releaseIndirectForwarding(smContext *context.SMContext, pfcpAction *pfcpAction, pfcpParam *pfcpParam) {
+	node, pdr := smContext.ReleaseIndirectForwarding()
+	if pdr == nil || pdr.State == context.RULE_INITIAL {
+		return
+	}
+	pfcpParam.removePDR = append(pfcpParam.removePDR, pdr)
+	pfcpParam.removeFAR = append(pfcpParam.removeFAR, pdr.FAR)
+	if smContext.PendingUPF == nil {
+		smContext.PendingUPF = make(context.PendingUPF)
+	}
+	smContext.PendingUPF[node.GetNodeIP()] = true
+	pfcpAction.sendPfcpModify = true
+	smContext.ChangeState(context.SmStatePfcpModify)
+	smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
+}
+
 func HandleUpdateCause(txn *transaction.Transaction, response *models.UpdateSmContext200Response, pfcpAction *pfcpAction) error {
 	body := txn.Req.(models.UpdateSmContextRequest)
 	smContext := txn.Ctxt.(*context.SMContext)
@@ -498,6 +660,9 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 	case models.N2SMINFOTYPE_PDU_RES_SETUP_RSP:
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N2 SM info type %v received",
 			smContextUpdateData.N2SmInfoType)
+		if leg := smContext.AccessLeg(smContextUpdateData.GetAnType()); leg != nil {
+			return activateAccessLeg(txn, pfcpAction, pfcpParam, leg)
+		}
 		if smContext.SMContextState != context.SmStateActive {
 			// Wait till the state becomes Active again
 			// TODO: implement sleep wait in concurrent architecture
@@ -543,6 +708,8 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 				smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, handle PDUSessionResourceSetupResponseTransfer failed: %+v", err)
 			}
 		}
+		// the MARs of the downlink PDRs above follow the UP connection
+		smContext.SteerDownlink()
 
 		pfcpParam.pdrList = append(pfcpParam.pdrList, pdrList...)
 		pfcpParam.farList = append(pfcpParam.farList, farList...)
@@ -550,6 +717,9 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 		pfcpAction.sendPfcpModify = true
 		smContext.ChangeState(context.SmStatePfcpModify)
 		smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
+		if source := smContext.CompleteAccessTypeChange(); source != "" {
+			go releaseSourceAccess(smContext, source)
+		}
 	case models.N2SMINFOTYPE_PDU_RES_SETUP_FAIL:
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N2 SM info type %v received",
 			smContextUpdateData.N2SmInfoType)
@@ -669,6 +839,7 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 		pfcpAction.sendPfcpModify = true
 		smContext.ChangeState(context.SmStatePfcpModify)
 		smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
+		checkIUpfChange(smContext)
 	case models.N2SMINFOTYPE_PATH_SWITCH_SETUP_FAIL:
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N2 SM info type %v received",
 			smContextUpdateData.N2SmInfoType)
@@ -700,6 +871,20 @@ func HandleUpdateN2Msg(txn *transaction.Transaction, response *models.UpdateSmCo
 		smContext.ChangeState(context.SmStateModify)
 		smContext.SubCtxLog.Debugln("PDUSessionSMContextUpdate, SMContextState Change State:", smContext.SMContextState.String())
 		response.JsonData.N2SmInfo = &models.RefToBinaryData{ContentId: "Handover"}
+	case models.N2SMINFOTYPE_HANDOVER_RES_ALLOC_FAIL:
+		smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, N2 SM info type %v received",
+			smContextUpdateData.N2SmInfoType)
+		fileBytes, err := readBinaryN2SmInformation(body.BinaryDataN2SmInformation)
+		if err != nil {
+			smContext.SubCtxLog.Errorf("failed to read file: %v", err)
+			return err
+		}
+		if len(fileBytes) > 0 {
+			if err := context.HandleHandoverResourceAllocationUnsuccessfulTransfer(fileBytes, smContext); err != nil {
+				smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, handle HandoverResourceAllocationUnsuccessfulTransfer failed: %+v", err)
+			}
+		}
+		cancelHandover(smContext, response, pfcpAction, pfcpParam)
 	}
 
 	return nil
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package producer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/consumer"
+	smf_context "github.com/omec-project/smf/context"
+	"github.com/omec-project/smf/logger"
+	"github.com/omec-project/smf/util"
+)
+
+// networkRetryInterval is the delay before checking again whether a network
+// requested procedure can run on a PDU session busy with another procedure
+const networkRetryInterval = 5 * time.Second
+
+// maxNetworkRetries bounds the checks, the network requested procedure being
+// dropped when the PDU session stays busy
+const maxNetworkRetries = 12
+
+// whenActive runs the network requested procedure once the PDU session is
+// Active, moving it to the next state first. It gives up once the PDU
+// session is released or after maxNetworkRetries checks.
+func whenActive(smContext *smf_context.SMContext, reason string, next smf_context.SMContextState, procedure func()) {
+	retryWhenActive(smContext, reason, next, procedure, 0)
+}
+
+func retryWhenActive(smContext *smf_context.SMContext, reason string, next smf_context.SMContextState, procedure func(), attempt int) {
+	smContext.SMLock.Lock()
+	state := smContext.SMContextState
+	if state == smf_context.SmStateRelease || smContext.Tunnel == nil {
+		// already released
+		smContext.SMLock.Unlock()
+		return
+	}
+	if state == smf_context.SmStateActive {
+		smContext.ChangeState(next)
+		smContext.SMLock.Unlock()
+		procedure()
+		return
+	}
+	smContext.SMLock.Unlock()
+	if attempt >= maxNetworkRetries {
+		smContext.SubPduSessLog.Errorf("%s dropped, PDU session still in state %s", reason, state.String())
+		return
+	}
+	smContext.SubPduSessLog.Warnf("%s in state %s, retry in %v", reason, state.String(), networkRetryInterval)
+	time.AfterFunc(networkRetryInterval, func() {
+		retryWhenActive(smContext, reason, next, procedure, attempt+1)
+	})
+}
+
+// releasePDUSessionByNetwork releases the PDU session towards the UE, the AN
+// and the UPF, e.g. when the DN-AAA session or the DHCP lease of the UE
+// address expires. The 5GSM cause is sent to the UE. The SM context is then
+// removed and the AMF notified.
+func releasePDUSessionByNetwork(smContext *smf_context.SMContext, reason string, cause uint8) {
+	whenActive(smContext, reason, smf_context.SmStatePfcpRelease, func() {
+		if err := sendReleaseN1N2Transfer(smContext, cause); err != nil {
+			smContext.SubPduSessLog.Errorf("%s, N1N2 transfer failed: %v", reason, err)
+		}
+		if err := SendPfcpSessionReleaseReq(smContext); err != nil {
+			smContext.SubPduSessLog.Errorf("%s, PFCP session release failed: %v", reason, err)
+		}
+		removeSMContextByNetwork(smContext, reason)
+	})
+}
+
+// removeSMContextByNetwork ends the SM policy association, removes the SM
+// context, releasing the UE address, and notifies the AMF of the release
+func removeSMContextByNetwork(smContext *smf_context.SMContext, reason string) {
+	smContext.SMLock.Lock()
+	if smContext.SMPolicyClient != nil {
+		releaseRequest := models.ReleaseSmContextRequest{JsonData: models.NewSmContextReleaseData()}
+		if _, err := consumer.SendSMPolicyAssociationDelete(smContext, &releaseRequest); err != nil {
+			smContext.SubPduSessLog.Errorf("%s, SM policy delete failed: %v", reason, err)
+		}
+	}
+	smf_context.RemoveSMContext(smContext.Ref)
+	smContext.SMLock.Unlock()
+	logger.PduSessLog.Infof("%s, PDU session released for UE [%s], PDU Session ID [%d]",
+		reason, smContext.Supi, smContext.PDUSessionID)
+
+	problemDetails, err := consumer.SendSMContextStatusNotification(smContext.SmStatusNotifyUri)
+	if problemDetails != nil {
+		smContext.SubPduSessLog.Warnf("%s, send SMContext Status Notification Problem[%+v]", reason, problemDetails)
+	}
+	if err != nil {
+		smContext.SubPduSessLog.Warnf("%s, send SMContext Status Notification Error[%v]", reason, err)
+	}
+}
+
+// sendReleaseN1N2Transfer sends the PDU Session Release Command to the UE
+// and the release of the PDU session resources to the AN, if its UP
+// connection is not deactivated
+func sendReleaseN1N2Transfer(smContext *smf_context.SMContext, cause uint8) error {
+	n1n2Request := models.NewN1N2MessageTransferRequest()
+	defer util.CleanupMultipartTempFiles(n1n2Request)
+
+	jsonData := models.NewN1N2MessageTransferReqData()
+	jsonData.SetPduSessionId(smContext.PDUSessionID)
+
+	smNasBuf, err := smf_context.BuildGSMPDUSessionReleaseCommand(smContext, cause)
+	if err != nil {
+		return fmt.Errorf("build GSM PDUSessionReleaseCommand failed: %w", err)
+	}
+	tmpFile, err := util.CreatePayloadTempFile(smNasBuf)
+	if err != nil {
+		return err
+	}
+	n1n2Request.SetBinaryDataN1Message(tmpFile)
+	jsonData.SetN1MessageContainer(*models.NewN1MessageContainer("SM", models.RefToBinaryData{ContentId: "GSM_NAS"}))
+
+	if smContext.UpCnxState != models.UPCNXSTATE_DEACTIVATED {
+		n2Pdu, err := smf_context.BuildPDUSessionResourceReleaseCommandTransfer(smContext)
+		if err != nil {
+			return fmt.Errorf("build PDUSessionResourceReleaseCommandTransfer failed: %w", err)
+		}
+		tmpFile, err = util.CreatePayloadTempFile(n2Pdu)
+		if err != nil {
+			return err
+		}
+		n1n2Request.SetBinaryDataN2Information(tmpFile)
+		n2InfoContent := models.NewN2InfoContent(models.RefToBinaryData{ContentId: "N2SmInformation"})
+		n2InfoContent.SetNgapIeType(models.NGAPIETYPE_PDU_RES_REL_CMD)
+		smInfo := models.NewN2SmInformation(smContext.PDUSessionID)
+		smInfo.SetN2InfoContent(*n2InfoContent)
+		if smContext.Snssai != nil {
+			smInfo.SetSNssai(*smContext.Snssai)
+		}
+		n2InfoContainer := models.NewN2InfoContainer(models.N2INFORMATIONCLASS_SM)
+		n2InfoContainer.SetSmInfo(*smInfo)
+		jsonData.SetN2InfoContainer(*n2InfoContainer)
+	}
+	n1n2Request.SetJsonData(*jsonData)
+
+	smContext.SMLock.Lock()
+	rspData, err := consumer.SendN1N2TransferWithRediscovery(context.Background(), smContext, n1n2Request)
+	smContext.SMLock.Unlock()
+	if err != nil {
+		return err
+	}
+	if rspData.GetCause() == models.N1N2MESSAGETRANSFERCAUSE_N1_MSG_NOT_TRANSFERRED {
+		return fmt.Errorf("N1N2MessageTransfer failure, %v", rspData.Cause)
+	}
+	return nil
+}
@@ -10,7 +10,9 @@ import (
 	"strconv"
 
 	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/openapi/v2/utils"
 	"github.com/omec-project/smf/context"
+	"github.com/omec-project/smf/logger"
 	"github.com/omec-project/util/httpwrapper"
 )
 
@@ -59,3 +61,78 @@ func HandleOAMGetUEPDUSessionInfo(smContextRef string) *httpwrapper.Response {
 	}
 	return httpResponse
 }
+
+func HandleOAMGetCongestion() *httpwrapper.Response {
+	return &httpwrapper.Response{
+		Header: nil,
+		Status: http.StatusOK,
+		Body:   context.GetCongestions(),
+	}
+}
+
+func HandleOAMSetCongestion(congestion context.Congestion) *httpwrapper.Response {
+	if err := context.SetCongestion(congestion); err != nil {
+		return &httpwrapper.Response{
+			Header: nil,
+			Status: http.StatusBadRequest,
+			Body:   utils.ProblemDetailsMalformedRequestSyntax(err.Error()),
+		}
+	}
+	logger.ProducerLog.Infof("congestion control started for %v", congestion)
+
+	return &httpwrapper.Response{
+		Header: nil,
+		Status: http.StatusOK,
+		Body:   congestion,
+	}
+}
+
+func HandleOAMClearCongestion(congestion context.Congestion) *httpwrapper.Response {
+	if !context.ClearCongestion(congestion) {
+		return &httpwrapper.Response{
+			Header: nil,
+			Status: http.StatusNotFound,
+			Body:   nil,
+		}
+	}
+	logger.ProducerLog.Infof("congestion control stopped for %v", congestion)
+
+	return &httpwrapper.Response{
+		Header: nil,
+		Status: http.StatusNoContent,
+		Body:   nil,
+	}
+}
+
+// HandleOAMRelocatePsa relocates the PSA of an SSC mode 2 or 3 PDU session on
+// operator request
+func HandleOAMRelocatePsa(smContextRef string) *httpwrapper.Response {
+	smContext := context.GetSMContext(smContextRef)
+	if smContext == nil {
+		return &httpwrapper.Response{
+			Header: nil,
+			Status: http.StatusNotFound,
+			Body:   nil,
+		}
+	}
+
+	smContext.SMLock.Lock()
+	started := smContext.StartPsaRelocation()
+	smContext.SMLock.Unlock()
+	if !started {
+		return &httpwrapper.Response{
+			Header: nil,
+			Status: http.StatusConflict,
+			Body: utils.ProblemDetails("PSA relocation not allowed", http.StatusConflict,
+				"PDU session in SSC mode 1 or PSA relocation ongoing"),
+		}
+	}
+	logger.ProducerLog.Infof("PSA relocation requested for UE [%s], PDU Session ID [%d]", smContext.Supi, smContext.PDUSessionID)
+	go relocatePsa(smContext)
+
+	return &httpwrapper.Response{
+		Header: nil,
+		Status: http.StatusAccepted,
+		Body:   nil,
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -178,6 +179,22 @@ func HandlePDUSessionSMContextCreate(eventData interface{}) error {
 		return fmt.Errorf("SnssaiError")
 	}
 
+	// LADN DNN only in the LADN service area
+	if !smContext.InLadnServiceArea() {
+		smContext.SubPduSessLog.Warnf("PDUSessionSMContextCreate, UE out of LADN DNN[%s] service area", createData.GetDnn())
+		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("OutOfLadnServiceArea")
+		return fmt.Errorf("OutOfLadnServiceArea")
+	}
+
+	// 5GSM congestion control
+	snssai := &smf_context.SNssai{Sst: createData.SNssai.GetSst(), Sd: createData.SNssai.GetSd()}
+	if cause := smf_context.CheckCongestion(snssai, createData.GetDnn()); cause != "" {
+		smContext.SubPduSessLog.Warnf("PDUSessionSMContextCreate, S-NSSAI[sst: %d, sd: %s] DNN[%s] rejected under congestion control [%s]",
+			snssai.Sst, snssai.Sd, createData.GetDnn(), cause)
+		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject(cause)
+		return fmt.Errorf("%s", cause)
+	}
+
 	// Query UDM
 	if problemDetails, err := consumer.SendNFDiscoveryUDM(); err != nil {
 		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, send NF Discovery Serving UDM Error[%+v]", err)
@@ -191,17 +208,6 @@ func HandlePDUSessionSMContextCreate(eventData interface{}) error {
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, send NF Discovery Serving UDM Successful")
 	}
 
-	// IP Allocation
-	if ip, err := smContext.DNNInfo.UeIPAllocator.Allocate(smContext.Supi); err != nil {
-		smContext.SubPduSessLog.Errorln("PDUSessionSMContextCreate, failed allocate IP address: ", err)
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("IpAllocError")
-		return fmt.Errorf("IpAllocError")
-	} else {
-		smContext.PDUAddress = &smf_context.UeIpAddr{Ip: ip, UpfProvided: false}
-		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, IP alloc success IP[%s]",
-			smContext.PDUAddress.Ip.String())
-	}
-
 	// UDM-Fetch Subscription Data based on servingnetwork.plmn and dnn, snssai
 	smPlmnID := models.PlmnIdNid{}
 	if createData.ServingNetwork.HasNid() {
@@ -282,6 +288,7 @@ func HandlePDUSessionSMContextCreate(eventData interface{}) error {
 		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("PDUSessionTypeIPv4OnlyAllowed")
 		return fmt.Errorf("invalid PDU session establishment request: %w", err)
 	}
+	smContext.HandleRedundantPduSessionRequest(fileBytes)
 
 	if smContext.SelectedPDUSessionType == nasMessage.PDUSessionTypeUnstructured {
 		smContext.SubPduSessLog.Errorf("Unstructured PDU Session Not Supported")
@@ -289,10 +296,79 @@ func HandlePDUSessionSMContextCreate(eventData interface{}) error {
 		return fmt.Errorf("unstructured PDU Session not supported")
 	}
 
+	// Secondary authentication/authorization by the DN-AAA server
+	eapAuth := false
+	if dnAaaInfo := smf_context.RetrieveDnAaaInfo(smContext.Dnn); dnAaaInfo != nil {
+		if dnAaaInfo.AuthMethod == smf_context.DnAaaAuthEap {
+			// EAP is relayed over N1 once the SM context is created,
+			// the PDU session is established when the UE is authorized
+			smContext.StartEapAuthentication()
+			eapAuth = true
+		} else if err := smContext.AuthenticateByDnAaa(dnAaaInfo); err != nil {
+			smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, secondary authentication failed: %v", err)
+			txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("SecondaryAuthFailure")
+			return fmt.Errorf("SecondaryAuthError")
+		} else {
+			smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, secondary authentication success")
+		}
+	}
+
+	if !eapAuth {
+		if cause, err := establishPDUSession(smContext); err != nil {
+			txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject(cause)
+			return err
+		}
+	}
+
+	// AMF Selection for SMF -> AMF communication
+	if problemDetails, err := consumer.SendNFDiscoveryServingAMF(smContext); err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, send NF Discovery Serving AMF Error[%v]", err)
+		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("AMFDiscoveryFailure")
+		return fmt.Errorf("AmfError")
+	} else if problemDetails != nil {
+		smContext.SubPduSessLog.Warnf("PDUSessionSMContextCreate, send NF Discovery Serving AMF Problem[%+v]", problemDetails)
+		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("AMFDiscoveryFailure")
+		return fmt.Errorf("AmfError")
+	} else {
+		smContext.SubPduSessLog.Debugln("PDUSessionSMContextCreate, Send NF Discovery Serving AMF success")
+	}
+
+	smContext.RebuildCommunicationClient()
+
+	response.JsonData = smContext.BuildCreatedData()
+	txn.Rsp = &httpwrapper.Response{
+		Header: http.Header{
+			"Location": {smContext.Ref},
+		},
+		Status: http.StatusCreated,
+		Body:   response,
+	}
+
+	smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, PDU session context create success ")
+
+	return nil
+	// TODO: UECM registration
+}
+
+// establishPDUSession allocates the UE IP address, creates the SM policy
+// association and selects the data path of the PDU session. It returns the
+// cause of the PDU Session Establishment Reject on failure.
+func establishPDUSession(smContext *smf_context.SMContext) (string, error) {
+	smfSelf := smf_context.SMF_Self()
+
+	// IP Allocation
+	if err := smContext.AllocateUeIpAddr(); err != nil {
+		smContext.SubPduSessLog.Errorln("PDUSessionSMContextCreate, failed allocate IP address: ", err)
+		if errors.Is(err, smf_context.ErrStaticIpConflict) {
+			return "StaticIpConflict", fmt.Errorf("StaticIpConflict")
+		}
+		return "IpAllocError", fmt.Errorf("IpAllocError")
+	}
+	smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, IP alloc success IP[%s]", smContext.PDUAddress.Ip.String())
+
 	if err := smContext.PCFSelection(); err != nil {
 		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, send NF Discovery Serving PCF Error[%v]", err)
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("PCFDiscoveryFailure")
-		return fmt.Errorf("PcfError")
+		return "PCFDiscoveryFailure", fmt.Errorf("PcfError")
 	}
 	smContext.SubPduSessLog.Infoln("PDUSessionSMContextCreate, send NF Discovery Serving PCF success")
 
@@ -302,13 +378,11 @@ func HandlePDUSessionSMContextCreate(eventData interface{}) error {
 	if smPolicyDecisionRsp, httpStatus, err := consumer.SendSMPolicyAssociationCreate(smContext); err != nil {
 		metrics.IncrementSvcPcfMsgStats(smfSelf.NfInstanceID, string(svcmsgtypes.SmPolicyAssociationCreate), "In", http.StatusText(httpStatus), err.Error())
 		smContext.SubPduSessLog.Errorln("PDUSessionSMContextCreate, SMPolicyAssociationCreate error: ", err)
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("PCFPolicyCreateFailure")
-		return fmt.Errorf("PcfAssoError")
+		return "PCFPolicyCreateFailure", fmt.Errorf("PcfAssoError")
 	} else if httpStatus != http.StatusCreated {
 		metrics.IncrementSvcPcfMsgStats(smfSelf.NfInstanceID, string(svcmsgtypes.SmPolicyAssociationCreate), "In", http.StatusText(httpStatus), "error")
 		smContext.SubPduSessLog.Errorln("PDUSessionSMContextCreate, SMPolicyAssociationCreate http status: ", http.StatusText(httpStatus))
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("PCFPolicyCreateFailure")
-		return fmt.Errorf("PcfAssoError")
+		return "PCFPolicyCreateFailure", fmt.Errorf("PcfAssoError")
 	} else {
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, Policy association create success")
 		smPolicyDecision = smPolicyDecisionRsp
@@ -326,46 +400,38 @@ func HandlePDUSessionSMContextCreate(eventData interface{}) error {
 	// dataPath selection
 	smContext.Tunnel = smf_context.NewUPTunnel()
 	var defaultPath *smf_context.DataPath
-	upfSelectionParams := &smf_context.UPFSelectionParams{
-		Dnn: createData.GetDnn(),
-		SNssai: &smf_context.SNssai{
-			Sst: createData.SNssai.GetSst(),
-			Sd:  createData.SNssai.GetSd(),
-		},
-	}
+	upfSelectionParams := smContext.UPFSelectionParams()
 
-	if smfSelf.ULCLSupport && smfSelf.UeRoutingManager != nil && smfSelf.UeRoutingManager.HasPath(createData.GetSupi()) {
-		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate: SUPI[%s] has pre-configured route", createData.Supi)
-		uePreConfigPaths := smfSelf.UeRoutingManager.GetPath(createData.GetSupi())
+	if smfSelf.ULCLSupport && smfSelf.UeRoutingManager != nil && smfSelf.UeRoutingManager.HasPath(smContext.Supi) {
+		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate: SUPI[%s] has pre-configured route", smContext.Supi)
+		uePreConfigPaths := smfSelf.UeRoutingManager.GetPath(smContext.Supi)
 		smContext.Tunnel.DataPathPool = uePreConfigPaths.DataPathPool
 		smContext.Tunnel.PathIDGenerator = uePreConfigPaths.PathIDGenerator
 		defaultPath = smContext.Tunnel.DataPathPool.GetDefaultPath()
 		if defaultPath == nil {
-			smContext.SubPduSessLog.Warnf("no default path found for SUPI[%s]", createData.Supi)
+			smContext.SubPduSessLog.Warnf("no default path found for SUPI[%s]", smContext.Supi)
 		} else if err := ensureDataPathUpfAssociated(defaultPath); err != nil {
-			smContext.SubPduSessLog.Errorf("ensureDataPathUpfAssociated error for SUPI[%s]: %v", createData.Supi, err)
+			smContext.SubPduSessLog.Errorf("ensureDataPathUpfAssociated error for SUPI[%s]: %v", smContext.Supi, err)
 		} else if err := defaultPath.ActivateTunnelAndPDR(smContext, 255); err != nil {
-			smContext.SubPduSessLog.Errorf("ActivateTunnelAndPDR error for SUPI[%s]: %v", createData.Supi, err)
+			smContext.SubPduSessLog.Errorf("ActivateTunnelAndPDR error for SUPI[%s]: %v", smContext.Supi, err)
 		}
-		smContext.BPManager = smf_context.NewBPManager(createData.GetSupi())
+		smContext.BPManager = smf_context.NewBPManager(smContext.Supi)
 	} else {
 		// UE has no pre-config path.
-		// Use default route
+		// Use the path to the UPF selected for the session
 		smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, no pre-config route")
-		defaultUPPath := smf_context.GetUserPlaneInformation().GetDefaultUserPlanePathByDNN(upfSelectionParams)
+		defaultUPPath := smContext.UserPlanePath()
 		defaultPath = smf_context.GenerateDataPath(defaultUPPath)
 		if defaultPath != nil {
 			defaultPath.IsDefaultPath = true
 			smContext.Tunnel.AddDataPath(defaultPath)
 			if err := ensureDataPathUpfAssociated(defaultPath); err != nil {
 				smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, UPF association recovery failed: %v", err)
-				txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("UPFDataPathError")
-				return fmt.Errorf("DataPathError")
+				return "UPFDataPathError", fmt.Errorf("DataPathError")
 			}
 			if err := defaultPath.ActivateTunnelAndPDR(smContext, 255); err != nil {
 				smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, data path error: %v", err.Error())
-				txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("UPFDataPathError")
-				return fmt.Errorf("DataPathError")
+				return "UPFDataPathError", fmt.Errorf("DataPathError")
 			}
 		}
 	}
@@ -375,38 +441,10 @@ func HandlePDUSessionSMContextCreate(eventData interface{}) error {
 		smContext.SubCtxLog.Debugln("PDUSessionSMContextCreate, SMContextState Change State:", smContext.SMContextState.String())
 		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, data path not found for selection param %v", upfSelectionParams.String())
 
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("InsufficientResourceSliceDnn")
-		return fmt.Errorf("InsufficientResourceSliceDnn")
+		return "InsufficientResourceSliceDnn", fmt.Errorf("InsufficientResourceSliceDnn")
 	}
 
-	// AMF Selection for SMF -> AMF communication
-	if problemDetails, err := consumer.SendNFDiscoveryServingAMF(smContext); err != nil {
-		smContext.SubPduSessLog.Errorf("PDUSessionSMContextCreate, send NF Discovery Serving AMF Error[%v]", err)
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("AMFDiscoveryFailure")
-		return fmt.Errorf("AmfError")
-	} else if problemDetails != nil {
-		smContext.SubPduSessLog.Warnf("PDUSessionSMContextCreate, send NF Discovery Serving AMF Problem[%+v]", problemDetails)
-		txn.Rsp = smContext.GeneratePDUSessionEstablishmentReject("AMFDiscoveryFailure")
-		return fmt.Errorf("AmfError")
-	} else {
-		smContext.SubPduSessLog.Debugln("PDUSessionSMContextCreate, Send NF Discovery Serving AMF success")
-	}
-
-	smContext.RebuildCommunicationClient()
-
-	response.JsonData = smContext.BuildCreatedData()
-	txn.Rsp = &httpwrapper.Response{
-		Header: http.Header{
-			"Location": {smContext.Ref},
-		},
-		Status: http.StatusCreated,
-		Body:   response,
-	}
-
-	smContext.SubPduSessLog.Infof("PDUSessionSMContextCreate, PDU session context create success ")
-
-	return nil
-	// TODO: UECM registration
+	return "", nil
 }
 
 func HandlePDUSessionSMContextUpdate(eventData interface{}) error {
@@ -421,11 +459,6 @@ func HandlePDUSessionSMContextUpdate(eventData interface{}) error {
 	var response models.UpdateSmContext200Response
 	response.JsonData = models.NewSmContextUpdatedData()
 
-	// N1 Msg Handling
-	if err := HandleUpdateN1Msg(txn, &response, pfcpAction); err != nil {
-		return err
-	}
-
 	pfcpParam := &pfcpParam{
 		pdrList: []*smf_context.PDR{},
 		farList: []*smf_context.FAR{},
@@ -433,6 +466,27 @@ func HandlePDUSessionSMContextUpdate(eventData interface{}) error {
 		qerList: []*smf_context.QER{},
 	}
 
+	// N1 Msg Handling
+	if err := HandleUpdateN1Msg(txn, &response, pfcpAction, pfcpParam); err != nil {
+		return err
+	}
+
+	// UE location handling
+	HandleUpdateUeLocation(txn)
+
+	// Access type change handling
+	if err := HandleUpdateAccessType(txn, &response, pfcpAction, pfcpParam); err != nil {
+		return err
+	}
+
+	// MA PDU session access release handling
+	HandleUpdateMaRelease(txn, &response, pfcpAction, pfcpParam)
+
+	// Presence in LADN handling
+	if err := HandleUpdatePresenceInLadn(txn, &response, pfcpAction, pfcpParam); err != nil {
+		return err
+	}
+
 	// UP Cnx State handling
 	if err := HandleUpCnxState(txn, &response, pfcpAction, pfcpParam); err != nil {
 		return err
@@ -493,6 +547,9 @@ func HandlePDUSessionSMContextUpdate(eventData interface{}) error {
 
 				// Form Modify err rsp
 				httpResponse = makePduCtxtModifyErrRsp(smContext, err.Error())
+				if pfcpAction.buildAccessLegAccept {
+					smContext.ReleaseMaPduRules()
+				}
 
 				/*
 					// TODO: Add Ctxt cleanup if PFCP response is context not found,
@@ -506,6 +563,12 @@ func HandlePDUSessionSMContextUpdate(eventData interface{}) error {
 				*/
 			} else {
 				// Modify Success
+				if pfcpAction.buildHandoverCommand {
+					setHandoverCommandTransfer(smContext, &response)
+				}
+				if pfcpAction.buildAccessLegAccept {
+					setAccessLegEstablishmentAccept(txn, &response)
+				}
 				httpResponse = &httpwrapper.Response{
 					Status: http.StatusOK,
 					Body:   response,
@@ -546,7 +609,7 @@ func makePduCtxtModifyErrRsp(smContext *smf_context.SMContext, errStr string) *h
 	problemDetail := smferrors.NewExtProblemDetailsWithCause(errStr, http.StatusServiceUnavailable, errStr, "UPF_NOT_RESPONDING")
 	var n1buf, n2buf []byte
 	var err error
-	if n1buf, err = smf_context.BuildGSMPDUSessionReleaseCommand(smContext); err != nil {
+	if n1buf, err = smf_context.BuildGSMPDUSessionReleaseCommand(smContext, nasMessage.Cause5GSMInsufficientResources); err != nil {
 		smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build GSM PDUSessionReleaseCommand failed: %+v", err)
 	}
 
@@ -750,6 +813,10 @@ func releaseTunnel(smContext *smf_context.SMContext) bool {
 				smContext.SubPduSessLog.Error(err)
 				continue
 			}
+			if _, ok := smContext.PFCPContext[curDataPathNode.GetNodeIP()]; !ok {
+				// no PFCP session left on the UPF
+				continue
+			}
 			if _, exist := deletedPFCPNode[curUPFID]; !exist {
 				err := pfcp_message.SendPfcpSessionDeletionRequest(curDataPathNode.UPF.NodeID, smContext, curDataPathNode.UPF.Port)
 				if err != nil {
@@ -760,6 +827,7 @@ func releaseTunnel(smContext *smf_context.SMContext) bool {
 			}
 		}
 	}
+	smContext.ReleaseMaPduRules()
 	smContext.Tunnel = nil
 	return true
 }
@@ -786,6 +854,9 @@ func SendPduSessN1N2Transfer(smContext *smf_context.SMContext, success bool) err
 	// N1N2 Json Data
 	jsonData := models.NewN1N2MessageTransferReqData()
 	jsonData.SetPduSessionId(smContext.PDUSessionID)
+	if success && smContext.MaPdu != nil {
+		jsonData.SetMaAcceptedInd(true)
+	}
 	n1n2Request.SetJsonData(*jsonData)
 
 	if success {
@@ -817,8 +888,8 @@ func SendPduSessN1N2Transfer(smContext *smf_context.SMContext, success bool) err
 			}
 		}
 	} else {
-		if smNasBuf, err := smf_context.BuildGSMPDUSessionEstablishmentReject(smContext,
-			nasMessage.Cause5GSMRequestRejectedUnspecified); err != nil {
+		// PFCP session establishment failed, the UPF is unable to serve the PDU session
+		if smNasBuf, err := smf_context.BuildGSMPDUSessionEstablishmentRejectDnnUnavailable(smContext); err != nil {
 			logger.PduSessLog.Errorf("build GSM PDUSessionEstablishmentReject failed: %s", err)
 		} else {
 			tmpFile, err := util.CreatePayloadTempFile(smNasBuf)
@@ -861,6 +932,9 @@ func SendPduSessN1N2Transfer(smContext *smf_context.SMContext, success bool) err
 	if err != nil {
 		smContext.SubPfcpLog.Errorf("CommitSmPolicyDecision failed, %v", err)
 	}
+	if success {
+		smContext.StartDnAaaSession()
+	}
 	smContext.SubPduSessLog.Infof("N1N2 Transfer completed")
 	return nil
 }
@@ -947,7 +1021,7 @@ func HandlePFCPResponse(smContext *smf_context.SMContext,
 		problemDetail := smferrors.NewExtProblemDetailsWithCause("PFCP Session Mod Timeout", http.StatusGatewayTimeout, "PFCP Session Modification Timeout", "UPF_NOT_RESPONDING")
 		var n1buf, n2buf []byte
 		var err error
-		if n1buf, err = smf_context.BuildGSMPDUSessionReleaseCommand(smContext); err != nil {
+		if n1buf, err = smf_context.BuildGSMPDUSessionReleaseCommand(smContext, nasMessage.Cause5GSMInsufficientResources); err != nil {
 			smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build GSM PDUSessionReleaseCommand failed: %+v", err)
 		}
 
@@ -1001,3 +1075,15 @@ func HandlePFCPResponse(smContext *smf_context.SMContext,
 	smContext.SubPfcpLog.Debugln("out HandlePFCPResponse")
 	return httpResponse
 }
+
+// HandleLadnRelease releases the PDU session of a LADN DNN once the UE stayed
+// out of the LADN service area for the release timer
+func HandleLadnRelease(smContext *smf_context.SMContext) {
+	releasePDUSessionByNetwork(smContext, "out of LADN service area", nasMessage.Cause5GSMOutOfLADNServiceArea)
+}
+
+// HandleDhcpLeaseExpiry releases the PDU session whose UE address lease
+// expired without being renewed by the DHCP server
+func HandleDhcpLeaseExpiry(smContext *smf_context.SMContext) {
+	releasePDUSessionByNetwork(smContext, "DHCP lease expiry", nasMessage.Cause5GSMRegularDeactivation)
+}
@@ -0,0 +1,261 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package producer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/omec-project/nas/v2"
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/consumer"
+	smf_context "github.com/omec-project/smf/context"
+	"github.com/omec-project/smf/smferrors"
+	"github.com/omec-project/smf/transaction"
+	"github.com/omec-project/smf/util"
+	"github.com/omec-project/util/httpwrapper"
+)
+
+// SendPduSessAuthenticationCommand sends the pending EAP request of the DN-AAA
+// server to the UE in a PDU Session Authentication Command, TS 23.502 4.3.2.3
+func SendPduSessAuthenticationCommand(smContext *smf_context.SMContext) error {
+	if !smContext.IsSecondaryAuthPending() {
+		return fmt.Errorf("no EAP request pending")
+	}
+
+	n1n2Request := models.NewN1N2MessageTransferRequest()
+	defer util.CleanupMultipartTempFiles(n1n2Request)
+
+	smNasBuf, err := smf_context.BuildGSMPDUSessionAuthenticationCommand(smContext, smContext.SecondaryAuth.EapRequest)
+	if err != nil {
+		return fmt.Errorf("build GSM PDUSessionAuthenticationCommand failed: %w", err)
+	}
+	tmpFile, err := util.CreatePayloadTempFile(smNasBuf)
+	if err != nil {
+		return err
+	}
+	n1n2Request.SetBinaryDataN1Message(tmpFile)
+	jsonData := models.NewN1N2MessageTransferReqData()
+	jsonData.SetPduSessionId(smContext.PDUSessionID)
+	jsonData.SetN1MessageContainer(*models.NewN1MessageContainer("SM", models.RefToBinaryData{ContentId: "GSM_NAS"}))
+	n1n2Request.SetJsonData(*jsonData)
+
+	smContext.SubPduSessLog.Infof("PDU session authentication command N1N2 transfer initiated")
+	smContext.SMLock.Lock()
+	rspData, err := consumer.SendN1N2TransferWithRediscovery(context.Background(), smContext, n1n2Request)
+	smContext.SMLock.Unlock()
+	if err != nil {
+		return err
+	}
+	if rspData.GetCause() == models.N1N2MESSAGETRANSFERCAUSE_N1_MSG_NOT_TRANSFERRED {
+		return fmt.Errorf("N1N2MessageTransfer failure, %v", rspData.Cause)
+	}
+	return nil
+}
+
+// HandlePDUSessionAuthenticationComplete relays the EAP response of the UE to
+// the DN-AAA server. The next EAP request is returned to the UE until the
+// DN-AAA server completes the authentication; once authorized the PDU session
+// establishment resumes, otherwise it is rejected.
+func HandlePDUSessionAuthenticationComplete(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	body := txn.Req.(models.UpdateSmContextRequest)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	buf, err := readBinaryN2SmInformation(body.BinaryDataN1SmMessage)
+	m := nas.NewMessage()
+	if err == nil && buf != nil {
+		err = m.GsmMessageDecode(&buf)
+	}
+	if err != nil || buf == nil || m.GsmHeader.GetMessageType() != nas.MsgTypePDUSessionAuthenticationComplete {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, PDU session authentication complete expected: %v", err)
+		txn.Rsp = &httpwrapper.Response{
+			Status: http.StatusForbidden,
+			Body: models.UpdateSmContext400Response{
+				JsonData: &models.SmContextUpdateError{
+					Error: smferrors.N1SmError,
+				},
+			},
+		}
+		return fmt.Errorf("PDU session authentication complete expected")
+	}
+
+	dnAaaInfo := smf_context.RetrieveDnAaaInfo(smContext.Dnn)
+	if dnAaaInfo == nil {
+		err = fmt.Errorf("no DN-AAA server for DNN %s", smContext.Dnn)
+	} else {
+		err = smContext.RelayEapResponse(dnAaaInfo, m.PDUSessionAuthenticationComplete.GetEAPMessage())
+	}
+	if err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, secondary authentication failed: %v", err)
+		txn.Rsp = makeSecondaryAuthRejectRsp(smContext, "SecondaryAuthFailure")
+		smf_context.RemoveSMContext(smContext.Ref)
+		return err
+	}
+
+	var response models.UpdateSmContext200Response
+	response.JsonData = models.NewSmContextUpdatedData()
+
+	if smContext.IsSecondaryAuthPending() {
+		// EAP challenge, the next request goes to the UE
+		smNasBuf, err := smf_context.BuildGSMPDUSessionAuthenticationCommand(smContext, smContext.SecondaryAuth.EapRequest)
+		if err != nil {
+			smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build GSM PDUSessionAuthenticationCommand failed: %v", err)
+			txn.Rsp = makeSystemFailureRsp()
+			return err
+		}
+		tmpFile, err := util.CreatePayloadTempFile(smNasBuf)
+		if err != nil {
+			smContext.SubPduSessLog.Errorln(err)
+			txn.Rsp = makeSystemFailureRsp()
+			return err
+		}
+		response.BinaryDataN1SmMessage = &tmpFile
+		response.JsonData.N1SmMsg = &models.RefToBinaryData{ContentId: "PDUSessionAuthenticationCommand"}
+		txn.Rsp = &httpwrapper.Response{
+			Status: http.StatusOK,
+			Body:   response,
+		}
+		return nil
+	}
+
+	smContext.SubPduSessLog.Infof("PDUSessionSMContextUpdate, secondary authentication success")
+	if cause, err := establishPDUSession(smContext); err != nil {
+		txn.Rsp = makeSecondaryAuthRejectRsp(smContext, cause)
+		smf_context.RemoveSMContext(smContext.Ref)
+		return err
+	}
+
+	txn.Rsp = &httpwrapper.Response{
+		Status: http.StatusOK,
+		Body:   response,
+	}
+	return nil
+}
+
+// makeSystemFailureRsp answers the SM context update the SMF failed to handle
+func makeSystemFailureRsp() *httpwrapper.Response {
+	problemDetail := smferrors.NewExtProblemDetailsSystemFailure()
+	return &httpwrapper.Response{
+		Status: int(problemDetail.GetStatus()),
+		Body: models.UpdateSmContext400Response{
+			JsonData: models.NewSmContextUpdateError(problemDetail),
+		},
+	}
+}
+
+// makeSecondaryAuthRejectRsp rejects the PDU session establishment in the
+// response to the SM context update carrying the authentication of the UE
+func makeSecondaryAuthRejectRsp(smContext *smf_context.SMContext, cause string) *httpwrapper.Response {
+	jsonData := models.NewSmContextUpdateError(smferrors.ErrorType[cause])
+	responseBody := models.UpdateSmContext400Response{
+		JsonData: jsonData,
+	}
+	if buf, err := smf_context.BuildGSMPDUSessionEstablishmentReject(smContext, smferrors.ErrorCause[cause]); err != nil {
+		smContext.SubPduSessLog.Errorf("PDUSessionSMContextUpdate, build GSM PDUSessionEstablishmentReject failed: %v", err)
+	} else if tmpFile, err := util.CreatePayloadTempFile(buf); err != nil {
+		smContext.SubPduSessLog.Errorln(err)
+	} else {
+		jsonData.SetN1SmMsg(models.RefToBinaryData{ContentId: "PDUSessionEstablishmentReject"})
+		responseBody.SetBinaryDataN1SmMessage(tmpFile)
+	}
+	return &httpwrapper.Response{
+		Status: int(*smferrors.ErrorType[cause].Status),
+		Body:   responseBody,
+	}
+}
+
+// HandleSecondaryAuthRelease releases the PDU session released by the UE or
+// the AMF during its authentication, no UE address, SM policy association or
+// user plane being allocated yet
+func HandleSecondaryAuthRelease(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	smContext.SubPduSessLog.Infof("PDUSessionSMContextRelease, PDU session released during secondary authentication")
+	txn.Rsp = &httpwrapper.Response{
+		Status: http.StatusNoContent,
+	}
+	smf_context.RemoveSMContext(smContext.Ref)
+	return nil
+}
+
+// HandleSecondaryAuthN1N2TransFailInd removes the SM context of the PDU
+// session whose authentication command the AMF failed to deliver to the UE
+func HandleSecondaryAuthN1N2TransFailInd(eventData interface{}) error {
+	txn := eventData.(*transaction.Transaction)
+	smContext := txn.Ctxt.(*smf_context.SMContext)
+
+	smContext.SMLock.Lock()
+	defer smContext.SMLock.Unlock()
+
+	smContext.SubPduSessLog.Warnf("PDU session authentication command not delivered to the UE, SM context removed")
+	smf_context.RemoveSMContext(smContext.Ref)
+	return nil
+}
+
+// HandleEapGuardTimeout rejects the PDU session establishment whose EAP
+// request is left unanswered by the UE, then removes the SM context
+func HandleEapGuardTimeout(smContext *smf_context.SMContext, eapId uint8) {
+	smContext.SMLock.Lock()
+	if smContext.SMContextState != smf_context.SmStateSecondaryAuthPending || !smContext.IsEapRequestPending(eapId) {
+		// answered meanwhile
+		smContext.SMLock.Unlock()
+		return
+	}
+	smContext.ChangeState(smf_context.SmStateRelease)
+	smContext.SMLock.Unlock()
+
+	if err := sendEstablishmentRejectN1N2Transfer(smContext,
+		nasMessage.Cause5GSMUserAuthenticationOrAuthorizationFailed); err != nil {
+		smContext.SubPduSessLog.Errorf("EAP guard timeout, N1N2 transfer failed: %v", err)
+	}
+	removeSMContextByNetwork(smContext, "EAP guard timeout")
+}
+
+// sendEstablishmentRejectN1N2Transfer sends the PDU Session Establishment
+// Reject to the UE
+func sendEstablishmentRejectN1N2Transfer(smContext *smf_context.SMContext, cause uint8) error {
+	n1n2Request := models.NewN1N2MessageTransferRequest()
+	defer util.CleanupMultipartTempFiles(n1n2Request)
+
+	smNasBuf, err := smf_context.BuildGSMPDUSessionEstablishmentReject(smContext, cause)
+	if err != nil {
+		return fmt.Errorf("build GSM PDUSessionEstablishmentReject failed: %w", err)
+	}
+	tmpFile, err := util.CreatePayloadTempFile(smNasBuf)
+	if err != nil {
+		return err
+	}
+	n1n2Request.SetBinaryDataN1Message(tmpFile)
+	jsonData := models.NewN1N2MessageTransferReqData()
+	jsonData.SetPduSessionId(smContext.PDUSessionID)
+	jsonData.SetN1MessageContainer(*models.NewN1MessageContainer("SM", models.RefToBinaryData{ContentId: "GSM_NAS"}))
+	n1n2Request.SetJsonData(*jsonData)
+
+	smContext.SMLock.Lock()
+	rspData, err := consumer.SendN1N2TransferWithRediscovery(context.Background(), smContext, n1n2Request)
+	smContext.SMLock.Unlock()
+	if err != nil {
+		return err
+	}
+	if rspData.GetCause() == models.N1N2MESSAGETRANSFERCAUSE_N1_MSG_NOT_TRANSFERRED {
+		return fmt.Errorf("N1N2MessageTransfer failure, %v", rspData.Cause)
+	}
+	return nil
+}
+
+// HandleDnAaaSessionTimeout releases the PDU session once the Session-Timeout
+// authorized by the DN-AAA server expires, TS 29.561 11.3.2
+func HandleDnAaaSessionTimeout(smContext *smf_context.SMContext) {
+	releasePDUSessionByNetwork(smContext, "DN-AAA session timeout", nasMessage.Cause5GSMRegularDeactivation)
+}
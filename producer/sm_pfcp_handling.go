@@ -20,7 +20,12 @@ func SendPfcpSessionModifyReq(smContext *smf_context.SMContext, pfcpParam *pfcpP
 	if err != nil {
 		smContext.SubCtxLog.Errorf("pfcp session modification failure: %+v", err)
 	}
+	return waitPfcpSessionModifyRsp(smContext)
+}
 
+// waitPfcpSessionModifyRsp waits for the UPFs pending for the PFCP session
+// modification to answer
+func waitPfcpSessionModifyRsp(smContext *smf_context.SMContext) error {
 	PFCPResponseStatus := <-smContext.SBIPFCPCommunicationChan
 
 	switch PFCPResponseStatus {
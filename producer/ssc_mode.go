@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package producer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/consumer"
+	smf_context "github.com/omec-project/smf/context"
+	"github.com/omec-project/smf/util"
+)
+
+// relocatePsa relocates the PSA of an SSC mode 2 or 3 PDU session whose
+// relocation was started, TS 23.502 4.3.5. The SSC mode 2 PDU session is
+// released, the UE being asked to establish it again on the new PSA.
+func relocatePsa(smContext *smf_context.SMContext) {
+	smContext.SMLock.Lock()
+	sscMode := smContext.SscMode
+	smContext.SMLock.Unlock()
+	if sscMode == smf_context.SscMode3 {
+		relocatePsaMakeBeforeBreak(smContext)
+		return
+	}
+	releasePDUSessionByNetwork(smContext, "PSA relocation", nasMessage.Cause5GSMReactivationRequested)
+}
+
+// relocatePsaMakeBeforeBreak asks the UE of an SSC mode 3 PDU session to
+// establish a PDU session to the same DNN, which gets the new PSA and a new
+// UE address. The PDU session is released at the end of the address lifetime.
+func relocatePsaMakeBeforeBreak(smContext *smf_context.SMContext) {
+	whenActive(smContext, "PSA relocation", smf_context.SmStateActive, func() {
+		sendAddressLifetime(smContext)
+	})
+}
+
+// sendAddressLifetime sends the PDU session address lifetime to the UE, then
+// releases the PDU session once it expires
+func sendAddressLifetime(smContext *smf_context.SMContext) {
+	lifetime := smf_context.RetrieveAddressLifetime(smContext.Dnn)
+	if err := sendAddressLifetimeN1N2Transfer(smContext, lifetime); err != nil {
+		smContext.SubPduSessLog.Errorf("PSA relocation, N1N2 transfer failed: %v", err)
+		smContext.SMLock.Lock()
+		smContext.StopPsaRelocation()
+		smContext.SMLock.Unlock()
+		return
+	}
+	smContext.SubPduSessLog.Infof("PSA relocation, PDU session released in %v", lifetime)
+	time.AfterFunc(lifetime, func() {
+		releasePDUSessionByNetwork(smContext, "PDU session address lifetime expiry", nasMessage.Cause5GSMRegularDeactivation)
+	})
+}
+
+// sendAddressLifetimeN1N2Transfer sends the PDU Session Modification Command
+// with the PDU session address lifetime to the UE
+func sendAddressLifetimeN1N2Transfer(smContext *smf_context.SMContext, lifetime time.Duration) error {
+	n1n2Request := models.NewN1N2MessageTransferRequest()
+	defer util.CleanupMultipartTempFiles(n1n2Request)
+
+	smNasBuf, err := smf_context.BuildGSMPDUSessionAddressLifetimeCommand(smContext, lifetime)
+	if err != nil {
+		return fmt.Errorf("build GSM PDUSessionModificationCommand failed: %w", err)
+	}
+	tmpFile, err := util.CreatePayloadTempFile(smNasBuf)
+	if err != nil {
+		return err
+	}
+	n1n2Request.SetBinaryDataN1Message(tmpFile)
+
+	jsonData := models.NewN1N2MessageTransferReqData()
+	jsonData.SetPduSessionId(smContext.PDUSessionID)
+	jsonData.SetN1MessageContainer(*models.NewN1MessageContainer("SM", models.RefToBinaryData{ContentId: "GSM_NAS"}))
+	n1n2Request.SetJsonData(*jsonData)
+
+	smContext.SMLock.Lock()
+	rspData, err := consumer.SendN1N2TransferWithRediscovery(context.Background(), smContext, n1n2Request)
+	smContext.SMLock.Unlock()
+	if err != nil {
+		return err
+	}
+	if rspData.GetCause() == models.N1N2MESSAGETRANSFERCAUSE_N1_MSG_NOT_TRANSFERRED {
+		return fmt.Errorf("N1N2MessageTransfer failure, %v", rspData.Cause)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package producer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/omec-project/nas/v2/nasMessage"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/consumer"
+	smf_context "github.com/omec-project/smf/context"
+	"github.com/omec-project/smf/pfcp/udp"
+	"github.com/omec-project/smf/util"
+)
+
+// reanchorTimeout bounds the wait for the PFCP session establishment on the
+// alternate UPF, the request being retransmitted meanwhile
+const reanchorTimeout = (udp.NumOfResend + 1) * udp.ResendRequestTimeOutPeriod * time.Second
+
+// HandleUpfFailure applies the UPF failure policy of the DNN to the PDU
+// session with a PFCP session on the failed UPF. Sessions which cannot be
+// re-anchored are released, the UE being asked to establish them again.
+func HandleUpfFailure(smContext *smf_context.SMContext, upf *smf_context.UPF) {
+	if smf_context.RetrieveUpfFailurePolicy(smContext.Dnn) != smf_context.UpfFailurePolicyReanchor {
+		whenActive(smContext, "UPF failure", smf_context.SmStatePfcpRelease, func() {
+			releasePDUSessionOnUpfFailure(smContext, upf)
+		})
+		return
+	}
+	whenActive(smContext, "UPF failure", smf_context.SmStatePfcpCreatePending, func() {
+		if err := reanchorPDUSession(smContext, upf); err != nil {
+			smContext.SubPduSessLog.Errorf("re-anchoring failed: %v", err)
+			releasePDUSessionOnUpfFailure(smContext, upf)
+		}
+	})
+}
+
+// releasePDUSessionOnUpfFailure releases the PDU session of the failed UPF.
+// The PFCP sessions on the failed UPF and those not established by an
+// alternate UPF are dropped, only the other UPFs being asked to delete theirs.
+func releasePDUSessionOnUpfFailure(smContext *smf_context.SMContext, failed *smf_context.UPF) {
+	if err := sendReleaseN1N2Transfer(smContext, nasMessage.Cause5GSMReactivationRequested); err != nil {
+		smContext.SubPduSessLog.Errorf("UPF failure, N1N2 transfer failed: %v", err)
+	}
+
+	smContext.SMLock.Lock()
+	smContext.ChangeState(smf_context.SmStatePfcpRelease)
+	smContext.DropFailedPFCPSessions(failed)
+	established := len(smContext.PFCPContext) != 0
+	smContext.SMLock.Unlock()
+	if established {
+		if err := SendPfcpSessionReleaseReq(smContext); err != nil {
+			smContext.SubPduSessLog.Errorf("UPF failure, PFCP session release failed: %v", err)
+		}
+	} else {
+		// no UPF left to signal
+		releaseTunnel(smContext)
+	}
+	removeSMContextByNetwork(smContext, "UPF failure")
+}
+
+// reanchorPDUSession establishes the PFCP session of the PDU session on an
+// alternate UPF and moves the uplink of the AN to it, TS 23.501 5.6.9.2.1.
+// The PDU session is left in PfcpCreatePending state on failure, including
+// no answer of the alternate UPF.
+func reanchorPDUSession(smContext *smf_context.SMContext, failed *smf_context.UPF) error {
+	smContext.SMLock.Lock()
+	path := smContext.AlternateUserPlanePath(failed)
+	if path == nil {
+		smContext.SMLock.Unlock()
+		return fmt.Errorf("no alternate UPF keeping the UE address")
+	}
+	if err := smContext.Reanchor(failed, path); err != nil {
+		smContext.SMLock.Unlock()
+		return err
+	}
+	smContext.SMLock.Unlock()
+
+	SendPFCPRules(smContext)
+	var err error
+	select {
+	case result := <-smContext.SBIPFCPCommunicationChan:
+		if result != smf_context.SessionEstablishSuccess {
+			err = fmt.Errorf("PFCP session establishment on the alternate UPF failed")
+		}
+	case <-time.After(reanchorTimeout):
+		err = fmt.Errorf("no PFCP session establishment response of the alternate UPF in %v", reanchorTimeout)
+	}
+	smContext.SMLock.Lock()
+	smContext.StopReanchoring()
+	smContext.SMLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	smContext.SMLock.Lock()
+	smContext.ChangeState(smf_context.SmStateActive)
+	upCnxState := smContext.UpCnxState
+	smContext.SMLock.Unlock()
+	if upCnxState == models.UPCNXSTATE_DEACTIVATED {
+		// the AN gets the uplink tunnel at the next UP activation
+		return nil
+	}
+	return sendUlTunnelModifyN1N2Transfer(smContext)
+}
+
+// sendUlTunnelModifyN1N2Transfer sends the PDU Session Resource Modify
+// Request moving the uplink of the AN to the UPF of the PDU session
+func sendUlTunnelModifyN1N2Transfer(smContext *smf_context.SMContext) error {
+	n1n2Request := models.NewN1N2MessageTransferRequest()
+	defer util.CleanupMultipartTempFiles(n1n2Request)
+
+	smContext.SMLock.Lock()
+	n2Pdu, err := smf_context.BuildULNGUUPTNLModifyRequestTransfer(smContext)
+	smContext.SMLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("build PDUSessionResourceModifyRequestTransfer failed: %w", err)
+	}
+	tmpFile, err := util.CreatePayloadTempFile(n2Pdu)
+	if err != nil {
+		return err
+	}
+	n1n2Request.SetBinaryDataN2Information(tmpFile)
+
+	jsonData := models.NewN1N2MessageTransferReqData()
+	jsonData.SetPduSessionId(smContext.PDUSessionID)
+	n2InfoContent := models.NewN2InfoContent(models.RefToBinaryData{ContentId: "N2SmInformation"})
+	n2InfoContent.SetNgapIeType(models.NGAPIETYPE_PDU_RES_MOD_REQ)
+	smInfo := models.NewN2SmInformation(smContext.PDUSessionID)
+	smInfo.SetN2InfoContent(*n2InfoContent)
+	if smContext.Snssai != nil {
+		smInfo.SetSNssai(*smContext.Snssai)
+	}
+	n2InfoContainer := models.NewN2InfoContainer(models.N2INFORMATIONCLASS_SM)
+	n2InfoContainer.SetSmInfo(*smInfo)
+	jsonData.SetN2InfoContainer(*n2InfoContainer)
+	n1n2Request.SetJsonData(*jsonData)
+
+	smContext.SMLock.Lock()
+	rspData, err := consumer.SendN1N2TransferWithRediscovery(context.Background(), smContext, n1n2Request)
+	smContext.SMLock.Unlock()
+	if err != nil {
+		return err
+	}
+	if rspData.GetCause() == models.N1N2MESSAGETRANSFERCAUSE_N1_MSG_NOT_TRANSFERRED {
+		return fmt.Errorf("N1N2MessageTransfer failure, %v", rspData.Cause)
+	}
+	return nil
+}
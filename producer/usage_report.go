@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package producer
+
+import (
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/consumer"
+	smfContext "github.com/omec-project/smf/context"
+)
+
+// HandleUsageReport reports to the PCF the usage measured by the UPF once a
+// usage monitoring threshold is reached (TS 23.503 6.2.2.3), then enforces the
+// SM policy decision returned by the PCF, e.g. new thresholds. The report
+// waits for the PDU session to be Active, which stays in Modify state meanwhile.
+func HandleUsageReport(smContext *smfContext.SMContext, reports []*smfContext.UsageReport) {
+	whenActive(smContext, "usage report", smfContext.SmStateModify, func() {
+		reportUsage(smContext, reports)
+	})
+}
+
+func reportUsage(smContext *smfContext.SMContext, reports []*smfContext.UsageReport) {
+	smContext.SMLock.Lock()
+
+	if !smContext.SmPolicyData.IsUsageReportRequired() {
+		smContext.SubQosLog.Infof("US_RE policy control request trigger not armed, %d usage report(s) not sent to PCF", len(reports))
+		smContext.ChangeState(smfContext.SmStateActive)
+		smContext.SMLock.Unlock()
+		return
+	}
+
+	accuUsageReports := smContext.BuildAccuUsageReports(reports)
+	smContext.SMLock.Unlock()
+
+	smPolicyDecision := sendUsageReport(smContext, accuUsageReports)
+
+	smContext.SMLock.Lock()
+	if smContext.SMContextState != smfContext.SmStateModify {
+		// released meanwhile
+		smContext.SMLock.Unlock()
+		return
+	}
+	smContext.ChangeState(smfContext.SmStateActive)
+	if smPolicyDecision == nil || !hasPolicyData(smPolicyDecision) {
+		if smPolicyDecision != nil && smPolicyDecision.PolicyCtrlReqTriggers != nil {
+			smContext.SmPolicyData.PolicyCtrlReqTriggers = smPolicyDecision.PolicyCtrlReqTriggers
+		}
+		smContext.SMLock.Unlock()
+		return
+	}
+	if err := enforceSmPolicyDecision(smContext, smPolicyDecision); err != nil {
+		smContext.SubQosLog.Errorf("SM policy decision after usage report not enforced: %v", err)
+	}
+}
+
+// sendUsageReport reports the accumulated usage to the PCF, returning its SM
+// policy decision if any
+func sendUsageReport(smContext *smfContext.SMContext, accuUsageReports []models.AccuUsageReport) *models.SmPolicyDecision {
+	if len(accuUsageReports) == 0 {
+		return nil
+	}
+	smContext.SubQosLog.Infof("report usage of %d usage monitoring data to PCF", len(accuUsageReports))
+	smPolicyDecision, httpStatus, err := consumer.SendSMPolicyAssociationUpdateByUsageReport(smContext, accuUsageReports)
+	if err != nil {
+		smContext.SubQosLog.Errorf("usage report to PCF failed, status [%d]: %v", httpStatus, err)
+		return nil
+	}
+	return smPolicyDecision
+}
+
+// hasPolicyData reports whether the SM policy decision provisions rules or policy data
+func hasPolicyData(smPolicyDecision *models.SmPolicyDecision) bool {
+	return len(smPolicyDecision.GetPccRules()) > 0 || len(smPolicyDecision.GetSessRules()) > 0 ||
+		len(smPolicyDecision.GetQosDecs()) > 0 || len(smPolicyDecision.GetTraffContDecs()) > 0 ||
+		len(smPolicyDecision.GetUmDecs()) > 0 || len(smPolicyDecision.GetConds()) > 0
+}
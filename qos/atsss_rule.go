@@ -0,0 +1,248 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package qos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/logger"
+)
+
+// ATSSS parameter identifiers, TS 24.193 6.1.3.1
+const (
+	AtsssParameterIdAtsssRules uint8 = 0x01
+)
+
+const (
+	AtsssRuleOperationCreateNewAtsssRule uint8 = 0x01
+)
+
+// Steering modes of the access selection descriptor, TS 24.193 6.1.3.2
+const (
+	AtsssSteeringModeActiveStandby uint8 = 0x01
+	AtsssSteeringModeSmallestDelay uint8 = 0x02
+	AtsssSteeringModeLoadBalancing uint8 = 0x03
+	AtsssSteeringModePriorityBased uint8 = 0x04
+)
+
+// Steering functionalities of the access selection descriptor
+const (
+	AtsssSteeringFunctionalityMPTCP   uint8 = 0x01
+	AtsssSteeringFunctionalityATSSSLL uint8 = 0x02
+)
+
+// Accesses of the steering mode information
+const (
+	atsssAccess3GPP    uint8 = 0
+	atsssAccessNon3GPP uint8 = 1
+)
+
+const defaultAtsssRuleId uint8 = 255
+
+// AtsssRule is the ATSSS rule the UE applies to steer its uplink traffic
+// across the accesses of an MA PDU session, TS 24.193 5.32.8
+type AtsssRule struct {
+	TrafficDescriptor     []PacketFilterComponent
+	Identifier            uint8
+	Precedence            uint8
+	SteeringMode          uint8
+	SteeringModeInfo      uint8
+	SteeringFunctionality uint8
+}
+
+type AtsssRules []AtsssRule
+
+// BuildAtsssRules builds an ATSSS rule per flow of the PCC rules whose
+// traffic control data carry steering modes, and the default match-all rule
+// keeping the traffic on the access the MA PDU session was established over.
+// Only the ATSSS-LL functionality is provided: the UPF runs no MPTCP proxy.
+func BuildAtsssRules(pccRules map[string]*models.PccRule, tcData map[string]*models.TrafficControlData,
+	access models.AccessType,
+) AtsssRules {
+	names := make([]string, 0, len(pccRules))
+	for name, pccRule := range pccRules {
+		if pccRule != nil && len(pccRule.GetRefTcData()) > 0 {
+			names = append(names, name)
+		}
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if pa, pb := pccRules[a].GetPrecedence(), pccRules[b].GetPrecedence(); pa != pb {
+			return int(pa - pb)
+		}
+		return strings.Compare(a, b)
+	})
+
+	atsssRules := AtsssRules{}
+	identifier := uint8(1)
+	for _, name := range names {
+		pccRule := pccRules[name]
+		tc := tcData[pccRule.GetRefTcData()[0]]
+		if tc == nil || (tc.SteerModeUl == nil && tc.SteerModeDl == nil) {
+			continue
+		}
+		// the UE steers the uplink traffic
+		steerMode := tc.SteerModeUl
+		if steerMode == nil {
+			steerMode = tc.SteerModeDl
+		}
+		if sf := tc.GetSteerFun(); sf != "" && sf != models.STEERINGFUNCTIONALITY_ATSSS_LL {
+			logger.QosLog.Infof("steering functionality %s of PCC rule [%s] not supported, ATSSS-LL used", sf, name)
+		}
+		mode, info := atsssAccessSelection(steerMode, access)
+		precedence := uint8(min(max(pccRule.GetPrecedence(), 0), int32(defaultAtsssRuleId-1)))
+		pfList, err := GetPacketFiltersFromPccRule(pccRule)
+		if err != nil {
+			logger.QosLog.Errorf("skip ATSSS rules: %v", err)
+			continue
+		}
+		for _, pf := range pfList {
+			if identifier == defaultAtsssRuleId {
+				logger.QosLog.Warnf("no ATSSS rule identifier left for PCC rule [%s]", name)
+				break
+			}
+			atsssRules = append(atsssRules, AtsssRule{
+				Identifier:            identifier,
+				Precedence:            precedence,
+				TrafficDescriptor:     trafficDescriptor(pf),
+				SteeringMode:          mode,
+				SteeringModeInfo:      info,
+				SteeringFunctionality: AtsssSteeringFunctionalityATSSSLL,
+			})
+			identifier++
+		}
+	}
+
+	mode, info := atsssAccessSelection(nil, access)
+	return append(atsssRules, AtsssRule{
+		Identifier:            defaultAtsssRuleId,
+		Precedence:            defaultAtsssRuleId,
+		TrafficDescriptor:     []PacketFilterComponent{{ComponentType: PFComponentTypeMatchAll}},
+		SteeringMode:          mode,
+		SteeringModeInfo:      info,
+		SteeringFunctionality: AtsssSteeringFunctionalityATSSSLL,
+	})
+}
+
+// trafficDescriptor keeps the packet filter components the traffic descriptor
+// of an ATSSS rule allows, which only describe the remote end
+func trafficDescriptor(pf PacketFilter) []PacketFilterComponent {
+	components := make([]PacketFilterComponent, 0, len(pf.Content))
+	for _, component := range pf.Content {
+		switch component.ComponentType {
+		case PFComponentTypeIPv4RemoteAddress, PFComponentTypeIPv6RemoteAddress,
+			PFComponentTypeProtocolIdentifierOrNextHeader, PFComponentTypeSingleRemotePort,
+			PFComponentTypeRemotePortRange:
+			components = append(components, component)
+		}
+	}
+	if len(components) == 0 {
+		return []PacketFilterComponent{{ComponentType: PFComponentTypeMatchAll}}
+	}
+	return components
+}
+
+// atsssAccessSelection returns the steering mode and its information: the
+// active and standby access of Active-Standby, the share of the 3GPP access
+// in percent of Load-Balancing and the priority access of Priority-based.
+// Without steering mode the traffic stays on the given access.
+func atsssAccessSelection(steerMode *models.SteeringMode, access models.AccessType) (uint8, uint8) {
+	if steerMode == nil {
+		return AtsssSteeringModeActiveStandby, atsssAccess(access) | 1<<1
+	}
+	switch steerMode.SteerModeValue {
+	case models.STEERMODEVALUE_SMALLEST_DELAY:
+		return AtsssSteeringModeSmallestDelay, 0
+	case models.STEERMODEVALUE_LOAD_BALANCING:
+		return AtsssSteeringModeLoadBalancing, uint8(min(max(steerMode.GetVar3gLoad(), 0), 100))
+	case models.STEERMODEVALUE_PRIORITY_BASED:
+		return AtsssSteeringModePriorityBased, atsssAccess(steerMode.GetPrioAcc())
+	default:
+		active := access
+		if steerMode.Active != nil {
+			active = *steerMode.Active
+		}
+		info := atsssAccess(active)
+		if steerMode.Standby != nil {
+			info |= 1 << 1
+		}
+		return AtsssSteeringModeActiveStandby, info
+	}
+}
+
+func atsssAccess(access models.AccessType) uint8 {
+	if access == models.ACCESSTYPE_NON_3_GPP_ACCESS {
+		return atsssAccessNon3GPP
+	}
+	return atsssAccess3GPP
+}
+
+func (r *AtsssRule) MarshalBinary() ([]byte, error) {
+	trafficDescriptorBuffer := bytes.NewBuffer(nil)
+	for _, component := range r.TrafficDescriptor {
+		trafficDescriptorBuffer.WriteByte(component.ComponentType)
+		trafficDescriptorBuffer.Write(component.ComponentValue)
+	}
+
+	ruleContentBuffer := bytes.NewBuffer(nil)
+	ruleContentBuffer.WriteByte(r.Identifier)
+	ruleContentBuffer.WriteByte(AtsssRuleOperationCreateNewAtsssRule)
+	ruleContentBuffer.WriteByte(r.Precedence)
+	if err := binary.Write(ruleContentBuffer, binary.BigEndian, uint16(trafficDescriptorBuffer.Len())); err != nil {
+		return nil, err
+	}
+	if _, err := ruleContentBuffer.ReadFrom(trafficDescriptorBuffer); err != nil {
+		return nil, err
+	}
+	// access selection descriptor
+	ruleContentBuffer.WriteByte(3)
+	ruleContentBuffer.WriteByte(r.SteeringMode)
+	ruleContentBuffer.WriteByte(r.SteeringModeInfo)
+	ruleContentBuffer.WriteByte(r.SteeringFunctionality)
+
+	ruleBuffer := bytes.NewBuffer(nil)
+	if err := binary.Write(ruleBuffer, binary.BigEndian, uint16(ruleContentBuffer.Len())); err != nil {
+		return nil, err
+	}
+	if _, err := ruleBuffer.ReadFrom(ruleContentBuffer); err != nil {
+		return nil, err
+	}
+	return ruleBuffer.Bytes(), nil
+}
+
+func (rs AtsssRules) MarshalBinary() ([]byte, error) {
+	atsssRulesBuffer := bytes.NewBuffer(nil)
+	for _, rule := range rs {
+		ruleBytes, err := rule.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		atsssRulesBuffer.Write(ruleBytes)
+	}
+	return atsssRulesBuffer.Bytes(), nil
+}
+
+// BuildAtsssParameters encodes the ATSSS rules as the ATSSS parameters of
+// the ATSSS container, TS 24.193 6.1.3.1
+func BuildAtsssParameters(rules AtsssRules) ([]byte, error) {
+	rulesBytes, err := rules.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if len(rulesBytes) > math.MaxUint16 {
+		return nil, fmt.Errorf("ATSSS rules too long: %d octets", len(rulesBytes))
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte(AtsssParameterIdAtsssRules)
+	if err := binary.Write(buf, binary.BigEndian, uint16(len(rulesBytes))); err != nil {
+		return nil, err
+	}
+	buf.Write(rulesBytes)
+	return buf.Bytes(), nil
+}
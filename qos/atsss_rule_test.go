@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package qos_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/omec-project/openapi/v2"
+	"github.com/omec-project/openapi/v2/models"
+	"github.com/omec-project/smf/qos"
+)
+
+func TestBuildAtsssRules(t *testing.T) {
+	loadBalancing := models.NewSteeringMode(models.STEERMODEVALUE_LOAD_BALANCING)
+	loadBalancing.Var3gLoad = openapi.PtrInt32(70)
+	pccRules := map[string]*models.PccRule{
+		"video": {
+			PccRuleId:  "video",
+			Precedence: openapi.PtrInt32(10),
+			RefTcData:  []string{"tc-video"},
+			FlowInfos: []models.FlowInformation{{
+				FlowDescription: openapi.PtrString("permit out 17 from 10.0.0.1 8000 to assigned"),
+				FlowDirection:   models.FLOWDIRECTIONRM_BIDIRECTIONAL.Ptr(),
+			}},
+		},
+		"web": {PccRuleId: "web", Precedence: openapi.PtrInt32(20), RefTcData: []string{"tc-web"}},
+	}
+	tcData := map[string]*models.TrafficControlData{
+		"tc-video": {TcId: "tc-video", SteerModeUl: loadBalancing, SteerFun: models.STEERINGFUNCTIONALITY_MPTCP.Ptr()},
+		"tc-web":   {TcId: "tc-web"},
+	}
+
+	rules := qos.BuildAtsssRules(pccRules, tcData, models.ACCESSTYPE_NON_3_GPP_ACCESS)
+	if len(rules) != 2 {
+		t.Fatalf("expected the video and the default ATSSS rule, got %d rules", len(rules))
+	}
+	video := rules[0]
+	if video.Precedence != 10 || video.SteeringMode != qos.AtsssSteeringModeLoadBalancing || video.SteeringModeInfo != 70 ||
+		video.SteeringFunctionality != qos.AtsssSteeringFunctionalityATSSSLL {
+		t.Errorf("unexpected video ATSSS rule %+v", video)
+	}
+	for _, component := range video.TrafficDescriptor {
+		switch component.ComponentType {
+		case qos.PFComponentTypeIPv4LocalAddress, qos.PFComponentTypeSingleLocalPort, qos.PFComponentTypeLocalPortRange:
+			t.Errorf("unexpected local component %#x in the traffic descriptor", component.ComponentType)
+		}
+	}
+	def := rules[1]
+	if def.Identifier != 255 || def.Precedence != 255 || def.SteeringMode != qos.AtsssSteeringModeActiveStandby ||
+		def.SteeringModeInfo != 0x03 {
+		t.Errorf("unexpected default ATSSS rule %+v", def)
+	}
+}
+
+func TestBuildAtsssParameters(t *testing.T) {
+	rules := qos.AtsssRules{{
+		Identifier:            255,
+		Precedence:            255,
+		TrafficDescriptor:     []qos.PacketFilterComponent{{ComponentType: qos.PFComponentTypeMatchAll}},
+		SteeringMode:          qos.AtsssSteeringModeActiveStandby,
+		SteeringModeInfo:      0x02,
+		SteeringFunctionality: qos.AtsssSteeringFunctionalityATSSSLL,
+	}}
+	buf, err := qos.BuildAtsssParameters(rules)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []byte{
+		0x01, 0x00, 0x0c, // ATSSS rules, length
+		0x00, 0x0a, // rule length
+		0xff, 0x01, 0xff, // identifier, operation, precedence
+		0x00, 0x01, 0x01, // match-all traffic descriptor
+		0x03, 0x01, 0x02, 0x02, // access selection descriptor
+	}
+	if !bytes.Equal(buf, expected) {
+		t.Errorf("expected %x, got %x", expected, buf)
+	}
+}
@@ -4,7 +4,11 @@
 
 package qos
 
-import "github.com/omec-project/openapi/v2/models"
+import (
+	"time"
+
+	"github.com/omec-project/openapi/v2/models"
+)
 
 type CondDataUpdate struct {
 	add, mod, del map[string]*models.ConditionData
@@ -17,10 +21,77 @@ func GetConditionDataUpdate(condData map[string]models.ConditionData, ctxtCondDa
 		del: make(map[string]*models.ConditionData),
 	}
 
-	// TODO
+	// Compare against Ctxt condition data to get added or modified conditions
+	for name, pcfCond := range condData {
+		cond := pcfCond
+		// if condId is empty then it need to be deleted
+		if cond.GetCondId() == "" {
+			change.del[name] = &cond
+			continue
+		}
+
+		// match against SM ctxt condition data for add/mod
+		if ctxtCond := ctxtCondData[name]; ctxtCond == nil {
+			change.add[name] = &cond
+		} else if GetCondDataChanges(&cond, ctxtCond) {
+			change.mod[name] = &cond
+		}
+	}
+
 	return &change
 }
 
 func CommitConditionDataUpdate(smCtxtPolData *SmCtxtPolicyData, update *CondDataUpdate) {
-	// TODO
+	// Iterate through Add/Mod/Del condition data
+
+	// Add new condition data
+	for name, cond := range update.add {
+		smCtxtPolData.SmCtxtCondData.CondData[name] = cond
+	}
+
+	// Mod condition data
+	for name, cond := range update.mod {
+		smCtxtPolData.SmCtxtCondData.CondData[name] = cond
+	}
+
+	// Del condition data
+	for name := range update.del {
+		delete(smCtxtPolData.SmCtxtCondData.CondData, name)
+	}
+}
+
+func (upd *CondDataUpdate) GetDeleted() map[string]*models.ConditionData {
+	if upd == nil {
+		return nil
+	}
+	return upd.del
+}
+
+// GetCondDataChanges reports whether the condition data differ
+func GetCondDataChanges(pcfCond, ctxtCond *models.ConditionData) bool {
+	if pcfCond == nil || ctxtCond == nil {
+		return true
+	}
+
+	return pcfCond.GetCondId() != ctxtCond.GetCondId() ||
+		!pcfCond.GetActivationTime().Equal(ctxtCond.GetActivationTime()) ||
+		!pcfCond.GetDeactivationTime().Equal(ctxtCond.GetDeactivationTime()) ||
+		pcfCond.GetAccessType() != ctxtCond.GetAccessType() ||
+		pcfCond.GetRatType() != ctxtCond.GetRatType()
+}
+
+// IsConditionActive reports whether the time window of the condition data
+// includes the given time. An unset activation time means already active and
+// an unset deactivation time means never deactivated.
+func IsConditionActive(cond *models.ConditionData, now time.Time) bool {
+	if cond == nil {
+		return true
+	}
+	if activation := cond.GetActivationTime(); !activation.IsZero() && now.Before(activation) {
+		return false
+	}
+	if deactivation := cond.GetDeactivationTime(); !deactivation.IsZero() && !now.Before(deactivation) {
+		return false
+	}
+	return true
 }
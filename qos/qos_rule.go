@@ -7,6 +7,8 @@ package qos
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
+	"fmt"
 	"net"
 	"strconv"
 	"strings"
@@ -72,7 +74,8 @@ type IPFilterRulePortRange struct {
 	highLimit string
 }
 
-type IPFilterRuleIpAddrV4 struct {
+// IPv4 or IPv6 address with mask or prefix length
+type IPFilterRuleIpAddr struct {
 	addr string
 	mask string
 }
@@ -81,7 +84,7 @@ type IPFilterRule struct {
 	protoId                string
 	sPort, dPort           string
 	sPortRange, dPortRange IPFilterRulePortRange
-	sAddrv4, dAddrv4       IPFilterRuleIpAddrV4
+	sAddr, dAddr           IPFilterRuleIpAddr
 }
 
 type PacketFilterComponent struct {
@@ -149,7 +152,7 @@ func BuildQosRules(smPolicyUpdates *PolicyUpdate) QoSRules {
 			refQosData := GetQoSDataFromPolicyDecision(smPolicyDecision, pccRuleVal.RefQosData[0])
 			qosRule := BuildAddQoSRuleFromPccRule(pccRuleVal, refQosData, OperationCodeCreateNewQoSRule)
 			if qosRule == nil {
-				logger.QosLog.Warnf("skip QoS rule build for PCC rule [%s]: missing QoS data", pccRuleName)
+				logger.QosLog.Warnf("skip QoS rule build for PCC rule [%s]: missing QoS data or invalid flow", pccRuleName)
 				continue
 			}
 			qosRules = append(qosRules, *qosRule)
@@ -166,7 +169,7 @@ func BuildQosRules(smPolicyUpdates *PolicyUpdate) QoSRules {
 			refQosData := GetQoSDataFromPolicyDecision(smPolicyDecision, pccRuleVal.RefQosData[0])
 			qosRule := BuildModifyQosRuleFromPccRule(pccRuleVal, refQosData, OperationCodeModifyExistingQoSRuleAndReplaceAllPacketFilters)
 			if qosRule == nil {
-				logger.QosLog.Warnf("skip QoS rule modify for PCC rule [%s]: missing QoS data", pccRuleName)
+				logger.QosLog.Warnf("skip QoS rule modify for PCC rule [%s]: missing QoS data or invalid flow", pccRuleName)
 				continue
 			}
 			qosRules = append(qosRules, *qosRule)
@@ -214,7 +217,7 @@ func BuildQosRulesPDUMod(smPolicyUpdates *PolicyUpdate) QoSRules {
 			// Build a new QoS rule from the PCC rule and reference QoS data
 			qosRule := BuildAddQoSRuleFromPccRule(pccRuleVal, refQosData, OperationCodeCreateNewQoSRule)
 			if qosRule == nil {
-				logger.QosLog.Warnf("skip QoS rule build for PCC rule [%s]: missing QoS data", pccRuleName)
+				logger.QosLog.Warnf("skip QoS rule build for PCC rule [%s]: missing QoS data or invalid flow", pccRuleName)
 				continue
 			}
 			// Append the constructed rule to the list
@@ -239,7 +242,7 @@ func BuildQosRulesPDUMod(smPolicyUpdates *PolicyUpdate) QoSRules {
 			// Build a QoS rule for modification (OperationCode can be same as create depending on implementation)
 			qosRule := BuildModifyQosRuleFromPccRule(pccRuleVal, refQosData, OperationCodeModifyExistingQoSRuleAndReplaceAllPacketFilters)
 			if qosRule == nil {
-				logger.QosLog.Warnf("skip QoS rule modify for PCC rule [%s]: missing QoS data", pccRuleName)
+				logger.QosLog.Warnf("skip QoS rule modify for PCC rule [%s]: missing QoS data or invalid flow", pccRuleName)
 				continue
 			}
 
@@ -296,7 +299,10 @@ func BuildAddQoSRuleFromPccRule(pccRule *models.PccRule, qosData *models.QosData
 		QFI:           GetQosFlowIdFromQosId(qosData.GetQosId()),
 	}
 
-	qRule.BuildPacketFilterListFromPccRule(pccRule)
+	if err := qRule.BuildPacketFilterListFromPccRule(pccRule); err != nil {
+		logger.QosLog.Errorf("skip QoS rule: %v", err)
+		return nil
+	}
 
 	return &qRule
 }
@@ -321,7 +327,10 @@ func BuildModifyQosRuleFromPccRule(pccRule *models.PccRule, qosData *models.QosD
 	case OperationCodeModifyExistingQoSRuleAndAddPacketFilters,
 		OperationCodeModifyExistingQoSRuleAndReplaceAllPacketFilters,
 		OperationCodeModifyExistingQoSRuleAndDeletePacketFilters:
-		qRule.BuildPacketFilterListFromPccRule(pccRule)
+		if err := qRule.BuildPacketFilterListFromPccRule(pccRule); err != nil {
+			logger.QosLog.Errorf("skip QoS rule: %v", err)
+			return nil
+		}
 	case OperationCodeModifyExistingQoSRuleWithoutModifyingPacketFilters:
 		// No packet filter changes needed
 	}
@@ -369,27 +378,43 @@ func GetQosRuleIdFromPccRuleId(pccRuleId string) uint8 {
 	}
 }
 
-func (q *QosRule) BuildPacketFilterListFromPccRule(pccRule *models.PccRule) {
-	pfList := []PacketFilter{}
+func (q *QosRule) BuildPacketFilterListFromPccRule(pccRule *models.PccRule) error {
+	pfList, err := GetPacketFiltersFromPccRule(pccRule)
+	if err != nil {
+		return err
+	}
+	q.PacketFilterList = pfList
+	return nil
+}
 
-	// Iterate through
+// GetPacketFiltersFromPccRule returns the packet filters of every flow of the
+// PCC rule. A single invalid flow fails the whole rule, the same way the PDR
+// of the rule is refused, so that the UE never gets a QoS rule the UPF does
+// not enforce.
+func GetPacketFiltersFromPccRule(pccRule *models.PccRule) ([]PacketFilter, error) {
+	pfList := []PacketFilter{}
 	for _, flow := range pccRule.FlowInfos {
-		pf := GetPacketFilterFromFlowInfo(&flow)
+		pf, err := GetPacketFilterFromFlowInfo(&flow)
+		if err != nil {
+			return nil, fmt.Errorf("packet filter [%s] of PCC rule [%s]: %w", flow.GetPackFiltId(), pccRule.GetPccRuleId(), err)
+		}
 		pfList = append(pfList, pf)
 	}
-	q.PacketFilterList = pfList
+	return pfList, nil
 }
 
-func GetPacketFilterFromFlowInfo(flowInfo *models.FlowInformation) PacketFilter {
+func GetPacketFilterFromFlowInfo(flowInfo *models.FlowInformation) (PacketFilter, error) {
 	pf := &PacketFilter{
 		Identifier: GetPfId(flowInfo.GetPackFiltId()),
 		Direction:  GetPfDirectionFromPccFlowInfo(flowInfo.GetFlowDirection()),
 	}
 
 	// Fill PF component contents
-	pf.GetPfContent(flowInfo.GetFlowDescription())
+	if err := pf.buildPfContent(flowInfo.GetFlowDescription(), flowInfo); err != nil {
+		return PacketFilter{}, err
+	}
 
-	return *pf
+	return *pf, nil
 }
 
 func GetPfId(pfID string) uint8 {
@@ -426,57 +451,99 @@ func GetPfDirectionFromPccFlowInfo(flowDir models.FlowDirectionRm) uint8 {
 //
 //	0		1 	2		3	  4   				5   		   6 	7						8
 //
-// See spec 29212-5.4.2 / 29512-5.6.3.2
-func DecodeFlowDescToIPFilters(flowDesc string) *IPFilterRule {
+// Addresses can be IPv4 or IPv6 with an optional mask or prefix length, "any" or "assigned".
+// Negated addresses, port lists and options are not allowed.
+// See spec 29212-5.4.2 / 29512-5.6.3.2 / RFC 6733-4.3.1
+func DecodeFlowDescToIPFilters(flowDesc string) (*IPFilterRule, error) {
 	// Tokenize flow desc and make PF components
 	pfcTags := strings.Fields(flowDesc)
+	if len(pfcTags) < 7 {
+		return nil, fmt.Errorf("flow description %q: too few fields", flowDesc)
+	}
+
+	if pfcTags[0] != "permit" {
+		return nil, fmt.Errorf("flow description %q: action %q not supported", flowDesc, pfcTags[0])
+	}
+	if pfcTags[1] != "out" {
+		return nil, fmt.Errorf("flow description %q: direction %q not supported", flowDesc, pfcTags[1])
+	}
 
 	// get PF tags into IP filter components
 	ipfRule := &IPFilterRule{}
 
 	// Protocol Id/Next Header
+	if _, err := strconv.ParseUint(pfcTags[2], 10, 8); err != nil && pfcTags[2] != "ip" {
+		return nil, fmt.Errorf("flow description %q: invalid protocol %q", flowDesc, pfcTags[2])
+	}
 	ipfRule.protoId = pfcTags[2]
 
+	if pfcTags[3] != "from" {
+		return nil, fmt.Errorf("flow description %q: \"from\" expected, got %q", flowDesc, pfcTags[3])
+	}
+
 	// decode source IP/mask
-	ipfRule.decodeIpFilterAddrv4(true, pfcTags[4])
+	i := 4
+	if err := ipfRule.decodeIpFilterAddr(true, pfcTags[i]); err != nil {
+		return nil, fmt.Errorf("flow description %q: %w", flowDesc, err)
+	}
+	i++
 
 	// decode source port/port-range (optional)
-	if pfcTags[6] == "to" {
-		// decode source port/port-range
-		ipfRule.decodeIpFilterPortInfo(true, pfcTags[5])
+	if pfcTags[i] != "to" {
+		if err := ipfRule.decodeIpFilterPortInfo(true, pfcTags[i]); err != nil {
+			return nil, fmt.Errorf("flow description %q: %w", flowDesc, err)
+		}
+		i++
+	}
 
-		// decode destination IP/mask
-		ipfRule.decodeIpFilterAddrv4(false, pfcTags[7])
+	if i+1 >= len(pfcTags) || pfcTags[i] != "to" {
+		return nil, fmt.Errorf("flow description %q: missing destination", flowDesc)
+	}
+	i++
 
-		// decode destination port/port-range(optional), if any
-		if len(pfcTags) == 9 {
-			ipfRule.decodeIpFilterPortInfo(false, pfcTags[8])
-		}
-	} else {
-		// decode destination IP/mask
-		ipfRule.decodeIpFilterAddrv4(false, pfcTags[6])
+	// decode destination IP/mask
+	if err := ipfRule.decodeIpFilterAddr(false, pfcTags[i]); err != nil {
+		return nil, fmt.Errorf("flow description %q: %w", flowDesc, err)
+	}
+	i++
 
-		// decode destination port/port-range(optional), if any
-		if len(pfcTags) == 8 {
-			ipfRule.decodeIpFilterPortInfo(false, pfcTags[7])
+	// decode destination port/port-range(optional), if any
+	if i < len(pfcTags) {
+		if err := ipfRule.decodeIpFilterPortInfo(false, pfcTags[i]); err != nil {
+			return nil, fmt.Errorf("flow description %q: %w", flowDesc, err)
 		}
+		i++
 	}
 
-	return ipfRule
+	if i < len(pfcTags) {
+		return nil, fmt.Errorf("flow description %q: option %q not supported", flowDesc, pfcTags[i])
+	}
+
+	return ipfRule, nil
 }
 
-func (ipf *IPFilterRule) IsMatchAllIPFilter() bool {
-	if ipf.sAddrv4.addr == "any" && ipf.dAddrv4.addr == "assigned" {
-		return true
+func (ipfRule *IPFilterRule) decodeIpFilterPortInfo(source bool, tag string) error {
+	if strings.Contains(tag, ",") {
+		return fmt.Errorf("port list %q not supported", tag)
 	}
-	return false
-}
 
-func (ipfRule *IPFilterRule) decodeIpFilterPortInfo(source bool, tag string) {
 	// check if it is single port or range
 	ports := strings.Split(tag, "-")
+	if len(ports) > 2 {
+		return fmt.Errorf("invalid port range %q", tag)
+	}
+	for _, port := range ports {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return fmt.Errorf("invalid port %q", tag)
+		}
+	}
 
 	if len(ports) > 1 { // port range
+		low, _ := strconv.ParseUint(ports[0], 10, 16)
+		high, _ := strconv.ParseUint(ports[1], 10, 16)
+		if low > high {
+			return fmt.Errorf("invalid port range %q", tag)
+		}
 		if source {
 			ipfRule.sPortRange.lowLimit = ports[0]
 			ipfRule.sPortRange.highLimit = ports[1]
@@ -491,45 +558,67 @@ func (ipfRule *IPFilterRule) decodeIpFilterPortInfo(source bool, tag string) {
 			ipfRule.dPort = ports[0]
 		}
 	}
+	return nil
 }
 
-func (ipfRule *IPFilterRule) decodeIpFilterAddrv4(source bool, tag string) {
+func (ipfRule *IPFilterRule) decodeIpFilterAddr(source bool, tag string) error {
+	if strings.HasPrefix(tag, "!") {
+		return fmt.Errorf("negated address %q not supported", tag)
+	}
+
+	addr := IPFilterRuleIpAddr{}
 	ipAndMask := strings.Split(tag, "/")
-	if source {
-		ipfRule.sAddrv4.addr = ipAndMask[0] // can be x.x.x.x or "any"
+	addr.addr = ipAndMask[0]
+
+	if addr.addr == "any" || addr.addr == "assigned" {
+		if len(ipAndMask) > 1 {
+			return fmt.Errorf("invalid address %q", tag)
+		}
 	} else {
-		ipfRule.dAddrv4.addr = ipAndMask[0] // can be x.x.x.x or "assigned"
-	}
+		ip := net.ParseIP(addr.addr)
+		if ip == nil {
+			return fmt.Errorf("invalid address %q", tag)
+		}
 
-	// mask can be nil
-	if len(ipAndMask) > 1 {
-		if source {
-			ipfRule.sAddrv4.mask = ipAndMask[1]
-		} else {
-			ipfRule.dAddrv4.mask = ipAndMask[1]
+		// mask can be nil
+		if len(ipAndMask) > 1 {
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			if mask, err := strconv.Atoi(ipAndMask[1]); err != nil || mask < 0 || mask > bits || len(ipAndMask) > 2 {
+				return fmt.Errorf("invalid address mask %q", tag)
+			}
+			addr.mask = ipAndMask[1]
 		}
 	}
+
+	if source {
+		ipfRule.sAddr = addr // can be x.x.x.x, x:x::x or "any"
+	} else {
+		ipfRule.dAddr = addr // can be x.x.x.x, x:x::x or "assigned"
+	}
+	return nil
+}
+
+// GetPfContent fills the packet filter components from the flow description
+func (pf *PacketFilter) GetPfContent(flowDesc string) error {
+	return pf.buildPfContent(flowDesc, nil)
 }
 
-func (pf *PacketFilter) GetPfContent(flowDesc string) {
+// buildPfContent fills the packet filter components from the flow description
+// and the ToS/traffic class, security parameter index and flow label of the flow information, if any.
+func (pf *PacketFilter) buildPfContent(flowDesc string, flowInfo *models.FlowInformation) error {
 	pfcList := []PacketFilterComponent{}
+	pf.ContentLength = 0
 
-	ipf := DecodeFlowDescToIPFilters(flowDesc)
+	ipf, err := DecodeFlowDescToIPFilters(flowDesc)
+	if err != nil {
+		return err
+	}
 
 	// Make Packet Filter Component from decoded IPFilters
 
-	// MatchAll Packet Filter
-	if ipf.IsMatchAllIPFilter() {
-		pfc := &PacketFilterComponent{
-			ComponentType: PFComponentTypeMatchAll,
-		}
-
-		pfcList = append(pfcList, *pfc)
-		pf.ContentLength += 1
-		pf.Content = pfcList
-		return
-	}
-
 	// Protocol identifier/Next header type
 	if pfc, len := BuildPFCompProtocolId(ipf.protoId); pfc != nil {
 		pfcList = append(pfcList, *pfc)
@@ -537,7 +626,7 @@ func (pf *PacketFilter) GetPfContent(flowDesc string) {
 	}
 
 	// Remote Addr
-	if pfc, len := buildPFCompAddr(false, ipf.sAddrv4); pfc != nil {
+	if pfc, len := buildPFCompAddr(false, ipf.sAddr); pfc != nil {
 		pfcList = append(pfcList, *pfc)
 		pf.ContentLength += len
 	}
@@ -555,7 +644,7 @@ func (pf *PacketFilter) GetPfContent(flowDesc string) {
 	}
 
 	// Local Addr
-	if pfc, len := buildPFCompAddr(true, ipf.dAddrv4); pfc != nil {
+	if pfc, len := buildPFCompAddr(true, ipf.dAddr); pfc != nil {
 		pfcList = append(pfcList, *pfc)
 		pf.ContentLength += len
 	}
@@ -572,57 +661,142 @@ func (pf *PacketFilter) GetPfContent(flowDesc string) {
 		pf.ContentLength += len
 	}
 
+	if flowInfo != nil {
+		// Security parameter index
+		if spi, err := DecodeSpi(flowInfo.GetSpi()); err != nil {
+			return err
+		} else if spi != nil {
+			pfcList = append(pfcList, PacketFilterComponent{
+				ComponentType:  PFComponentTypeSecurityParameterIndex,
+				ComponentValue: spi,
+			})
+			pf.ContentLength += 5
+		}
+
+		// Type of service/Traffic class
+		if tos, err := DecodeTosTrafficClass(flowInfo.GetTosTrafficClass()); err != nil {
+			return err
+		} else if tos != nil {
+			pfcList = append(pfcList, PacketFilterComponent{
+				ComponentType:  PFComponentTypeTypeOfServiceOrTrafficClass,
+				ComponentValue: tos,
+			})
+			pf.ContentLength += 3
+		}
+
+		// Flow label
+		if fl, err := DecodeFlowLabel(flowInfo.GetFlowLabel()); err != nil {
+			return err
+		} else if fl != nil {
+			pfcList = append(pfcList, PacketFilterComponent{
+				ComponentType:  PFComponentTypeFlowLabel,
+				ComponentValue: fl,
+			})
+			pf.ContentLength += 4
+		}
+	}
+
+	// MatchAll Packet Filter
+	if len(pfcList) == 0 {
+		pfcList = append(pfcList, PacketFilterComponent{
+			ComponentType: PFComponentTypeMatchAll,
+		})
+		pf.ContentLength += 1
+	}
+
 	pf.Content = pfcList
+	return nil
 }
 
-func buildPFCompAddr(local bool, val IPFilterRuleIpAddrV4) (*PacketFilterComponent, uint8) {
-	component := PFComponentTypeIPv4RemoteAddress
+// DecodeTosTrafficClass returns the IPv4 ToS or IPv6 traffic class and mask,
+// two octets encoded in hexadecimal (TS 29.514 5.6.3.2), nil if not set.
+func DecodeTosTrafficClass(tosTrafficClass string) ([]byte, error) {
+	return decodeHexOctets("ToS/traffic class", tosTrafficClass, 2)
+}
 
-	if local {
-		component = PFComponentTypeIPv4LocalAddress
-		// if local address value- "assigned" then don't need to set it
-		if val.addr == "assigned" {
-			return nil, 0
-		}
-	} else {
-		// if remote address value- "any" then don't need to set it
-		if val.addr == "any" {
-			return nil, 0
-		}
+// DecodeSpi returns the IPsec security parameter index, four octets encoded in
+// hexadecimal (TS 29.514 5.6.3.2), nil if not set.
+func DecodeSpi(spi string) ([]byte, error) {
+	return decodeHexOctets("security parameter index", spi, 4)
+}
+
+// DecodeFlowLabel returns the 20 bits IPv6 flow label, three octets encoded in
+// hexadecimal (TS 29.514 5.6.3.2), nil if not set.
+func DecodeFlowLabel(flowLabel string) ([]byte, error) {
+	fl, err := decodeHexOctets("flow label", flowLabel, 3)
+	if err == nil && fl != nil && fl[0]&0xf0 != 0 {
+		return nil, fmt.Errorf("flow label %q exceeds 20 bits", flowLabel)
 	}
+	return fl, err
+}
 
-	pfc := &PacketFilterComponent{
-		ComponentType:  component,
-		ComponentValue: make([]byte, 0),
+func decodeHexOctets(name, val string, octets int) ([]byte, error) {
+	if val == "" {
+		return nil, nil
 	}
+	b, err := hex.DecodeString(val)
+	if err != nil || len(b) != octets {
+		return nil, fmt.Errorf("invalid %s %q: %d octets in hexadecimal expected", name, val, octets)
+	}
+	return b, nil
+}
 
-	var addr, mask []byte
+func buildPFCompAddr(local bool, val IPFilterRuleIpAddr) (*PacketFilterComponent, uint8) {
+	// "any" remote address or "assigned" local address don't need to be set
+	if val.addr == "any" || val.addr == "assigned" {
+		return nil, 0
+	}
 
-	if ipAddr := net.ParseIP(val.addr); ipAddr == nil {
+	ipAddr := net.ParseIP(val.addr)
+	if ipAddr == nil {
 		return nil, 0
-	} else {
-		// check if it is valid v4 addr
-		if v4addr := ipAddr.To4(); v4addr == nil {
-			return nil, 0
-		} else {
-			addr = []byte(v4addr)
-			pfc.ComponentValue = append(pfc.ComponentValue, addr...)
+	}
+
+	// IPv4 address and mask
+	if v4addr := ipAddr.To4(); v4addr != nil {
+		component := PFComponentTypeIPv4RemoteAddress
+		if local {
+			component = PFComponentTypeIPv4LocalAddress
+		}
+
+		maskInt := 32
+		if val.mask != "" {
+			var err error
+			if maskInt, err = strconv.Atoi(val.mask); err != nil {
+				logger.QosLog.Errorf("error converting mask to int: %s", err)
+			}
 		}
+
+		pfc := &PacketFilterComponent{
+			ComponentType:  component,
+			ComponentValue: make([]byte, 0, 8),
+		}
+		pfc.ComponentValue = append(pfc.ComponentValue, v4addr...)
+		pfc.ComponentValue = append(pfc.ComponentValue, net.CIDRMask(maskInt, 32)...)
+		return pfc, 9
 	}
 
+	// IPv6 address and prefix length
+	component := PFComponentTypeIPv6RemoteAddress
+	if local {
+		component = PFComponentTypeIPv6LocalAddress
+	}
+
+	prefixLen := 128
 	if val.mask != "" {
-		maskInt, err := strconv.Atoi(val.mask)
-		if err != nil {
-			logger.QosLog.Errorf("error converting mask to int: %s", err)
+		var err error
+		if prefixLen, err = strconv.Atoi(val.mask); err != nil {
+			logger.QosLog.Errorf("error converting prefix length to int: %s", err)
 		}
-		mask = net.CIDRMask(maskInt, 32)
-		pfc.ComponentValue = append(pfc.ComponentValue, mask...)
-	} else {
-		mask = net.CIDRMask(32, 32)
-		pfc.ComponentValue = append(pfc.ComponentValue, mask...)
 	}
 
-	return pfc, 9
+	pfc := &PacketFilterComponent{
+		ComponentType:  component,
+		ComponentValue: make([]byte, 0, 17),
+	}
+	pfc.ComponentValue = append(pfc.ComponentValue, ipAddr.To16()...)
+	pfc.ComponentValue = append(pfc.ComponentValue, uint8(prefixLen))
+	return pfc, 18
 }
 
 func buildPFCompPort(local bool, val string) (*PacketFilterComponent, uint8) {
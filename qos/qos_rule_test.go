@@ -23,15 +23,41 @@ var flowDesc = []string{
 
 func TestDecodeFlowDescToIPFilters(t *testing.T) {
 	for i, flow := range flowDesc {
-		ipf := qos.DecodeFlowDescToIPFilters(flow)
+		ipf, err := qos.DecodeFlowDescToIPFilters(flow)
+		if err != nil {
+			t.Fatalf("flow %v: unexpected error: %v", i, err)
+		}
 		t.Logf("flow: %v %v", i, ipf.String())
 	}
 }
 
+func TestDecodeFlowDescToIPFiltersErrors(t *testing.T) {
+	invalidFlowDesc := []string{
+		"permit out ip from 1.1.1.1",
+		"deny out ip from any to assigned",
+		"permit in ip from any to assigned",
+		"permit out tcp from any to assigned",
+		"permit out ip from !1.1.1.1 to assigned",
+		"permit out ip from 1.1.1.1/33 to assigned",
+		"permit out ip from 2001:db8::1/129 to assigned",
+		"permit out ip from any 1000,2000 to assigned",
+		"permit out ip from any 2000-1000 to assigned",
+		"permit out ip from any to assigned 70000",
+		"permit out 6 from any to assigned 80 established",
+	}
+	for _, flow := range invalidFlowDesc {
+		if _, err := qos.DecodeFlowDescToIPFilters(flow); err == nil {
+			t.Errorf("expected error for flow description %q", flow)
+		}
+	}
+}
+
 func TestGetPfContent(t *testing.T) {
 	pf := &qos.PacketFilter{}
 	for i, flow := range flowDesc {
-		pf.GetPfContent(flow)
+		if err := pf.GetPfContent(flow); err != nil {
+			t.Fatalf("flow %v: unexpected error: %v", i, err)
+		}
 		t.Logf("Flow: %v", i)
 		for _, pfc := range pf.Content {
 			t.Logf("%v", pfc.String())
@@ -39,6 +65,72 @@ func TestGetPfContent(t *testing.T) {
 	}
 }
 
+func TestGetPfContentMatchAll(t *testing.T) {
+	pf := &qos.PacketFilter{}
+	if err := pf.GetPfContent("permit out ip from any to assigned"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pf.Content) != 1 || pf.Content[0].ComponentType != qos.PFComponentTypeMatchAll || pf.ContentLength != 1 {
+		t.Errorf("expected match all packet filter, got %v", pf.Content)
+	}
+
+	// ports are not dropped when addresses match all
+	if err := pf.GetPfContent("permit out ip from any 1000 to assigned"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pf.Content) != 1 || pf.Content[0].ComponentType != qos.PFComponentTypeSingleRemotePort || pf.ContentLength != 3 {
+		t.Errorf("expected single remote port component, got %v", pf.Content)
+	}
+}
+
+func TestGetPacketFilterFromFlowInfoIPv6(t *testing.T) {
+	flowInfo := &models.FlowInformation{
+		FlowDescription: openapi.PtrString("permit out 17 from 2001:db8::1/64 5000 to assigned"),
+		PackFiltId:      openapi.PtrString("3"),
+		FlowDirection:   models.FLOWDIRECTIONRM_DOWNLINK.Ptr(),
+	}
+	flowInfo.SetTosTrafficClass("b8fc")
+	flowInfo.SetSpi("0000abcd")
+	flowInfo.SetFlowLabel("012345")
+
+	pf, err := qos.GetPacketFilterFromFlowInfo(flowInfo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []qos.PacketFilterComponent{
+		{ComponentType: qos.PFComponentTypeProtocolIdentifierOrNextHeader, ComponentValue: []byte{17}},
+		{
+			ComponentType: qos.PFComponentTypeIPv6RemoteAddress,
+			ComponentValue: []byte{
+				0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 64,
+			},
+		},
+		{ComponentType: qos.PFComponentTypeSingleRemotePort, ComponentValue: []byte{0x13, 0x88}},
+		{ComponentType: qos.PFComponentTypeSecurityParameterIndex, ComponentValue: []byte{0x00, 0x00, 0xab, 0xcd}},
+		{ComponentType: qos.PFComponentTypeTypeOfServiceOrTrafficClass, ComponentValue: []byte{0xb8, 0xfc}},
+		{ComponentType: qos.PFComponentTypeFlowLabel, ComponentValue: []byte{0x01, 0x23, 0x45}},
+	}
+	if len(pf.Content) != len(expected) {
+		t.Fatalf("expected %d components, got %v", len(expected), pf.Content)
+	}
+	length := 0
+	for i, pfc := range expected {
+		if pf.Content[i].ComponentType != pfc.ComponentType || !bytes.Equal(pf.Content[i].ComponentValue, pfc.ComponentValue) {
+			t.Errorf("component %d: expected %v, got %v", i, pfc, pf.Content[i])
+		}
+		length += 1 + len(pfc.ComponentValue)
+	}
+	if int(pf.ContentLength) != length {
+		t.Errorf("expected content length %d, got %d", length, pf.ContentLength)
+	}
+
+	flowInfo.SetFlowLabel("f12345")
+	if _, err := qos.GetPacketFilterFromFlowInfo(flowInfo); err == nil {
+		t.Errorf("expected error for flow label exceeding 20 bits")
+	}
+}
+
 func TestBuildQosRules(t *testing.T) {
 	// make SM Policy Decision
 	smPolicyDecision := models.NewSmPolicyDecision()
@@ -100,6 +192,21 @@ func TestBuildQosRules_SkipsPccRuleWithoutRefQosData(t *testing.T) {
 	}
 }
 
+func TestBuildAddQoSRuleFromPccRuleRejectsInvalidFlow(t *testing.T) {
+	pccRule := &models.PccRule{
+		PccRuleId: "1",
+		FlowInfos: []models.FlowInformation{
+			{FlowDescription: openapi.PtrString("permit out ip from 1.1.1.1 to 2.2.2.2"), PackFiltId: openapi.PtrString("1")},
+			{FlowDescription: openapi.PtrString("permit out ip from 1.1.1.1 1000,2000 to 2.2.2.2"), PackFiltId: openapi.PtrString("2")},
+		},
+	}
+	qosData := &models.QosData{QosId: "1"}
+
+	if qosRule := qos.BuildAddQoSRuleFromPccRule(pccRule, qosData, qos.OperationCodeCreateNewQoSRule); qosRule != nil {
+		t.Errorf("expected the PCC rule with an invalid flow refused, got %+v", qosRule)
+	}
+}
+
 func makeSamplePccRules() map[string]models.PccRule {
 	pccRule1 := models.PccRule{
 		PccRuleId:  "1",
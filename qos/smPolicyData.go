@@ -4,7 +4,11 @@
 
 package qos
 
-import "github.com/omec-project/openapi/v2/models"
+import (
+	"slices"
+
+	"github.com/omec-project/openapi/v2/models"
+)
 
 // Define SMF Session-Rule/PccRule/Rule-Qos-Data
 type PolicyUpdate struct {
@@ -13,6 +17,7 @@ type PolicyUpdate struct {
 	QosFlowUpdate  *QosFlowsUpdate
 	TCUpdate       *TrafficControlUpdate
 	CondDataUpdate *CondDataUpdate
+	UmDataUpdate   *UsageMonDataUpdate
 
 	// relevant SM Policy Decision from PCF
 	SmPolicyDecision *models.SmPolicyDecision
@@ -25,7 +30,11 @@ type SmCtxtPolicyData struct {
 	SmCtxtTCData       SmCtxtTrafficControlData
 	SmCtxtChargingData SmCtxtChargingData
 	SmCtxtCondData     SmCtxtCondData
+	SmCtxtUsageMonData SmCtxtUsageMonData
 	SmCtxtSessionRules SmCtxtSessionRulesInfo
+
+	// policy control request triggers armed by the PCF
+	PolicyCtrlReqTriggers []models.PolicyControlRequestTrigger
 }
 
 // maintain all session rule-info and current active sess rule
@@ -56,15 +65,53 @@ type SmCtxtCondData struct {
 	CondData map[string]*models.ConditionData
 }
 
+type SmCtxtUsageMonData struct {
+	UsageMonData map[string]*models.UsageMonitoringData
+}
+
+// IsAccessTypeChangeReportRequired reports whether the PCF armed the AC_TY_CH
+// policy control request trigger
+func (obj *SmCtxtPolicyData) IsAccessTypeChangeReportRequired() bool {
+	return slices.Contains(obj.PolicyCtrlReqTriggers, models.POLICYCONTROLREQUESTTRIGGER_AC_TY_CH)
+}
+
 func (obj *SmCtxtPolicyData) Initialize() {
 	obj.SmCtxtSessionRules.SessionRules = make(map[string]*models.SessionRule)
 	obj.SmCtxtPccRules.PccRules = make(map[string]*models.PccRule)
 	obj.SmCtxtQosData.QosData = make(map[string]*models.QosData)
 	obj.SmCtxtCondData.CondData = make(map[string]*models.ConditionData)
+	obj.SmCtxtUsageMonData.UsageMonData = make(map[string]*models.UsageMonitoringData)
 	obj.SmCtxtChargingData.ChargingData = make(map[string]*models.ChargingData)
 	obj.SmCtxtTCData.TrafficControlData = make(map[string]*models.TrafficControlData)
 }
 
+// SmPolicyDecision returns the SM policy decision the SM context enforces,
+// to build all the rules of the PDU session anew
+func (obj *SmCtxtPolicyData) SmPolicyDecision() *models.SmPolicyDecision {
+	sessRules := make(map[string]models.SessionRule)
+	for id, rule := range obj.SmCtxtSessionRules.SessionRules {
+		sessRules[id] = *rule
+	}
+	pccRules := make(map[string]models.PccRule)
+	for id, rule := range obj.SmCtxtPccRules.PccRules {
+		pccRules[id] = *rule
+	}
+	qosDecs := make(map[string]models.QosData)
+	for id, qosData := range obj.SmCtxtQosData.QosData {
+		qosDecs[id] = *qosData
+	}
+	traffContDecs := make(map[string]models.TrafficControlData)
+	for id, tcData := range obj.SmCtxtTCData.TrafficControlData {
+		traffContDecs[id] = *tcData
+	}
+	return &models.SmPolicyDecision{
+		SessRules:     &sessRules,
+		PccRules:      pccRules,
+		QosDecs:       &qosDecs,
+		TraffContDecs: &traffContDecs,
+	}
+}
+
 func BuildSmPolicyUpdate(smCtxtPolData *SmCtxtPolicyData, smPolicyDecision *models.SmPolicyDecision) *PolicyUpdate {
 	update := &PolicyUpdate{}
 
@@ -86,9 +133,74 @@ func BuildSmPolicyUpdate(smCtxtPolData *SmCtxtPolicyData, smPolicyDecision *mode
 	// Condition Data update
 	update.CondDataUpdate = GetConditionDataUpdate(smPolicyDecision.Conds, smCtxtPolData.SmCtxtCondData.CondData)
 
+	// Usage Monitoring Data update
+	update.UmDataUpdate = GetUsageMonDataUpdate(smPolicyDecision.UmDecs, smCtxtPolData.SmCtxtUsageMonData.UsageMonData)
+
 	return update
 }
 
+// IsFlowStatusOnlyUpdate reports whether the policy update changes nothing but
+// the flow status of traffic control data already known to the SM context.
+// Such updates only need the QER gates to be updated on the UPF.
+func (upd *PolicyUpdate) IsFlowStatusOnlyUpdate(smCtxtPolData *SmCtxtPolicyData) bool {
+	if upd == nil || upd.TCUpdate == nil || len(upd.TCUpdate.mod) == 0 ||
+		len(upd.TCUpdate.add) > 0 || len(upd.TCUpdate.del) > 0 {
+		return false
+	}
+
+	if pcc := upd.PccRuleUpdate; pcc != nil && (len(pcc.add) > 0 || len(pcc.mod) > 0 || len(pcc.del) > 0) {
+		return false
+	}
+
+	if qf := upd.QosFlowUpdate; qf != nil && (len(qf.add) > 0 || len(qf.mod) > 0 || len(qf.del) > 0) {
+		return false
+	}
+
+	if sr := upd.SessRuleUpdate; sr != nil && (len(sr.add) > 0 || len(sr.del) > 0) {
+		return false
+	}
+
+	for name, tc := range upd.TCUpdate.mod {
+		if !IsFlowStatusOnlyChange(tc, smCtxtPolData.SmCtxtTCData.TrafficControlData[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsUserPlaneOnlyUpdate reports whether the policy update is enforced by the
+// UPF alone, i.e. it changes only flow status of traffic control data and/or
+// usage monitoring data, so the UE and RAN are not involved.
+func (upd *PolicyUpdate) IsUserPlaneOnlyUpdate(smCtxtPolData *SmCtxtPolicyData) bool {
+	if upd == nil {
+		return false
+	}
+
+	umChanged := upd.UmDataUpdate.HasChanges()
+	tcChanged := upd.TCUpdate != nil &&
+		(len(upd.TCUpdate.add) > 0 || len(upd.TCUpdate.mod) > 0 || len(upd.TCUpdate.del) > 0)
+
+	switch {
+	case tcChanged:
+		return upd.IsFlowStatusOnlyUpdate(smCtxtPolData)
+	case !umChanged:
+		return false
+	}
+
+	if pcc := upd.PccRuleUpdate; pcc != nil && (len(pcc.add) > 0 || len(pcc.mod) > 0 || len(pcc.del) > 0) {
+		return false
+	}
+
+	if qf := upd.QosFlowUpdate; qf != nil && (len(qf.add) > 0 || len(qf.mod) > 0 || len(qf.del) > 0) {
+		return false
+	}
+
+	if sr := upd.SessRuleUpdate; sr != nil && (len(sr.add) > 0 || len(sr.del) > 0) {
+		return false
+	}
+	return true
+}
+
 func CommitSmPolicyDecision(smCtxtPolData *SmCtxtPolicyData, smPolicyUpdate *PolicyUpdate) error {
 	// Update Qos Flows
 	if smPolicyUpdate.QosFlowUpdate != nil {
@@ -115,5 +227,18 @@ func CommitSmPolicyDecision(smCtxtPolData *SmCtxtPolicyData, smPolicyUpdate *Pol
 		CommitConditionDataUpdate(smCtxtPolData, smPolicyUpdate.CondDataUpdate)
 	}
 
+	// Update Usage Monitoring Data
+	if smPolicyUpdate.UmDataUpdate != nil {
+		if smCtxtPolData.SmCtxtUsageMonData.UsageMonData == nil {
+			smCtxtPolData.SmCtxtUsageMonData.UsageMonData = make(map[string]*models.UsageMonitoringData)
+		}
+		CommitUsageMonDataUpdate(smCtxtPolData, smPolicyUpdate.UmDataUpdate)
+	}
+
+	// Policy control request triggers are provided as a whole when changed
+	if smPolicyUpdate.SmPolicyDecision != nil && smPolicyUpdate.SmPolicyDecision.PolicyCtrlReqTriggers != nil {
+		smCtxtPolData.PolicyCtrlReqTriggers = smPolicyUpdate.SmPolicyDecision.PolicyCtrlReqTriggers
+	}
+
 	return nil
 }
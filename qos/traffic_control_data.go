@@ -41,6 +41,13 @@ func GetTrafficControlUpdate(tcData *map[string]models.TrafficControlData, ctxtT
 	return &change
 }
 
+func (upd *TrafficControlUpdate) GetModified() map[string]*models.TrafficControlData {
+	if upd == nil {
+		return nil
+	}
+	return upd.mod
+}
+
 func CommitTrafficControlUpdate(smCtxtPolData *SmCtxtPolicyData, update *TrafficControlUpdate) {
 	// Iterate through Add/Mod/Del TC
 
@@ -51,8 +58,12 @@ func CommitTrafficControlUpdate(smCtxtPolData *SmCtxtPolicyData, update *Traffic
 		}
 	}
 
-	// Mod rules
-	// TODO
+	// Mod tc
+	if len(update.mod) > 0 {
+		for name, tc := range update.mod {
+			smCtxtPolData.SmCtxtTCData.TrafficControlData[name] = tc
+		}
+	}
 
 	// Del Rules
 	if len(update.del) > 0 {
@@ -67,11 +78,11 @@ func GetTCDataChanges(pcfTc, ctxtTc *models.TrafficControlData) bool {
 		return true
 	}
 
-	if pcfTc.TcId != ctxtTc.TcId ||
-		pcfTc.FlowStatus != ctxtTc.FlowStatus ||
-		pcfTc.MuteNotif != ctxtTc.MuteNotif ||
-		pcfTc.TrafficSteeringPolIdDl != ctxtTc.TrafficSteeringPolIdDl ||
-		pcfTc.TrafficSteeringPolIdUl != ctxtTc.TrafficSteeringPolIdUl {
+	if pcfTc.GetTcId() != ctxtTc.GetTcId() ||
+		pcfTc.GetFlowStatus() != ctxtTc.GetFlowStatus() ||
+		pcfTc.GetMuteNotif() != ctxtTc.GetMuteNotif() ||
+		pcfTc.GetTrafficSteeringPolIdDl() != ctxtTc.GetTrafficSteeringPolIdDl() ||
+		pcfTc.GetTrafficSteeringPolIdUl() != ctxtTc.GetTrafficSteeringPolIdUl() {
 		return true
 	}
 
@@ -90,6 +101,18 @@ func GetTCDataChanges(pcfTc, ctxtTc *models.TrafficControlData) bool {
 	return false
 }
 
+// IsFlowStatusOnlyChange reports whether the PCF traffic control data differs
+// from the SM context copy in its flow status and nothing else.
+func IsFlowStatusOnlyChange(pcfTc, ctxtTc *models.TrafficControlData) bool {
+	if pcfTc == nil || ctxtTc == nil || pcfTc.GetFlowStatus() == ctxtTc.GetFlowStatus() {
+		return false
+	}
+
+	tc := *pcfTc
+	tc.FlowStatus = ctxtTc.FlowStatus
+	return !GetTCDataChanges(&tc, ctxtTc)
+}
+
 func compareRedirectInfo(a, b *models.RedirectInformation) bool {
 	if a == nil && b == nil {
 		return true
@@ -98,9 +121,9 @@ func compareRedirectInfo(a, b *models.RedirectInformation) bool {
 		return false
 	}
 
-	return a.RedirectEnabled == b.RedirectEnabled &&
-		a.RedirectAddressType == b.RedirectAddressType &&
-		a.RedirectServerAddress == b.RedirectServerAddress
+	return a.GetRedirectEnabled() == b.GetRedirectEnabled() &&
+		a.GetRedirectAddressType() == b.GetRedirectAddressType() &&
+		a.GetRedirectServerAddress() == b.GetRedirectServerAddress()
 }
 
 func compareRouteToLocations(a, b []models.RouteToLocation) bool {
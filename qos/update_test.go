@@ -5,6 +5,7 @@ package qos
 
 import (
 	"testing"
+	"time"
 
 	"github.com/omec-project/openapi/v2/models"
 )
@@ -113,3 +114,194 @@ func TestGetTrafficControlUpdateUsesDistinctPointersPerEntry(t *testing.T) {
 		t.Fatal("unexpected traffic control ids in update")
 	}
 }
+
+func TestIsFlowStatusOnlyUpdate(t *testing.T) {
+	enabled := models.FLOWSTATUS_ENABLED
+	disabled := models.FLOWSTATUS_DISABLED
+
+	smCtxtPolData := &SmCtxtPolicyData{}
+	smCtxtPolData.Initialize()
+	smCtxtPolData.SmCtxtTCData.TrafficControlData["tc-1"] = &models.TrafficControlData{TcId: "tc-1", FlowStatus: &enabled}
+
+	tcData := map[string]models.TrafficControlData{
+		"tc-1": {TcId: "tc-1", FlowStatus: &disabled},
+	}
+	update := &PolicyUpdate{
+		TCUpdate: GetTrafficControlUpdate(&tcData, smCtxtPolData.SmCtxtTCData.TrafficControlData),
+	}
+	if !update.IsFlowStatusOnlyUpdate(smCtxtPolData) {
+		t.Fatal("expected flow status only update")
+	}
+
+	// redirection change alongside the flow status
+	redirect := models.NewRedirectInformation()
+	redirect.SetRedirectEnabled(true)
+	tcData["tc-1"] = models.TrafficControlData{TcId: "tc-1", FlowStatus: &disabled, RedirectInfo: redirect}
+	update.TCUpdate = GetTrafficControlUpdate(&tcData, smCtxtPolData.SmCtxtTCData.TrafficControlData)
+	if update.IsFlowStatusOnlyUpdate(smCtxtPolData) {
+		t.Fatal("expected redirect change not to be a flow status only update")
+	}
+
+	// same flow status, decoded into a distinct pointer
+	sameStatus := models.FLOWSTATUS_ENABLED
+	tcData["tc-1"] = models.TrafficControlData{TcId: "tc-1", FlowStatus: &sameStatus}
+	update.TCUpdate = GetTrafficControlUpdate(&tcData, smCtxtPolData.SmCtxtTCData.TrafficControlData)
+	if len(update.TCUpdate.GetModified()) != 0 {
+		t.Fatal("expected unchanged traffic control data not to be modified")
+	}
+}
+
+func TestGetConditionDataUpdate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	added := models.ConditionData{CondId: "cond-add"}
+	added.SetActivationTime(start)
+	modified := models.ConditionData{CondId: "cond-mod"}
+	modified.SetActivationTime(start.Add(time.Hour))
+	unchanged := models.ConditionData{CondId: "cond-same"}
+	unchanged.SetActivationTime(start)
+	ctxtModified := models.ConditionData{CondId: "cond-mod"}
+	ctxtModified.SetActivationTime(start)
+
+	update := GetConditionDataUpdate(map[string]models.ConditionData{
+		"cond-add":  added,
+		"cond-mod":  modified,
+		"cond-same": unchanged,
+		"cond-del":  {},
+	}, map[string]*models.ConditionData{
+		"cond-mod":  &ctxtModified,
+		"cond-same": &unchanged,
+		"cond-del":  {CondId: "cond-del"},
+	})
+
+	if _, ok := update.add["cond-add"]; !ok || len(update.add) != 1 {
+		t.Errorf("expected cond-add to be added, got %v", update.add)
+	}
+	if _, ok := update.mod["cond-mod"]; !ok || len(update.mod) != 1 {
+		t.Errorf("expected cond-mod to be modified, got %v", update.mod)
+	}
+	if _, ok := update.del["cond-del"]; !ok || len(update.del) != 1 {
+		t.Errorf("expected cond-del to be deleted, got %v", update.del)
+	}
+
+	polData := &SmCtxtPolicyData{}
+	polData.Initialize()
+	polData.SmCtxtCondData.CondData["cond-del"] = &models.ConditionData{CondId: "cond-del"}
+	CommitConditionDataUpdate(polData, update)
+	if _, ok := polData.SmCtxtCondData.CondData["cond-del"]; ok {
+		t.Errorf("expected cond-del to be removed from SM context")
+	}
+	if got := polData.SmCtxtCondData.CondData["cond-mod"]; got == nil || !got.GetActivationTime().Equal(start.Add(time.Hour)) {
+		t.Errorf("expected cond-mod to be updated in SM context, got %v", got)
+	}
+}
+
+func TestIsConditionActive(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := func(activation, deactivation time.Time) *models.ConditionData {
+		cond := models.NewConditionData("cond-1")
+		if !activation.IsZero() {
+			cond.SetActivationTime(activation)
+		}
+		if !deactivation.IsZero() {
+			cond.SetDeactivationTime(deactivation)
+		}
+		return cond
+	}
+
+	testCases := []struct {
+		name     string
+		cond     *models.ConditionData
+		expected bool
+	}{
+		{"no condition", nil, true},
+		{"no time window", window(time.Time{}, time.Time{}), true},
+		{"not yet active", window(now.Add(time.Hour), time.Time{}), false},
+		{"active", window(now.Add(-time.Hour), now.Add(time.Hour)), true},
+		{"deactivated", window(time.Time{}, now), false},
+		{"activated now", window(now, time.Time{}), true},
+	}
+
+	for _, tc := range testCases {
+		if got := IsConditionActive(tc.cond, now); got != tc.expected {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestGetUsageMonDataUpdate(t *testing.T) {
+	ctxtUm := models.NewUsageMonitoringData("um-mod")
+	ctxtUm.SetVolumeThreshold(1000)
+	sameUm := models.NewUsageMonitoringData("um-same")
+	sameUm.SetTimeThreshold(60)
+
+	modUm := models.NewUsageMonitoringData("um-mod")
+	modUm.SetVolumeThreshold(2000)
+	addUm := models.NewUsageMonitoringData("um-add")
+	addUm.SetVolumeThresholdDownlink(500)
+
+	update := GetUsageMonDataUpdate(map[string]models.UsageMonitoringData{
+		"um-add":  *addUm,
+		"um-mod":  *modUm,
+		"um-same": *sameUm,
+		"um-del":  {},
+	}, map[string]*models.UsageMonitoringData{
+		"um-mod":  ctxtUm,
+		"um-same": sameUm,
+		"um-del":  models.NewUsageMonitoringData("um-del"),
+	})
+
+	if _, ok := update.add["um-add"]; !ok || len(update.add) != 1 {
+		t.Errorf("expected um-add to be added, got %v", update.add)
+	}
+	if _, ok := update.mod["um-mod"]; !ok || len(update.mod) != 1 {
+		t.Errorf("expected um-mod to be modified, got %v", update.mod)
+	}
+	if _, ok := update.del["um-del"]; !ok || len(update.del) != 1 {
+		t.Errorf("expected um-del to be deleted, got %v", update.del)
+	}
+
+	polData := &SmCtxtPolicyData{}
+	polData.Initialize()
+	polData.SmCtxtUsageMonData.UsageMonData["um-del"] = models.NewUsageMonitoringData("um-del")
+	CommitUsageMonDataUpdate(polData, update)
+	if _, ok := polData.SmCtxtUsageMonData.UsageMonData["um-del"]; ok {
+		t.Errorf("expected um-del to be removed from SM context")
+	}
+	if got := polData.SmCtxtUsageMonData.UsageMonData["um-mod"]; got == nil || got.GetVolumeThreshold() != 2000 {
+		t.Errorf("expected um-mod to be updated in SM context, got %v", got)
+	}
+}
+
+func TestIsUserPlaneOnlyUpdate(t *testing.T) {
+	smCtxtPolData := &SmCtxtPolicyData{}
+	smCtxtPolData.Initialize()
+
+	um := models.NewUsageMonitoringData("um-1")
+	um.SetVolumeThreshold(1000)
+	decision := &models.SmPolicyDecision{
+		UmDecs: map[string]models.UsageMonitoringData{"um-1": *um},
+	}
+	if !BuildSmPolicyUpdate(smCtxtPolData, decision).IsUserPlaneOnlyUpdate(smCtxtPolData) {
+		t.Error("expected usage monitoring update to be a user plane only update")
+	}
+
+	// a new PCC rule is to be signalled to the UE
+	decision.PccRules = map[string]models.PccRule{"rule-1": {PccRuleId: "rule-1"}}
+	if BuildSmPolicyUpdate(smCtxtPolData, decision).IsUserPlaneOnlyUpdate(smCtxtPolData) {
+		t.Error("expected PCC rule update not to be a user plane only update")
+	}
+
+	if BuildSmPolicyUpdate(smCtxtPolData, &models.SmPolicyDecision{}).IsUserPlaneOnlyUpdate(smCtxtPolData) {
+		t.Error("expected empty update not to be a user plane only update")
+	}
+
+	decision = &models.SmPolicyDecision{PolicyCtrlReqTriggers: []models.PolicyControlRequestTrigger{
+		models.POLICYCONTROLREQUESTTRIGGER_US_RE,
+	}}
+	if err := CommitSmPolicyDecision(smCtxtPolData, BuildSmPolicyUpdate(smCtxtPolData, decision)); err != nil {
+		t.Fatal(err)
+	}
+	if !smCtxtPolData.IsUsageReportRequired() {
+		t.Error("expected US_RE trigger to be armed")
+	}
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package qos
+
+import (
+	"slices"
+
+	"github.com/omec-project/openapi/v2/models"
+)
+
+type UsageMonDataUpdate struct {
+	add, mod, del map[string]*models.UsageMonitoringData
+}
+
+func GetUsageMonDataUpdate(umDecs map[string]models.UsageMonitoringData, ctxtUmData map[string]*models.UsageMonitoringData) *UsageMonDataUpdate {
+	change := UsageMonDataUpdate{
+		add: make(map[string]*models.UsageMonitoringData),
+		mod: make(map[string]*models.UsageMonitoringData),
+		del: make(map[string]*models.UsageMonitoringData),
+	}
+
+	for name, pcfUm := range umDecs {
+		um := pcfUm
+		// if umId is empty then it need to be deleted
+		if um.GetUmId() == "" {
+			change.del[name] = &um
+			continue
+		}
+
+		// match against SM ctxt usage monitoring data for add/mod
+		if ctxtUm := ctxtUmData[name]; ctxtUm == nil {
+			change.add[name] = &um
+		} else if GetUsageMonDataChanges(&um, ctxtUm) {
+			change.mod[name] = &um
+		}
+	}
+
+	return &change
+}
+
+func CommitUsageMonDataUpdate(smCtxtPolData *SmCtxtPolicyData, update *UsageMonDataUpdate) {
+	// Add new usage monitoring data
+	for name, um := range update.add {
+		smCtxtPolData.SmCtxtUsageMonData.UsageMonData[name] = um
+	}
+
+	// Mod usage monitoring data
+	for name, um := range update.mod {
+		smCtxtPolData.SmCtxtUsageMonData.UsageMonData[name] = um
+	}
+
+	// Del usage monitoring data
+	for name := range update.del {
+		delete(smCtxtPolData.SmCtxtUsageMonData.UsageMonData, name)
+	}
+}
+
+// HasChanges reports whether usage monitoring data are added, modified or deleted
+func (upd *UsageMonDataUpdate) HasChanges() bool {
+	return upd != nil && (len(upd.add) > 0 || len(upd.mod) > 0 || len(upd.del) > 0)
+}
+
+// GetUsageMonDataChanges reports whether the thresholds of the usage monitoring data differ
+func GetUsageMonDataChanges(pcfUm, ctxtUm *models.UsageMonitoringData) bool {
+	if pcfUm == nil || ctxtUm == nil {
+		return true
+	}
+
+	return pcfUm.GetUmId() != ctxtUm.GetUmId() ||
+		pcfUm.GetVolumeThreshold() != ctxtUm.GetVolumeThreshold() ||
+		pcfUm.GetVolumeThresholdUplink() != ctxtUm.GetVolumeThresholdUplink() ||
+		pcfUm.GetVolumeThresholdDownlink() != ctxtUm.GetVolumeThresholdDownlink() ||
+		pcfUm.GetTimeThreshold() != ctxtUm.GetTimeThreshold() ||
+		!slices.Equal(pcfUm.GetExUsagePccRuleIds(), ctxtUm.GetExUsagePccRuleIds())
+}
+
+// IsUsageReportRequired reports whether the PCF armed the US_RE policy control
+// request trigger, i.e. expects accumulated usage to be reported.
+func (obj *SmCtxtPolicyData) IsUsageReportRequired() bool {
+	return slices.Contains(obj.PolicyCtrlReqTriggers, models.POLICYCONTROLREQUESTTRIGGER_US_RE)
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package radius
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	DefaultTimeout = 3 * time.Second
+	DefaultRetries = 2
+)
+
+// Client exchanges RADIUS packets with a server over UDP
+type Client struct {
+	// Addr is the host:port of the server
+	Addr    string
+	Secret  []byte
+	Timeout time.Duration
+	Retries int
+}
+
+// Exchange sends the request and waits for the authentic response from the
+// server, retransmitting the request on timeout, RFC 2865 2.4
+func (c *Client) Exchange(request *Packet) (*Packet, error) {
+	raw, err := request.Encode(c.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	retries := c.Retries
+	if retries <= 0 {
+		retries = DefaultRetries
+	}
+
+	conn, err := net.Dial("udp", c.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial RADIUS server %s: %w", c.Addr, err)
+	}
+	defer conn.Close()
+
+	// the authenticator of an Accounting-Request is only known once encoded
+	sent := *request
+	copy(sent.Authenticator[:], raw[4:20])
+
+	buf := make([]byte, maxPacketLen)
+	for attempt := 0; attempt <= retries; attempt++ {
+		if _, err := conn.Write(raw); err != nil {
+			return nil, fmt.Errorf("send %s to %s: %w", request.Code, c.Addr, err)
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, err
+		}
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return nil, fmt.Errorf("receive from %s: %w", c.Addr, err)
+			}
+			// silently discard responses which are not for this request, RFC 2865 3
+			if !IsAuthenticResponse(buf[:n], &sent, c.Secret) {
+				continue
+			}
+			return Decode(buf[:n])
+		}
+	}
+	return nil, fmt.Errorf("no response to %s from %s after %d attempts", request.Code, c.Addr, retries+1)
+}
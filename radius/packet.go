@@ -0,0 +1,389 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+// Package radius implements the RADIUS client used by the SMF towards a DN-AAA
+// server for secondary authentication/authorization and accounting of PDU
+// sessions, TS 29.561 clause 11 (RFC 2865, RFC 2866 and RFC 3579).
+package radius
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync/atomic"
+)
+
+type Code uint8
+
+const (
+	CodeAccessRequest      Code = 1
+	CodeAccessAccept       Code = 2
+	CodeAccessReject       Code = 3
+	CodeAccountingRequest  Code = 4
+	CodeAccountingResponse Code = 5
+	CodeAccessChallenge    Code = 11
+)
+
+func (c Code) String() string {
+	switch c {
+	case CodeAccessRequest:
+		return "Access-Request"
+	case CodeAccessAccept:
+		return "Access-Accept"
+	case CodeAccessReject:
+		return "Access-Reject"
+	case CodeAccountingRequest:
+		return "Accounting-Request"
+	case CodeAccountingResponse:
+		return "Accounting-Response"
+	case CodeAccessChallenge:
+		return "Access-Challenge"
+	default:
+		return fmt.Sprintf("Code(%d)", uint8(c))
+	}
+}
+
+// Type is the RADIUS attribute type
+type Type uint8
+
+const (
+	UserName             Type = 1
+	UserPassword         Type = 2
+	CHAPPassword         Type = 3
+	NASIPAddress         Type = 4
+	ServiceType          Type = 6
+	FramedProtocol       Type = 7
+	FramedIPAddress      Type = 8
+	ReplyMessage         Type = 18
+	State                Type = 24
+	Class                Type = 25
+	SessionTimeout       Type = 27
+	CalledStationID      Type = 30
+	CallingStationID     Type = 31
+	NASIdentifier        Type = 32
+	AcctStatusType       Type = 40
+	AcctSessionID        Type = 44
+	AcctSessionTime      Type = 46
+	AcctTerminateCause   Type = 49
+	CHAPChallenge        Type = 60
+	EAPMessage           Type = 79
+	MessageAuthenticator Type = 80
+)
+
+// Acct-Status-Type values, RFC 2866 5.1
+const (
+	AcctStatusTypeStart uint32 = 1
+	AcctStatusTypeStop  uint32 = 2
+)
+
+// Acct-Terminate-Cause values, RFC 2866 5.10
+const (
+	AcctTerminateCauseUserRequest    uint32 = 1
+	AcctTerminateCauseSessionTimeout uint32 = 5
+	AcctTerminateCauseAdminReset     uint32 = 6
+)
+
+const (
+	headerLen       = 20
+	maxPacketLen    = 4096
+	maxAttributeLen = 253
+)
+
+// Attribute is a RADIUS attribute, RFC 2865 5
+type Attribute struct {
+	Value []byte
+	Type  Type
+}
+
+// Packet is a RADIUS packet, RFC 2865 3
+type Packet struct {
+	Attributes    []Attribute
+	Authenticator [16]byte
+	Identifier    uint8
+	Code          Code
+}
+
+var identifier atomic.Uint32
+
+// New returns a request with the next identifier and, for an Access-Request,
+// a random request authenticator
+func New(code Code) (*Packet, error) {
+	p := &Packet{
+		Code:       code,
+		Identifier: uint8(identifier.Add(1)),
+	}
+	if code == CodeAccessRequest {
+		if _, err := rand.Read(p.Authenticator[:]); err != nil {
+			return nil, fmt.Errorf("request authenticator: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// Response returns a response to the request, the authenticator holds the one
+// of the request until the response is encoded
+func (p *Packet) Response(code Code) *Packet {
+	return &Packet{
+		Code:          code,
+		Identifier:    p.Identifier,
+		Authenticator: p.Authenticator,
+	}
+}
+
+// Add appends the attribute, values longer than an attribute (e.g. EAP-Message)
+// are split into consecutive attributes
+func (p *Packet) Add(t Type, value []byte) {
+	for len(value) > maxAttributeLen {
+		p.Attributes = append(p.Attributes, Attribute{Type: t, Value: value[:maxAttributeLen]})
+		value = value[maxAttributeLen:]
+	}
+	p.Attributes = append(p.Attributes, Attribute{Type: t, Value: value})
+}
+
+func (p *Packet) AddString(t Type, value string) {
+	p.Add(t, []byte(value))
+}
+
+func (p *Packet) AddUint32(t Type, value uint32) {
+	p.Add(t, binary.BigEndian.AppendUint32(nil, value))
+}
+
+func (p *Packet) AddIP(t Type, ip net.IP) {
+	p.Add(t, ip.To4())
+}
+
+// Get returns the value of the first attribute of the type
+func (p *Packet) Get(t Type) []byte {
+	for _, attr := range p.Attributes {
+		if attr.Type == t {
+			return attr.Value
+		}
+	}
+	return nil
+}
+
+// GetAll returns the values of all the attributes of the type
+func (p *Packet) GetAll(t Type) [][]byte {
+	var values [][]byte
+	for _, attr := range p.Attributes {
+		if attr.Type == t {
+			values = append(values, attr.Value)
+		}
+	}
+	return values
+}
+
+func (p *Packet) GetUint32(t Type) (uint32, bool) {
+	value := p.Get(t)
+	if len(value) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(value), true
+}
+
+func (p *Packet) GetIP(t Type) net.IP {
+	value := p.Get(t)
+	if len(value) != net.IPv4len {
+		return nil
+	}
+	return net.IP(bytes.Clone(value))
+}
+
+// GetEAPMessage returns the EAP packet carried in the EAP-Message attributes, RFC 3579 3.1
+func (p *Packet) GetEAPMessage() []byte {
+	return bytes.Join(p.GetAll(EAPMessage), nil)
+}
+
+// Encode returns the packet in wire format. The authenticator of an
+// Accounting-Request or of a response is computed from the shared secret, and
+// the Message-Authenticator is added to packets carrying an EAP-Message, RFC 3579 3.2.
+func (p *Packet) Encode(secret []byte) ([]byte, error) {
+	attrs := p.Attributes
+	if p.Get(EAPMessage) != nil && p.Get(MessageAuthenticator) == nil {
+		attrs = append(append([]Attribute{}, attrs...), Attribute{Type: MessageAuthenticator, Value: make([]byte, md5.Size)})
+	}
+
+	length := headerLen
+	for _, attr := range attrs {
+		if len(attr.Value) > maxAttributeLen {
+			return nil, fmt.Errorf("attribute %d too long: %d", attr.Type, len(attr.Value))
+		}
+		length += 2 + len(attr.Value)
+	}
+	if length > maxPacketLen {
+		return nil, fmt.Errorf("packet too long: %d", length)
+	}
+
+	b := make([]byte, headerLen, length)
+	b[0] = byte(p.Code)
+	b[1] = p.Identifier
+	binary.BigEndian.PutUint16(b[2:4], uint16(length))
+	if p.Code != CodeAccountingRequest {
+		copy(b[4:20], p.Authenticator[:])
+	}
+	msgAuthOffset := 0
+	for _, attr := range attrs {
+		b = append(b, byte(attr.Type), byte(2+len(attr.Value)))
+		if attr.Type == MessageAuthenticator {
+			msgAuthOffset = len(b)
+		}
+		b = append(b, attr.Value...)
+	}
+
+	if msgAuthOffset != 0 {
+		clear(b[msgAuthOffset : msgAuthOffset+md5.Size])
+		mac := hmac.New(md5.New, secret)
+		mac.Write(b)
+		copy(b[msgAuthOffset:], mac.Sum(nil))
+	}
+
+	if p.Code != CodeAccessRequest {
+		hash := md5.New()
+		hash.Write(b)
+		hash.Write(secret)
+		copy(b[4:20], hash.Sum(nil))
+	}
+	return b, nil
+}
+
+// Decode parses a packet in wire format
+func Decode(b []byte) (*Packet, error) {
+	if len(b) < headerLen {
+		return nil, fmt.Errorf("packet too short: %d", len(b))
+	}
+	length := int(binary.BigEndian.Uint16(b[2:4]))
+	if length < headerLen || length > maxPacketLen || length > len(b) {
+		return nil, fmt.Errorf("invalid packet length: %d", length)
+	}
+
+	p := &Packet{
+		Code:       Code(b[0]),
+		Identifier: b[1],
+	}
+	copy(p.Authenticator[:], b[4:20])
+	for attrs := b[headerLen:length]; len(attrs) > 0; {
+		if len(attrs) < 2 || int(attrs[1]) < 2 || int(attrs[1]) > len(attrs) {
+			return nil, fmt.Errorf("invalid attribute")
+		}
+		p.Attributes = append(p.Attributes, Attribute{
+			Type:  Type(attrs[0]),
+			Value: bytes.Clone(attrs[2:attrs[1]]),
+		})
+		attrs = attrs[attrs[1]:]
+	}
+	return p, nil
+}
+
+// IsAuthenticResponse reports whether the response in wire format matches the
+// request and was sent by a server sharing the secret, RFC 2865 3 and RFC 3579 3.2
+func IsAuthenticResponse(response []byte, request *Packet, secret []byte) bool {
+	if len(response) < headerLen || response[1] != request.Identifier {
+		return false
+	}
+	length := int(binary.BigEndian.Uint16(response[2:4]))
+	if length < headerLen || length > len(response) {
+		return false
+	}
+	b := bytes.Clone(response[:length])
+	copy(b[4:20], request.Authenticator[:])
+
+	hash := md5.New()
+	hash.Write(b)
+	hash.Write(secret)
+	if !hmac.Equal(hash.Sum(nil), response[4:20]) {
+		return false
+	}
+	return isAuthenticMessage(b, secret)
+}
+
+// IsAuthenticRequest reports whether the request in wire format was sent by a
+// client sharing the secret, RFC 2866 3 and RFC 3579 3.2
+func IsAuthenticRequest(request []byte, secret []byte) bool {
+	if len(request) < headerLen {
+		return false
+	}
+	length := int(binary.BigEndian.Uint16(request[2:4]))
+	if length < headerLen || length > len(request) {
+		return false
+	}
+	b := bytes.Clone(request[:length])
+	if Code(b[0]) == CodeAccountingRequest {
+		clear(b[4:20])
+		hash := md5.New()
+		hash.Write(b)
+		hash.Write(secret)
+		if !hmac.Equal(hash.Sum(nil), request[4:20]) {
+			return false
+		}
+	}
+	return isAuthenticMessage(b, secret)
+}
+
+// isAuthenticMessage checks the Message-Authenticator of the packet holding
+// the request authenticator, mandatory with an EAP-Message, RFC 3579 3.2
+func isAuthenticMessage(b []byte, secret []byte) bool {
+	msgAuthOffset, eap := 0, false
+	for offset := headerLen; offset+2 <= len(b); offset += int(b[offset+1]) {
+		if int(b[offset+1]) < 2 {
+			return false
+		}
+		switch Type(b[offset]) {
+		case EAPMessage:
+			eap = true
+		case MessageAuthenticator:
+			if b[offset+1] != 2+md5.Size || offset+2+md5.Size > len(b) {
+				return false
+			}
+			msgAuthOffset = offset + 2
+		}
+	}
+	if msgAuthOffset == 0 {
+		// an EAP-Message is only accepted with a Message-Authenticator
+		return !eap
+	}
+	received := bytes.Clone(b[msgAuthOffset : msgAuthOffset+md5.Size])
+	clear(b[msgAuthOffset : msgAuthOffset+md5.Size])
+	mac := hmac.New(md5.New, secret)
+	mac.Write(b)
+	return hmac.Equal(mac.Sum(nil), received)
+}
+
+// EncryptUserPassword hides the password of a User-Password attribute, RFC 2865 5.2
+func EncryptUserPassword(password, secret []byte, authenticator [16]byte) []byte {
+	padded := make([]byte, (len(password)+15)/16*16)
+	if len(padded) == 0 {
+		padded = make([]byte, 16)
+	}
+	copy(padded, password)
+
+	last := authenticator[:]
+	for i := 0; i < len(padded); i += 16 {
+		hash := md5.Sum(append(bytes.Clone(secret), last...))
+		for j := range 16 {
+			padded[i+j] ^= hash[j]
+		}
+		last = padded[i : i+16]
+	}
+	return padded
+}
+
+// DecryptUserPassword reveals the password of a User-Password attribute, RFC 2865 5.2
+func DecryptUserPassword(hidden, secret []byte, authenticator [16]byte) ([]byte, error) {
+	if len(hidden) == 0 || len(hidden)%16 != 0 {
+		return nil, fmt.Errorf("invalid User-Password length: %d", len(hidden))
+	}
+	password := make([]byte, len(hidden))
+	last := authenticator[:]
+	for i := 0; i < len(hidden); i += 16 {
+		hash := md5.Sum(append(bytes.Clone(secret), last...))
+		for j := range 16 {
+			password[i+j] = hidden[i+j] ^ hash[j]
+		}
+		last = hidden[i : i+16]
+	}
+	return bytes.TrimRight(password, "\x00"), nil
+}
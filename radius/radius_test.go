@@ -0,0 +1,214 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package radius_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/omec-project/smf/radius"
+)
+
+var secret = []byte("testing123")
+
+func startServer(t *testing.T, handler radius.Handler) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	server := &radius.Server{Secret: secret, Handler: handler}
+	go func() { _ = server.Serve(conn) }()
+	return conn.LocalAddr().String()
+}
+
+func TestUserPassword(t *testing.T) {
+	authenticator := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	for _, password := range []string{"a", "0123456789abcdef", "a password longer than sixteen octets"} {
+		hidden := radius.EncryptUserPassword([]byte(password), secret, authenticator)
+		if len(hidden)%16 != 0 {
+			t.Errorf("hidden password length %d not a multiple of 16", len(hidden))
+		}
+		revealed, err := radius.DecryptUserPassword(hidden, secret, authenticator)
+		if err != nil {
+			t.Fatalf("decrypt: %v", err)
+		}
+		if string(revealed) != password {
+			t.Errorf("expected password %q, got %q", password, revealed)
+		}
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	request, err := radius.New(radius.CodeAccessRequest)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	request.AddString(radius.UserName, "user")
+	eap := bytes.Repeat([]byte{0xab}, 300)
+	request.Add(radius.EAPMessage, eap)
+
+	raw, err := request.Encode(secret)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if !radius.IsAuthenticRequest(raw, secret) {
+		t.Errorf("expected authentic request")
+	}
+	if radius.IsAuthenticRequest(raw, []byte("other")) {
+		t.Errorf("expected request not authentic with another secret")
+	}
+
+	decoded, err := radius.Decode(raw)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if string(decoded.Get(radius.UserName)) != "user" {
+		t.Errorf("unexpected User-Name %q", decoded.Get(radius.UserName))
+	}
+	if n := len(decoded.GetAll(radius.EAPMessage)); n != 2 {
+		t.Errorf("expected EAP-Message split in 2 attributes, got %d", n)
+	}
+	if !bytes.Equal(decoded.GetEAPMessage(), eap) {
+		t.Errorf("unexpected EAP-Message")
+	}
+	if decoded.Get(radius.MessageAuthenticator) == nil {
+		t.Errorf("expected Message-Authenticator")
+	}
+
+	response := decoded.Response(radius.CodeAccessAccept)
+	response.AddIP(radius.FramedIPAddress, net.ParseIP("10.1.2.3"))
+	rawResponse, err := response.Encode(secret)
+	if err != nil {
+		t.Fatalf("encode response: %v", err)
+	}
+	if !radius.IsAuthenticResponse(rawResponse, request, secret) {
+		t.Errorf("expected authentic response")
+	}
+	rawResponse[len(rawResponse)-1] ^= 0xff
+	if radius.IsAuthenticResponse(rawResponse, request, secret) {
+		t.Errorf("expected tampered response not authentic")
+	}
+}
+
+func TestEapMessageWithoutMessageAuthenticator(t *testing.T) {
+	request, err := radius.New(radius.CodeAccessRequest)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+
+	// Access-Challenge with an EAP-Request and a valid Response Authenticator
+	// but no Message-Authenticator
+	eap := []byte{1, 2, 0, 5, 4}
+	raw := []byte{byte(radius.CodeAccessChallenge), request.Identifier, 0, 0}
+	raw = append(raw, request.Authenticator[:]...)
+	raw = append(raw, byte(radius.EAPMessage), byte(2+len(eap)))
+	raw = append(raw, eap...)
+	binary.BigEndian.PutUint16(raw[2:4], uint16(len(raw)))
+	hash := md5.New()
+	hash.Write(raw)
+	hash.Write(secret)
+	copy(raw[4:20], hash.Sum(nil))
+
+	if radius.IsAuthenticResponse(raw, request, secret) {
+		t.Errorf("expected EAP-Message without Message-Authenticator not authentic")
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	testCases := map[string][]byte{
+		"short":              {1, 1, 0, 20},
+		"length too long":    append([]byte{1, 1, 0, 30}, make([]byte, 16)...),
+		"attribute too long": append(append([]byte{1, 1, 0, 23}, make([]byte, 16)...), 1, 5, 'a'),
+	}
+	for name, raw := range testCases {
+		if _, err := radius.Decode(raw); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestClientExchange(t *testing.T) {
+	addr := startServer(t, func(request *radius.Packet) *radius.Packet {
+		switch request.Code {
+		case radius.CodeAccessRequest:
+			password, err := radius.DecryptUserPassword(request.Get(radius.UserPassword), secret, request.Authenticator)
+			if err != nil || string(password) != "secret" {
+				return request.Response(radius.CodeAccessReject)
+			}
+			response := request.Response(radius.CodeAccessAccept)
+			response.AddIP(radius.FramedIPAddress, net.ParseIP("10.1.2.3"))
+			response.AddUint32(radius.SessionTimeout, 3600)
+			response.AddString(radius.Class, "gold")
+			return response
+		case radius.CodeAccountingRequest:
+			return request.Response(radius.CodeAccountingResponse)
+		}
+		return nil
+	})
+	client := &radius.Client{Addr: addr, Secret: secret, Timeout: time.Second}
+
+	for _, tc := range []struct {
+		password string
+		code     radius.Code
+	}{
+		{password: "secret", code: radius.CodeAccessAccept},
+		{password: "wrong", code: radius.CodeAccessReject},
+	} {
+		request, err := radius.New(radius.CodeAccessRequest)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		request.AddString(radius.UserName, "user")
+		request.Add(radius.UserPassword, radius.EncryptUserPassword([]byte(tc.password), secret, request.Authenticator))
+		response, err := client.Exchange(request)
+		if err != nil {
+			t.Fatalf("exchange: %v", err)
+		}
+		if response.Code != tc.code {
+			t.Errorf("expected %s, got %s", tc.code, response.Code)
+		}
+		if tc.code != radius.CodeAccessAccept {
+			continue
+		}
+		if ip := response.GetIP(radius.FramedIPAddress); !ip.Equal(net.ParseIP("10.1.2.3")) {
+			t.Errorf("unexpected Framed-IP-Address %v", ip)
+		}
+		if timeout, ok := response.GetUint32(radius.SessionTimeout); !ok || timeout != 3600 {
+			t.Errorf("unexpected Session-Timeout %v", timeout)
+		}
+	}
+
+	request, err := radius.New(radius.CodeAccountingRequest)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	request.AddUint32(radius.AcctStatusType, radius.AcctStatusTypeStart)
+	request.AddString(radius.AcctSessionID, "session")
+	response, err := client.Exchange(request)
+	if err != nil {
+		t.Fatalf("accounting exchange: %v", err)
+	}
+	if response.Code != radius.CodeAccountingResponse {
+		t.Errorf("expected Accounting-Response, got %s", response.Code)
+	}
+}
+
+func TestClientExchangeTimeout(t *testing.T) {
+	addr := startServer(t, func(request *radius.Packet) *radius.Packet { return nil })
+	client := &radius.Client{Addr: addr, Secret: secret, Timeout: 50 * time.Millisecond, Retries: 1}
+
+	request, err := radius.New(radius.CodeAccessRequest)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if _, err := client.Exchange(request); err == nil {
+		t.Errorf("expected timeout error")
+	}
+}
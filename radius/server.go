@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Canonical Ltd.
+
+package radius
+
+import (
+	"net"
+)
+
+// Handler returns the response to the request, nil to discard the request
+type Handler func(request *Packet) *Packet
+
+// Server is a minimal RADIUS server, e.g. a local stand-in for a DN-AAA server
+type Server struct {
+	Handler Handler
+	Secret  []byte
+}
+
+// Serve answers the authentic requests received on the connection until it is closed
+func (s *Server) Serve(conn net.PacketConn) error {
+	buf := make([]byte, maxPacketLen)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		if !IsAuthenticRequest(buf[:n], s.Secret) {
+			continue
+		}
+		request, err := Decode(buf[:n])
+		if err != nil {
+			continue
+		}
+		response := s.Handler(request)
+		if response == nil {
+			continue
+		}
+		raw, err := response.Encode(s.Secret)
+		if err != nil {
+			continue
+		}
+		if _, err := conn.WriteTo(raw, addr); err != nil {
+			return err
+		}
+	}
+}
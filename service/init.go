@@ -39,6 +39,7 @@ import (
 	"github.com/omec-project/smf/pfcp/udp"
 	"github.com/omec-project/smf/pfcp/upf"
 	"github.com/omec-project/smf/polling"
+	"github.com/omec-project/smf/producer"
 	"github.com/omec-project/util/http2_util"
 	utilLogger "github.com/omec-project/util/logger"
 	"github.com/urfave/cli/v3"
@@ -273,6 +274,18 @@ func (smf *SMF) Start() {
 	udp.Run(pfcp.Dispatch)
 	time.Sleep(1000 * time.Millisecond)
 
+	// PCC rules with condition data are installed and removed on timers
+	smfContext.SetConditionEventHandler(producer.HandleConditionEvent)
+	smfContext.SetDnAaaSessionTimeoutHandler(producer.HandleDnAaaSessionTimeout)
+	smfContext.SetEapGuardHandler(producer.HandleEapGuardTimeout)
+	smfContext.SetDhcpLeaseExpiryHandler(producer.HandleDhcpLeaseExpiry)
+	smfContext.SetLadnReleaseHandler(producer.HandleLadnRelease)
+	smfContext.SetUpfFailureHandler(producer.HandleUpfFailure)
+	if factory.SmfConfig.Configuration.EnableDbStore {
+		smfContext.RestoreConditionSchedules()
+		smfContext.RestoreStickyIps()
+	}
+
 	HTTPAddr := fmt.Sprintf("%s:%d", smfSelf.BindingIPv4, smfSelf.SBIPort)
 	sslLog := filepath.Dir(factory.SmfConfig.CfgLocation) + "/sslkey.log"
 	server, err := http2_util.NewServer(HTTPAddr, sslLog, router)
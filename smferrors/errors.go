@@ -41,6 +41,34 @@ var (
 		Cause:         openapi.PtrString(string(models.CAUSE_REL_DUE_TO_INSUFFICIENT_RESOURCES_SLICE_DNN)),
 		InvalidParams: nil,
 	}
+	DnnCongestion = models.ExtProblemDetails{
+		Title:         openapi.PtrString("DNN Congestion"),
+		Status:        openapi.PtrInt32(http.StatusForbidden),
+		Detail:        openapi.PtrString("The request is rejected due to DNN based congestion control."),
+		Cause:         openapi.PtrString(string(models.CAUSE_DNN_CONGESTION)),
+		InvalidParams: nil,
+	}
+	SnssaiCongestion = models.ExtProblemDetails{
+		Title:         openapi.PtrString("S-NSSAI Congestion"),
+		Status:        openapi.PtrInt32(http.StatusForbidden),
+		Detail:        openapi.PtrString("The request is rejected due to S-NSSAI based congestion control."),
+		Cause:         openapi.PtrString(string(models.CAUSE_S_NSSAI_CONGESTION)),
+		InvalidParams: nil,
+	}
+	SecondaryAuthFailure = models.ExtProblemDetails{
+		Title:         openapi.PtrString("Secondary Authentication Failure"),
+		Status:        openapi.PtrInt32(http.StatusForbidden),
+		Detail:        openapi.PtrString("The UE is not authenticated or authorized by the DN-AAA server."),
+		Cause:         openapi.PtrString(utils.CauseRequestRejected),
+		InvalidParams: nil,
+	}
+	OutOfLadnServiceArea = models.ExtProblemDetails{
+		Title:         openapi.PtrString("Out Of LADN Service Area"),
+		Status:        openapi.PtrInt32(http.StatusForbidden),
+		Detail:        openapi.PtrString("The UE is outside of the service area of the LADN DNN."),
+		Cause:         openapi.PtrString("OUT_OF_LADN_SERVICE_AREA"),
+		InvalidParams: nil,
+	}
 	IpAllocError = models.ExtProblemDetails{
 		Title:         openapi.PtrString("IP Allocation Error"),
 		Status:        openapi.PtrInt32(http.StatusInternalServerError),
@@ -48,6 +76,13 @@ var (
 		Cause:         openapi.PtrString(string(models.CAUSE_REL_DUE_TO_INSUFFICIENT_RESOURCES_SLICE)),
 		InvalidParams: nil,
 	}
+	StaticIpConflict = models.ExtProblemDetails{
+		Title:         openapi.PtrString("Static IP Conflict"),
+		Status:        openapi.PtrInt32(http.StatusForbidden),
+		Detail:        openapi.PtrString("The subscribed static IP address is outside of the DNN pools or in use by another UE."),
+		Cause:         openapi.PtrString(utils.CauseRequestRejected),
+		InvalidParams: nil,
+	}
 	SubscriptionDataFetchError = models.ExtProblemDetails{
 		Title:         openapi.PtrString("Subscription Data Fetch error"),
 		Status:        openapi.PtrInt32(http.StatusInternalServerError),
@@ -123,6 +158,12 @@ var ErrorType = map[string]models.ExtProblemDetails{
 	"DnnNotSupported":               DnnNotSupported,
 	"InsufficientResourceSliceDnn":  InsufficientResourceSliceDnn,
 	"IpAllocError":                  IpAllocError,
+	"StaticIpConflict":              StaticIpConflict,
+	"DnnCongestion":                 DnnCongestion,
+	"SliceDnnCongestion":            SnssaiCongestion,
+	"SliceCongestion":               SnssaiCongestion,
+	"SecondaryAuthFailure":          SecondaryAuthFailure,
+	"OutOfLadnServiceArea":          OutOfLadnServiceArea,
 	"SubscriptionDataFetchError":    SubscriptionDataFetchError,
 	"SubscriptionDataLenError":      SubscriptionDataLenError,
 	"UDMDiscoveryFailure":           UDMDiscoveryFailure,
@@ -166,10 +207,16 @@ var ErrorCause = map[string]uint8{
 	"DnnNotSupported":               nasMessage.Cause5GMMDNNNotSupportedOrNotSubscribedInTheSlice,
 	"InsufficientResourceSliceDnn":  nasMessage.Cause5GSMInsufficientResourcesForSpecificSliceAndDNN,
 	"IpAllocError":                  nasMessage.Cause5GSMInsufficientResources,
+	"StaticIpConflict":              nasMessage.Cause5GSMRequestRejectedUnspecified,
+	"DnnCongestion":                 nasMessage.Cause5GSMInsufficientResources,
+	"SliceDnnCongestion":            nasMessage.Cause5GSMInsufficientResourcesForSpecificSliceAndDNN,
+	"SliceCongestion":               nasMessage.Cause5GSMInsufficientResourcesForSpecificSlice,
+	"SecondaryAuthFailure":          nasMessage.Cause5GSMUserAuthenticationOrAuthorizationFailed,
+	"OutOfLadnServiceArea":          nasMessage.Cause5GSMOutOfLADNServiceArea,
 	"SubscriptionDataFetchError":    nasMessage.Cause5GSMRequestRejectedUnspecified,
 	"SubscriptionDataLenError":      nasMessage.Cause5GSMRequestRejectedUnspecified,
 	"UDMDiscoveryFailure":           nasMessage.Cause5GSMRequestRejectedUnspecified,
-	"UPFDataPathError":              nasMessage.Cause5GSMRequestRejectedUnspecified,
+	"UPFDataPathError":              nasMessage.Cause5GSMInsufficientResources,
 	"PCFDiscoveryFailure":           nasMessage.Cause5GSMRequestRejectedUnspecified,
 	"PCFPolicyCreateFailure":        nasMessage.Cause5GSMRequestRejectedUnspecified,
 	"ApplySMPolicyFailure":          nasMessage.Cause5GSMRequestRejectedUnspecified,